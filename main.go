@@ -4,19 +4,27 @@ import (
 	"bufio"
 	"strconv"
 
-	// "context"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"log"
+	"net"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/Xuanwo/go-locale"
-	"github.com/araddon/dateparse"
 	"github.com/dknelson9876/oregano/ocli"
 	"github.com/dknelson9876/oregano/omoney"
+	"github.com/erikgeiser/promptkit/confirmation"
 	"github.com/google/shlex"
 	"github.com/manifoldco/promptui"
 	"github.com/plaid/plaid-go/plaid"
@@ -29,10 +37,27 @@ type WorkTuple struct {
 	id       string
 }
 
+// Exit codes for a command given as arguments to oregano
+const (
+	exitOk    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+var (
+	// Returned by a command that should end the prompt
+	errQuit = errors.New("quit")
+	// Returned by a command that was used incorrectly, after
+	// printing how it should be used
+	errUsage = errors.New("invalid usage")
+)
+
 var (
 	workingList []WorkTuple
-	oview       *ocli.OViewPlain
+	oview       ocli.OView
 	model       *omoney.Model
+	// Where alerts raised by new transactions are delivered
+	notifier ocli.Notifier
 )
 
 func main() {
@@ -40,7 +65,6 @@ func main() {
 	log.SetFlags(0)
 	// TODO: change log level based on command line flags
 	olog := ocli.NewOLogger(ocli.Debug)
-	oview = ocli.NewOViewPlain(false)
 
 	// Establish default storage folder as ~/.config/oregano/
 	dirname, _ := os.UserHomeDir()
@@ -69,6 +93,14 @@ func main() {
 		}
 	}
 
+	// Output defaults to tables, but can be set to a machine
+	// readable format for every command
+	viper.SetDefault("output.format", "table")
+	oview, err = ocli.NewOView(viper.GetString("output.format"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	// Load stored tokens and aliases
 	model, err = ocli.LoadModelFromDB(configDir)
 	if err != nil {
@@ -84,46 +116,84 @@ func main() {
 		}
 	}
 
+	notifier, err = newNotifier()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// `oregano serve` runs the REST API instead of the interactive prompt.
+	// The API never reads access tokens, and may be running as a service
+	// with nobody to ask for a passphrase, so secrets stay locked
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		serveCmd()
+		return
+	}
+
+	// Plaid access tokens are encrypted at rest, so ask for the
+	// passphrase the first time one is needed. Tokens stored before
+	// encryption existed are encrypted right away instead
+	model.UnlockWhenNeeded(unlockSecrets)
+	if !model.SecretsInitialized() && model.HasPlaintextSecrets() {
+		err = unlockSecrets(model)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	// Use helper to detect country and lang from env/config
 	// countries, lang := DetectRegion()
 
 	// Load the plaid environment from the config
 	viper.SetDefault("plaid.environment", "sandbox")
-	// plaidEnvStr := strings.ToLower(viper.GetString("plaid.environment"))
-
-	// NOTE: Plaid is manually disabled here until I can get back to integrating it
-	plaidDisabled := true
-	// var plaidEnv plaid.Environment
-	// switch plaidEnvStr {
-	// case "sandbox":
-	// 	plaidEnv = plaid.Sandbox
-	// case "development":
-	// 	plaidEnv = plaid.Development
-	// default:
-	// 	log.Println("Invalid plaid environment. Supported environments are 'sandbox' or 'development'")
-	// 	plaidDisabled = true
-	// }
-
-	// check that the required plaid api keys are present
-	if !viper.IsSet("plaid.client_id") {
+	plaidEnvStr := strings.ToLower(viper.GetString("plaid.environment"))
+
+	// Plaid integration is still incomplete, so it stays off unless
+	// plaid.enabled is set in the config
+	plaidDisabled := !viper.GetBool("plaid.enabled")
+	var plaidEnv plaid.Environment
+	switch plaidEnvStr {
+	case "sandbox":
+		plaidEnv = plaid.Sandbox
+	case "development":
+		plaidEnv = plaid.Development
+	default:
+		log.Println("Invalid plaid environment. Supported environments are 'sandbox' or 'development'")
+		plaidDisabled = true
+	}
+
+	// check that the required plaid api keys are present, when they'll be used
+	if !plaidDisabled && !viper.IsSet("plaid.client_id") {
 		log.Println("⚠️  PLAID_CLIENT_ID not set. Plaid connected features will not work until PLAID_CLIENT_ID is set in as an envvar or in config.json.")
 		plaidDisabled = true
 	}
-	if !viper.IsSet("plaid.secret") {
+	if !plaidDisabled && !viper.IsSet("plaid.secret") {
 		log.Println("⚠️ PLAID_SECRET not set. Plaid connected features will not work until PLAID_SECRET is set in as an envvar or in config.json.")
 		plaidDisabled = true
 	}
 
 	// Build the plaid client using their library
-	// var client *plaid.APIClient
-	// if !plaidDisabled {
-	// 	opts := plaid.NewConfiguration()
-	// 	opts.AddDefaultHeader("PLAID-CLIENT-ID", viper.GetString("plaid.client_id"))
-	// 	opts.AddDefaultHeader("PLAID-SECRET", viper.GetString("plaid.secret"))
-	// 	opts.UseEnvironment(plaidEnv)
-	// 	client = plaid.NewAPIClient(opts)
-	// }
-	// ctx := context.Background()
+	var client *plaid.APIClient
+	if !plaidDisabled {
+		opts := plaid.NewConfiguration()
+		opts.AddDefaultHeader("PLAID-CLIENT-ID", viper.GetString("plaid.client_id"))
+		opts.AddDefaultHeader("PLAID-SECRET", viper.GetString("plaid.secret"))
+		opts.UseEnvironment(plaidEnv)
+		client = plaid.NewAPIClient(opts)
+	}
+	ctx := context.Background()
+
+	// Arguments are run as a single command instead of starting the
+	// prompt, so that oregano can be scripted
+	if len(os.Args) > 1 {
+		os.Exit(runArgs(os.Args[1:]))
+	}
+
+	// Optionally listen for webhooks from Plaid announcing new
+	// transactions or items that need to be relinked
+	viper.SetDefault("webhook.port", "8081")
+	if viper.GetBool("webhook.enabled") {
+		startWebhookReceiver(ctx, client)
+	}
 
 	// ----- Begin Main Loop -----------------------------------
 	reader := bufio.NewReader(os.Stdin)
@@ -131,6 +201,8 @@ func main() {
 
 	fmt.Println("Welcome to Oregano, the cli budget program")
 	fmt.Println("For help, use 'help' (h). To quit, use 'quit' (q)")
+	warnUnpaidStatements()
+	showStartupAlerts()
 	for {
 		fmt.Print("\x1B[32moregano >> \x1B[0m")
 		var line string
@@ -150,168 +222,520 @@ func main() {
 		if len(tokens) == 0 {
 			continue
 		}
-		switch tokens[0] {
-		case "h", "help":
-			if len(tokens) == 2 {
-				switch tokens[1] {
-				case "link":
-					log.Println("link - link a new institution (Opens in a new browser tab)")
-					log.Println("\tOpens a new browser tab to go through the")
-					log.Println("\tPlaid account linking process")
-					log.Println("usage: link")
-				case "ls", "list":
-					log.Println("list - list accounts or transactions")
-					log.Println("\tProvide an alias to list transactions under that account,")
-					log.Println("\tor don't provide an alias to list all accounts")
-					log.Println("usage: ls (alias) (options)")
-					log.Println("\t-l\t(long) Show more details")
-					log.Println("\t--num [n]\tList n transactions (default 10)")
-					log.Println("\t--start [date]\tFilter transactions by earliest date")
-					log.Println("\t--end [date]\tFilter transactions by latest date")
-				case "alias":
-					log.Println("alias - Assign a new alias to an account")
-					log.Println("\tAssigns the alias [alias] as the alias of ")
-					log.Println("\tthe account with id [id]")
-					log.Println("\tFind an account's id using `ls -l` or `acc`")
-					log.Println("usage: alias [id] [alias]")
-				case "rm", "remove":
-					log.Println("remove - Remove an account or transaction")
-					log.Println("\tSpecify the working id (wid) or actual id")
-					log.Println("\tof a transaction or account. If no flag")
-					log.Println("\tis provided, the provided id is assumed to")
-					log.Println("\tbe a wid")
-					log.Println("usage: rm (options) [id]")
-					log.Println("\t-w\t(working) Provided id is a working id")
-					log.Println("\t-t\t(transaction) Provided id is a transaction id")
-					log.Println("\t\t\t TODO not implemented")
-					log.Println("\t-c\t(account) Provided id is an account id")
-				case "acc", "account":
-					log.Println("account - print or edit information about an account")
-					log.Println("Usage: account [alias/id] (options)")
-					log.Println("\t-a <amount> <date>\t(anchor) set a known amount at a time to base balance off of")
-				case "trs", "transactions":
-					log.Println("transactions - list transactions from a specific account")
-					log.Println("usage: trs [id/alias]")
-				case "import":
-					log.Println("import - interactively import transactions from a CSV file")
-					log.Println("usage: import [filepath]")
-				case "p", "print":
-					log.Println("print - print more information about a transaction from the working list")
-					log.Println("usage: p [wid] (options)")
-					log.Println("\t-l\t(long) Show even more details about the transaction")
-				case "e", "edit":
-					log.Println("edit - edit information about a transaction, by setting with")
-					log.Println("\t specific flags which fields to change")
-					log.Println("usage: e [wid] (options)")
-					log.Println("\t--account <account>")
-					log.Println("\t--payee <payee>")
-					log.Println("\t--amount <amount>")
-					log.Println("\t--date <date>")
-					log.Println("\t--category <category>")
-					log.Println("\t--desc <desc>")
-				case "new":
-					log.Println("new - manually create account or transaction")
-					log.Println("* new account [alias] [type]\t\tcreate a new manual account")
-					log.Println("* new transaction []...\t\t TODO")
-				}
-				continue
-			}
-			log.Println("oregano-cli - Terminal budgeting app\n" +
-				"Commands:\n" +
-				"* help (h)\t\tPrint this menu\n" +
-				"* quit (q)\t\tQuit oregano\n" +
-				"* link\t\t\tLink a new institution (Opens in a new browser tab)\n" +
-				"* list (ls)\t\tList accounts or transactions\n" +
-				"* alias [id] [alias]\tAssign [alias] as the new alias for [id]\n" +
-				"* remove (rm) [alias/id...]\tRemove a linked institution\n" +
-				"* account (acc) [alias/id...]\tPrint details about specific account(s)\n" +
-				"* transactions (trs) [alias/id]\t List transactions from a specific account\n" +
-				"* import [filename]\t Import transactions from a csv file\n" +
-				"* print (p) [argument index]\tPrint more details about something that was output\n" +
-				"* edit (e) [wid]\tEdit the fields of a transaction\n"+
-				"* repair\t\tUsing higher level data as authoritative, correct inconsistencies\n" +
-				"* new ...\t\tmanually create account or transaction")
-		case "q", "quit":
+		err = runCommand(tokens)
+		if err == errQuit {
 			return
+		} else if err != nil && err != errUsage {
+			log.Printf("Error: %s\n", err)
+		}
+		deliverAlerts()
+
+	}
+
+}
+
+// Run the command given as arguments, returning the exit code
+func runArgs(args []string) int {
+	// stdout is kept for the command's output, which may be piped
+	// somewhere as json or csv
+	if n, ok := notifier.(*ocli.StdoutNotifier); ok {
+		n.Out = os.Stderr
+	}
+	err := runCommand(args)
+	deliverAlerts()
+	switch err {
+	case nil, errQuit:
+		return exitOk
+	case errUsage:
+		return exitUsage
+	default:
+		log.Printf("Error: %s\n", err)
+		return exitError
+	}
+}
+
+// Run a single command, either typed at the prompt or given as
+// arguments to oregano
+func runCommand(tokens []string) error {
+	// -o/--output [format] changes the output format for just this command
+	tokens, format, err := takeOutputFlag(tokens)
+	if err != nil {
+		return err
+	}
+	if format != "" {
+		view, err := ocli.NewOView(format)
+		if err != nil {
+			return err
+		}
+		defer func(prev ocli.OView) { oview = prev }(oview)
+		oview = view
+	}
+	if len(tokens) == 0 {
+		return errUsage
+	}
+
+	switch tokens[0] {
+	case "h", "help":
+		return helpCmd(tokens)
+	case "q", "quit":
+		return errQuit
+	case "link":
+		// linkNewInstitution(model, client, countries, lang)
+		return errors.New("link has been manually disabled")
+	case "list", "ls":
+		return listCmd(tokens)
+	case "alias":
+		return aliasCmd(tokens)
+	case "remove", "rm":
+		return removeCmd(tokens)
+	case "account", "acc":
+		return accountCmd(tokens)
+	case "transactions", "trs":
+		return transactionsCmd(tokens)
+	case "search", "s":
+		return searchCmd(tokens)
+	case "attach":
+		return attachCmd(tokens)
+	case "attachments":
+		return attachmentsCmd(tokens)
+	case "import":
+		return importCmd(tokens)
+	case "print", "p":
+		return printCmd(tokens)
+	case "edit", "e":
+		return editCmd(tokens)
+	case "repair":
+		model.RepairAccounts()
+		return nil
+	case "new":
+		return newCmd(tokens)
+	case "catmap":
+		return catmapCmd(tokens)
+	case "payeemap":
+		return payeemapCmd(tokens)
+	case "invest":
+		return investCmd(tokens)
+	case "loan":
+		return loanCmd(tokens)
+	case "payoff":
+		return payoffCmd(tokens)
+	case "statement":
+		return statementCmd(tokens)
+	case "alert", "alerts":
+		return alertCmd(tokens)
+	case "chart":
+		return chartCmd(tokens)
+	case "person", "people":
+		return personCmd(tokens)
+	case "share":
+		return shareCmd(tokens)
+	case "settle":
+		return settleCmd(tokens)
+	case "reimburse":
+		return reimburseCmd(tokens)
+	case "report", "reports":
+		return reportCmd(tokens)
+	case "db":
+		return dbCmd(tokens)
+	case "undo", "redo":
+		return undoCmd(tokens)
+	case "rekey":
+		return rekeyCmd(tokens)
+	case "tui":
+		return ocli.RunTui(model)
+	default:
+		log.Println("Unrecognized command. Type 'help' for valid commands")
+		return errUsage
+	}
+}
+
+// Remove -o/--output [format] from anywhere in tokens, returning
+// the remaining tokens and the format, if there was one
+func takeOutputFlag(tokens []string) ([]string, string, error) {
+	rest := make([]string, 0, len(tokens))
+	format := ""
+	for i := 0; i < len(tokens); i++ {
+		if tokens[i] != "-o" && tokens[i] != "--output" {
+			rest = append(rest, tokens[i])
+			continue
+		}
+		if i+1 == len(tokens) {
+			return nil, "", fmt.Errorf("missing value for %s", tokens[i])
+		}
+		format = tokens[i+1]
+		i++
+	}
+	return rest, format, nil
+}
+
+func helpCmd(tokens []string) error {
+	if len(tokens) == 2 {
+		switch tokens[1] {
 		case "link":
-			if plaidDisabled {
-				log.Println("Link has been manually disabled")
-				// linkNewInstitution(model, client, countries, lang)
-			} else {
-				log.Println("link is unavailable while Plaid integration is disabled")
-			}
-		case "list", "ls":
-			listCmd(tokens)
+			log.Println("link - link a new institution (Opens in a new browser tab)")
+			log.Println("\tOpens a new browser tab to go through the")
+			log.Println("\tPlaid account linking process")
+			log.Println("usage: link")
+		case "ls", "list":
+			log.Println("list - list accounts or transactions")
+			log.Println("\tProvide an alias to list transactions under that account,")
+			log.Println("\tor don't provide an alias to list all accounts")
+			log.Println("usage: ls (alias) (options)")
+			log.Println("\t-l\t(long) Show more details")
+			log.Println("\t-a\t(all) Include closed accounts when listing accounts")
+			log.Println("\t--num [n]\tList n transactions (default 10)")
+			log.Println("\t--start [date]\tFilter transactions by earliest date")
+			log.Println("\t--end [date]\tFilter transactions by latest date")
+			log.Println("\t--where [query]\tFilter transactions by a query, leave out")
+			log.Println("\t\t\tthe alias to search every account. For example:")
+			log.Println("\t\t\tpayee ~ amazon and amount > 50 and date >= 2024-01")
+			log.Println("\t\t\tFields: payee, amount, date, category, desc, instdesc, account")
+			log.Println("\t\t\tOperators: = != < <= > >= ~ (contains) !~, joined by and/or/not")
 		case "alias":
-			aliasCmd(tokens)
-		case "remove", "rm":
-			removeCmd(tokens)
-		case "account", "acc":
-			accountCmd(tokens)
-		case "transactions", "trs":
-			transactionsCmd(tokens)
+			log.Println("alias - Assign a new alias to an account")
+			log.Println("\tAssigns the alias [alias] as the alias of ")
+			log.Println("\tthe account with id [id]")
+			log.Println("\tFind an account's id using `ls -l` or `acc`")
+			log.Println("usage: alias [id] [alias]")
+		case "rm", "remove":
+			log.Println("remove - Remove an account or transaction")
+			log.Println("\tSpecify the working id (wid) or actual id")
+			log.Println("\tof a transaction or account. If no flag")
+			log.Println("\tis provided, the provided id is assumed to")
+			log.Println("\tbe a wid")
+			log.Println("usage: rm (options) [id]")
+			log.Println("\t-w\t(working) Provided id is a working id")
+			log.Println("\t-t\t(transaction) Provided id is a transaction id")
+			log.Println("\t\t\t TODO not implemented")
+			log.Println("\t-c\t(account) Provided id is an account id")
+			log.Println("\t--cascade\tRemove an account's transactions along with it.")
+			log.Println("\t\t\tWithout it, accounts with transactions are not removed")
+		case "acc", "account":
+			log.Println("account - print or edit information about an account")
+			log.Println("Usage: account [alias/id] (options)")
+			log.Println("\t-a <amount> <date>\t(anchor) set a known amount at a time to base balance off of")
+			log.Println("\t--close\t\t\thide the account from `ls`, keeping its transactions")
+			log.Println("\t--reopen\t\tshow a closed account in `ls` again")
+		case "trs", "transactions":
+			log.Println("transactions - list transactions from a specific account")
+			log.Println("usage: trs [id/alias]")
+		case "s", "search":
+			log.Println("search - find transactions in every account by payee or description")
+			log.Println("\tMatches contain every word given, as the start of a word,")
+			log.Println("\tso `search amaz prime` finds \"Amazon Prime\". The best")
+			log.Println("\tmatches are listed first and added to the working list")
+			log.Println("usage: search [terms...] (options)")
+			log.Println("\t-l\t(long) Show more details")
+			log.Println("\t--num [n]\tList n matches (default 10)")
+			log.Println("\t--start [date]\tFilter matches by earliest date")
+			log.Println("\t--end [date]\tFilter matches by latest date")
+			log.Println("\t--where [query]\tFilter matches by a query, as in ls")
+		case "attach":
+			log.Println("attach - keep a copy of a file, such as a receipt, with a transaction")
+			log.Println("\tThe file is copied into the attachments folder next to")
+			log.Println("\tthe database, so the original can be moved or deleted")
+			log.Println("usage: attach [wid] [file]")
+		case "attachments":
+			log.Println("attachments - list the files attached to a transaction")
+			log.Println("usage: attachments [wid]")
+			log.Println("* attachments clean\tdelete attachments of removed transactions,")
+			log.Println("\t\t\tand stored files nothing refers to")
 		case "import":
-			importCmd(tokens)
-		case "print", "p":
-			printCmd(tokens)
-		case "edit", "e":
-			editCmd(tokens)
-		case "repair":
-			model.RepairAccounts()
+			log.Println("import - interactively import transactions from a CSV file")
+			log.Println("\tWith --profile, the answers given are saved under that name,")
+			log.Println("\tand later imports with the same profile ask nothing")
+			log.Println("usage: import [filepath] (options)")
+			log.Println("\t--profile [name]\tUse or create a saved import profile")
+		case "p", "print":
+			log.Println("print - print more information about a transaction from the working list")
+			log.Println("usage: p [wid] (options)")
+			log.Println("\t-l\t(long) Show even more details about the transaction")
+		case "e", "edit":
+			log.Println("edit - edit information about a transaction, by setting with")
+			log.Println("\t specific flags which fields to change")
+			log.Println("\tGive a selection of wids (3-10,14) or --where and a query")
+			log.Println("\tto change many transactions at once. They are shown and")
+			log.Println("\tconfirmed first, and a single undo reverts them all")
+			log.Println("usage: e [wid/wids] (options)")
+			log.Println("usage: e --where [query] (options)")
+			log.Println("\t-y\t(yes) Don't ask before changing many transactions")
+			log.Println("\t--account <account>")
+			log.Println("\t--payee <payee>")
+			log.Println("\t--amount <amount>")
+			log.Println("\t--date <date>")
+			log.Println("\t--category <category>")
+			log.Println("\t--desc <desc>")
+			log.Println("\t--status <pending/posted/cleared/reconciled>")
 		case "new":
-			newCmd(tokens)
-		default:
-			log.Println("Unrecognized command. Type 'help' for valid commands")
+			log.Println("new - manually create account or transaction")
+			log.Println("* new account [alias] [type]\t\tcreate a new manual account")
+			log.Println("* new transaction []...\t\t TODO")
+			log.Println("\t-s/--status <status>\tpending, posted (default), cleared, or reconciled")
+		case "undo":
+			log.Println("undo - revert the last change(s) made to accounts or transactions")
+			log.Println("\tAdding, editing and removing transactions, removing")
+			log.Println("\taccounts, closing accounts, and changing aliases or anchors")
+			log.Println("\tcan be undone.")
+			log.Println("\tAn edit of many transactions at once counts as one change")
+			log.Println("usage: undo (n)")
+		case "redo":
+			log.Println("redo - reapply the last change(s) that were undone")
+			log.Println("\tMaking any new change discards everything waiting to be redone")
+			log.Println("usage: redo (n)")
+		case "rekey":
+			log.Println("rekey - encrypt stored secrets such as Plaid access tokens with a new key")
+			log.Println("\tPrompts for a new passphrase, unless a key file is given.")
+			log.Println("\tIf nothing has been encrypted yet, this sets up encryption")
+			log.Println("usage: rekey (options)")
+			log.Println("\t--key-file <path>\tderive the new key from the contents of a file")
+		case "payeemap":
+			log.Println("payeemap - view or edit the payees learned for bank descriptions")
+			log.Println("\tImported and synced transactions are named by cleaning up")
+			log.Println("\tthe bank's description, dropping prefixes like \"SQ *\",")
+			log.Println("\tstore numbers, locations and reference codes. Renaming the")
+			log.Println("\tpayee with `edit` learns the new name for every later")
+			log.Println("\ttransaction whose description cleans up the same way")
+			log.Println("usage: payeemap (subcommand)")
+			log.Println("* payeemap\t\t\t\tlist all learned payees")
+			log.Println("* payeemap set [description] [payee]\tlearn a payee for a description")
+			log.Println("* payeemap rm [description]\t\tforget the payee for a description")
+			log.Println("* payeemap test [description]\t\tshow the payee a description gets")
+		case "invest":
+			log.Println("invest - record trades and view holdings of investment accounts")
+			log.Println("\tShares are bought into lots, which sells close oldest first")
+			log.Println("\tThe balance of an investment account is the market value of")
+			log.Println("\twhat it holds, at the latest loaded price of each security,")
+			log.Println("\tor else the price it last traded at")
+			log.Println("usage: invest [subcommand]")
+			log.Println("* invest buy [acc] [symbol] [shares] [price]\tbuy shares")
+			log.Println("* invest sell [acc] [symbol] [shares] [price]\tsell shares")
+			log.Println("\t-t/--time <date>\twhen the trade happened (default: now)")
+			log.Println("\t-f/--fees <amount>\tcommissions and fees paid")
+			log.Println("\t-m/--method <method>\tsell the oldest (fifo, default) or newest (lifo) lots first")
+			log.Println("\t-l/--lots <lot:shares,...>\tsell exactly these shares of these lots")
+			log.Println("* invest dividend [acc] [symbol] [amount]\trecord a dividend paid out")
+			log.Println("* invest split [acc] [symbol] [new:old]\t\trecord a split, such as 2:1")
+			log.Println("* invest holdings (acc)\t\t\tshow what is held, at market value")
+			log.Println("* invest lots [acc] (symbol)\t\tshow the open lots")
+			log.Println("* invest events (acc) (symbol)\t\tlist every recorded event")
+			log.Println("* invest gains [year] (acc)\t\treport gains and losses realized in a year")
+			log.Println("\t--export <filename>\twrite the report to a csv file")
+			log.Println("* invest rm [event id]\t\t\tremove a mistaken event")
+			log.Println("* invest prices [filename]\t\tload prices from a csv file")
+			log.Println("\tRows are symbol,date,price and optionally the security's name")
+			log.Println("* invest price [symbol] (price)\t\tshow, or set today's, price")
+		case "loan":
+			log.Println("loan - amortize a personal loan and project paying it off")
+			log.Println("\tPayments are transactions into the loan account with a")
+			log.Println("\tnegative amount. Each is split into the interest accrued")
+			log.Println("\tdaily since the last payment, and the principal paid down")
+			log.Println("usage: loan [acc] (subcommand)")
+			log.Println("* loan [acc]\t\t\tshow the terms and what is left to pay")
+			log.Println("* loan [acc] set [principal] [apr] [months] [payment day] [start]")
+			log.Println("\t\t\t\tset the terms of the loan")
+			log.Println("* loan [acc] schedule (--extra n)\tshow the full amortization schedule")
+			log.Println("* loan [acc] payments\t\tsplit each payment made into principal and interest")
+			log.Println("* loan [acc] payoff (--extra n,...)\tproject the payoff date and interest left,")
+			log.Println("\t\t\t\tonce for each extra amount paid every month")
+		case "payoff":
+			log.Println("payoff - compare orders of paying off credit cards and loans")
+			log.Println("\tEvery open credit card and personal loan with a balance is")
+			log.Println("\tpaid down with a monthly budget. Minimums are paid first, and")
+			log.Println("\tthe rest goes to one debt at a time: the smallest balance")
+			log.Println("\t(snowball), the highest APR (avalanche), or a custom order.")
+			log.Println("\tLoans with terms already know their APR and payment")
+			log.Println("usage: payoff [monthly budget] (options)")
+			log.Println("\t--apr <acc=rate,...>\tAPR of each card, such as visa=24.99")
+			log.Println("\t--min <acc=amount,...>\tminimum monthly payment of each card")
+			log.Println("\t--order <acc,...>\talso plan paying debts off in this order")
+		case "statement":
+			log.Println("statement - group a credit card's transactions by billing cycle")
+			log.Println("\tEach statement closes on the closing day and includes it. Its")
+			log.Println("\tpayment is due on the due day, in the next month if that day")
+			log.Println("\tcomes first. Payments are transactions with a negative amount")
+			log.Println("\tafter the statement closes. A warning is shown at startup when")
+			log.Println("\tthe minimum payment of the last statement is due soon or late")
+			log.Println("usage: statement [card] (subcommand)")
+			log.Println("* statement [card] (--cycles n)\tshow the last n statements (default 6),")
+			log.Println("\t\t\t\tand the transactions of the current cycle")
+			log.Println("* statement [card] set [closing day] [due day]")
+			log.Println("\t\t\t\tset the days statements close and are due")
+		case "alert", "alerts":
+			log.Println("alert - get told when spending or balances cross a threshold")
+			log.Println("\tRules are checked every time a transaction is added. Alerts")
+			log.Println("\tare delivered by the notifier set in config.json as")
+			log.Println("\talerts.notifier: stdout (default), desktop, smtp, or command,")
+			log.Println("\tand shown at startup until dismissed")
+			log.Println("usage: alert (subcommand)")
+			log.Println("* alert (--all)\t\t\tshow alerts not yet dismissed, or every alert")
+			log.Println("* alert rules\t\t\tshow every alert rule")
+			log.Println("* alert add budget [category] [amount] (--warn percent)")
+			log.Println("\t\t\t\twarn when a month's spending in a category nears")
+			log.Println("\t\t\t\t(80% by default) or passes amount")
+			log.Println("* alert add balance [acc] [amount]\twarn when the balance drops below amount")
+			log.Println("* alert add large [amount] (acc)\twarn about any transaction of at least amount")
+			log.Println("* alert rm [rule id]\t\tremove a rule")
+			log.Println("* alert dismiss\t\t\tclear every alert")
+		case "chart":
+			log.Println("chart - draw trends as bar charts and sparklines")
+			log.Println("\tCharts fit the width of the terminal. Only posted")
+			log.Println("\ttransactions are counted")
+			log.Println("usage: chart [subcommand]")
+			log.Println("* chart spending (acc) (--months n)\tspending per category per month,")
+			log.Println("\t\t\t\tover the last n months (default 6)")
+			log.Println("\t\t\t\tspending and income take --where [query]")
+			log.Println("\t\t\t\tto count only matching transactions, as in ls")
+			log.Println("* chart balance [acc] (--days n)\tthe balance at the end of each day,")
+			log.Println("\t\t\t\tover the last n days (default 90)")
+			log.Println("* chart income (acc) (--months n)\tincome against expenses per month")
+		case "person", "people":
+			log.Println("person - manage the people expenses are shared with")
+			log.Println("usage: person (subcommand)")
+			log.Println("* person\t\t\tlist everyone and what they owe")
+			log.Println("* person add [name]\t\tadd someone to share expenses with")
+			log.Println("* person rm [name]\t\tremove someone who is settled up")
+		case "share":
+			log.Println("share - split a transaction with other people")
+			log.Println("\tA share of a purchase is owed by that person, and a share")
+			log.Println("\tof a deposit from them pays back what they owe. People")
+			log.Println("\tlisted without an amount split what's left evenly with you")
+			log.Println("usage: share [wid] (people)")
+			log.Println("* share [wid]\t\t\tshow who the transaction is shared with")
+			log.Println("* share [wid] [name]...\tsplit the transaction evenly with you")
+			log.Println("* share [wid] [name=amount]...\tset someone's share to an amount")
+			log.Println("* share [wid] [name=percent%]...\tset someone's share to a percent")
+			log.Println("* share [wid] [name=0]\t\tstop sharing the transaction with someone")
+		case "settle":
+			log.Println("settle - see who owes whom, and settle up")
+			log.Println("usage: settle (name) (acc) (amount)")
+			log.Println("* settle\t\t\tshow what everyone owes or is owed")
+			log.Println("* settle [name]\t\tshow every transaction shared with someone")
+			log.Println("* settle [name] [acc] (amount)\trecord a payment in acc that settles")
+			log.Println("\t\t\t\tamount, or everything, between you")
+		case "reimburse":
+			log.Println("reimburse - track expenses that will be paid back")
+			log.Println("\tReimbursable transactions, and the deposits paying them")
+			log.Println("\tback, are left out of category spending and budgets")
+			log.Println("usage: reimburse (wids) (off)")
+			log.Println("* reimburse\t\t\tlist reimbursable transactions not yet paid back")
+			log.Println("* reimburse [wid/wids]\t\tmark transactions as reimbursable")
+			log.Println("* reimburse [wid/wids] off\tmark transactions as not reimbursable")
+		case "report", "reports":
+			log.Println("report - group reimbursable transactions into expense reports")
+			log.Println("\tA deposit added for exactly a report's total, after its")
+			log.Println("\tfirst expense, is matched to it as what paid it back")
+			log.Println("usage: report (subcommand)")
+			log.Println("* report\t\t\tlist every report and what is still owed")
+			log.Println("* report [name]\t\tshow a report's transactions, or only")
+			log.Println("\t\t\t\tthose matching --where [query], as in ls")
+			log.Println("* report new [name]\t\tstart a new report")
+			log.Println("* report add [name] [wid/wids]\tput transactions in a report")
+			log.Println("* report match [name] [wid]\tmatch a deposit as paying back a report")
+			log.Println("* report unmatch [name]\tforget what paid back a report")
+			log.Println("* report rm [name]\t\tremove a report, keeping its transactions")
+		case "db":
+			log.Println("db - inspect or manage the database schema")
+			log.Println("\tThe schema is migrated automatically at startup, after")
+			log.Println("\ttaking a backup next to the database file")
+			log.Println("usage: db [subcommand]")
+			log.Println("* db status\t\tshow the schema version and every migration")
+			log.Println("* db backup\t\twrite a backup next to the database file")
+			log.Println("* db rollback\t\tbackup, then undo the last group of migrations")
+		case "tui":
+			log.Println("tui - browse and edit accounts and transactions full screen")
+			log.Println("\tAccounts are listed in a sidebar beside a table of the")
+			log.Println("\tselected account's transactions. Press q to return here")
+			log.Println("usage: tui")
+			log.Println("* tab		switch between the sidebar and the table")
+			log.Println("* up/down (k/j)	move the selection")
+			log.Println("* /		filter transactions, esc to clear")
+			log.Println("* e, enter	edit the selected transaction, tab to change field")
+			log.Println("* d		delete the selected transaction")
+			log.Println("* u		undo the last change")
+		case "catmap":
+			log.Println("catmap - view or edit how Plaid categories map to categories")
+			log.Println("\tTransactions synced from Plaid are categorized using these")
+			log.Println("\tmappings. Detailed Plaid categories (FOOD_AND_DRINK_COFFEE)")
+			log.Println("\ttake priority over primary ones (FOOD_AND_DRINK)")
+			log.Println("usage: catmap (subcommand)")
+			log.Println("* catmap\t\t\t\tlist all mappings")
+			log.Println("* catmap set [plaid category] [category]\tmap a Plaid category")
+			log.Println("* catmap rm [plaid category]\t\tremove a mapping")
+			log.Println("* catmap review\t\t\tlist Plaid categories seen without a mapping")
 		}
-
+		return nil
 	}
-
+	log.Println("oregano-cli - Terminal budgeting app\n" +
+		"Commands:\n" +
+		"* help (h)\t\tPrint this menu\n" +
+		"* quit (q)\t\tQuit oregano\n" +
+		"* link\t\t\tLink a new institution (Opens in a new browser tab)\n" +
+		"* list (ls)\t\tList accounts or transactions\n" +
+		"* alias [id] [alias]\tAssign [alias] as the new alias for [id]\n" +
+		"* remove (rm) [alias/id...]\tRemove a linked institution\n" +
+		"* account (acc) [alias/id...]\tPrint details about specific account(s)\n" +
+		"* transactions (trs) [alias/id]\t List transactions from a specific account\n" +
+		"* search (s) [terms...]\tFind transactions by payee or description\n" +
+		"* attach [wid] [file]\tAttach a receipt or other file to a transaction\n" +
+		"* attachments [wid]\tList the files attached to a transaction\n" +
+		"* import [filename]\t Import transactions from a csv file\n" +
+		"* print (p) [argument index]\tPrint more details about something that was output\n" +
+		"* edit (e) [wid/wids]\tEdit the fields of one or many transactions\n"+
+		"* repair\t\tUsing higher level data as authoritative, correct inconsistencies\n" +
+		"* new ...\t\tmanually create account or transaction\n" +
+		"* catmap ...\t\tView or edit how Plaid categories are mapped\n" +
+		"* payeemap ...\t\tView or edit payees learned for bank descriptions\n" +
+		"* invest ...\t\tRecord trades and view investment holdings\n" +
+		"* loan [acc] ...\tAmortize a personal loan and project its payoff\n" +
+		"* payoff [budget]\tCompare snowball and avalanche debt payoff plans\n" +
+		"* statement [card] ...\tShow credit card statements and minimum payments\n" +
+		"* alert ...\t\tSet budgets and thresholds to be alerted about\n" +
+		"* chart ...\t\tChart spending, balances, and income over time\n" +
+		"* person ...\t\tAdd or remove people to share expenses with\n" +
+		"* share [wid] ...\tSplit a transaction with other people\n" +
+		"* settle (name) ...\tShow who owes whom, and record settling up\n" +
+		"* reimburse (wids)\tMark or list expenses that will be paid back\n" +
+		"* report ...\t\tGroup reimbursable expenses into expense reports\n" +
+		"* db ...\t\tInspect or manage the database schema\n" +
+		"* undo (n)\t\tRevert the last n changes\n" +
+		"* redo (n)\t\tReapply the last n undone changes\n" +
+		"* rekey\t\t\tEncrypt stored Plaid access tokens with a new key\n" +
+		"* tui\t\t\tBrowse and edit transactions full screen\n" +
+		"Options for any command:\n" +
+		"* -o/--output [format]\tPrint as table (default), json, csv, or tsv")
+	return nil
 }
 
 //   - if no id is provided, accounts will be listed
 //   - if a string id is provided, it will be assumed to be an account alias
 //     and transactions in that account will be printed
-func listCmd(tokens []string) {
-	if len(tokens) == 1 {
-		oview.ShowAccounts(model, ocli.ShowAccountOptions{ShowType: true})
-		return
-	} else if len(tokens) > 1 {
-		// Require that if an account is provided, it is the first argument
-		//TODO do I prevent account aliases from starting with '-'?
-		if strings.HasPrefix(tokens[1], "-") {
-			// straight to flags without account name -> list accounts
-			// ls (-l)
-
-			long := false
-			if tokens[1] == "-l" {
-				long = true
-			} else {
-				log.Println("Error: unknown flag")
-				return
-			}
-
-			ops := ocli.ShowAccountOptions{ShowType: true}
-			if long {
-				ops.ShowId = true
-				ops.ShowAnchor = true
-			}
-			oview.ShowAccounts(model, ops)
-		} else {
-			// has account name -> list transactions
-			// ls BOA (-l) (--start/end <date>) (--num <n>)
-			// TODO this has a lot of code in common with transactionsCmd
-
-			list := ocli.ListTransactions(tokens, model, len(workingList))
-
-			for i := range list {
-				workingList = append(workingList, WorkTuple{"transaction", list[i].Id})
-			}
+func listCmd(tokens []string) error {
+	// only -l and -a without account name -> list accounts
+	// ls (-l) (-a)
+	ops := ocli.ShowAccountOptions{ShowType: true}
+	for _, token := range tokens[1:] {
+		switch token {
+		case "-l":
+			ops.ShowId = true
+			ops.ShowAnchor = true
+		case "-a":
+			ops.ShowClosed = true
+		case "-la", "-al":
+			ops.ShowId = true
+			ops.ShowAnchor = true
+			ops.ShowClosed = true
+		default:
+			// has account name or filters -> list transactions
+			// ls (BOA) (-l) (--start/end <date>) (--num <n>) (--where <query>)
+			return transactionsCmd(tokens)
 		}
-
 	}
+
+	oview.ShowAccounts(model, ops)
+	return nil
 }
 
-func aliasCmd(tokens []string) {
+func aliasCmd(tokens []string) error {
 	validFlags := map[string]int{
 		"<>": 2,
 	}
@@ -321,22 +745,19 @@ func aliasCmd(tokens []string) {
 		log.Println("Fail to parse 'alias' command")
 		log.Println("Usage: alias [id] [alias]")
 		log.Println("Use 'help alias' for details")
-		return
-	}
-
-	err = model.SetAlias(flags["<>"][0], flags["<>"][1])
-	if err != nil {
-		log.Printf("Error: %s\n", err)
+		return errUsage
 	}
 
+	return model.SetAlias(flags["<>"][0], flags["<>"][1])
 }
 
-func removeCmd(tokens []string) {
+func removeCmd(tokens []string) error {
 	validFlags := map[string]int{
-		"<>": 1,
-		"-t": 0,
-		"-w": 0,
-		"-c": 0,
+		"<>":        1,
+		"-t":        0,
+		"-w":        0,
+		"-c":        0,
+		"--cascade": 0,
 	}
 
 	flags, err := ocli.ParseTokensToFlags(tokens, validFlags)
@@ -344,7 +765,7 @@ func removeCmd(tokens []string) {
 		log.Println("Fail to parse 'rm' command")
 		log.Println("Usage: rm [alias/id]")
 		log.Println("Use 'help remove' for details")
-		return
+		return errUsage
 	}
 
 	flag := "working"
@@ -354,17 +775,14 @@ func removeCmd(tokens []string) {
 	if _, ok := flags["-c"]; ok {
 		flag = "account"
 	} else if _, ok := flags["-t"]; ok {
-		flag = "transaction"
-		log.Println("ERROR: Removing by transaction id not yet implemented")
-		return
+		return errors.New("removing by transaction id not yet implemented")
 	}
 
 	input := flags["<>"][0]
 	if flag == "working" {
 		item, err := fromWorkingList(input)
 		if err != nil {
-			log.Printf("Could not find item in working list.\nError: %s\n", err)
-			return
+			return fmt.Errorf("could not find item in working list: %s", err)
 		}
 
 		if transaction, ok := item.(omoney.Transaction); ok {
@@ -374,33 +792,29 @@ func removeCmd(tokens []string) {
 			log.Printf("Pulled account %s from working list\n", account.Alias)
 			acc = &account
 		} else {
-			log.Println("Failed to recognize type of item from working list")
-			return
+			return errors.New("failed to recognize type of item from working list")
 		}
 	}
 
 	if flag == "working" && tr != nil {
 		log.Printf("Removing transaction %s\n", input)
-		err = model.RemoveTransaction(tr)
-
-	} else if flag == "account" || (flag == "working" && acc != nil) {
-		log.Printf("Removing account %s\n", input)
-		if acc != nil {
-			input = acc.Id
-		}
-		err = model.RemoveAccount(input)
+		return model.RemoveTransaction(tr)
 	}
 
-	if err != nil {
-		log.Println(err)
+	log.Printf("Removing account %s\n", input)
+	if acc != nil {
+		input = acc.Id
 	}
-
+	_, cascade := flags["--cascade"]
+	return model.RemoveAccount(input, cascade)
 }
 
-func accountCmd(tokens []string) {
+func accountCmd(tokens []string) error {
 	validFlags := map[string]int{
-		"<>": 1,
-		"-a": 2,
+		"<>":       1,
+		"-a":       2,
+		"--close":  0,
+		"--reopen": 0,
 	}
 
 	flags, err := ocli.ParseTokensToFlags(tokens, validFlags)
@@ -408,25 +822,39 @@ func accountCmd(tokens []string) {
 		log.Println("Fail to parse 'acc' command")
 		log.Println("Usage: acc [alias/id]")
 		log.Println("Use 'help account' for details")
-		return
+		return errUsage
 	}
 
 	input := flags["<>"][0]
 	if anchor, ok := flags["-a"]; ok {
 		err = model.SetAnchor(input, anchor)
 		if err != nil {
-			log.Printf("Error: %s\n", err)
-		} else {
-			acc, _ := model.GetAccount(input)
-			log.Printf("Updated anchor to $%.2f on %s", acc.AnchorBalance, acc.AnchorTime.Format("2006/01/02"))
+			return err
 		}
-		return
+		acc, _ := model.GetAccount(input)
+		log.Printf("Updated anchor to $%.2f on %s", acc.AnchorBalance, acc.AnchorTime.Format("2006/01/02"))
+		return nil
+	}
+	if _, ok := flags["--close"]; ok {
+		err = model.SetClosed(input, true)
+		if err != nil {
+			return err
+		}
+		log.Printf("Closed %s. It is hidden from `ls` but its transactions are kept\n", input)
+		return nil
+	}
+	if _, ok := flags["--reopen"]; ok {
+		err = model.SetClosed(input, false)
+		if err != nil {
+			return err
+		}
+		log.Printf("Reopened %s\n", input)
+		return nil
 	}
 
 	acc, err := model.GetAccount(input)
 	if err != nil {
-		log.Printf("Error: %s\n", err)
-		return
+		return err
 	}
 	if acc.PlaidToken == "" {
 		// account was manually created
@@ -445,40 +873,160 @@ func accountCmd(tokens []string) {
 		// }
 		// oview.ShowPlaidAccounts(resp.GetAccounts())
 	}
+	return nil
+}
+
+func transactionsCmd(tokens []string) error {
+	if len(tokens) < 2 {
+		log.Println("Usage: trs [alias/id] (-l) (--num [n]) (--start [date]) (--end [date]) (--where [query])")
+		return errUsage
+	}
+
+	list, err := ocli.ListTransactions(tokens, model, oview, len(workingList))
+	if err != nil {
+		return err
+	}
 
+	for i := range list {
+		workingList = append(workingList, WorkTuple{"transaction", list[i].Id})
+	}
+	return nil
 }
 
-func transactionsCmd(tokens []string) {
-	list := ocli.ListTransactions(tokens, model, len(workingList))
+func searchCmd(tokens []string) error {
+	if len(tokens) < 2 {
+		log.Println("Usage: search [terms...] (-l) (--num [n]) (--start [date]) (--end [date]) (--where [query])")
+		return errUsage
+	}
+
+	list, err := ocli.SearchTransactions(tokens, model, oview, len(workingList))
+	if err != nil {
+		return err
+	}
 
 	for i := range list {
 		workingList = append(workingList, WorkTuple{"transaction", list[i].Id})
 	}
+	return nil
+}
+
+func attachCmd(tokens []string) error {
+	if len(tokens) != 3 {
+		log.Println("Usage: attach [wid] [file]")
+		return errUsage
+	}
+
+	v, err := fromWorkingList(tokens[1])
+	if err != nil {
+		return err
+	}
+	tr, ok := v.(omoney.Transaction)
+	if !ok {
+		return errors.New("wid does not point to a transaction")
+	}
+
+	att, err := model.AttachFile(tr.Id, tokens[2])
+	if err != nil {
+		return err
+	}
+	log.Printf("Attached %s to %s\n", att.Name, tr.Payee)
+	return nil
+}
+
+// attachments [wid]
+// attachments clean
+func attachmentsCmd(tokens []string) error {
+	if len(tokens) != 2 {
+		log.Println("Usage: attachments [wid]")
+		log.Println("       attachments clean")
+		return errUsage
+	}
+
+	if tokens[1] == "clean" {
+		removed, err := model.CleanAttachments()
+		for _, name := range removed {
+			log.Printf("Deleted %s\n", name)
+		}
+		if err != nil {
+			return err
+		}
+		log.Printf("Deleted %d unused files\n", len(removed))
+		return nil
+	}
+
+	v, err := fromWorkingList(tokens[1])
+	if err != nil {
+		return err
+	}
+	tr, ok := v.(omoney.Transaction)
+	if !ok {
+		return errors.New("wid does not point to a transaction")
+	}
 
+	atts, err := model.GetAttachments(tr.Id)
+	if err != nil {
+		return err
+	}
+	oview.ShowAttachments(atts)
+	return nil
 }
 
-func importCmd(tokens []string) {
+// import [filename] (--profile [name])
+func importCmd(tokens []string) error {
 	validFlags := map[string]int{
-		"<>": 1,
+		"<>":        1,
+		"--profile": 1,
 	}
 
 	flags, err := ocli.ParseTokensToFlags(tokens, validFlags)
 	if err != nil {
 		log.Println("Fail to parse 'import' command")
-		log.Println("Usage: import [filename]")
+		log.Println("Usage: import [filename] (--profile [name])")
 		log.Println("Use 'help import' for details")
-		return
+		return errUsage
+	}
+
+	// use the named profile if it exists, otherwise
+	// save the answers given below under that name
+	var profile *omoney.ImportProfile
+	newProfile := false
+	if name, ok := flags["--profile"]; ok {
+		saved, err := model.GetImportProfile(name[0])
+		if err == sql.ErrNoRows {
+			saved = omoney.ImportProfile{Name: name[0]}
+			newProfile = true
+		} else if err != nil {
+			return err
+		}
+		profile = &saved
 	}
 
 	input := flags["<>"][0]
-	newTrans := ocli.ReadCsv(input, model.GetAliases())
-	for _, tr := range newTrans {
-		model.AddTransaction(tr)
+	newTrans, err := ocli.ReadCsv(input, model.GetAliases(), profile)
+	if err != nil {
+		return err
+	}
+
+	if newProfile {
+		err = model.SaveImportProfile(profile)
+		if err != nil {
+			return err
+		}
+		log.Printf("Saved import profile %s\n", profile.Name)
 	}
 
+	for _, tr := range newTrans {
+		model.ResolvePayee(tr)
+		err = model.AddTransaction(tr)
+		if err != nil {
+			return err
+		}
+	}
+	log.Printf("Imported %d transactions\n", len(newTrans))
+	return nil
 }
 
-func printCmd(tokens []string) {
+func printCmd(tokens []string) error {
 	// -l	long (detailed)
 	validFlags := map[string]int{
 		"<>": 1,
@@ -487,10 +1035,10 @@ func printCmd(tokens []string) {
 
 	flags, err := ocli.ParseTokensToFlags(tokens, validFlags)
 	if err != nil {
-		log.Println("Fail to parse 'import' command")
-		log.Println("Usage: import [filename]")
-		log.Println("Use 'help import' for details")
-		return
+		log.Println("Fail to parse 'print' command")
+		log.Println("Usage: print [wid] (-l)")
+		log.Println("Use 'help print' for details")
+		return errUsage
 	}
 
 	_, long := flags["-l"]
@@ -498,8 +1046,7 @@ func printCmd(tokens []string) {
 
 	v, err := fromWorkingList(arg)
 	if err != nil {
-		log.Printf("Error: %s\n", err)
-		return
+		return err
 	}
 
 	switch t := v.(type) {
@@ -515,77 +1062,149 @@ func printCmd(tokens []string) {
 		}
 		oview.ShowTransaction(t, ops)
 	}
-
+	return nil
 }
 
 // e <wid> (--account/--payee/--amount/--date/--category/--desc)
-func editCmd(tokens []string) {
-	if len(tokens) < 2 {
-		log.Println("Error: not enough arguments")
-		return
+// edit [wid] [updates...]
+// edit [wids] [updates...] (-y)		wids is a selection like 3-10,14
+// edit --where [query] [updates...] (-y)
+func editCmd(tokens []string) error {
+	if len(tokens) < 3 {
+		log.Println("Usage: edit [wid/wids] (--account/--payee/--amount/--date/--category/--desc/--status [value]) (-y)")
+		log.Println("       edit --where [query] (--account/--payee/--amount/--date/--category/--desc/--status [value]) (-y)")
+		return errUsage
 	}
 
-	v, err := fromWorkingList(tokens[1])
-	if err != nil {
-		log.Printf("Error: %s\n", err)
-		return
-	}
-	tr, ok := v.(omoney.Transaction)
-	if !ok {
-		log.Println("Error: wid does not point to a transaction")
-		return
+	// -y skips confirming changes to more than one transaction
+	rest := make([]string, 0, len(tokens))
+	confirmed := false
+	for _, token := range tokens {
+		if token == "-y" || token == "--yes" {
+			confirmed = true
+		} else {
+			rest = append(rest, token)
+		}
 	}
+	tokens = rest
 
-	ops := make([]omoney.UpdateTransactionOptions, 0)
-	i := 2
-	for i < len(tokens)-1 {
-		switch tokens[i] {
-		case "--account":
-			acc, err := model.GetAccount(tokens[i+1])
-			if err != nil {
-				log.Printf("Error: %s\n", err)
-				return
-			}
-			ops = append(ops, omoney.WithAccountUpdate(acc.Id))
-			i += 2
-		case "--payee":
-			ops = append(ops, omoney.WithPayeeUpdate(tokens[i+1]))
-			i += 2
-		case "--amount":
-			amount, err := strconv.ParseFloat(tokens[i+1], 64)
+	var trs []omoney.Transaction
+	var updates []string
+	if tokens[1] == "--where" {
+		query, err := omoney.ParseQuery(tokens[2])
+		if err != nil {
+			return err
+		}
+		op := omoney.GetTransactionsOptions{Query: query}
+		op.Count, err = model.CountTransactions("", op)
+		if err != nil {
+			return err
+		}
+		trs, err = model.GetTransactions(op)
+		if err != nil {
+			return err
+		}
+		updates = tokens[3:]
+	} else {
+		wids, err := ocli.ParseWidSelection(tokens[1], len(workingList))
+		if err != nil {
+			return err
+		}
+		for _, wid := range wids {
+			v, err := fromWorkingList(strconv.Itoa(wid))
 			if err != nil {
-				log.Println("Error: failed to parse amount")
-				return
+				return err
 			}
-			ops = append(ops, omoney.WithAmountUpdate(amount))
-			i += 2
-		case "--date":
-			date, err := dateparse.ParseLocal(tokens[i+1])
-			if err != nil {
-				log.Println("Error: failed to parse date")
-				return
+			tr, ok := v.(omoney.Transaction)
+			if !ok {
+				return fmt.Errorf("wid %d does not point to a transaction", wid)
 			}
-			ops = append(ops, omoney.WithDateUpdate(date))
-			i += 2
-		case "--category":
-			ops = append(ops, omoney.WithCategoryUpdate(tokens[i+1]))
-			i += 2
-		case "--desc":
-			ops = append(ops, omoney.WithDescUpdate(tokens[i+1]))
-			i += 2
+			trs = append(trs, tr)
 		}
+		updates = tokens[2:]
 	}
 
-	err = model.UpdateTransaction(tr.Id, ops...)
+	ops, err := ocli.BuildTransactionUpdates(model, updates)
 	if err != nil {
-		log.Printf("Error: %s\n", err)
+		return err
+	}
+	if len(ops) == 0 {
+		return errors.New("nothing to change, give at least one field to set")
+	}
+	if len(trs) == 0 {
+		return errors.New("no transactions match")
+	}
+
+	if len(trs) == 1 && tokens[1] != "--where" {
+		err = model.UpdateTransaction(trs[0].Id, ops...)
+		if err != nil {
+			return err
+		}
+		return learnPayees(trs, updates)
+	}
+
+	// show what is about to change before changing it
+	oview.ShowTransactions(trs, false, len(workingList))
+	ids := make([]string, len(trs))
+	for i := range trs {
+		workingList = append(workingList, WorkTuple{"transaction", trs[i].Id})
+		ids[i] = trs[i].Id
+	}
+
+	if !confirmed {
+		prompt := promptui.Prompt{
+			Label:     fmt.Sprintf("Update these %d transactions", len(trs)),
+			IsConfirm: true,
+		}
+		if _, err := prompt.Run(); err != nil {
+			log.Println("Nothing was changed")
+			return nil
+		}
+	}
+
+	err = model.UpdateTransactions(ids, ops...)
+	if err != nil {
+		return err
+	}
+	log.Printf("Updated %d transactions, `undo` reverts them all\n", len(trs))
+	return learnPayees(trs, updates)
+}
+
+// When an edit renamed the payee, remember the new payee for later
+// transactions with institution descriptions like the edited ones
+func learnPayees(trs []omoney.Transaction, updates []string) error {
+	payee := ""
+	for i := 0; i+1 < len(updates); i += 2 {
+		if updates[i] == "--payee" {
+			payee = updates[i+1]
+		}
 	}
+	if payee == "" {
+		return nil
+	}
+
+	learned := make(map[string]bool)
+	for _, tr := range trs {
+		if tr.InstDescription == "" {
+			continue
+		}
+		key, err := model.LearnPayee(tr.InstDescription, payee)
+		if err != nil {
+			return err
+		}
+		if key != "" && !learned[key] {
+			learned[key] = true
+			log.Printf("Transactions described like %s will be named %s\n", key, payee)
+		}
+	}
+	return nil
 }
 
-func newCmd(tokens []string) {
+func newCmd(tokens []string) error {
 	if len(tokens) < 2 {
-		log.Printf("Error: command 'new' requires more arguments\n")
-		return
+		log.Println("Usage: new [account/transaction] ...")
+		log.Println("Use 'help new' for details")
+		return errUsage
 	}
 
 	// trim 'new' off front of cmd
@@ -603,22 +1222,20 @@ func newCmd(tokens []string) {
 			log.Println("Fail to parse 'new acc' command")
 			log.Println("Usage: new acc [alias] [type]")
 			log.Println("Use 'help new' for details")
-			return
+			return errUsage
 		}
 
-		acc := ocli.CreateManualAccount(flags["<>"])
-		if acc == nil {
-			log.Println("Error making new manual account")
-			return
+		acc, err := ocli.BuildManualAccount(flags["<>"])
+		if err != nil {
+			return err
 		}
-		model.AddAccount(*acc)
+		return model.AddAccount(*acc)
 	case "transaction", "tr":
 		// new tr [acc] [payee] [amount] (date) (cat)
 		//      (desc) (-t/--time date) (-c/--category cat) (-d/--description desc)
-		if len(tokens) < 3 {
-			log.Printf("Error: command 'new transaction' requires more arguments\n")
-			log.Printf("Usage: new tr [account] [payee] [amount] (date) (category) (desc)")
-			return
+		if len(tokens) < 4 {
+			log.Println("Usage: new tr [account] [payee] [amount] (date) (category) (desc)")
+			return errUsage
 		}
 
 		// if account is valid alias, replace with ID
@@ -628,8 +1245,7 @@ func newCmd(tokens []string) {
 			tokens[1] = model.GetAccountId(tokens[1])
 			log.Printf("converted alias %s to accid %s\n", alias, tokens[1])
 		} else if !model.IsValidAccountId(tokens[1]) {
-			log.Printf("Error: %s is not a valid account alias or id\n", tokens[1])
-			return
+			return fmt.Errorf("%s is not a valid account alias or id", tokens[1])
 		} else {
 			log.Printf("Continuing with provided account id %s\n", tokens[1])
 		}
@@ -637,36 +1253,1150 @@ func newCmd(tokens []string) {
 		// trim 'tr' off front of cmd
 		tokens = tokens[1:]
 
-		tr := ocli.CreateManualTransaction(tokens)
-		if tr == nil {
-			log.Println("Error making new manual transaction")
-			return
+		tr, err := ocli.BuildManualTransaction(tokens)
+		if err != nil {
+			return err
 		}
 
 		// transaction is purposely handled by model and not
 		// account because I intend to later add an always
 		// up to date budget model
-		model.AddTransaction(tr)
+		err = model.AddTransaction(tr)
+		if err != nil {
+			return err
+		}
 		log.Printf("Saving new transaction %+v\n", tr)
+		return nil
 	default:
-		log.Printf("Error: unknown subcommand %s\n", tokens[1])
+		log.Printf("Error: unknown subcommand %s\n", tokens[0])
 		log.Println("Valid subcommands are: account, transaction")
+		return errUsage
 	}
 }
 
-func linkNewInstitution(model *omoney.Model, client *plaid.APIClient, countries []string, lang string) {
-	// Build a linker struct to run Plaid Link
-	linker := ocli.NewLinker(client, countries, lang)
-	port := viper.GetString("link.port")
-
-	// Attempt to run link in a browser window
-	var tokenPair *ocli.TokenPair
-	tokenPair, err := linker.Link(port)
-	if err != nil {
-		log.Fatalln(err)
+// catmap (set [plaid category] [category]) (rm [plaid category]) (review)
+func catmapCmd(tokens []string) error {
+	if len(tokens) == 1 {
+		oview.ShowCategoryMappings(model.GetCategoryMappings())
+		return nil
 	}
-	log.Println("Institution linked!")
-	log.Printf("Item ID: %s\n", tokenPair.ItemID)
+
+	switch tokens[1] {
+	case "set":
+		if len(tokens) != 4 {
+			log.Println("Usage: catmap set [plaid category] [category]")
+			return errUsage
+		}
+		return model.SetCategoryMapping(strings.ToUpper(tokens[2]), tokens[3])
+	case "rm", "remove":
+		if len(tokens) != 3 {
+			log.Println("Usage: catmap rm [plaid category]")
+			return errUsage
+		}
+		return model.RemoveCategoryMapping(strings.ToUpper(tokens[2]))
+	case "review":
+		oview.ShowUnmappedCategories(model.GetUnmappedCategories())
+		return nil
+	default:
+		log.Printf("Error: unknown subcommand %s\n", tokens[1])
+		log.Println("Valid subcommands are: set, rm, review")
+		return errUsage
+	}
+}
+
+// db [status/backup/rollback]
+func payeemapCmd(tokens []string) error {
+	if len(tokens) == 1 {
+		oview.ShowPayeeAliases(model.GetPayeeAliases())
+		return nil
+	}
+
+	switch tokens[1] {
+	case "set":
+		if len(tokens) != 4 {
+			log.Println("Usage: payeemap set [description] [payee]")
+			return errUsage
+		}
+		key := omoney.PayeeKey(tokens[2])
+		if key == "" {
+			return fmt.Errorf("nothing to match is left of %s once normalized", tokens[2])
+		}
+		return model.SetPayeeAlias(key, tokens[3])
+	case "rm", "remove":
+		if len(tokens) != 3 {
+			log.Println("Usage: payeemap rm [description]")
+			return errUsage
+		}
+		return model.RemovePayeeAlias(omoney.PayeeKey(tokens[2]))
+	case "test":
+		if len(tokens) != 3 {
+			log.Println("Usage: payeemap test [description]")
+			return errUsage
+		}
+		tr := &omoney.Transaction{InstDescription: tokens[2]}
+		model.ResolvePayee(tr)
+		log.Printf("%s -> %s\n", omoney.PayeeKey(tokens[2]), tr.Payee)
+		return nil
+	default:
+		log.Printf("Error: unknown subcommand %s\n", tokens[1])
+		log.Println("Valid subcommands are: set, rm, test")
+		return errUsage
+	}
+}
+
+func investCmd(tokens []string) error {
+	if len(tokens) < 2 {
+		log.Println("Usage: invest [buy/sell/dividend/split/holdings/lots/events/gains/rm/prices/price]")
+		log.Println("Use 'help invest' for details")
+		return errUsage
+	}
+
+	switch tokens[1] {
+	case "buy", "sell", "dividend", "split":
+		ev, err := ocli.BuildInvestmentEvent(tokens[1:])
+		if err != nil {
+			return err
+		}
+		err = model.AddInvestmentEvent(ev)
+		if err != nil {
+			return err
+		}
+		oview.ShowInvestmentEvents([]omoney.InvestmentEvent{*ev})
+	case "holdings":
+		if len(tokens) > 3 {
+			log.Println("Usage: invest holdings (account)")
+			return errUsage
+		}
+		accId := ""
+		if len(tokens) == 3 {
+			acc, err := model.GetAccount(tokens[2])
+			if err != nil {
+				return err
+			}
+			accId = acc.Id
+		}
+		holdings, err := model.GetHoldings(accId, time.Now())
+		if err != nil {
+			return err
+		}
+		oview.ShowHoldings(model, holdings)
+	case "lots":
+		if len(tokens) != 3 && len(tokens) != 4 {
+			log.Println("Usage: invest lots [account] (symbol)")
+			return errUsage
+		}
+		acc, err := model.GetAccount(tokens[2])
+		if err != nil {
+			return err
+		}
+		holdings, err := model.GetHoldings(acc.Id, time.Now())
+		if err != nil {
+			return err
+		}
+		lots := make([]omoney.Lot, 0)
+		for _, h := range holdings {
+			if len(tokens) == 4 && !strings.EqualFold(h.Symbol, tokens[3]) {
+				continue
+			}
+			lots = append(lots, h.Lots...)
+		}
+		oview.ShowLots(lots)
+	case "events":
+		if len(tokens) > 4 {
+			log.Println("Usage: invest events (account) (symbol)")
+			return errUsage
+		}
+		accId, symbol := "", ""
+		if len(tokens) >= 3 {
+			acc, err := model.GetAccount(tokens[2])
+			if err != nil {
+				return err
+			}
+			accId = acc.Id
+		}
+		if len(tokens) == 4 {
+			symbol = tokens[3]
+		}
+		events, err := model.GetInvestmentEvents(accId, symbol)
+		if err != nil {
+			return err
+		}
+		oview.ShowInvestmentEvents(events)
+	case "rm", "remove":
+		if len(tokens) != 3 {
+			log.Println("Usage: invest rm [event id]")
+			return errUsage
+		}
+		id, err := strconv.ParseInt(tokens[2], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid event id %s", tokens[2])
+		}
+		return model.RemoveInvestmentEvent(id)
+	case "gains":
+		return gainsCmd(tokens[1:])
+	case "prices":
+		if len(tokens) != 3 {
+			log.Println("Usage: invest prices [filename]")
+			return errUsage
+		}
+		prices, names, err := ocli.ReadPricesCsv(tokens[2])
+		if err != nil {
+			return err
+		}
+		err = model.SetPrices(prices)
+		if err != nil {
+			return err
+		}
+		for symbol, name := range names {
+			err = model.SetSecurityName(symbol, name)
+			if err != nil {
+				return err
+			}
+		}
+		log.Printf("Loaded %d prices\n", len(prices))
+	case "price":
+		if len(tokens) != 3 && len(tokens) != 4 {
+			log.Println("Usage: invest price [symbol] (price)")
+			return errUsage
+		}
+		symbol := strings.ToUpper(tokens[2])
+		if len(tokens) == 4 {
+			price, err := strconv.ParseFloat(strings.TrimPrefix(tokens[3], "$"), 64)
+			if err != nil {
+				return fmt.Errorf("unable to parse price %s", tokens[3])
+			}
+			y, mo, d := time.Now().Date()
+			today := time.Date(y, mo, d, 0, 0, 0, 0, time.Local)
+			return model.SetPrices([]omoney.SecurityPrice{{Symbol: symbol, Date: today, Price: price}})
+		}
+		price, date, err := model.GetPrice(symbol, time.Now())
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("no price known for %s", symbol)
+		} else if err != nil {
+			return err
+		}
+		log.Printf("%s: $%.2f on %s\n", symbol, price, date.Format("2006/01/02"))
+	default:
+		log.Printf("Error: unknown subcommand %s\n", tokens[1])
+		log.Println("Valid subcommands are: buy, sell, dividend, split, holdings, lots, events, gains, rm, prices, price")
+		return errUsage
+	}
+	return nil
+}
+
+// example input: [gains 2024 brokerage --export gains.csv]
+func gainsCmd(tokens []string) error {
+	// [year]	year the shares were sold in
+	// (account)	alias or id of the account, or every account if left out
+	// --export	path of a csv file to write the report to
+	usage := func() error {
+		log.Println("Usage: invest gains [year] (account) (--export [filename])")
+		return errUsage
+	}
+	if len(tokens) < 2 {
+		return usage()
+	}
+	year, err := strconv.Atoi(tokens[1])
+	if err != nil {
+		return fmt.Errorf("invalid year %s", tokens[1])
+	}
+
+	accId, export := "", ""
+	for i := 2; i < len(tokens); i++ {
+		if tokens[i] == "--export" {
+			if i+1 == len(tokens) {
+				return usage()
+			}
+			export = tokens[i+1]
+			i++
+		} else if accId == "" {
+			acc, err := model.GetAccount(tokens[i])
+			if err != nil {
+				return err
+			}
+			accId = acc.Id
+		} else {
+			return usage()
+		}
+	}
+
+	gains, err := model.GetCapitalGains(year, accId)
+	if err != nil {
+		return err
+	}
+	if export == "" {
+		oview.ShowCapitalGains(model, gains)
+		return nil
+	}
+
+	f, err := os.Create(export)
+	if err != nil {
+		return err
+	}
+	ocli.NewOViewData("csv", f).ShowCapitalGains(model, gains)
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+	log.Printf("Wrote %d lots sold in %d to %s\n", len(gains), year, export)
+	return nil
+}
+
+func loanCmd(tokens []string) error {
+	if len(tokens) < 2 {
+		log.Println("Usage: loan [account] (set/schedule/payments/payoff)")
+		log.Println("Use 'help loan' for details")
+		return errUsage
+	}
+	account := tokens[1]
+
+	// the amounts given with --extra, or just none if not given
+	extras := func(args []string) ([]float64, error) {
+		if len(args) == 0 {
+			return []float64{0}, nil
+		}
+		if len(args) != 2 || args[0] != "--extra" {
+			return nil, fmt.Errorf("unexpected arguments %s", strings.Join(args, " "))
+		}
+		return ocli.ParseAmounts(args[1])
+	}
+
+	if len(tokens) == 2 {
+		acc, err := model.GetAccount(account)
+		if err != nil {
+			return err
+		}
+		oview.ShowAccount(acc)
+		projections, err := model.ProjectLoanPayoff(account)
+		if err != nil {
+			return err
+		}
+		oview.ShowLoanProjections(projections)
+		return nil
+	}
+
+	switch tokens[2] {
+	case "set":
+		terms, err := ocli.BuildLoanTerms(tokens[3:])
+		if err != nil {
+			log.Println("Usage: loan [account] set [principal] [apr] [months] [payment day] [start date]")
+			return err
+		}
+		err = model.SetLoanTerms(account, terms)
+		if err != nil {
+			return err
+		}
+		log.Printf("Monthly payment: $%.2f\n", terms.MonthlyPayment())
+	case "schedule":
+		amounts, err := extras(tokens[3:])
+		if err != nil || len(amounts) != 1 {
+			log.Println("Usage: loan [account] schedule (--extra [amount])")
+			return errUsage
+		}
+		acc, err := model.GetAccount(account)
+		if err != nil {
+			return err
+		}
+		if !acc.Loan.IsSet() {
+			return fmt.Errorf("%s has no loan terms yet", account)
+		}
+		schedule, err := acc.Loan.Schedule(amounts[0])
+		if err != nil {
+			return err
+		}
+		oview.ShowInstallments(schedule)
+	case "payments":
+		payments, err := model.GetLoanPayments(account)
+		if err != nil {
+			return err
+		}
+		oview.ShowLoanPayments(payments)
+	case "payoff":
+		amounts, err := extras(tokens[3:])
+		if err != nil {
+			log.Println("Usage: loan [account] payoff (--extra [amount,...])")
+			return err
+		}
+		if amounts[0] != 0 {
+			// always compare against paying nothing extra
+			amounts = append([]float64{0}, amounts...)
+		}
+		projections, err := model.ProjectLoanPayoff(account, amounts...)
+		if err != nil {
+			return err
+		}
+		oview.ShowLoanProjections(projections)
+	default:
+		log.Printf("Error: unknown subcommand %s\n", tokens[2])
+		log.Println("Valid subcommands are: set, schedule, payments, payoff")
+		return errUsage
+	}
+	return nil
+}
+
+// example input: [payoff 1200 --apr visa=24.99 --min visa=35 --order car,visa]
+func payoffCmd(tokens []string) error {
+	validFlags := map[string]int{
+		"<>":      1,
+		"--apr":   1,
+		"--min":   1,
+		"--order": 1,
+	}
+	flags, err := ocli.ParseTokensToFlags(tokens, validFlags)
+	if err != nil {
+		log.Println("Usage: payoff [monthly budget] (--apr acc=rate,...) (--min acc=amount,...) (--order acc,...)")
+		log.Println("Use 'help payoff' for details")
+		return errUsage
+	}
+
+	budget, err := strconv.ParseFloat(strings.TrimPrefix(flags["<>"][0], "$"), 64)
+	if err != nil {
+		return fmt.Errorf("unable to parse budget %s", flags["<>"][0])
+	}
+
+	debts, err := model.GetDebts()
+	if err != nil {
+		return err
+	}
+	for _, flag := range []string{"--apr", "--min"} {
+		value, ok := flags[flag]
+		if !ok {
+			continue
+		}
+		amounts, err := ocli.ParseAccountAmounts(model, value[0])
+		if err != nil {
+			return err
+		}
+		for i := range debts {
+			if amount, ok := amounts[debts[i].AccountId]; ok && flag == "--apr" {
+				debts[i].Apr = amount
+			} else if ok {
+				debts[i].MinPayment = amount
+			}
+		}
+	}
+
+	strategies := []omoney.PayoffStrategy{omoney.Snowball, omoney.Avalanche}
+	var order []string
+	if value, ok := flags["--order"]; ok {
+		for _, alias := range strings.Split(value[0], ",") {
+			acc, err := model.GetAccount(strings.TrimSpace(alias))
+			if err != nil {
+				return err
+			}
+			order = append(order, acc.Id)
+		}
+		strategies = append(strategies, omoney.CustomOrder)
+	}
+
+	plans := make([]omoney.PayoffPlan, 0, len(strategies))
+	for _, strategy := range strategies {
+		plan, err := omoney.PlanPayoff(debts, budget, strategy, order, time.Now())
+		if err != nil {
+			return err
+		}
+		plans = append(plans, plan)
+	}
+	oview.ShowPayoffPlans(debts, plans)
+	return nil
+}
+
+// example input: [statement visa --cycles 12] or [statement visa set 20 15]
+func statementCmd(tokens []string) error {
+	if len(tokens) < 2 {
+		log.Println("Usage: statement [card] (--cycles [n]) or statement [card] set [closing day] [due day]")
+		log.Println("Use 'help statement' for details")
+		return errUsage
+	}
+	account := tokens[1]
+
+	if len(tokens) > 2 && tokens[2] == "set" {
+		if len(tokens) != 5 {
+			log.Println("Usage: statement [card] set [closing day] [due day]")
+			return errUsage
+		}
+		closing, err := strconv.Atoi(tokens[3])
+		if err != nil {
+			return fmt.Errorf("unable to parse closing day %s", tokens[3])
+		}
+		due, err := strconv.Atoi(tokens[4])
+		if err != nil {
+			return fmt.Errorf("unable to parse due day %s", tokens[4])
+		}
+		return model.SetStatementDays(account, closing, due)
+	}
+
+	cycles := 6
+	switch {
+	case len(tokens) == 4 && tokens[2] == "--cycles":
+		n, err := strconv.Atoi(tokens[3])
+		if err != nil || n < 1 {
+			return fmt.Errorf("unable to parse number of cycles %s", tokens[3])
+		}
+		cycles = n
+	case len(tokens) != 2:
+		log.Println("Usage: statement [card] (--cycles [n]) or statement [card] set [closing day] [due day]")
+		return errUsage
+	}
+
+	now := time.Now()
+	statements, err := model.GetStatements(account, cycles, now)
+	if err != nil {
+		return err
+	}
+	oview.ShowStatements(statements, now)
+
+	// credit card amounts are shown as stored
+	trs := statements[0].Transactions
+	oview.ShowTransactions(trs, false, len(workingList))
+	for i := range trs {
+		workingList = append(workingList, WorkTuple{"transaction", trs[i].Id})
+	}
+	return nil
+}
+
+// Print a warning for every credit card whose last statement is due
+// soon or late without its minimum payment having been seen
+func warnUnpaidStatements() {
+	now := time.Now()
+	unpaid, err := model.GetUnpaidStatements(now)
+	if err != nil {
+		log.Printf("Error checking statements: %s\n", err)
+		return
+	}
+	for _, s := range unpaid {
+		fmt.Printf("⚠️  %s statement of $%.2f is %s: minimum $%.2f due %s, $%.2f paid\n",
+			s.Alias, s.Balance, s.Status(now), s.MinPayment, s.Due.Format("2006/01/02"), s.Paid)
+	}
+}
+
+// example input: [alert add budget dining 300 --warn 90] or [alert dismiss]
+func alertCmd(tokens []string) error {
+	if len(tokens) == 1 || (len(tokens) == 2 && tokens[1] == "--all") {
+		alerts, err := model.GetAlerts(len(tokens) == 2)
+		if err != nil {
+			return err
+		}
+		oview.ShowAlerts(alerts)
+		return nil
+	}
+
+	switch tokens[1] {
+	case "rules":
+		rules, err := model.GetAlertRules()
+		if err != nil {
+			return err
+		}
+		oview.ShowAlertRules(model, rules)
+	case "add":
+		rule, err := ocli.BuildAlertRule(tokens[2:])
+		if err != nil {
+			log.Println("Usage: alert add budget [category] [amount] (--warn percent)")
+			log.Println("       alert add balance [acc] [amount]")
+			log.Println("       alert add large [amount] (acc)")
+			return err
+		}
+		err = model.AddAlertRule(rule)
+		if err != nil {
+			return err
+		}
+		log.Printf("Added alert rule %d\n", rule.Id)
+	case "rm":
+		if len(tokens) != 3 {
+			log.Println("Usage: alert rm [rule id]")
+			return errUsage
+		}
+		id, err := strconv.ParseInt(tokens[2], 10, 64)
+		if err != nil {
+			return fmt.Errorf("unable to parse rule id %s", tokens[2])
+		}
+		return model.RemoveAlertRule(id)
+	case "dismiss":
+		return model.DismissAlerts()
+	default:
+		log.Printf("Error: unknown subcommand %s\n", tokens[1])
+		log.Println("Valid subcommands are: rules, add, rm, dismiss")
+		return errUsage
+	}
+	return nil
+}
+
+// example input: [chart spending visa --months 12] or [chart balance checking]
+func chartCmd(tokens []string) error {
+	if len(tokens) < 2 {
+		log.Println("Usage: chart [spending/balance/income] (acc) (--months n / --days n) (--where [query])")
+		log.Println("Use 'help chart' for details")
+		return errUsage
+	}
+
+	// the account is optional, and may come before or after the flags
+	account := ""
+	span := -1
+	var query *omoney.Query
+	for i := 2; i < len(tokens); i++ {
+		switch tokens[i] {
+		case "--months", "--days":
+			if i+1 == len(tokens) {
+				return fmt.Errorf("missing number after %s", tokens[i])
+			}
+			n, err := strconv.Atoi(tokens[i+1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("unable to parse %s %s", tokens[i][2:], tokens[i+1])
+			}
+			span = n
+			i++
+		case "--where":
+			if i+1 == len(tokens) {
+				return errors.New("missing query after --where")
+			}
+			var err error
+			query, err = omoney.ParseQuery(tokens[i+1])
+			if err != nil {
+				return err
+			}
+			i++
+		default:
+			if account != "" {
+				log.Println("Usage: chart [spending/balance/income] (acc) (--months n / --days n) (--where [query])")
+				return errUsage
+			}
+			account = tokens[i]
+		}
+	}
+
+	now := time.Now()
+	switch tokens[1] {
+	case "spending", "income":
+		if span == -1 {
+			span = 6
+		}
+		accId := ""
+		if account != "" {
+			acc, err := model.GetAccount(account)
+			if err != nil {
+				return err
+			}
+			accId = acc.Id
+		}
+		months, err := model.GetMonthlyTotals(accId, now.AddDate(0, 1-span, 0), now, query)
+		if err != nil {
+			return err
+		}
+		if tokens[1] == "spending" {
+			oview.ShowCategoryTrend(months)
+		} else {
+			oview.ShowIncomeExpense(months)
+		}
+	case "balance":
+		if account == "" {
+			log.Println("Usage: chart balance [acc] (--days n)")
+			return errUsage
+		}
+		// a balance counts every transaction, so can't be filtered
+		if query != nil {
+			return errors.New("chart balance does not take --where")
+		}
+		if span == -1 {
+			span = 90
+		}
+		acc, err := model.GetAccount(account)
+		if err != nil {
+			return err
+		}
+		points, err := model.GetBalanceHistory(acc.Id, now.AddDate(0, 0, 1-span), now)
+		if err != nil {
+			return err
+		}
+		oview.ShowBalanceHistory(acc, points)
+	default:
+		log.Printf("Error: unknown subcommand %s\n", tokens[1])
+		log.Println("Valid subcommands are: spending, balance, income")
+		return errUsage
+	}
+	return nil
+}
+
+// example input: [person add alex] or [person]
+func personCmd(tokens []string) error {
+	if len(tokens) == 1 {
+		balances, err := model.GetPersonBalances()
+		if err != nil {
+			return err
+		}
+		oview.ShowPersonBalances(balances)
+		return nil
+	}
+
+	if len(tokens) != 3 {
+		log.Println("Usage: person (add/rm [name])")
+		return errUsage
+	}
+	switch tokens[1] {
+	case "add":
+		_, err := model.AddPerson(tokens[2])
+		return err
+	case "rm":
+		return model.RemovePerson(tokens[2])
+	default:
+		log.Printf("Error: unknown subcommand %s\n", tokens[1])
+		log.Println("Valid subcommands are: add, rm")
+		return errUsage
+	}
+}
+
+// example input: [share 3 alex sam] or [share 3 alex=20 sam=50%]
+func shareCmd(tokens []string) error {
+	if len(tokens) < 2 {
+		log.Println("Usage: share [wid] ([name](=amount or =percent%)...)")
+		log.Println("Use 'help share' for details")
+		return errUsage
+	}
+
+	v, err := fromWorkingList(tokens[1])
+	if err != nil {
+		return err
+	}
+	tr, ok := v.(omoney.Transaction)
+	if !ok {
+		return errors.New("wid does not point to a transaction")
+	}
+
+	if len(tokens) > 2 {
+		shares, err := ocli.BuildShares(tr.Amount, tokens[2:])
+		if err != nil {
+			return err
+		}
+		err = model.SetShares(tr.Id, shares)
+		if err != nil {
+			return err
+		}
+	}
+
+	shares, err := model.GetShares(tr.Id)
+	if err != nil {
+		return err
+	}
+	if len(shares) == 0 {
+		log.Printf("%s isn't shared with anyone\n", tr.Payee)
+		return nil
+	}
+	names := make([]string, 0, len(shares))
+	for name := range shares {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		log.Printf("%s: $%.2f of $%.2f\n", name, shares[name], tr.Amount)
+	}
+	return nil
+}
+
+// example input: [settle], [settle alex] or [settle alex checking 40]
+func settleCmd(tokens []string) error {
+	switch len(tokens) {
+	case 1:
+		balances, err := model.GetPersonBalances()
+		if err != nil {
+			return err
+		}
+		oview.ShowPersonBalances(balances)
+	case 2:
+		shared, err := model.GetSharedTransactions(tokens[1])
+		if err != nil {
+			return err
+		}
+		oview.ShowSharedTransactions(model, shared, len(workingList))
+		for i := range shared {
+			workingList = append(workingList, WorkTuple{"transaction", shared[i].Transaction.Id})
+		}
+	case 3, 4:
+		amount := 0.0
+		if len(tokens) == 4 {
+			var err error
+			amount, err = strconv.ParseFloat(strings.TrimPrefix(tokens[3], "$"), 64)
+			if err != nil || amount <= 0 {
+				return fmt.Errorf("unable to parse amount %s", tokens[3])
+			}
+		}
+		tr, err := model.Settle(tokens[1], tokens[2], amount, time.Now())
+		if err != nil {
+			return err
+		}
+		if tr.Amount < 0 {
+			log.Printf("Recorded $%.2f from %s\n", -tr.Amount, tokens[1])
+		} else {
+			log.Printf("Recorded $%.2f to %s\n", tr.Amount, tokens[1])
+		}
+		workingList = append(workingList, WorkTuple{"transaction", tr.Id})
+	default:
+		log.Println("Usage: settle (name) (acc) (amount)")
+		log.Println("Use 'help settle' for details")
+		return errUsage
+	}
+	return nil
+}
+
+// The ids of the transactions a selection of wids such as "3-10,14" points to
+func transactionIdsFromWids(input string) ([]string, error) {
+	wids, err := ocli.ParseWidSelection(input, len(workingList))
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(wids))
+	for i, wid := range wids {
+		v, err := fromWorkingList(strconv.Itoa(wid))
+		if err != nil {
+			return nil, err
+		}
+		tr, ok := v.(omoney.Transaction)
+		if !ok {
+			return nil, fmt.Errorf("wid %d does not point to a transaction", wid)
+		}
+		ids[i] = tr.Id
+	}
+	return ids, nil
+}
+
+// Show trs, adding them to the working list, followed by their total
+func showTransactionTotal(trs []omoney.Transaction) {
+	oview.ShowTransactions(trs, false, len(workingList))
+	total := 0.0
+	for i := range trs {
+		workingList = append(workingList, WorkTuple{"transaction", trs[i].Id})
+		total += trs[i].Amount
+	}
+	log.Printf("Total: $%.2f\n", total)
+}
+
+// example input: [reimburse], [reimburse 3-5] or [reimburse 4 off]
+func reimburseCmd(tokens []string) error {
+	switch {
+	case len(tokens) == 1:
+		trs, err := model.GetOutstandingReimbursements()
+		if err != nil {
+			return err
+		}
+		showTransactionTotal(trs)
+		return nil
+	case len(tokens) == 2 || (len(tokens) == 3 && tokens[2] == "off"):
+		ids, err := transactionIdsFromWids(tokens[1])
+		if err != nil {
+			return err
+		}
+		return model.SetReimbursable(ids, len(tokens) == 2)
+	default:
+		log.Println("Usage: reimburse ([wid/wids] (off))")
+		return errUsage
+	}
+}
+
+// example input: [report new conference] or [report add conference 3-5]
+func reportCmd(tokens []string) error {
+	if len(tokens) == 1 {
+		reports, err := model.GetExpenseReports()
+		if err != nil {
+			return err
+		}
+		oview.ShowExpenseReports(reports)
+		return nil
+	}
+	if len(tokens) == 2 || (len(tokens) == 4 && tokens[2] == "--where") {
+		var query *omoney.Query
+		if len(tokens) == 4 {
+			var err error
+			query, err = omoney.ParseQuery(tokens[3])
+			if err != nil {
+				return err
+			}
+		}
+		summary, err := model.GetReportSummary(tokens[1])
+		if err != nil {
+			return err
+		}
+		oview.ShowExpenseReports([]omoney.ReportSummary{summary})
+		trs, err := model.GetReportTransactions(tokens[1], query)
+		if err != nil {
+			return err
+		}
+		showTransactionTotal(trs)
+		return nil
+	}
+
+	switch tokens[1] {
+	case "new":
+		if len(tokens) != 3 {
+			log.Println("Usage: report new [name]")
+			return errUsage
+		}
+		_, err := model.AddExpenseReport(tokens[2])
+		return err
+	case "add":
+		if len(tokens) != 4 {
+			log.Println("Usage: report add [name] [wid/wids]")
+			return errUsage
+		}
+		ids, err := transactionIdsFromWids(tokens[3])
+		if err != nil {
+			return err
+		}
+		return model.AddToReport(tokens[2], ids)
+	case "match":
+		if len(tokens) != 4 {
+			log.Println("Usage: report match [name] [wid]")
+			return errUsage
+		}
+		v, err := fromWorkingList(tokens[3])
+		if err != nil {
+			return err
+		}
+		tr, ok := v.(omoney.Transaction)
+		if !ok {
+			return errors.New("wid does not point to a transaction")
+		}
+		return model.MatchReimbursement(tokens[2], tr.Id)
+	case "unmatch":
+		if len(tokens) != 3 {
+			log.Println("Usage: report unmatch [name]")
+			return errUsage
+		}
+		return model.UnmatchReimbursement(tokens[2])
+	case "rm":
+		if len(tokens) != 3 {
+			log.Println("Usage: report rm [name]")
+			return errUsage
+		}
+		return model.RemoveExpenseReport(tokens[2])
+	default:
+		log.Printf("Error: unknown subcommand %s\n", tokens[1])
+		log.Println("Valid subcommands are: new, add, match, unmatch, rm")
+		return errUsage
+	}
+}
+
+// Build the notifier chosen by alerts.notifier in the config
+func newNotifier() (ocli.Notifier, error) {
+	viper.SetDefault("alerts.notifier", "stdout")
+	viper.SetDefault("alerts.smtp.address", "localhost:25")
+	viper.SetDefault("alerts.smtp.from", "oregano@localhost")
+
+	switch kind := viper.GetString("alerts.notifier"); kind {
+	case "stdout":
+		return &ocli.StdoutNotifier{Out: os.Stdout}, nil
+	case "desktop":
+		return &ocli.DesktopNotifier{}, nil
+	case "smtp":
+		to := viper.GetStringSlice("alerts.smtp.to")
+		if len(to) == 0 {
+			return nil, errors.New("alerts.smtp.to must be set to send alerts by email")
+		}
+		return &ocli.SmtpNotifier{
+			Address: viper.GetString("alerts.smtp.address"),
+			From:    viper.GetString("alerts.smtp.from"),
+			To:      to,
+		}, nil
+	case "command":
+		command := viper.GetString("alerts.command")
+		if command == "" {
+			return nil, errors.New("alerts.command must be set to run a command for alerts")
+		}
+		return &ocli.CommandNotifier{Command: command}, nil
+	default:
+		return nil, fmt.Errorf("unknown alerts.notifier %s, expected one of stdout, desktop, smtp, command", kind)
+	}
+}
+
+// Send any alerts raised since the last time through the notifier
+func deliverAlerts() {
+	err := ocli.DeliverAlerts(model, notifier)
+	if err != nil {
+		log.Printf("Error delivering alerts: %s\n", err)
+	}
+}
+
+// Print every alert that hasn't been dismissed, then deliver any that
+// haven't been yet. Printing them is delivery enough when the
+// notifier prints too
+func showStartupAlerts() {
+	alerts, err := model.GetAlerts(false)
+	if err != nil {
+		log.Printf("Error checking alerts: %s\n", err)
+		return
+	}
+	_, printed := notifier.(*ocli.StdoutNotifier)
+	for _, alert := range alerts {
+		fmt.Printf("⚠️  %s\n", alert.Message)
+		if printed && !alert.Notified {
+			err = model.MarkAlertNotified(alert.Id)
+			if err != nil {
+				log.Printf("Error checking alerts: %s\n", err)
+			}
+		}
+	}
+	if len(alerts) > 0 {
+		fmt.Println("Use 'alert dismiss' to clear these alerts")
+	}
+	deliverAlerts()
+}
+
+func dbCmd(tokens []string) error {
+	if len(tokens) != 2 {
+		log.Println("Usage: db [status/backup/rollback]")
+		log.Println("Use 'help db' for details")
+		return errUsage
+	}
+
+	switch tokens[1] {
+	case "status":
+		ms, err := model.MigrationStatus()
+		if err != nil {
+			return err
+		}
+		applied := ms.Applied()
+		if len(applied) == 0 {
+			log.Println("Schema version: none")
+		} else {
+			// Applied() is sorted newest first
+			log.Printf("Schema version: %s\n", applied[0].Name)
+		}
+		oview.ShowMigrations(ms)
+	case "backup":
+		backup, err := model.BackupNextToDB()
+		if err != nil {
+			return err
+		}
+		log.Printf("Backed up database to %s\n", backup)
+	case "rollback":
+		ms, err := model.MigrationStatus()
+		if err != nil {
+			return err
+		}
+		last := ms.LastGroup()
+		if last.IsZero() {
+			log.Println("No migrations to roll back")
+			return nil
+		}
+
+		prompt := confirmation.New(
+			fmt.Sprintf("->Undo %s? Data in the affected tables and columns will be lost", last.Migrations),
+			confirmation.No,
+		)
+		prompt.Template = confirmation.TemplateYN
+		prompt.ResultTemplate = confirmation.ResultTemplateYN
+		ok, err := prompt.RunPrompt()
+		if err != nil || !ok {
+			return errors.New("rollback canceled")
+		}
+
+		backup, err := model.BackupNextToDB()
+		if err != nil {
+			return fmt.Errorf("failed to back up before rollback: %s", err)
+		}
+		log.Printf("Backed up database to %s\n", backup)
+
+		group, err := model.Rollback()
+		if err != nil {
+			return err
+		}
+		log.Printf("Rolled back %s\n", group.Migrations)
+		log.Println("Restart oregano to migrate back to the latest schema")
+	default:
+		log.Printf("Error: unknown subcommand %s\n", tokens[1])
+		log.Println("Valid subcommands are: status, backup, rollback")
+		return errUsage
+	}
+	return nil
+}
+
+// undo (n) / redo (n)
+func undoCmd(tokens []string) error {
+	n := 1
+	if len(tokens) == 2 {
+		var err error
+		n, err = strconv.Atoi(tokens[1])
+		if err != nil || n < 1 {
+			return fmt.Errorf("%s is not a valid number of changes", tokens[1])
+		}
+	} else if len(tokens) > 2 {
+		log.Printf("Usage: %s (n)\n", tokens[0])
+		return errUsage
+	}
+
+	var ops []omoney.Operation
+	var err error
+	verb := "Undid"
+	if tokens[0] == "undo" {
+		ops, err = model.Undo(n)
+	} else {
+		ops, err = model.Redo(n)
+		verb = "Redid"
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, op := range ops {
+		log.Printf("%s %s\n", verb, op.String())
+	}
+	return nil
+}
+
+// rekey (--key-file <path>)
+func rekeyCmd(tokens []string) error {
+	validFlags := map[string]int{
+		"--key-file": 1,
+	}
+
+	flags, err := ocli.ParseTokensToFlags(tokens, validFlags)
+	if err != nil {
+		log.Println("Fail to parse 'rekey' command")
+		log.Println("Usage: rekey (--key-file <path>)")
+		log.Println("Use 'help rekey' for details")
+		return errUsage
+	}
+
+	keyFile := ""
+	if path, ok := flags["--key-file"]; ok {
+		keyFile = path[0]
+	}
+
+	if !model.SecretsInitialized() {
+		err = setupSecrets(model, keyFile)
+		if err != nil {
+			return err
+		}
+		log.Println("Encrypted stored secrets with the new key")
+	} else {
+		material, err := readKeyMaterial("New passphrase", keyFile, true)
+		if err != nil {
+			return err
+		}
+
+		err = model.Rekey(material)
+		if err != nil {
+			return err
+		}
+		log.Println("Re-encrypted stored secrets with the new key")
+	}
+
+	if keyFile != "" && keyFile != viper.GetString("secrets.key_file") {
+		log.Printf("Set secrets.key_file to %s so that oregano can unlock at startup\n", keyFile)
+	}
+	return nil
+}
+
+func linkNewInstitution(model *omoney.Model, client *plaid.APIClient, countries []string, lang string) {
+	// Build a linker struct to run Plaid Link
+	linker := ocli.NewLinker(client, countries, lang)
+	port := viper.GetString("link.port")
+
+	// Attempt to run link in a browser window
+	var tokenPair *ocli.TokenPair
+	tokenPair, err := linker.Link(port)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	log.Println("Institution linked!")
+	log.Printf("Item ID: %s\n", tokenPair.ItemID)
 
 	acc := omoney.NewAccount(
 		omoney.WithPlaidIds(tokenPair.ItemID, tokenPair.AccessToken),
@@ -702,8 +2432,162 @@ func linkNewInstitution(model *omoney.Model, client *plaid.APIClient, countries
 		acc.Alias = input
 	}
 
-	// Store the long term access token from plaid
-	model.AddAccount(*acc)
+	// Store the long term access token from plaid, which asks for
+	// the key it will be encrypted with if it hasn't been yet
+	err = model.AddAccount(*acc)
+	if err != nil {
+		log.Fatalln(err)
+	}
+}
+
+// Unlock m's encrypted secrets using the configured key file, or by asking
+// for the passphrase. If encryption hasn't been set up yet, set it up
+// instead, encrypting any secrets stored before it existed
+func unlockSecrets(m *omoney.Model) error {
+	keyFile := viper.GetString("secrets.key_file")
+
+	if !m.SecretsInitialized() {
+		if !m.HasPlaintextSecrets() {
+			log.Println("Choose a passphrase to encrypt Plaid access tokens with")
+		} else {
+			log.Println("⚠️  Plaid access tokens are stored unencrypted. Choose a passphrase to encrypt them with")
+		}
+		return setupSecrets(m, keyFile)
+	}
+
+	for attempt := 0; attempt < 3; attempt++ {
+		material, err := readKeyMaterial("Passphrase to unlock Plaid access tokens", keyFile, false)
+		if err != nil {
+			return err
+		}
+
+		err = m.Unlock(material)
+		if err != omoney.ErrWrongPassphrase || keyFile != "" {
+			return err
+		}
+		log.Println("Incorrect passphrase")
+	}
+	return errors.New("too many incorrect passphrases")
+}
+
+func setupSecrets(m *omoney.Model, keyFile string) error {
+	material, err := readKeyMaterial("New passphrase", keyFile, true)
+	if err != nil {
+		return err
+	}
+	return m.InitSecrets(material)
+}
+
+// Read the contents of keyFile if set, otherwise prompt for a passphrase,
+// asking twice if confirm is set
+func readKeyMaterial(label string, keyFile string, confirm bool) ([]byte, error) {
+	if keyFile != "" {
+		return os.ReadFile(keyFile)
+	}
+
+	prompt := promptui.Prompt{Label: label, Mask: '*'}
+	passphrase, err := prompt.Run()
+	if err != nil {
+		return nil, err
+	}
+
+	if confirm {
+		prompt = promptui.Prompt{Label: "Confirm passphrase", Mask: '*'}
+		again, err := prompt.Run()
+		if err != nil {
+			return nil, err
+		}
+		if again != passphrase {
+			return nil, errors.New("passphrases do not match")
+		}
+	}
+
+	return []byte(passphrase), nil
+}
+
+func startWebhookReceiver(ctx context.Context, client *plaid.APIClient) {
+	var keys ocli.VerificationKeySource
+	if keyFile := viper.GetString("webhook.key_file"); keyFile != "" {
+		keys = &ocli.FileKeySource{Path: keyFile}
+	} else if client != nil {
+		keys = &ocli.PlaidKeySource{Client: client}
+	} else {
+		log.Println("⚠️  Webhooks require Plaid to be enabled or webhook.key_file to be set. Not listening for webhooks.")
+		return
+	}
+
+	// syncs happen in the background, where they can't stop to ask
+	// for the passphrase, so unlock now
+	if client != nil && model.SecretsInitialized() && !model.IsUnlocked() {
+		err := unlockSecrets(model)
+		if err != nil {
+			log.Printf("⚠️  %s. Not listening for webhooks.\n", err)
+			return
+		}
+	}
+
+	onSync := func(itemId string) error {
+		if client == nil {
+			log.Printf("Plaid has new transactions for %s, but sync is unavailable while Plaid integration is disabled\n", itemId)
+			return nil
+		}
+		// synced in the background while the prompt is open, so kept
+		// out of the journal the user undoes and redoes from
+		result, err := ocli.SyncItem(ctx, client, model.Unjournaled(), itemId)
+		if err != nil {
+			return err
+		}
+		log.Printf("Synced %s: %d added, %d modified, %d removed\n",
+			itemId, result.Added, result.Modified, result.Removed)
+		deliverAlerts()
+		return nil
+	}
+
+	onRelink := func(itemId string, needsRelink bool) error {
+		if needsRelink {
+			log.Printf("⚠️  %s needs to be relinked\n", itemId)
+		}
+		return model.SetNeedsRelink(itemId, needsRelink)
+	}
+
+	receiver := ocli.NewWebhookReceiver(keys, onSync, onRelink)
+	receiver.Listen(viper.GetString("webhook.port"))
+}
+
+// Serve the model over the REST API until interrupted
+func serveCmd() {
+	viper.SetDefault("server.address", "127.0.0.1")
+	viper.SetDefault("server.port", "8082")
+
+	token := viper.GetString("server.token")
+	if token == "" {
+		buf := make([]byte, 24)
+		_, err := rand.Read(buf)
+		if err != nil {
+			log.Fatal(err)
+		}
+		token = hex.EncodeToString(buf)
+		log.Printf("No server.token configured, generated one for this session: %s\n", token)
+		log.Println("Set server.token in config.json or SERVER_TOKEN to keep it between sessions")
+	}
+
+	server := ocli.NewApiServer(model, token)
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-interrupt
+		log.Println("Shutting down API server...")
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	}()
+
+	addr := net.JoinHostPort(viper.GetString("server.address"), viper.GetString("server.port"))
+	err := server.ListenAndServe(addr)
+	if err != nil {
+		log.Fatal(err)
+	}
 }
 
 func fromWorkingList(input string) (interface{}, error) {
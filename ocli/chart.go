@@ -0,0 +1,197 @@
+package ocli
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"golang.org/x/term"
+)
+
+// Charts are drawn with block characters, so that they line up with
+// lipgloss tables and can be joined with them
+
+// Eighths of a block, for the end of a bar
+var barEighths = []string{"", "▏", "▎", "▍", "▌", "▋", "▊", "▉"}
+
+// Heights of a sparkline, lowest first
+var sparkLevels = []rune("▁▂▃▄▅▆▇█")
+
+// How each series of a stacked bar is filled when there is no color
+var stackFills = []string{"█", "▓", "▒", "░", "▚", "▞", "▪", "◆"}
+
+// The colors of each series of a stacked bar
+var stackColors = []lipgloss.Color{"12", "10", "11", "13", "14", "9", "208", "141"}
+
+// Charts never get narrower than this, even in a tiny terminal
+const minChartWidth = 20
+
+// The width of the terminal, or of $COLUMNS, or 80 if neither is known
+func terminalWidth() int {
+	if w, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil && w > 0 {
+		return w
+	}
+	if w, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && w > 0 {
+		return w
+	}
+	return 80
+}
+
+// A horizontal bar width cells long at most, scaled so that max fills it
+func bar(value float64, max float64, width int) string {
+	if max <= 0 || value <= 0 || width <= 0 {
+		return ""
+	}
+	eighths := int(math.Round(math.Min(value/max, 1) * float64(width) * 8))
+	return strings.Repeat("█", eighths/8) + barEighths[eighths%8]
+}
+
+// The longest of labels, in cells
+func labelWidth(labels []string) int {
+	width := 0
+	for _, l := range labels {
+		width = max(width, lipgloss.Width(l))
+	}
+	return width
+}
+
+// One bar per label, as long as its value relative to the largest,
+// followed by the value. Bars fill what width leaves after the labels
+// and values. Negative values are drawn as empty bars
+func BarChart(labels []string, values []float64, width int) string {
+	texts := make([]string, len(values))
+	largest := 0.0
+	for i, v := range values {
+		texts[i] = fmt.Sprintf("$%.2f", v)
+		largest = math.Max(largest, v)
+	}
+	lw := labelWidth(labels)
+	barWidth := max(width-lw-labelWidth(texts)-2, minChartWidth)
+
+	var b strings.Builder
+	for i, l := range labels {
+		b.WriteString(lipgloss.NewStyle().Width(lw).Render(l))
+		b.WriteString(" ")
+		b.WriteString(bar(values[i], largest, barWidth))
+		b.WriteString(" ")
+		b.WriteString(texts[i])
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// Shrink values to at most width of them, averaging each run of
+// values that become one
+func resample(values []float64, width int) []float64 {
+	if len(values) <= width || width <= 0 {
+		return values
+	}
+	out := make([]float64, width)
+	for i := range out {
+		from := i * len(values) / width
+		to := (i + 1) * len(values) / width
+		sum := 0.0
+		for _, v := range values[from:to] {
+			sum += v
+		}
+		out[i] = sum / float64(to-from)
+	}
+	return out
+}
+
+// A line of block characters from low to high, one per value, between
+// the smallest and largest of values. More values than width are
+// averaged together to fit
+func Sparkline(values []float64, width int) string {
+	values = resample(values, width)
+	if len(values) == 0 {
+		return ""
+	}
+	low, high := values[0], values[0]
+	for _, v := range values {
+		low = math.Min(low, v)
+		high = math.Max(high, v)
+	}
+
+	line := make([]rune, len(values))
+	for i, v := range values {
+		level := 0
+		if high > low {
+			level = int(math.Round((v - low) / (high - low) * float64(len(sparkLevels)-1)))
+		}
+		line[i] = sparkLevels[level]
+	}
+	return string(line)
+}
+
+// One bar per label made of a segment for each series, with values[i][j]
+// being the size of series j in bar i, followed by the bar's total and a
+// legend. Bars are scaled so the largest total fills what width leaves.
+// Series are told apart by color, or by fill pattern without it
+func StackedBars(labels []string, series []string, values [][]float64, width int, color bool) string {
+	totals := make([]float64, len(labels))
+	texts := make([]string, len(labels))
+	largest := 0.0
+	for i := range labels {
+		for _, v := range values[i] {
+			totals[i] += math.Max(v, 0)
+		}
+		texts[i] = fmt.Sprintf("$%.2f", totals[i])
+		largest = math.Max(largest, totals[i])
+	}
+	lw := labelWidth(labels)
+	barWidth := max(width-lw-labelWidth(texts)-2, minChartWidth)
+
+	segment := func(j int, cells int) string {
+		if color {
+			style := lipgloss.NewStyle().Foreground(stackColors[j%len(stackColors)])
+			return style.Render(strings.Repeat("█", cells))
+		}
+		return strings.Repeat(stackFills[j%len(stackFills)], cells)
+	}
+
+	var b strings.Builder
+	for i, l := range labels {
+		b.WriteString(lipgloss.NewStyle().Width(lw).Render(l))
+		b.WriteString(" ")
+		// round where each segment ends rather than each segment's
+		// length, so that the bar's length matches its total
+		drawn, sum := 0, 0.0
+		for j := range series {
+			if largest <= 0 {
+				break
+			}
+			sum += math.Max(values[i][j], 0)
+			end := int(math.Round(sum / largest * float64(barWidth)))
+			if end > drawn {
+				b.WriteString(segment(j, end-drawn))
+				drawn = end
+			}
+		}
+		b.WriteString(" ")
+		b.WriteString(texts[i])
+		b.WriteString("\n")
+	}
+
+	// the legend wraps to fit width
+	line := ""
+	for j, s := range series {
+		if s == "" {
+			s = "uncategorized"
+		}
+		entry := segment(j, 1) + " " + s
+		if line != "" && lipgloss.Width(line)+2+lipgloss.Width(entry) > width {
+			b.WriteString(line + "\n")
+			line = ""
+		}
+		if line != "" {
+			line += "  "
+		}
+		line += entry
+	}
+	b.WriteString(line + "\n")
+	return b.String()
+}
@@ -0,0 +1,58 @@
+package ocli
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+func TestSparkline(t *testing.T) {
+	have := Sparkline([]float64{0, 7, 3.5, 7}, 10)
+	if have != "▁█▅█" {
+		t.Fatalf("Sparkline failed\nhave: %s\nneed: ▁█▅█", have)
+	}
+	// averaged down to fit
+	have = Sparkline([]float64{0, 0, 4, 4, 8, 8}, 3)
+	if have != "▁▅█" {
+		t.Fatalf("Sparkline failed\nhave: %s\nneed: ▁▅█", have)
+	}
+	if have = Sparkline([]float64{5, 5}, 10); have != "▁▁" {
+		t.Fatalf("Sparkline failed\nhave: %s\nneed: ▁▁", have)
+	}
+}
+
+func TestBarChartFitsWidth(t *testing.T) {
+	chart := BarChart([]string{"groceries", "rent"}, []float64{300, 1200}, 50)
+	lines := strings.Split(strings.TrimSuffix(chart, "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("BarChart failed\nhave: %q\nneed: 2 lines", chart)
+	}
+	// the largest fills the width exactly
+	if w := lipgloss.Width(lines[1]); w != 50 {
+		t.Fatalf("BarChart failed\nhave: width %d\nneed: width 50", w)
+	}
+	if !strings.HasPrefix(lines[0], "groceries ") || !strings.HasSuffix(lines[0], " $300.00") {
+		t.Fatalf("BarChart failed\nhave: %q", lines[0])
+	}
+}
+
+func TestStackedBars(t *testing.T) {
+	chart := StackedBars(
+		[]string{"2024/01", "2024/02"},
+		[]string{"rent", ""},
+		[][]float64{{100, 100}, {100, 0}},
+		40, false)
+	lines := strings.Split(strings.TrimSuffix(chart, "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("StackedBars failed\nhave: %q\nneed: 2 bars and a legend", chart)
+	}
+	// 40 less the label, total and spaces leaves 24 cells for the largest
+	full := strings.Count(lines[0], stackFills[0]) + strings.Count(lines[0], stackFills[1])
+	if full != 24 || strings.Count(lines[1], stackFills[0]) != 12 {
+		t.Fatalf("StackedBars failed\nhave: %q", chart)
+	}
+	if lines[2] != stackFills[0]+" rent  "+stackFills[1]+" uncategorized" {
+		t.Fatalf("StackedBars failed\nhave: legend %q", lines[2])
+	}
+}
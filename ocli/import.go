@@ -26,15 +26,20 @@ const (
 	sInstDesc      = "Institution Description"
 	sDesc          = "Description"
 	sDir           = "Direction (Debit/Credit)"
+	sStatus        = "Status (Pending/Posted)"
 )
 
 // Given the path to a csv file, and the map existingAccounts of alias -> id,
-// interactively parse the csv file into a slice of transaction structs
-func ReadCsv(filepath string, existingAccounts map[string]string) []*omoney.Transaction {
+// parse the csv file into a slice of transaction structs.
+//
+// If profile already holds a column mapping, it is used without asking
+// anything, and unknown account names are an error. Otherwise the mapping
+// is built interactively and, if profile is not nil, the answers are
+// stored in it so that it can be saved for next time
+func ReadCsv(filepath string, existingAccounts map[string]string, profile *omoney.ImportProfile) ([]*omoney.Transaction, error) {
 	f, err := os.Open(filepath)
 	if err != nil {
-		fmt.Printf("Error: %s\n", err)
-		return nil
+		return nil, err
 	}
 
 	defer f.Close()
@@ -42,84 +47,31 @@ func ReadCsv(filepath string, existingAccounts map[string]string) []*omoney.Tran
 	csvReader := csv.NewReader(f)
 	records, err := csvReader.ReadAll()
 	if err != nil {
-		fmt.Printf("Error: %s\n", err)
-		return nil
+		return nil, err
 	}
-
-	headerPrompt := confirmation.New(
-		fmt.Sprintf("->Are these headers for your file? [(%s, %s, %s)", records[0][0], records[0][1], records[0][2]),
-		confirmation.No,
-	)
-	headerPrompt.Template = confirmation.TemplateYN
-	headerPrompt.ResultTemplate = confirmation.ResultTemplateYN
-	headers, err := headerPrompt.RunPrompt()
-	if err != nil {
-		fmt.Printf("Error: %v\n", err)
-		return nil
+	if len(records) == 0 {
+		return nil, errors.New("file has no rows")
 	}
 
-	// loop until columns are accepted as correct
-	var colMap map[string]int
-	for {
-		colMap, err = buildColumnMap(records, headers)
-		if err != nil {
-			fmt.Printf("Leaving import setup: %s\n", err)
-			return nil
-		}
-		// fmt.Println(colMap)
-
-		var rowIdx int
-		if headers {
-			rowIdx = 1
-		} else {
-			rowIdx = 0
-		}
-
-		canContinue := false
-		tr, err := tryBuildTransaction(records[rowIdx], colMap)
-		if err != nil {
-			fmt.Printf("Error: %s\n", err)
-		} else {
-			fmt.Printf("The first transaction was parsed into:\n%s\n", tr)
-			canContinue = true
-		}
-
-		var restartStr string
-		if canContinue {
-			restartStr = "->Reassign columns? (No will begin processing)"
-		} else {
-			restartStr = "->Could not assign columns. Retry column assignment?"
-		}
+	interactive := profile == nil || len(profile.Columns) == 0
 
-		restartPrompt := confirmation.New(restartStr,
-			confirmation.NewValue(true))
-		restartPrompt.Template = confirmation.TemplateYN
-		restartPrompt.ResultTemplate = confirmation.ResultTemplateYN
-
-		response, err := restartPrompt.RunPrompt()
+	var headers bool
+	var colMap map[string]int
+	accMap := make(map[string]string, 0) // name in csv -> accountId in model
+	if interactive {
+		headers, colMap, err = promptColumns(records)
 		if err != nil {
-			fmt.Printf("Something went wrong with the prompt: %v\n", err)
-			return nil
+			return nil, err
 		}
-
-		if !response {
-			if canContinue {
-				// said no to reassign when columns could be parsed
-				// so break the loop to start actually parsing
-				break
-			} else {
-				// said no to reassign when columns could not be parsed
-				// so cancel the import
-				fmt.Println("Canceling import...")
-				return nil
-			}
+	} else {
+		headers = profile.Headers
+		colMap = profile.Columns
+		for name, id := range profile.Accounts {
+			accMap[name] = id
 		}
-		// else said yes to reassign, so let the loop restart
-
 	}
 	fmt.Println("Processing...")
 
-	accMap := make(map[string]string, 0) // name in csv -> accountId in model
 	newTrans := make([]*omoney.Transaction, 0)
 
 	var recordsRange [][]string
@@ -150,6 +102,8 @@ func ReadCsv(filepath string, existingAccounts map[string]string) []*omoney.Tran
 				// if a known match exists, change it to that match
 				tr.AccountId = matchedAcc
 
+			} else if !interactive {
+				return nil, fmt.Errorf("account '%s' in file doesn't match known accounts or the profile", tr.AccountId)
 			} else {
 				// else ask what the match should be, store it, and set it
 				keymap := selection.NewDefaultKeyMap()
@@ -163,8 +117,7 @@ func ReadCsv(filepath string, existingAccounts map[string]string) []*omoney.Tran
 
 				chosenAlias, err := sel.RunPrompt()
 				if err != nil {
-					fmt.Println("Import canceled")
-					return nil
+					return nil, errors.New("import canceled")
 				}
 
 				chosenId := existingAccounts[chosenAlias]
@@ -176,7 +129,83 @@ func ReadCsv(filepath string, existingAccounts map[string]string) []*omoney.Tran
 		newTrans = append(newTrans, tr)
 	}
 
-	return newTrans
+	if interactive && profile != nil {
+		profile.Headers = headers
+		profile.Columns = colMap
+		profile.Accounts = accMap
+	}
+
+	return newTrans, nil
+}
+
+// Ask whether the file has headers and which column holds each field,
+// until the first row parses and the user accepts it
+func promptColumns(records [][]string) (bool, map[string]int, error) {
+	headerPrompt := confirmation.New(
+		fmt.Sprintf("->Are these headers for your file? [(%s, %s, %s)", records[0][0], records[0][1], records[0][2]),
+		confirmation.No,
+	)
+	headerPrompt.Template = confirmation.TemplateYN
+	headerPrompt.ResultTemplate = confirmation.ResultTemplateYN
+	headers, err := headerPrompt.RunPrompt()
+	if err != nil {
+		return false, nil, err
+	}
+
+	// loop until columns are accepted as correct
+	for {
+		colMap, err := buildColumnMap(records, headers)
+		if err != nil {
+			return false, nil, fmt.Errorf("leaving import setup: %s", err)
+		}
+
+		var rowIdx int
+		if headers {
+			rowIdx = 1
+		} else {
+			rowIdx = 0
+		}
+
+		canContinue := false
+		tr, err := tryBuildTransaction(records[rowIdx], colMap)
+		if err != nil {
+			fmt.Printf("Error: %s\n", err)
+		} else {
+			fmt.Printf("The first transaction was parsed into:\n%s\n", tr)
+			canContinue = true
+		}
+
+		var restartStr string
+		if canContinue {
+			restartStr = "->Reassign columns? (No will begin processing)"
+		} else {
+			restartStr = "->Could not assign columns. Retry column assignment?"
+		}
+
+		restartPrompt := confirmation.New(restartStr,
+			confirmation.NewValue(true))
+		restartPrompt.Template = confirmation.TemplateYN
+		restartPrompt.ResultTemplate = confirmation.ResultTemplateYN
+
+		response, err := restartPrompt.RunPrompt()
+		if err != nil {
+			return false, nil, fmt.Errorf("something went wrong with the prompt: %v", err)
+		}
+
+		if !response {
+			if canContinue {
+				// said no to reassign when columns could be parsed
+				// so start actually parsing
+				return headers, colMap, nil
+			} else {
+				// said no to reassign when columns could not be parsed
+				// so cancel the import
+				return false, nil, errors.New("import canceled")
+			}
+		}
+		// else said yes to reassign, so let the loop restart
+
+	}
 }
 
 func buildColumnMap(records [][]string, headers bool) (map[string]int, error) {
@@ -185,7 +214,7 @@ func buildColumnMap(records [][]string, headers bool) (map[string]int, error) {
 	keymap.Down = append(keymap.Down, "j")
 
 	unmatchedFields := []string{sTransactionID, sAccount, sPayee, sAmount,
-		sDate, sCategory, sInstDesc, sDesc, sDir}
+		sDate, sCategory, sInstDesc, sDesc, sDir, sStatus}
 	colMap := make(map[string]int, 0)
 	colIdx := 0
 	for colIdx < len(records[0]) {
@@ -288,6 +317,14 @@ func tryBuildTransaction(record []string, colMap map[string]int) (*omoney.Transa
 		ops = append(ops, omoney.WithDescription(desc))
 	}
 
+	if statusCol, ok := colMap[sStatus]; ok && record[statusCol] != "" {
+		status, err := omoney.ParseTransactionStatus(strings.TrimSpace(record[statusCol]))
+		if err != nil {
+			return nil, fmt.Errorf("could not parse 'Status' column: %s", err)
+		}
+		ops = append(ops, omoney.WithStatus(status))
+	}
+
 	var mul float64
 	if dirCol, ok := colMap[sDir]; ok {
 		dir := record[dirCol]
@@ -326,3 +363,56 @@ func removeElement(s []string, element string) []string {
 func collapseWhitepace(s string) string {
 	return strings.Join(strings.Fields(s), " ")
 }
+
+// Given the path to a csv file of security prices, with the columns
+// symbol, date, price, and optionally the security's name, parse it
+// into prices and a map of symbol -> name for rows that had one.
+// A first row that doesn't have a price in it is taken as headers
+func ReadPricesCsv(filepath string) ([]omoney.SecurityPrice, map[string]string, error) {
+	f, err := os.Open(filepath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer f.Close()
+
+	csvReader := csv.NewReader(f)
+	csvReader.FieldsPerRecord = -1
+	records, err := csvReader.ReadAll()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil, errors.New("file has no rows")
+	}
+	if len(records[0]) >= 3 {
+		if _, err := strconv.ParseFloat(strings.TrimSpace(records[0][2]), 64); err != nil {
+			records = records[1:]
+		}
+	}
+
+	prices := make([]omoney.SecurityPrice, 0, len(records))
+	names := make(map[string]string)
+	for i, rec := range records {
+		if len(rec) < 3 {
+			return nil, nil, fmt.Errorf("row %d: need symbol, date, and price", i+1)
+		}
+		symbol := strings.ToUpper(strings.TrimSpace(rec[0]))
+		if symbol == "" {
+			return nil, nil, fmt.Errorf("row %d: missing symbol", i+1)
+		}
+		date, err := dateparse.ParseLocal(strings.TrimSpace(rec[1]))
+		if err != nil {
+			return nil, nil, fmt.Errorf("row %d: %w", i+1, err)
+		}
+		price, err := strconv.ParseFloat(strings.TrimPrefix(strings.TrimSpace(rec[2]), "$"), 64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("row %d: %w", i+1, err)
+		}
+		if len(rec) > 3 && strings.TrimSpace(rec[3]) != "" {
+			names[symbol] = strings.TrimSpace(rec[3])
+		}
+		prices = append(prices, omoney.SecurityPrice{Symbol: symbol, Date: date, Price: price})
+	}
+	return prices, names, nil
+}
@@ -0,0 +1,97 @@
+package ocli
+
+import (
+	"fmt"
+	"io"
+	"net/smtp"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dknelson9876/oregano/omoney"
+)
+
+// Somewhere to deliver alerts to
+type Notifier interface {
+	Notify(alert omoney.Alert) error
+}
+
+// Prints alerts
+type StdoutNotifier struct {
+	Out io.Writer
+}
+
+func (n *StdoutNotifier) Notify(alert omoney.Alert) error {
+	_, err := fmt.Fprintf(n.Out, "⚠️  %s\n", alert.Message)
+	return err
+}
+
+// Shows alerts as desktop notifications with notify-send
+type DesktopNotifier struct{}
+
+func (n *DesktopNotifier) Notify(alert omoney.Alert) error {
+	return exec.Command("notify-send", "--app-name=oregano", "Oregano", alert.Message).Run()
+}
+
+// Emails alerts through an SMTP server, usually one running locally
+// that doesn't need a login
+type SmtpNotifier struct {
+	// host:port of the server
+	Address string
+	From    string
+	To      []string
+}
+
+func (n *SmtpNotifier) Notify(alert omoney.Alert) error {
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: Oregano: %s\r\nDate: %s\r\n\r\n%s\r\n",
+		n.From,
+		strings.Join(n.To, ", "),
+		alert.Message,
+		alert.Time.Format(time.RFC1123Z),
+		alert.Message)
+	return smtp.SendMail(n.Address, nil, n.From, n.To, []byte(msg))
+}
+
+// Runs a shell command for each alert, with the alert in the
+// environment as OREGANO_ALERT_ID, OREGANO_ALERT_MESSAGE and
+// OREGANO_ALERT_TRANSACTION, and the message on stdin
+type CommandNotifier struct {
+	Command string
+}
+
+func (n *CommandNotifier) Notify(alert omoney.Alert) error {
+	cmd := exec.Command("sh", "-c", n.Command)
+	cmd.Env = append(os.Environ(),
+		"OREGANO_ALERT_ID="+strconv.FormatInt(alert.Id, 10),
+		"OREGANO_ALERT_MESSAGE="+alert.Message,
+		"OREGANO_ALERT_TRANSACTION="+alert.TransactionId,
+	)
+	cmd.Stdin = strings.NewReader(alert.Message + "\n")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("alert command failed: %s: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// Deliver every alert that hasn't been yet, marking each as delivered
+// once it is. Stops at the first that fails, to try again later
+func DeliverAlerts(model *omoney.Model, notifier Notifier) error {
+	alerts, err := model.GetUnnotifiedAlerts()
+	if err != nil {
+		return err
+	}
+	for _, alert := range alerts {
+		err = notifier.Notify(alert)
+		if err != nil {
+			return err
+		}
+		err = model.MarkAlertNotified(alert.Id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
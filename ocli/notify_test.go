@@ -0,0 +1,85 @@
+package ocli
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dknelson9876/oregano/omoney"
+)
+
+// Fails after delivering a number of alerts
+type flakyNotifier struct {
+	delivered []string
+	failAfter int
+}
+
+func (n *flakyNotifier) Notify(alert omoney.Alert) error {
+	if len(n.delivered) == n.failAfter {
+		return errors.New("server down")
+	}
+	n.delivered = append(n.delivered, alert.Message)
+	return nil
+}
+
+func TestDeliverAlerts(t *testing.T) {
+	model, err := LoadModelFromDB(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	acc := omoney.NewAccount(omoney.WithAlias("chase"), omoney.WithAccountType(omoney.Checking))
+	model.AddAccount(*acc)
+	err = model.AddAlertRule(&omoney.AlertRule{Kind: omoney.AlertLarge, Amount: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, payee := range []string{"Rent", "Laptop"} {
+		tr := omoney.NewTransaction(acc.Id, payee, 1000, omoney.WithDate(time.Date(2024, 01, 1, 0, 0, 0, 0, time.Local)))
+		err = model.AddTransaction(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// what failed is tried again next time, and nothing is sent twice
+	n := &flakyNotifier{failAfter: 1}
+	if err := DeliverAlerts(model, n); err == nil {
+		t.Fatal("DeliverAlerts should pass along the notifier's error")
+	}
+	n.failAfter = 10
+	err = DeliverAlerts(model, n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(n.delivered) != 2 || !strings.Contains(n.delivered[0], "Rent") || !strings.Contains(n.delivered[1], "Laptop") {
+		t.Fatalf("DeliverAlerts failed\nhave: %v\nneed: Rent, then Laptop", n.delivered)
+	}
+}
+
+func TestStdoutAndCommandNotifiers(t *testing.T) {
+	alert := omoney.Alert{Id: 7, Message: "dining is over budget", TransactionId: "abc"}
+
+	var out bytes.Buffer
+	err := (&StdoutNotifier{Out: &out}).Notify(alert)
+	if err != nil || !strings.Contains(out.String(), "dining is over budget") {
+		t.Fatalf("StdoutNotifier failed\nhave: %q (%v)", out.String(), err)
+	}
+
+	path := filepath.Join(t.TempDir(), "alerts")
+	err = (&CommandNotifier{Command: `cat > "` + path + `"; echo "$OREGANO_ALERT_ID" >> "` + path + `"`}).Notify(alert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := os.ReadFile(path)
+	if string(b) != "dining is over budget\n7\n" {
+		t.Fatalf("CommandNotifier failed\nhave: %q\nneed: the message, then the alert id", string(b))
+	}
+
+	if err := (&CommandNotifier{Command: "exit 3"}).Notify(alert); err == nil {
+		t.Fatal("A failing command should be an error")
+	}
+}
@@ -3,6 +3,8 @@ package ocli
 import (
 	"errors"
 	"fmt"
+	"math"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -12,27 +14,53 @@ import (
 )
 
 func CreateManualAccount(input []string) *omoney.Account {
-	if len(input) < 2 {
-		fmt.Println("Error: new account requires exactly 2 arguments")
-		fmt.Println("Usage: new account [alias] [type]")
+	acc, err := BuildManualAccount(input)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err)
+		if len(input) < 2 {
+			fmt.Println("Usage: new account [alias] [type]")
+		}
 		return nil
 	}
+	return acc
+}
+
+// Validate input of the form [alias] [type] and build the account it describes
+func BuildManualAccount(input []string) (*omoney.Account, error) {
+	if len(input) < 2 {
+		return nil, errors.New("new account requires exactly 2 arguments")
+	}
 	alias := input[0]
 	accType, err := omoney.ParseAccountType(input[1])
 	if err != nil {
-		fmt.Printf("Error: %s\n", err)
-		return nil
+		return nil, err
 	}
 
 	return omoney.NewAccount(
 		omoney.WithAlias(alias),
 		omoney.WithAccountType(accType),
-	)
+	), nil
 }
 
 func CreateManualTransaction(input []string) *omoney.Transaction {
+	tr, err := BuildManualTransaction(input)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err)
+		return nil
+	}
+	return tr
+}
+
+// Validate input of the form used by `new tr` (without the leading
+// 'new tr') and build the transaction it describes
+func BuildManualTransaction(input []string) (*omoney.Transaction, error) {
 	// new tr [acc] [payee] [amount] (date) (cat)
 	//      (desc) (-t/--time date) (-c/--category cat) (-d/--description desc)
+	//      (-s/--status status)
+
+	if len(input) < 3 {
+		return nil, errors.New("a transaction requires an account, payee, and amount")
+	}
 
 	acc := input[0]
 
@@ -40,53 +68,53 @@ func CreateManualTransaction(input []string) *omoney.Transaction {
 
 	amount, err := strconv.ParseFloat(input[2], 64)
 	if err != nil {
-		fmt.Printf("Error: Unable to parse amount %s\n", input[1])
-		return nil
+		return nil, fmt.Errorf("unable to parse amount %s", input[2])
 	}
 
 	var date time.Time
 	dateFound := false
 	cat := ""
 	desc := ""
+	status := omoney.Posted
 	endPositional := false
 	i := 3
 	for i < len(input) {
 		if strings.HasPrefix(input[i], "-") {
 			endPositional = true
 			if i+1 == len(input) {
-				fmt.Println("Error: Found flag with no value at end of command")
-				return nil
+				return nil, errors.New("found flag with no value at end of command")
 			}
 			switch input[i] {
 			case "-t", "--time":
 				date, err = dateparse.ParseLocal(input[i+1])
 				if err != nil {
-					fmt.Printf("Error: Unable to parse datetime %s\n", input[i+1])
-					return nil
+					return nil, fmt.Errorf("unable to parse datetime %s", input[i+1])
 				}
 				dateFound = true
 			case "-c", "--category":
 				cat = input[i+1]
 			case "-d", "--description":
 				desc = input[i+1]
+			case "-s", "--status":
+				status, err = omoney.ParseTransactionStatus(input[i+1])
+				if err != nil {
+					return nil, err
+				}
 			default:
-				fmt.Printf("Error: Unrecognized flag %s\n", input[i])
-				return nil
+				return nil, fmt.Errorf("unrecognized flag %s", input[i])
 			}
 			i += 2
 		} else {
 			if endPositional {
 				// found positional arg, after using flag. Ambiguous, so fail
-				fmt.Printf("Error: Positional argument after using flag. Cannot parse new transaction\n")
-				return nil
+				return nil, errors.New("positional argument after using flag. Cannot parse new transaction")
 			} else {
 				// still on positional args
 				switch i {
 				case 3:
 					date, err = dateparse.ParseLocal(input[3])
 					if err != nil {
-						fmt.Printf("Error: Unable to parse datetime %s\n", input[3])
-						return nil
+						return nil, fmt.Errorf("unable to parse datetime %s", input[3])
 					}
 					dateFound = true
 				case 4:
@@ -94,8 +122,7 @@ func CreateManualTransaction(input []string) *omoney.Transaction {
 				case 5:
 					desc = input[5]
 				default:
-					fmt.Println("ERROR: this should be unreachable, unless a missed an earlier check")
-					return nil
+					return nil, errors.New("too many positional arguments")
 				}
 				i++
 			}
@@ -109,7 +136,413 @@ func CreateManualTransaction(input []string) *omoney.Transaction {
 	return omoney.NewTransaction(acc, payee, amount,
 		omoney.WithDate(date),
 		omoney.WithCategory(cat),
-		omoney.WithDescription(desc))
+		omoney.WithDescription(desc),
+		omoney.WithStatus(status)), nil
+}
+
+// Validate input of the form used by `invest buy/sell/dividend/split`
+// (without the leading 'invest') and build the event it describes
+func BuildInvestmentEvent(input []string) (*omoney.InvestmentEvent, error) {
+	// buy [acc] [symbol] [shares] [price] (-t/--time date) (-f/--fees fees)
+	// sell [acc] [symbol] [shares] [price] (-t/--time date) (-f/--fees fees)
+	//      (-m/--method fifo/lifo) (-l/--lots lot:shares,...)
+	// dividend [acc] [symbol] [amount] (-t/--time date)
+	// split [acc] [symbol] [new:old] (-t/--time date)
+
+	if len(input) == 0 {
+		return nil, errors.New("missing investment event")
+	}
+	ev := &omoney.InvestmentEvent{Kind: omoney.InvestmentEventKind(input[0])}
+
+	positional := 2
+	switch ev.Kind {
+	case omoney.EventBuy, omoney.EventSell:
+		positional = 4
+	case omoney.EventDividend, omoney.EventSplit:
+		positional = 3
+	default:
+		return nil, fmt.Errorf("unknown investment event %s", input[0])
+	}
+	if len(input) < positional+1 {
+		return nil, fmt.Errorf("%s requires %d arguments", input[0], positional)
+	}
+	ev.AccountId = input[1]
+	ev.Symbol = strings.ToUpper(input[2])
+
+	var err error
+	switch ev.Kind {
+	case omoney.EventBuy, omoney.EventSell:
+		ev.Quantity, err = strconv.ParseFloat(input[3], 64)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse shares %s", input[3])
+		}
+		ev.Price, err = strconv.ParseFloat(strings.TrimPrefix(input[4], "$"), 64)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse price %s", input[4])
+		}
+	case omoney.EventDividend:
+		ev.Amount, err = strconv.ParseFloat(strings.TrimPrefix(input[3], "$"), 64)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse amount %s", input[3])
+		}
+	case omoney.EventSplit:
+		ev.Quantity, err = parseSplitRatio(input[3])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ev.Date = time.Now()
+	i := positional + 1
+	for i < len(input) {
+		if i+1 == len(input) {
+			return nil, fmt.Errorf("missing value for %s", input[i])
+		}
+		switch input[i] {
+		case "-t", "--time":
+			ev.Date, err = dateparse.ParseLocal(input[i+1])
+			if err != nil {
+				return nil, fmt.Errorf("unable to parse datetime %s", input[i+1])
+			}
+		case "-f", "--fees":
+			if ev.Kind != omoney.EventBuy && ev.Kind != omoney.EventSell {
+				return nil, fmt.Errorf("%s does not take fees", ev.Kind)
+			}
+			ev.Fees, err = strconv.ParseFloat(strings.TrimPrefix(input[i+1], "$"), 64)
+			if err != nil {
+				return nil, fmt.Errorf("unable to parse fees %s", input[i+1])
+			}
+		case "-m", "--method":
+			ev.Method = omoney.LotMethod(strings.ToLower(input[i+1]))
+		case "-l", "--lots":
+			ev.Lots, err = parseLotSelections(input[i+1])
+			if err != nil {
+				return nil, err
+			}
+			ev.Method = omoney.MethodSpecific
+		default:
+			return nil, fmt.Errorf("unrecognized flag %s", input[i])
+		}
+		i += 2
+	}
+
+	return ev, nil
+}
+
+// Parse the lots a sell takes shares from, given as lot:shares pairs
+// such as 12:5,14:2.5, where lot is the id of the buy that opened it
+func parseLotSelections(input string) ([]omoney.LotSelection, error) {
+	selections := make([]omoney.LotSelection, 0)
+	for _, part := range strings.Split(input, ",") {
+		lot, shares, found := strings.Cut(strings.TrimSpace(part), ":")
+		if !found {
+			return nil, fmt.Errorf("lots must be given as lot:shares, not %s", part)
+		}
+		lotId, err := strconv.ParseInt(lot, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse lot %s", lot)
+		}
+		quantity, err := strconv.ParseFloat(shares, 64)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse shares %s", shares)
+		}
+		selections = append(selections, omoney.LotSelection{LotId: lotId, Quantity: quantity})
+	}
+	return selections, nil
+}
+
+// Parse a split given as new:old shares, such as 2:1 for a 2-for-1
+// split or 1:10 for a reverse split, or as a single ratio like 2
+func parseSplitRatio(input string) (float64, error) {
+	newShares, oldShares, found := strings.Cut(input, ":")
+	ratio, err := strconv.ParseFloat(newShares, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unable to parse split %s", input)
+	}
+	if found {
+		old, err := strconv.ParseFloat(oldShares, 64)
+		if err != nil || old == 0 {
+			return 0, fmt.Errorf("unable to parse split %s", input)
+		}
+		ratio /= old
+	}
+	return ratio, nil
+}
+
+// Validate input of the form [principal] [apr] [months] [payment day]
+// [start date] and build the loan terms it describes
+func BuildLoanTerms(input []string) (omoney.LoanTerms, error) {
+	if len(input) != 5 {
+		return omoney.LoanTerms{}, errors.New("loan terms require principal, APR, months, payment day, and start date")
+	}
+
+	principal, err := strconv.ParseFloat(strings.TrimPrefix(input[0], "$"), 64)
+	if err != nil {
+		return omoney.LoanTerms{}, fmt.Errorf("unable to parse principal %s", input[0])
+	}
+	apr, err := strconv.ParseFloat(strings.TrimSuffix(input[1], "%"), 64)
+	if err != nil {
+		return omoney.LoanTerms{}, fmt.Errorf("unable to parse APR %s", input[1])
+	}
+	months, err := strconv.Atoi(input[2])
+	if err != nil {
+		return omoney.LoanTerms{}, fmt.Errorf("unable to parse months %s", input[2])
+	}
+	day, err := strconv.Atoi(input[3])
+	if err != nil {
+		return omoney.LoanTerms{}, fmt.Errorf("unable to parse payment day %s", input[3])
+	}
+	start, err := dateparse.ParseLocal(input[4])
+	if err != nil {
+		return omoney.LoanTerms{}, fmt.Errorf("unable to parse datetime %s", input[4])
+	}
+
+	terms := omoney.LoanTerms{Principal: principal, Apr: apr, TermMonths: months, PaymentDay: day, Start: start}
+	return terms, terms.Validate()
+}
+
+// Validate input of the form used by `alert add` (without the leading
+// 'alert add') and build the rule it describes. Accounts are left as
+// given, for the model to look up
+func BuildAlertRule(input []string) (*omoney.AlertRule, error) {
+	// budget [category] [amount] (--warn percent)
+	// balance [acc] [amount]
+	// large [amount] (acc)
+	if len(input) < 2 {
+		return nil, errors.New("an alert rule requires a kind and an amount")
+	}
+
+	parseAmount := func(s string) (float64, error) {
+		amount, err := strconv.ParseFloat(strings.TrimPrefix(s, "$"), 64)
+		if err != nil {
+			return 0, fmt.Errorf("unable to parse amount %s", s)
+		}
+		return amount, nil
+	}
+
+	rule := &omoney.AlertRule{Kind: omoney.AlertKind(input[0])}
+	var err error
+	switch rule.Kind {
+	case omoney.AlertBudget:
+		if len(input) != 3 && len(input) != 5 {
+			return nil, errors.New("a budget requires a category and an amount")
+		}
+		rule.Target = input[1]
+		rule.Amount, err = parseAmount(input[2])
+		if err != nil {
+			return nil, err
+		}
+		if len(input) == 5 {
+			if input[3] != "--warn" {
+				return nil, fmt.Errorf("unrecognized flag %s", input[3])
+			}
+			rule.WarnPercent, err = strconv.ParseFloat(strings.TrimSuffix(input[4], "%"), 64)
+			if err != nil {
+				return nil, fmt.Errorf("unable to parse percent %s", input[4])
+			}
+		}
+	case omoney.AlertLowBalance:
+		if len(input) != 3 {
+			return nil, errors.New("a low balance alert requires an account and an amount")
+		}
+		rule.Target = input[1]
+		rule.Amount, err = parseAmount(input[2])
+		if err != nil {
+			return nil, err
+		}
+	case omoney.AlertLarge:
+		if len(input) > 3 {
+			return nil, errors.New("too many arguments")
+		}
+		rule.Amount, err = parseAmount(input[1])
+		if err != nil {
+			return nil, err
+		}
+		if len(input) == 3 {
+			rule.Target = input[2]
+		}
+	default:
+		return nil, fmt.Errorf("unknown alert kind %s, expected one of budget, balance, large", input[0])
+	}
+	return rule, nil
+}
+
+// Validate input of the form used by `share` (without the leading
+// 'share [wid]') and work out each person's share of a transaction of
+// amount. Each is a name, optionally followed by =amount or =percent%.
+// Names without one split what's left evenly with you. Shares have the
+// sign of amount, and a share of 0 removes it
+func BuildShares(amount float64, input []string) (map[string]float64, error) {
+	// [name](=amount or =percent%) ...
+	if len(input) == 0 {
+		return nil, errors.New("sharing requires at least one person")
+	}
+
+	shares := make(map[string]float64)
+	even := make([]string, 0)
+	left := math.Abs(amount)
+	for _, arg := range input {
+		name, value, found := strings.Cut(arg, "=")
+		if _, ok := shares[name]; ok || slices.Contains(even, name) {
+			return nil, fmt.Errorf("%s is listed twice", name)
+		}
+		if !found {
+			even = append(even, name)
+			continue
+		}
+
+		var share float64
+		var err error
+		if percent, ok := strings.CutSuffix(value, "%"); ok {
+			share, err = strconv.ParseFloat(percent, 64)
+			share = share / 100 * math.Abs(amount)
+		} else {
+			share, err = strconv.ParseFloat(strings.TrimPrefix(value, "$"), 64)
+		}
+		if err != nil || share < 0 {
+			return nil, fmt.Errorf("unable to parse share %s", value)
+		}
+		share = math.Round(share*100) / 100
+		shares[name] = share
+		left -= share
+	}
+
+	if len(even) > 0 {
+		if left < 0 {
+			left = 0
+		}
+		// you take part in an even split too
+		each := math.Round(left/float64(len(even)+1)*100) / 100
+		for _, name := range even {
+			shares[name] = each
+		}
+	}
+	if amount < 0 {
+		for name := range shares {
+			shares[name] = -shares[name]
+		}
+	}
+	return shares, nil
+}
+
+// Parse a comma separated list of amounts, such as 100,250.50
+func ParseAmounts(input string) ([]float64, error) {
+	amounts := make([]float64, 0)
+	for _, part := range strings.Split(input, ",") {
+		amount, err := strconv.ParseFloat(strings.TrimPrefix(strings.TrimSpace(part), "$"), 64)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse amount %s", part)
+		}
+		amounts = append(amounts, amount)
+	}
+	return amounts, nil
+}
+
+// Parse a comma separated list of account=amount pairs, such as
+// visa=24.99,car=6.5, into a map of account id -> amount
+func ParseAccountAmounts(model *omoney.Model, input string) (map[string]float64, error) {
+	amounts := make(map[string]float64)
+	for _, part := range strings.Split(input, ",") {
+		account, value, found := strings.Cut(strings.TrimSpace(part), "=")
+		if !found {
+			return nil, fmt.Errorf("expected account=amount, not %s", part)
+		}
+		acc, err := model.GetAccount(account)
+		if err != nil {
+			return nil, err
+		}
+		amount, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimPrefix(value, "$"), "%"), 64)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse amount %s", value)
+		}
+		amounts[acc.Id] = amount
+	}
+	return amounts, nil
+}
+
+// Given flag tokens of the form used by `edit`, such as
+// [--payee <payee> --amount <amount>], build the updates they describe
+func BuildTransactionUpdates(model *omoney.Model, tokens []string) ([]omoney.UpdateTransactionOptions, error) {
+	ops := make([]omoney.UpdateTransactionOptions, 0)
+	i := 0
+	for i < len(tokens) {
+		if i+1 >= len(tokens) {
+			return nil, fmt.Errorf("missing value for %s", tokens[i])
+		}
+
+		switch tokens[i] {
+		case "--account":
+			acc, err := model.GetAccount(tokens[i+1])
+			if err != nil {
+				return nil, err
+			}
+			ops = append(ops, omoney.WithAccountUpdate(acc.Id))
+		case "--payee":
+			ops = append(ops, omoney.WithPayeeUpdate(tokens[i+1]))
+		case "--amount":
+			amount, err := strconv.ParseFloat(tokens[i+1], 64)
+			if err != nil {
+				return nil, errors.New("failed to parse amount")
+			}
+			ops = append(ops, omoney.WithAmountUpdate(amount))
+		case "--date":
+			date, err := dateparse.ParseLocal(tokens[i+1])
+			if err != nil {
+				return nil, errors.New("failed to parse date")
+			}
+			ops = append(ops, omoney.WithDateUpdate(date))
+		case "--category":
+			ops = append(ops, omoney.WithCategoryUpdate(tokens[i+1]))
+		case "--desc":
+			ops = append(ops, omoney.WithDescUpdate(tokens[i+1]))
+		case "--status":
+			status, err := omoney.ParseTransactionStatus(tokens[i+1])
+			if err != nil {
+				return nil, err
+			}
+			ops = append(ops, omoney.WithStatusUpdate(status))
+		default:
+			return nil, fmt.Errorf("unknown flag %s", tokens[i])
+		}
+		i += 2
+	}
+
+	return ops, nil
+}
+
+// Parse a selection of working ids such as "3-10,14" into the ids it
+// names, in order and without repeats. Every id must be below count
+func ParseWidSelection(input string, count int) ([]int, error) {
+	wids := make([]int, 0)
+	seen := make(map[int]bool)
+	for _, part := range strings.Split(input, ",") {
+		first, last, isRange := strings.Cut(part, "-")
+		start, err := strconv.Atoi(strings.TrimSpace(first))
+		if err != nil {
+			return nil, fmt.Errorf("%s is not a valid wid", first)
+		}
+		end := start
+		if isRange {
+			end, err = strconv.Atoi(strings.TrimSpace(last))
+			if err != nil {
+				return nil, fmt.Errorf("%s is not a valid wid", last)
+			}
+		}
+		if start < 0 || end < start {
+			return nil, fmt.Errorf("%s is not a valid range of wids", part)
+		}
+		if end >= count {
+			return nil, fmt.Errorf("%d is not a valid wid", end)
+		}
+
+		for wid := start; wid <= end; wid++ {
+			if !seen[wid] {
+				seen[wid] = true
+				wids = append(wids, wid)
+			}
+		}
+	}
+	return wids, nil
 }
 
 // format of flagMap is {<flag>: <number of arguments for flag>}
@@ -158,74 +591,136 @@ func ParseTokensToFlags(tokens []string, flagMap map[string]int) (map[string][]s
 // example input: [ls <account> -n 20 -l]
 //
 // return the list of transactions printed, for the working list
-func ListTransactions(input []string, model *omoney.Model, workingIndex int) []omoney.Transaction {
+func ListTransactions(input []string, model *omoney.Model, view OView, workingIndex int) ([]omoney.Transaction, error) {
+	// [account]	alias or id of the account to list, or every account if left out
 	// -l	long: show all possible details about each transaction
 	// --num	number: an integer number of transactions to print (default: 10)
 	// --start	a time for the oldest transaction cutoff
 	// --end    a time for the newest transaction cutoff
+	// --where	a query that transactions must match
 
-	acc, err := model.GetAccount(input[1])
-	if err != nil {
-		fmt.Printf("Alias %s not recognized\n", input[0])
-		return nil
+	var acc *omoney.Account
+	i := 1
+	if len(input) > 1 && !strings.HasPrefix(input[1], "-") {
+		found, err := model.GetAccount(input[1])
+		if err != nil {
+			return nil, err
+		}
+		acc = &found
+		i = 2
 	}
 
 	filterOps := omoney.GetTransactionsOptions{Count: 10}
 	showOps := ShowTransactionOptions{}
 
-	i := 2
 	for i < len(input) {
-		if strings.HasPrefix(input[i], "-") {
-			switch input[i] {
-			case "-l":
-				showOps.ShowId = true
-				showOps.ShowCategory = true
-				showOps.ShowInstDesc = true
-				showOps.ShowDesc = true
-				i++
-			case "--num":
-				n, err := strconv.Atoi(input[i+1])
-				if err != nil {
-					fmt.Printf("Failed to parse number %s\n", input[i+1])
-					return nil
-				}
-				filterOps.Count = n
-				i += 2
-			case "--start":
-				date, err := dateparse.ParseLocal(input[i+1])
-				if err != nil {
-					fmt.Printf("Failed to parse date %s\n", input[i+1])
-					return nil
-				}
-				filterOps.StartDate = &date
-				i += 2
-			case "--end":
-				date, err := dateparse.ParseLocal(input[i+1])
-				if err != nil {
-					fmt.Printf("Failed to parse date %s\n", input[i+1])
-					return nil
-				}
-				filterOps.EndDate = &date
-				i += 2
-			default:
-				fmt.Printf("Unknown flag: %s\n", input[i])
-				return nil
-			}
-		} else {
-			fmt.Println("Failed to parse command")
-			return nil
+		if !strings.HasPrefix(input[i], "-") {
+			return nil, fmt.Errorf("unexpected argument %s", input[i])
 		}
+		next, err := parseTransactionsFlag(input, i, &filterOps, &showOps)
+		if err != nil {
+			return nil, err
+		}
+		i = next
 	}
 
-	list, err := model.GetTransactionsByAccount(acc.Id, filterOps)
+	// across accounts, amounts are shown as stored (spending is positive)
+	// since accounts disagree on which way to show them
+	var list []omoney.Transaction
+	var err error
+	invert := false
+	if acc != nil {
+		list, err = model.GetTransactionsByAccount(acc.Id, filterOps)
+		invert = acc.Type != omoney.CreditCard
+	} else {
+		list, err = model.GetTransactions(filterOps)
+	}
 	if err != nil {
-		fmt.Printf("Error: %s\n", err)
-		return nil
+		return nil, err
+	}
+
+	view.ShowTransactions(list, invert, workingIndex)
+
+	return list, nil
+}
+
+// Parse the flag at input[i] shared by commands that list transactions
+// (-l, --num, --start, --end, --where) into filterOps and showOps,
+// returning the index of the next argument
+func parseTransactionsFlag(input []string, i int, filterOps *omoney.GetTransactionsOptions, showOps *ShowTransactionOptions) (int, error) {
+	if input[i] != "-l" && i+1 == len(input) {
+		return 0, fmt.Errorf("missing value for %s", input[i])
+	}
+
+	switch input[i] {
+	case "-l":
+		showOps.ShowId = true
+		showOps.ShowCategory = true
+		showOps.ShowInstDesc = true
+		showOps.ShowDesc = true
+		return i + 1, nil
+	case "--num":
+		n, err := strconv.Atoi(input[i+1])
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse number %s", input[i+1])
+		}
+		filterOps.Count = n
+	case "--start":
+		date, err := dateparse.ParseLocal(input[i+1])
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse date %s", input[i+1])
+		}
+		filterOps.StartDate = &date
+	case "--end":
+		date, err := dateparse.ParseLocal(input[i+1])
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse date %s", input[i+1])
+		}
+		filterOps.EndDate = &date
+	case "--where":
+		query, err := omoney.ParseQuery(input[i+1])
+		if err != nil {
+			return 0, err
+		}
+		filterOps.Query = query
+	default:
+		return 0, fmt.Errorf("unknown flag %s", input[i])
 	}
+	return i + 2, nil
+}
+
+func SearchTransactions(input []string, model *omoney.Model, view OView, workingIndex int) ([]omoney.Transaction, error) {
+	// [terms...]	words that must all appear in the payee or descriptions
+	// and the same flags as ListTransactions
 
-	invert := acc.Type != omoney.CreditCard
-	ShowTransactions(list, invert, workingIndex)
+	filterOps := omoney.GetTransactionsOptions{Count: 10}
+	showOps := ShowTransactionOptions{}
+	terms := make([]string, 0)
+
+	for i := 1; i < len(input); {
+		if !strings.HasPrefix(input[i], "-") {
+			terms = append(terms, input[i])
+			i++
+			continue
+		}
+		next, err := parseTransactionsFlag(input, i, &filterOps, &showOps)
+		if err != nil {
+			return nil, err
+		}
+		i = next
+	}
+
+	if len(terms) == 0 {
+		return nil, errors.New("nothing to search for")
+	}
+
+	list, err := model.SearchTransactions(strings.Join(terms, " "), filterOps)
+	if err != nil {
+		return nil, err
+	}
 
-	return list
+	// matches come from every account, so amounts are shown as stored
+	view.ShowTransactions(list, false, workingIndex)
 
+	return list, nil
 }
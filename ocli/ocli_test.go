@@ -1,6 +1,7 @@
 package ocli
 
 import (
+	"reflect"
 	"testing"
 	"time"
 
@@ -74,3 +75,99 @@ func TestNewTrMixedPositionalAndFlag(t *testing.T) {
 		}
 	}
 }
+
+func TestParseWidSelection(t *testing.T) {
+	wids, err := ParseWidSelection("3-5,1,4,9", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	need := []int{3, 4, 5, 1, 9}
+	if len(wids) != len(need) {
+		t.Fatalf("ParseWidSelection failed"+
+			"\nhave: %v"+
+			"\nneed: %v",
+			wids, need)
+	}
+	for i := range need {
+		if wids[i] != need[i] {
+			t.Fatalf("ParseWidSelection failed"+
+				"\nhave: %v"+
+				"\nneed: %v",
+				wids, need)
+		}
+	}
+
+	for _, bad := range []string{"", "3-", "5-3", "a", "2,10", "-1"} {
+		if _, err := ParseWidSelection(bad, 10); err == nil {
+			t.Fatalf("ParseWidSelection accepted %q", bad)
+		}
+	}
+}
+
+func TestBuildInvestmentEvent(t *testing.T) {
+	ev, err := BuildInvestmentEvent([]string{"buy", "brokerage", "vti", "10", "$215.30", "-t", "2024/01/05", "--fees", "4.95"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	need := om.InvestmentEvent{AccountId: "brokerage", Symbol: "VTI", Kind: om.EventBuy,
+		Date: time.Date(2024, 1, 5, 0, 0, 0, 0, time.Local), Quantity: 10, Price: 215.30, Fees: 4.95}
+	if !reflect.DeepEqual(*ev, need) {
+		t.Fatalf("BuildInvestmentEvent failed"+
+			"\nhave: %v"+
+			"\nneed: %v", *ev, need)
+	}
+
+	ev, err = BuildInvestmentEvent([]string{"sell", "brokerage", "VTI", "7", "250", "--lots", "3:5,9:2"})
+	lots := []om.LotSelection{{LotId: 3, Quantity: 5}, {LotId: 9, Quantity: 2}}
+	if err != nil || ev.Method != om.MethodSpecific || !reflect.DeepEqual(ev.Lots, lots) {
+		t.Fatalf("Specific lot sell failed\nhave: %v (%v)\nneed: lots %v", ev, err, lots)
+	}
+
+	ev, err = BuildInvestmentEvent([]string{"split", "brokerage", "GE", "1:8"})
+	if err != nil || ev.Quantity != 0.125 {
+		t.Fatalf("Reverse split failed\nhave: %v (%v)\nneed: ratio 0.125", ev, err)
+	}
+
+	_, err = BuildInvestmentEvent([]string{"dividend", "brokerage", "VTI", "12", "--fees", "1"})
+	if err == nil {
+		t.Fatal("Dividend with fees should fail")
+	}
+}
+
+func TestBuildAlertRule(t *testing.T) {
+	rule, err := BuildAlertRule([]string{"budget", "dining", "$300", "--warn", "90%"})
+	need := om.AlertRule{Kind: om.AlertBudget, Target: "dining", Amount: 300, WarnPercent: 90}
+	if err != nil || *rule != need {
+		t.Fatalf("BuildAlertRule failed\nhave: %v (%v)\nneed: %v", rule, err, need)
+	}
+
+	rule, err = BuildAlertRule([]string{"large", "1000"})
+	if err != nil || rule.Kind != om.AlertLarge || rule.Amount != 1000 || rule.Target != "" {
+		t.Fatalf("Large alert failed\nhave: %v (%v)", rule, err)
+	}
+
+	_, err = BuildAlertRule([]string{"balance", "chase"})
+	if err == nil {
+		t.Fatal("Low balance without an amount should fail")
+	}
+}
+
+func TestBuildShares(t *testing.T) {
+	shares, err := BuildShares(90, []string{"alex", "sam"})
+	if err != nil || len(shares) != 2 || shares["alex"] != 30 || shares["sam"] != 30 {
+		t.Fatalf("BuildShares failed\nhave: %v (%v)\nneed: 30 each", shares, err)
+	}
+
+	// even splits share what's left after the rest
+	shares, err = BuildShares(-100, []string{"alex=$40", "sam=10%", "kim"})
+	if err != nil || shares["alex"] != -40 || shares["sam"] != -10 || shares["kim"] != -25 {
+		t.Fatalf("BuildShares failed\nhave: %v (%v)\nneed: alex -40, sam -10, kim -25", shares, err)
+	}
+
+	if _, err = BuildShares(50, []string{"alex", "alex=10"}); err == nil {
+		t.Fatal("Listing someone twice should fail")
+	}
+	if _, err = BuildShares(50, []string{"alex=ten"}); err == nil {
+		t.Fatal("An unparseable share should fail")
+	}
+}
@@ -2,12 +2,18 @@ package ocli
 
 import (
 	"fmt"
+	"os"
+	"slices"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/charmbracelet/lipgloss"
 	"github.com/charmbracelet/lipgloss/table"
 	"github.com/dknelson9876/oregano/omoney"
 	"github.com/plaid/plaid-go/plaid"
+	"github.com/uptrace/bun/migrate"
 )
 
 // Define styles
@@ -17,9 +23,47 @@ var (
 	rightAlignStyle = lipgloss.NewStyle().Align(lipgloss.Right)
 )
 
+// Everything that can be shown to the user. OViewPlain draws tables
+// for people, while OViewData writes formats meant for other programs
 type OView interface {
-	ShowAccount(account plaid.AccountBase)
-	ShowAccounts(accounts []plaid.AccountBase)
+	ShowAccounts(model *omoney.Model, ops ...ShowAccountOptions)
+	ShowAccount(acc omoney.Account)
+	ShowTransactions(trs []omoney.Transaction, invert bool, workingIndex int)
+	ShowTransaction(tr omoney.Transaction, ops ...ShowTransactionOptions)
+	ShowCategoryMappings(mappings []omoney.CategoryMapping)
+	ShowUnmappedCategories(unmapped []omoney.UnmappedCategory)
+	ShowMigrations(ms migrate.MigrationSlice)
+	ShowAttachments(atts []omoney.Attachment)
+	ShowPayeeAliases(aliases []omoney.PayeeAlias)
+	ShowHoldings(model *omoney.Model, holdings []omoney.Holding)
+	ShowLots(lots []omoney.Lot)
+	ShowInvestmentEvents(events []omoney.InvestmentEvent)
+	ShowCapitalGains(model *omoney.Model, gains []omoney.Disposal)
+	ShowInstallments(installments []omoney.Installment)
+	ShowLoanPayments(payments []omoney.LoanPayment)
+	ShowLoanProjections(projections []omoney.LoanProjection)
+	ShowPayoffPlans(debts []omoney.Debt, plans []omoney.PayoffPlan)
+	ShowStatements(statements []omoney.Statement, now time.Time)
+	ShowAlertRules(model *omoney.Model, rules []omoney.AlertRule)
+	ShowAlerts(alerts []omoney.Alert)
+	ShowCategoryTrend(months []omoney.MonthTotals)
+	ShowBalanceHistory(acc omoney.Account, points []omoney.BalancePoint)
+	ShowIncomeExpense(months []omoney.MonthTotals)
+	ShowPersonBalances(balances []omoney.PersonBalance)
+	ShowSharedTransactions(model *omoney.Model, shared []omoney.SharedTransaction, workingIndex int)
+	ShowExpenseReports(reports []omoney.ReportSummary)
+}
+
+// Build the view for an output format: table, json, csv, or tsv
+func NewOView(format string) (OView, error) {
+	switch format {
+	case "", "table":
+		return NewOViewPlain(false), nil
+	case "json", "csv", "tsv":
+		return NewOViewData(format, os.Stdout), nil
+	default:
+		return nil, fmt.Errorf("unknown output format %s, expected one of table, json, csv, tsv", format)
+	}
 }
 
 type OViewPlain struct {
@@ -99,7 +143,7 @@ func (v *OViewPlain) ShowPlaidAccounts(accounts []plaid.AccountBase) {
 }
 
 // workingIndex: the current length of the workinglist, so that new wid's can be printed
-func ShowTransactions(trs []omoney.Transaction, invert bool, workingIndex int) {
+func (v *OViewPlain) ShowTransactions(trs []omoney.Transaction, invert bool, workingIndex int) {
 	var negAmount int
 	if invert {
 		negAmount = -1
@@ -109,10 +153,17 @@ func ShowTransactions(trs []omoney.Transaction, invert bool, workingIndex int) {
 
 	var rows [][]string
 	for i, tr := range trs {
+		payee := tr.Payee
+		if tr.Status == omoney.Pending {
+			payee += faintStyle.Render(" (pending)")
+		}
+		if tr.Reimbursable {
+			payee += faintStyle.Render(" (reimbursable)")
+		}
 		thisRow := []string{
 			strconv.Itoa(workingIndex + i),
 			tr.Date.Format("2006/01/02"),
-			tr.Payee,
+			payee,
 			tr.Category,
 			fmt.Sprintf("$%.2f", tr.Amount*float64(negAmount)),
 		}
@@ -159,6 +210,10 @@ func (v *OViewPlain) ShowTransaction(tr omoney.Transaction, ops ...ShowTransacti
 	rows = append(rows, fmt.Sprintf("Payee: %s", tr.Payee))
 	rows = append(rows, fmt.Sprintf("Amount: $%.2f", tr.Amount))
 	rows = append(rows, fmt.Sprintf("Date: %s", tr.Date.Format("2006/01/02")))
+	rows = append(rows, fmt.Sprintf("Status: %s", tr.Status))
+	if tr.Reimbursable {
+		rows = append(rows, "Reimbursable: yes")
+	}
 
 	if op.ShowCategory {
 		rows = append(rows, fmt.Sprintf("Category: %s", tr.Category))
@@ -181,12 +236,22 @@ type ShowAccountOptions struct {
 	ShowType   bool
 	ShowAnchor bool
 	ShowId     bool
+	// Include closed accounts, which are otherwise left out
+	ShowClosed bool
 }
 
-func (v *OViewPlain) ShowAccounts(model *omoney.Model, ops ...ShowAccountOptions) {
-	accounts := model.GetAccounts()
+// The accounts to list, leaving out closed ones unless asked for
+func listedAccounts(model *omoney.Model, op ShowAccountOptions) []omoney.Account {
+	accounts := make([]omoney.Account, 0)
+	for _, acc := range model.GetAccounts() {
+		if op.ShowClosed || !acc.Closed {
+			accounts = append(accounts, acc)
+		}
+	}
+	return accounts
+}
 
-	rows := make([][]string, len(accounts))
+func (v *OViewPlain) ShowAccounts(model *omoney.Model, ops ...ShowAccountOptions) {
 	var op ShowAccountOptions
 	var headers []string
 	if len(ops) == 1 {
@@ -195,14 +260,21 @@ func (v *OViewPlain) ShowAccounts(model *omoney.Model, ops ...ShowAccountOptions
 		op = ShowAccountOptions{}
 	}
 
+	accounts := listedAccounts(model, op)
+	rows := make([][]string, len(accounts))
+
 	// always show alias
 	// TODO: Plaid integration may allow accounts without aliases
 	headers = append(headers, "ALIAS")
 	for i, acc := range accounts {
-		rows[i] = append(rows[i], acc.Alias)
+		if acc.Closed {
+			rows[i] = append(rows[i], faintStyle.Render(acc.Alias+" (closed)"))
+		} else {
+			rows[i] = append(rows[i], acc.Alias)
+		}
 	}
 
-	headers = append(headers, "BALANCE")
+	headers = append(headers, "BALANCE", "AVAILABLE")
 	// TODO model.getcurrentbalance
 	for i, acc := range accounts {
 		bal, err := model.GetCurrentBalance(acc.Id)
@@ -210,7 +282,12 @@ func (v *OViewPlain) ShowAccounts(model *omoney.Model, ops ...ShowAccountOptions
 			fmt.Printf("Error calculating balance: %s\n", err)
 			return
 		}
-		rows[i] = append(rows[i], fmt.Sprintf("$%.2f", bal))
+		available, err := model.GetAvailableBalance(acc.Id)
+		if err != nil {
+			fmt.Printf("Error calculating balance: %s\n", err)
+			return
+		}
+		rows[i] = append(rows[i], fmt.Sprintf("$%.2f", bal), fmt.Sprintf("$%.2f", available))
 	}
 
 	if op.ShowType {
@@ -247,4 +324,689 @@ func (v *OViewPlain) ShowAccount(acc omoney.Account) {
 		acc.Type,
 		acc.GetAnchorBalance(),
 		acc.GetAnchorTime())
+	if acc.NeedsRelink {
+		fmt.Println("⚠️  This account needs to be relinked")
+	}
+	if acc.Closed {
+		fmt.Println("This account is closed")
+	}
+	if acc.Loan.IsSet() {
+		fmt.Printf("Loan: $%.2f at %.2f%% APR over %d months from %s\nPayment: $%.2f due on day %d\n",
+			acc.Loan.Principal,
+			acc.Loan.Apr,
+			acc.Loan.TermMonths,
+			acc.Loan.Start.Format("2006/01/02"),
+			acc.Loan.MonthlyPayment(),
+			acc.Loan.PaymentDay)
+	}
+	if acc.StatementDay != 0 {
+		fmt.Printf("Statements: close on day %d, due on day %d\n", acc.StatementDay, acc.DueDay)
+	}
+}
+
+func (v *OViewPlain) ShowCategoryMappings(mappings []omoney.CategoryMapping) {
+	rows := make([][]string, len(mappings))
+	for i, mapping := range mappings {
+		rows[i] = []string{mapping.PlaidCategory, mapping.Category}
+	}
+
+	t := table.New().Headers("PLAID CATEGORY", "CATEGORY").Rows(rows...)
+	fmt.Println(t)
+}
+
+func (v *OViewPlain) ShowUnmappedCategories(unmapped []omoney.UnmappedCategory) {
+	rows := make([][]string, len(unmapped))
+	for i, u := range unmapped {
+		rows[i] = []string{u.PlaidCategory, strconv.Itoa(u.Count), u.LastSeen.Format("2006/01/02")}
+	}
+
+	t := table.New().
+		StyleFunc(func(row, col int) lipgloss.Style {
+			if col == 1 {
+				return rightAlignStyle
+			} else {
+				return lipgloss.NewStyle()
+			}
+		}).
+		Headers("PLAID CATEGORY", "COUNT", "LAST SEEN").
+		Rows(rows...)
+	fmt.Println(t)
+}
+
+func (v *OViewPlain) ShowPayeeAliases(aliases []omoney.PayeeAlias) {
+	rows := make([][]string, len(aliases))
+	for i, alias := range aliases {
+		rows[i] = []string{alias.Key, alias.Payee}
+	}
+
+	t := table.New().Headers("DESCRIPTION", "PAYEE").Rows(rows...)
+	fmt.Println(t)
+}
+
+func (v *OViewPlain) ShowMigrations(ms migrate.MigrationSlice) {
+	rows := make([][]string, len(ms))
+	for i, m := range ms {
+		applied := faintStyle.Render("pending")
+		if m.IsApplied() {
+			applied = m.MigratedAt.Local().Format("2006/01/02 15:04")
+		}
+		rows[i] = []string{m.Name, m.Comment, applied}
+	}
+
+	t := table.New().Headers("VERSION", "MIGRATION", "APPLIED").Rows(rows...)
+	fmt.Println(t)
+}
+
+func (v *OViewPlain) ShowAttachments(atts []omoney.Attachment) {
+	rows := make([][]string, len(atts))
+	for i, att := range atts {
+		rows[i] = []string{att.Name, formatSize(att.Size), att.Added.Format("2006/01/02"), att.Path}
+	}
+
+	t := table.New().
+		StyleFunc(func(row, col int) lipgloss.Style {
+			if col == 1 {
+				return rightAlignStyle
+			} else {
+				return lipgloss.NewStyle()
+			}
+		}).
+		Headers("NAME", "SIZE", "ADDED", "PATH").
+		Rows(rows...)
+	fmt.Println(t)
+}
+
+// Format a number of bytes for people, such as 1.2 MB
+func formatSize(size int64) string {
+	const unit = 1000
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "kMGTPE"[exp])
+}
+
+// Map of account id -> alias, for showing which account something is in
+func accountAliases(model *omoney.Model) map[string]string {
+	aliases := make(map[string]string)
+	for _, acc := range model.GetAccounts() {
+		aliases[acc.Id] = acc.Alias
+	}
+	return aliases
+}
+
+func (v *OViewPlain) ShowHoldings(model *omoney.Model, holdings []omoney.Holding) {
+	aliases := accountAliases(model)
+	rows := make([][]string, 0, len(holdings)+1)
+	var totalCost, totalValue float64
+	for _, h := range holdings {
+		price := faintStyle.Render("unknown")
+		if !h.PriceDate.IsZero() {
+			price = fmt.Sprintf("$%.2f (%s)", h.Price, h.PriceDate.Format("2006/01/02"))
+		}
+		gain := h.MarketValue - h.CostBasis
+		rows = append(rows, []string{
+			aliases[h.AccountId],
+			h.Symbol,
+			fmt.Sprintf("%g", h.Quantity),
+			price,
+			fmt.Sprintf("$%.2f", h.CostBasis),
+			fmt.Sprintf("$%.2f", h.MarketValue),
+			fmt.Sprintf("$%.2f", gain),
+			fmt.Sprintf("$%.2f", h.Dividends),
+		})
+		totalCost += h.CostBasis
+		totalValue += h.MarketValue
+	}
+	rows = append(rows, []string{"total", "", "", "",
+		fmt.Sprintf("$%.2f", totalCost),
+		fmt.Sprintf("$%.2f", totalValue),
+		fmt.Sprintf("$%.2f", totalValue-totalCost),
+		"",
+	})
+
+	t := table.New().
+		StyleFunc(func(row, col int) lipgloss.Style {
+			if col >= 2 {
+				return rightAlignStyle
+			} else {
+				return lipgloss.NewStyle()
+			}
+		}).
+		Headers("ACCOUNT", "SYMBOL", "SHARES", "PRICE", "COST", "VALUE", "GAIN", "DIVIDENDS").
+		Rows(rows...)
+	fmt.Println(t)
+}
+
+func (v *OViewPlain) ShowLots(lots []omoney.Lot) {
+	rows := make([][]string, len(lots))
+	for i, lot := range lots {
+		rows[i] = []string{
+			fmt.Sprintf("%d", lot.Id),
+			lot.Symbol,
+			lot.Acquired.Format("2006/01/02"),
+			fmt.Sprintf("%g", lot.Quantity),
+			fmt.Sprintf("$%.4f", lot.CostPerShare),
+			fmt.Sprintf("$%.2f", lot.Quantity*lot.CostPerShare),
+		}
+	}
+
+	t := table.New().
+		StyleFunc(func(row, col int) lipgloss.Style {
+			if col >= 3 {
+				return rightAlignStyle
+			} else {
+				return lipgloss.NewStyle()
+			}
+		}).
+		Headers("LOT", "SYMBOL", "ACQUIRED", "SHARES", "COST/SHARE", "COST").
+		Rows(rows...)
+	fmt.Println(t)
+}
+
+func (v *OViewPlain) ShowInvestmentEvents(events []omoney.InvestmentEvent) {
+	rows := make([][]string, len(events))
+	for i, ev := range events {
+		detail := ""
+		switch ev.Kind {
+		case omoney.EventBuy, omoney.EventSell:
+			detail = fmt.Sprintf("%g @ $%.2f", ev.Quantity, ev.Price)
+			if ev.Fees != 0 {
+				detail += fmt.Sprintf(" + $%.2f fees", ev.Fees)
+			}
+			if ev.Method == omoney.MethodLifo {
+				detail += " (lifo)"
+			}
+			for _, sel := range ev.Lots {
+				detail += fmt.Sprintf(" [lot %d: %g]", sel.LotId, sel.Quantity)
+			}
+		case omoney.EventDividend:
+			detail = fmt.Sprintf("$%.2f", ev.Amount)
+		case omoney.EventSplit:
+			detail = fmt.Sprintf("%g for 1", ev.Quantity)
+		}
+		rows[i] = []string{
+			fmt.Sprintf("%d", ev.Id),
+			ev.Date.Format("2006/01/02"),
+			ev.Symbol,
+			string(ev.Kind),
+			detail,
+		}
+	}
+
+	t := table.New().Headers("ID", "DATE", "SYMBOL", "EVENT", "DETAIL").Rows(rows...)
+	fmt.Println(t)
+}
+
+func (v *OViewPlain) ShowCapitalGains(model *omoney.Model, gains []omoney.Disposal) {
+	aliases := accountAliases(model)
+	rows := make([][]string, 0, len(gains)+2)
+	var shortTerm, longTerm float64
+	for _, d := range gains {
+		term := "short"
+		if d.LongTerm {
+			term = "long"
+			longTerm += d.Gain
+		} else {
+			shortTerm += d.Gain
+		}
+		wash := ""
+		if d.WashSale {
+			wash = "yes"
+		}
+		rows = append(rows, []string{
+			aliases[d.AccountId],
+			d.Symbol,
+			fmt.Sprintf("%d", d.LotId),
+			fmt.Sprintf("%g", d.Quantity),
+			d.Acquired.Format("2006/01/02"),
+			d.Sold.Format("2006/01/02"),
+			fmt.Sprintf("$%.2f", d.Proceeds),
+			fmt.Sprintf("$%.2f", d.CostBasis),
+			fmt.Sprintf("$%.2f", d.Gain),
+			term,
+			wash,
+		})
+	}
+	rows = append(rows,
+		[]string{"short term", "", "", "", "", "", "", "", fmt.Sprintf("$%.2f", shortTerm), "", ""},
+		[]string{"long term", "", "", "", "", "", "", "", fmt.Sprintf("$%.2f", longTerm), "", ""},
+	)
+
+	t := table.New().
+		StyleFunc(func(row, col int) lipgloss.Style {
+			if col == 3 || (col >= 6 && col <= 8) {
+				return rightAlignStyle
+			} else {
+				return lipgloss.NewStyle()
+			}
+		}).
+		Headers("ACCOUNT", "SYMBOL", "LOT", "SHARES", "ACQUIRED", "SOLD", "PROCEEDS", "COST", "GAIN", "TERM", "WASH SALE").
+		Rows(rows...)
+	fmt.Println(t)
+}
+
+func (v *OViewPlain) ShowInstallments(installments []omoney.Installment) {
+	rows := make([][]string, len(installments))
+	for i, in := range installments {
+		rows[i] = []string{
+			strconv.Itoa(in.Number),
+			in.Date.Format("2006/01/02"),
+			fmt.Sprintf("$%.2f", in.Payment),
+			fmt.Sprintf("$%.2f", in.Principal),
+			fmt.Sprintf("$%.2f", in.Interest),
+			fmt.Sprintf("$%.2f", in.Balance),
+		}
+	}
+
+	t := table.New().
+		StyleFunc(func(row, col int) lipgloss.Style {
+			if col >= 2 {
+				return rightAlignStyle
+			} else {
+				return lipgloss.NewStyle()
+			}
+		}).
+		Headers("#", "DUE", "PAYMENT", "PRINCIPAL", "INTEREST", "BALANCE").
+		Rows(rows...)
+	fmt.Println(t)
+}
+
+func (v *OViewPlain) ShowLoanPayments(payments []omoney.LoanPayment) {
+	rows := make([][]string, len(payments))
+	for i, p := range payments {
+		rows[i] = []string{
+			p.Date.Format("2006/01/02"),
+			fmt.Sprintf("$%.2f", p.Amount),
+			fmt.Sprintf("$%.2f", p.Principal),
+			fmt.Sprintf("$%.2f", p.Interest),
+			fmt.Sprintf("$%.2f", p.Balance),
+		}
+	}
+
+	t := table.New().
+		StyleFunc(func(row, col int) lipgloss.Style {
+			if col >= 1 {
+				return rightAlignStyle
+			} else {
+				return lipgloss.NewStyle()
+			}
+		}).
+		Headers("DATE", "PAID", "PRINCIPAL", "INTEREST", "BALANCE").
+		Rows(rows...)
+	fmt.Println(t)
+}
+
+func (v *OViewPlain) ShowLoanProjections(projections []omoney.LoanProjection) {
+	rows := make([][]string, len(projections))
+	for i, p := range projections {
+		rows[i] = []string{
+			fmt.Sprintf("$%.2f", p.Extra),
+			strconv.Itoa(len(p.Installments)),
+			p.PayoffDate.Format("2006/01/02"),
+			fmt.Sprintf("$%.2f", p.TotalInterest),
+			fmt.Sprintf("$%.2f", projections[0].TotalInterest-p.TotalInterest),
+		}
+	}
+
+	t := table.New().
+		StyleFunc(func(row, col int) lipgloss.Style {
+			if col != 2 {
+				return rightAlignStyle
+			} else {
+				return lipgloss.NewStyle()
+			}
+		}).
+		Headers("EXTRA/MONTH", "PAYMENTS LEFT", "PAID OFF", "INTEREST LEFT", "SAVED").
+		Rows(rows...)
+	fmt.Println(t)
+}
+
+func (v *OViewPlain) ShowPayoffPlans(debts []omoney.Debt, plans []omoney.PayoffPlan) {
+	headers := []string{"ACCOUNT", "BALANCE", "APR", "MINIMUM"}
+	for _, plan := range plans {
+		headers = append(headers, strings.ToUpper(string(plan.Strategy)))
+	}
+
+	rows := make([][]string, 0, len(debts)+2)
+	for _, d := range debts {
+		row := []string{
+			d.Alias,
+			fmt.Sprintf("$%.2f", d.Balance),
+			fmt.Sprintf("%.2f%%", d.Apr),
+			fmt.Sprintf("$%.2f", d.MinPayment),
+		}
+		for _, plan := range plans {
+			row = append(row, fmt.Sprintf("%s (#%d)",
+				plan.PaidOff[d.AccountId].Format("2006/01"),
+				slices.Index(plan.Order, d.AccountId)+1))
+		}
+		rows = append(rows, row)
+	}
+
+	debtFree := []string{"debt free", "", "", ""}
+	interest := []string{"total interest", "", "", ""}
+	for _, plan := range plans {
+		debtFree = append(debtFree, fmt.Sprintf("%s (%d months)", plan.DebtFree.Format("2006/01"), plan.Months))
+		interest = append(interest, fmt.Sprintf("$%.2f", plan.TotalInterest))
+	}
+	rows = append(rows, debtFree, interest)
+
+	t := table.New().
+		StyleFunc(func(row, col int) lipgloss.Style {
+			if col >= 1 && col <= 3 {
+				return rightAlignStyle
+			} else {
+				return lipgloss.NewStyle()
+			}
+		}).
+		Headers(headers...).
+		Rows(rows...)
+	fmt.Println(t)
+}
+
+func (v *OViewPlain) ShowStatements(statements []omoney.Statement, now time.Time) {
+	rows := make([][]string, len(statements))
+	for i, s := range statements {
+		status := string(s.Status(now))
+		if s.NeedsPayment(now) {
+			status = "⚠️  " + status
+		}
+		rows[i] = []string{
+			s.Closing.Format("2006/01/02"),
+			s.Due.Format("2006/01/02"),
+			fmt.Sprintf("$%.2f", s.PreviousBalance),
+			fmt.Sprintf("$%.2f", s.Charges),
+			fmt.Sprintf("$%.2f", s.Credits),
+			fmt.Sprintf("$%.2f", s.Balance),
+			fmt.Sprintf("$%.2f", s.MinPayment),
+			fmt.Sprintf("$%.2f", s.Paid),
+			status,
+		}
+	}
+
+	t := table.New().
+		StyleFunc(func(row, col int) lipgloss.Style {
+			if col >= 2 && col <= 7 {
+				return rightAlignStyle
+			} else {
+				return lipgloss.NewStyle()
+			}
+		}).
+		Headers("CLOSES", "DUE", "PREVIOUS", "CHARGES", "CREDITS", "BALANCE", "MINIMUM", "PAID", "STATUS").
+		Rows(rows...)
+	fmt.Println(t)
+}
+
+func (v *OViewPlain) ShowAlertRules(model *omoney.Model, rules []omoney.AlertRule) {
+	aliases := accountAliases(model)
+	rows := make([][]string, len(rules))
+	for i, r := range rules {
+		target := r.Target
+		if r.Kind != omoney.AlertBudget {
+			target = aliases[r.Target]
+		}
+		if r.Kind == omoney.AlertLarge && r.Target == "" {
+			target = faintStyle.Render("any account")
+		}
+		warn := ""
+		if r.Kind == omoney.AlertBudget {
+			warn = fmt.Sprintf("%.0f%%", r.WarnPercent)
+		}
+		rows[i] = []string{
+			strconv.FormatInt(r.Id, 10),
+			string(r.Kind),
+			target,
+			fmt.Sprintf("$%.2f", r.Amount),
+			warn,
+		}
+	}
+
+	t := table.New().
+		StyleFunc(func(row, col int) lipgloss.Style {
+			if col == 3 || col == 4 {
+				return rightAlignStyle
+			} else {
+				return lipgloss.NewStyle()
+			}
+		}).
+		Headers("ID", "KIND", "TARGET", "AMOUNT", "WARN AT").
+		Rows(rows...)
+	fmt.Println(t)
+}
+
+func (v *OViewPlain) ShowAlerts(alerts []omoney.Alert) {
+	rows := make([][]string, len(alerts))
+	for i, a := range alerts {
+		message := a.Message
+		if a.Dismissed {
+			message = faintStyle.Render(message)
+		}
+		rows[i] = []string{a.Time.Format("2006/01/02 15:04"), message}
+	}
+
+	t := table.New().Headers("TIME", "ALERT").Rows(rows...)
+	fmt.Println(t)
+}
+
+// Every category spent in over months, the most spent in first
+func spendingCategories(months []omoney.MonthTotals) ([]string, map[string]float64) {
+	totals := make(map[string]float64)
+	for _, month := range months {
+		for category, amount := range month.Categories {
+			totals[category] += amount
+		}
+	}
+	categories := make([]string, 0, len(totals))
+	for category, total := range totals {
+		if total > 0 {
+			categories = append(categories, category)
+		}
+	}
+	sort.Slice(categories, func(i, j int) bool {
+		if totals[categories[i]] != totals[categories[j]] {
+			return totals[categories[i]] > totals[categories[j]]
+		}
+		return categories[i] < categories[j]
+	})
+	return categories, totals
+}
+
+func (v *OViewPlain) ShowCategoryTrend(months []omoney.MonthTotals) {
+	width := terminalWidth()
+	categories, totals := spendingCategories(months)
+
+	// only so many categories can be told apart in one bar
+	stacked := categories
+	if len(categories) > len(stackColors) {
+		stacked = append(slices.Clone(categories[:len(stackColors)-1]), "other")
+	}
+	labels := make([]string, len(months))
+	values := make([][]float64, len(months))
+	for i, month := range months {
+		labels[i] = month.Month.Format("2006/01")
+		values[i] = make([]float64, len(stacked))
+		for j, category := range categories {
+			values[i][min(j, len(stacked)-1)] += month.Categories[category]
+		}
+	}
+	fmt.Print(StackedBars(labels, stacked, values, width, v.enableColor))
+
+	rows := make([][]string, len(categories))
+	for i, category := range categories {
+		trend := make([]float64, len(months))
+		for j, month := range months {
+			trend[j] = month.Categories[category]
+		}
+		name := category
+		if name == "" {
+			name = faintStyle.Render("uncategorized")
+		}
+		rows[i] = []string{
+			name,
+			fmt.Sprintf("$%.2f", totals[category]),
+			fmt.Sprintf("$%.2f", totals[category]/float64(len(months))),
+			Sparkline(trend, width/2),
+		}
+	}
+	t := table.New().
+		StyleFunc(func(row, col int) lipgloss.Style {
+			if col == 1 || col == 2 {
+				return rightAlignStyle
+			} else {
+				return lipgloss.NewStyle()
+			}
+		}).
+		Headers("CATEGORY", "TOTAL", "MONTHLY", "TREND").
+		Rows(rows...)
+	fmt.Println(t)
+}
+
+func (v *OViewPlain) ShowBalanceHistory(acc omoney.Account, points []omoney.BalancePoint) {
+	if len(points) == 0 {
+		return
+	}
+	width := terminalWidth()
+	values := make([]float64, len(points))
+	low, high := points[0], points[0]
+	for i, p := range points {
+		values[i] = p.Balance
+		if p.Balance < low.Balance {
+			low = p
+		}
+		if p.Balance > high.Balance {
+			high = p
+		}
+	}
+	first, last := points[0], points[len(points)-1]
+
+	fmt.Printf("%s: $%.2f on %s to $%.2f on %s\n",
+		acc.Alias, first.Balance, first.Date.Format("2006/01/02"), last.Balance, last.Date.Format("2006/01/02"))
+	fmt.Println(faintStyle.Render(fmt.Sprintf("low $%.2f on %s, high $%.2f on %s",
+		low.Balance, low.Date.Format("2006/01/02"), high.Balance, high.Date.Format("2006/01/02"))))
+	fmt.Println(Sparkline(values, width))
+
+	// the balance at the end of each month, or of the last day
+	labels := make([]string, 0)
+	ends := make([]float64, 0)
+	for i, p := range points {
+		if i == len(points)-1 || points[i+1].Date.Month() != p.Date.Month() {
+			labels = append(labels, p.Date.Format("2006/01/02"))
+			ends = append(ends, p.Balance)
+		}
+	}
+	fmt.Print(BarChart(labels, ends, width))
+}
+
+func (v *OViewPlain) ShowIncomeExpense(months []omoney.MonthTotals) {
+	width := terminalWidth()
+	labels := make([]string, 0, 2*len(months))
+	values := make([]float64, 0, 2*len(months))
+	nets := make([]float64, len(months))
+	for i, month := range months {
+		labels = append(labels, month.Month.Format("2006/01")+" in", "        out")
+		values = append(values, month.Income, month.Expenses)
+		nets[i] = month.Net()
+	}
+	fmt.Print(BarChart(labels, values, width))
+
+	income, expenses := 0.0, 0.0
+	for _, month := range months {
+		income += month.Income
+		expenses += month.Expenses
+	}
+	fmt.Printf("net %s $%.2f (in $%.2f, out $%.2f)\n", Sparkline(nets, width/2), income-expenses, income, expenses)
+}
+
+func (v *OViewPlain) ShowPersonBalances(balances []omoney.PersonBalance) {
+	rows := make([][]string, len(balances))
+	for i, b := range balances {
+		var status string
+		switch {
+		case b.Owed >= 0.005:
+			status = fmt.Sprintf("%s owes you", b.Person.Name)
+		case b.Owed <= -0.005:
+			status = fmt.Sprintf("you owe %s", b.Person.Name)
+		default:
+			status = faintStyle.Render("settled up")
+		}
+		rows[i] = []string{b.Person.Name, fmt.Sprintf("$%.2f", b.Owed), status}
+	}
+
+	t := table.New().
+		StyleFunc(func(row, col int) lipgloss.Style {
+			if col == 1 {
+				return rightAlignStyle
+			} else {
+				return lipgloss.NewStyle()
+			}
+		}).
+		Headers("PERSON", "BALANCE", "").
+		Rows(rows...)
+	fmt.Println(t)
+}
+
+func (v *OViewPlain) ShowSharedTransactions(model *omoney.Model, shared []omoney.SharedTransaction, workingIndex int) {
+	aliases := accountAliases(model)
+	rows := make([][]string, len(shared))
+	for i, s := range shared {
+		payee := s.Transaction.Payee
+		if s.Transaction.Category == omoney.SettlementCategory {
+			payee += faintStyle.Render(" (settlement)")
+		}
+		rows[i] = []string{
+			strconv.Itoa(workingIndex + i),
+			s.Transaction.Date.Format("2006/01/02"),
+			aliases[s.Transaction.AccountId],
+			payee,
+			fmt.Sprintf("$%.2f", s.Transaction.Amount),
+			fmt.Sprintf("$%.2f", s.Share),
+		}
+	}
+
+	t := table.New().
+		StyleFunc(func(row, col int) lipgloss.Style {
+			if col == 4 || col == 5 {
+				return rightAlignStyle
+			} else {
+				return lipgloss.NewStyle()
+			}
+		}).
+		Headers("WID", "DATE", "ACCOUNT", "PAYEE", "AMOUNT", "THEIR SHARE").
+		Rows(rows...)
+	fmt.Println(t)
+}
+
+func (v *OViewPlain) ShowExpenseReports(reports []omoney.ReportSummary) {
+	rows := make([][]string, len(reports))
+	for i, r := range reports {
+		paid := faintStyle.Render("not yet")
+		if r.Deposit != nil {
+			paid = fmt.Sprintf("$%.2f on %s", -r.Deposit.Amount, r.Deposit.Date.Format("2006/01/02"))
+		}
+		rows[i] = []string{
+			r.Report.Name,
+			r.Report.Created.Format("2006/01/02"),
+			strconv.Itoa(r.Count),
+			fmt.Sprintf("$%.2f", r.Total),
+			paid,
+			fmt.Sprintf("$%.2f", r.Outstanding()),
+		}
+	}
+
+	t := table.New().
+		StyleFunc(func(row, col int) lipgloss.Style {
+			if col == 2 || col == 3 || col == 5 {
+				return rightAlignStyle
+			} else {
+				return lipgloss.NewStyle()
+			}
+		}).
+		Headers("REPORT", "CREATED", "EXPENSES", "TOTAL", "PAID BACK", "OUTSTANDING").
+		Rows(rows...)
+	fmt.Println(t)
 }
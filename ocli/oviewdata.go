@@ -0,0 +1,707 @@
+package ocli
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dknelson9876/oregano/omoney"
+	"github.com/uptrace/bun/migrate"
+)
+
+// Writes every view as json, csv, or tsv instead of a table, so that
+// output can be piped into jq or opened as a spreadsheet. Every field
+// is included regardless of the options that choose columns for tables
+type OViewData struct {
+	// One of json, csv, or tsv
+	format string
+	out    io.Writer
+}
+
+type dataAccount struct {
+	Id    string `json:"id"`
+	Alias string `json:"alias"`
+	Type  string `json:"type"`
+	// Only set when listing accounts, since it
+	// is calculated from their transactions
+	Balance *float64 `json:"balance,omitempty"`
+	// Balance plus pending transactions, also only set when listing
+	Available     *float64  `json:"available,omitempty"`
+	AnchorBalance float64   `json:"anchor_balance"`
+	AnchorTime    time.Time `json:"anchor_time"`
+	NeedsRelink   bool      `json:"needs_relink"`
+	Closed        bool      `json:"closed"`
+	// Only set for loans with terms
+	LoanPrincipal      *float64   `json:"loan_principal,omitempty"`
+	LoanApr            *float64   `json:"loan_apr,omitempty"`
+	LoanTermMonths     *int       `json:"loan_term_months,omitempty"`
+	LoanPaymentDay     *int       `json:"loan_payment_day,omitempty"`
+	LoanStart          *time.Time `json:"loan_start,omitempty"`
+	LoanMonthlyPayment *float64   `json:"loan_monthly_payment,omitempty"`
+	// Only set for credit cards with statement days
+	StatementDay *int `json:"statement_day,omitempty"`
+	DueDay       *int `json:"due_day,omitempty"`
+}
+
+type dataAlertRule struct {
+	Id   int64  `json:"id"`
+	Kind string `json:"kind"`
+	// A category for budgets, otherwise an account id
+	Target string `json:"target"`
+	// Alias of the account targeted, if any
+	Account     string  `json:"account"`
+	Amount      float64 `json:"amount"`
+	WarnPercent float64 `json:"warn_percent"`
+}
+
+type dataAlert struct {
+	Id            int64     `json:"id"`
+	RuleId        int64     `json:"rule_id"`
+	Time          time.Time `json:"time"`
+	TransactionId string    `json:"transaction_id"`
+	Message       string    `json:"message"`
+	Notified      bool      `json:"notified"`
+	Dismissed     bool      `json:"dismissed"`
+}
+
+type dataCategoryMonth struct {
+	Month    time.Time `json:"month"`
+	Category string    `json:"category"`
+	Amount   float64   `json:"amount"`
+}
+
+type dataBalancePoint struct {
+	AccountId string    `json:"account_id"`
+	Date      time.Time `json:"date"`
+	Balance   float64   `json:"balance"`
+}
+
+type dataMonthTotals struct {
+	Month    time.Time `json:"month"`
+	Income   float64   `json:"income"`
+	Expenses float64   `json:"expenses"`
+	Net      float64   `json:"net"`
+}
+
+type dataPersonBalance struct {
+	Name string `json:"name"`
+	// Positive when they owe you
+	Owed float64 `json:"owed"`
+}
+
+type dataSharedTransaction struct {
+	Wid       int       `json:"wid"`
+	Id        string    `json:"id"`
+	AccountId string    `json:"account_id"`
+	Date      time.Time `json:"date"`
+	Payee     string    `json:"payee"`
+	Category  string    `json:"category"`
+	Amount    float64   `json:"amount"`
+	Share     float64   `json:"share"`
+}
+
+type dataExpenseReport struct {
+	Id          int64     `json:"id"`
+	Name        string    `json:"name"`
+	Created     time.Time `json:"created"`
+	Count       int       `json:"count"`
+	Total       float64   `json:"total"`
+	DepositId   string    `json:"deposit_id"`
+	Outstanding float64   `json:"outstanding"`
+}
+
+type dataStatement struct {
+	AccountId       string    `json:"account_id"`
+	Account         string    `json:"account"`
+	Opening         time.Time `json:"opening"`
+	Closing         time.Time `json:"closing"`
+	Due             time.Time `json:"due"`
+	PreviousBalance float64   `json:"previous_balance"`
+	Charges         float64   `json:"charges"`
+	Credits         float64   `json:"credits"`
+	Balance         float64   `json:"balance"`
+	MinPayment      float64   `json:"min_payment"`
+	Paid            float64   `json:"paid"`
+	Status          string    `json:"status"`
+}
+
+type dataPayoff struct {
+	Strategy  string    `json:"strategy"`
+	AccountId string    `json:"account_id"`
+	Account   string    `json:"account"`
+	Balance   float64   `json:"balance"`
+	Apr       float64   `json:"apr"`
+	Minimum   float64   `json:"minimum"`
+	Priority  int       `json:"priority"`
+	PaidOff   time.Time `json:"paid_off"`
+	// Totals of the whole plan, repeated on each of its rows
+	DebtFree      time.Time `json:"debt_free"`
+	TotalInterest float64   `json:"total_interest"`
+}
+
+type dataInstallment struct {
+	Number    int       `json:"number"`
+	Date      time.Time `json:"date"`
+	Payment   float64   `json:"payment"`
+	Principal float64   `json:"principal"`
+	Interest  float64   `json:"interest"`
+	Balance   float64   `json:"balance"`
+}
+
+type dataLoanPayment struct {
+	TransactionId string    `json:"transaction_id"`
+	Date          time.Time `json:"date"`
+	Amount        float64   `json:"amount"`
+	Principal     float64   `json:"principal"`
+	Interest      float64   `json:"interest"`
+	Balance       float64   `json:"balance"`
+}
+
+type dataLoanProjection struct {
+	Extra         float64   `json:"extra"`
+	Payments      int       `json:"payments"`
+	PayoffDate    time.Time `json:"payoff_date"`
+	TotalInterest float64   `json:"total_interest"`
+}
+
+// Amounts are written as stored, without the inversion
+// that tables apply for accounts other than credit cards
+type dataTransaction struct {
+	// Only set when listing, since that adds to the working list
+	Wid             *int      `json:"wid,omitempty"`
+	Id              string    `json:"id"`
+	AccountId       string    `json:"account_id"`
+	Date            time.Time `json:"date"`
+	Payee           string    `json:"payee"`
+	Amount          float64   `json:"amount"`
+	Category        string    `json:"category"`
+	InstDescription string    `json:"inst_description"`
+	Description     string    `json:"description"`
+	Status          string    `json:"status"`
+	PendingId       string    `json:"pending_id"`
+	Reimbursable    bool      `json:"reimbursable"`
+	ReportId        int64     `json:"report_id"`
+}
+
+type dataCategoryMapping struct {
+	PlaidCategory string `json:"plaid_category"`
+	Category      string `json:"category"`
+}
+
+type dataPayeeAlias struct {
+	Key   string `json:"key"`
+	Payee string `json:"payee"`
+}
+
+type dataUnmappedCategory struct {
+	PlaidCategory string    `json:"plaid_category"`
+	Count         int       `json:"count"`
+	LastSeen      time.Time `json:"last_seen"`
+}
+
+type dataMigration struct {
+	Version string `json:"version"`
+	Comment string `json:"comment"`
+	// Nil if the migration is pending
+	MigratedAt *time.Time `json:"migrated_at"`
+}
+
+type dataAttachment struct {
+	Id            string    `json:"id"`
+	TransactionId string    `json:"transaction_id"`
+	Name          string    `json:"name"`
+	Hash          string    `json:"hash"`
+	Size          int64     `json:"size"`
+	Added         time.Time `json:"added"`
+	Path          string    `json:"path"`
+}
+
+type dataHolding struct {
+	AccountId   string     `json:"account_id"`
+	Account     string     `json:"account"`
+	Symbol      string     `json:"symbol"`
+	Quantity    float64    `json:"quantity"`
+	CostBasis   float64    `json:"cost_basis"`
+	Price       float64    `json:"price"`
+	PriceDate   *time.Time `json:"price_date"`
+	MarketValue float64    `json:"market_value"`
+	Dividends   float64    `json:"dividends"`
+}
+
+type dataLot struct {
+	Id           int64     `json:"id"`
+	AccountId    string    `json:"account_id"`
+	Symbol       string    `json:"symbol"`
+	Acquired     time.Time `json:"acquired"`
+	Quantity     float64   `json:"quantity"`
+	CostPerShare float64   `json:"cost_per_share"`
+}
+
+type dataDisposal struct {
+	SellId    int64     `json:"sell_id"`
+	LotId     int64     `json:"lot_id"`
+	AccountId string    `json:"account_id"`
+	Account   string    `json:"account"`
+	Symbol    string    `json:"symbol"`
+	Quantity  float64   `json:"quantity"`
+	Acquired  time.Time `json:"acquired"`
+	Sold      time.Time `json:"sold"`
+	Proceeds  float64   `json:"proceeds"`
+	CostBasis float64   `json:"cost_basis"`
+	Gain      float64   `json:"gain"`
+	Term      string    `json:"term"`
+	WashSale  bool      `json:"wash_sale"`
+}
+
+type dataInvestmentEvent struct {
+	Id        int64     `json:"id"`
+	AccountId string    `json:"account_id"`
+	Symbol    string    `json:"symbol"`
+	Kind      string    `json:"kind"`
+	Date      time.Time `json:"date"`
+	Quantity  float64   `json:"quantity"`
+	Price     float64   `json:"price"`
+	Amount    float64   `json:"amount"`
+	Fees      float64   `json:"fees"`
+	Method    string    `json:"method"`
+}
+
+func NewOViewData(format string, out io.Writer) *OViewData {
+	return &OViewData{
+		format: format,
+		out:    out,
+	}
+}
+
+func (v *OViewData) ShowAccounts(model *omoney.Model, ops ...ShowAccountOptions) {
+	var op ShowAccountOptions
+	if len(ops) == 1 {
+		op = ops[0]
+	}
+	accounts := listedAccounts(model, op)
+	records := make([]dataAccount, len(accounts))
+	for i, acc := range accounts {
+		bal, err := model.GetCurrentBalance(acc.Id)
+		if err != nil {
+			fmt.Printf("Error calculating balance: %s\n", err)
+			return
+		}
+		available, err := model.GetAvailableBalance(acc.Id)
+		if err != nil {
+			fmt.Printf("Error calculating balance: %s\n", err)
+			return
+		}
+		records[i] = toDataAccount(acc)
+		records[i].Balance = &bal
+		records[i].Available = &available
+	}
+	v.writeList(records)
+}
+
+func (v *OViewData) ShowAccount(acc omoney.Account) {
+	v.writeOne(toDataAccount(acc))
+}
+
+func (v *OViewData) ShowTransactions(trs []omoney.Transaction, invert bool, workingIndex int) {
+	records := make([]dataTransaction, len(trs))
+	for i, tr := range trs {
+		wid := workingIndex + i
+		records[i] = toDataTransaction(tr)
+		records[i].Wid = &wid
+	}
+	v.writeList(records)
+}
+
+func (v *OViewData) ShowTransaction(tr omoney.Transaction, ops ...ShowTransactionOptions) {
+	v.writeOne(toDataTransaction(tr))
+}
+
+func (v *OViewData) ShowCategoryMappings(mappings []omoney.CategoryMapping) {
+	records := make([]dataCategoryMapping, len(mappings))
+	for i, mapping := range mappings {
+		records[i] = dataCategoryMapping{mapping.PlaidCategory, mapping.Category}
+	}
+	v.writeList(records)
+}
+
+func (v *OViewData) ShowUnmappedCategories(unmapped []omoney.UnmappedCategory) {
+	records := make([]dataUnmappedCategory, len(unmapped))
+	for i, u := range unmapped {
+		records[i] = dataUnmappedCategory{u.PlaidCategory, u.Count, u.LastSeen}
+	}
+	v.writeList(records)
+}
+
+func (v *OViewData) ShowPayeeAliases(aliases []omoney.PayeeAlias) {
+	records := make([]dataPayeeAlias, len(aliases))
+	for i, alias := range aliases {
+		records[i] = dataPayeeAlias{alias.Key, alias.Payee}
+	}
+	v.writeList(records)
+}
+
+func (v *OViewData) ShowMigrations(ms migrate.MigrationSlice) {
+	records := make([]dataMigration, len(ms))
+	for i, m := range ms {
+		records[i] = dataMigration{Version: m.Name, Comment: m.Comment}
+		if m.IsApplied() {
+			migratedAt := m.MigratedAt
+			records[i].MigratedAt = &migratedAt
+		}
+	}
+	v.writeList(records)
+}
+
+func (v *OViewData) ShowAttachments(atts []omoney.Attachment) {
+	records := make([]dataAttachment, len(atts))
+	for i, att := range atts {
+		records[i] = dataAttachment{att.Id, att.TransactionId, att.Name, att.Hash, att.Size, att.Added, att.Path}
+	}
+	v.writeList(records)
+}
+
+func toDataAccount(acc omoney.Account) dataAccount {
+	data := dataAccount{
+		Id:            acc.Id,
+		Alias:         acc.Alias,
+		Type:          string(acc.Type),
+		AnchorBalance: acc.AnchorBalance,
+		AnchorTime:    acc.AnchorTime,
+		NeedsRelink:   acc.NeedsRelink,
+		Closed:        acc.Closed,
+	}
+	if acc.Loan.IsSet() {
+		loan := acc.Loan
+		payment := loan.MonthlyPayment()
+		data.LoanPrincipal = &loan.Principal
+		data.LoanApr = &loan.Apr
+		data.LoanTermMonths = &loan.TermMonths
+		data.LoanPaymentDay = &loan.PaymentDay
+		data.LoanStart = &loan.Start
+		data.LoanMonthlyPayment = &payment
+	}
+	if acc.StatementDay != 0 {
+		data.StatementDay = &acc.StatementDay
+		data.DueDay = &acc.DueDay
+	}
+	return data
+}
+
+func toDataTransaction(tr omoney.Transaction) dataTransaction {
+	return dataTransaction{
+		Id:              tr.Id,
+		AccountId:       tr.AccountId,
+		Date:            tr.Date,
+		Payee:           tr.Payee,
+		Amount:          tr.Amount,
+		Category:        tr.Category,
+		InstDescription: tr.InstDescription,
+		Description:     tr.Description,
+		Status:          string(tr.Status),
+		PendingId:       tr.PendingId,
+		Reimbursable:    tr.Reimbursable,
+		ReportId:        tr.ReportId,
+	}
+}
+
+// Write a single record, as a json object or a csv/tsv with one row
+func (v *OViewData) writeOne(record interface{}) {
+	if v.format == "json" {
+		v.writeJson(record)
+		return
+	}
+
+	list := reflect.MakeSlice(reflect.SliceOf(reflect.TypeOf(record)), 0, 1)
+	v.writeList(reflect.Append(list, reflect.ValueOf(record)).Interface())
+}
+
+// Write a slice of records, as a json array or as csv/tsv with a header
+// row named by the json tags of the record's fields
+func (v *OViewData) writeList(records interface{}) {
+	if v.format == "json" {
+		v.writeJson(records)
+		return
+	}
+
+	w := csv.NewWriter(v.out)
+	if v.format == "tsv" {
+		w.Comma = '\t'
+	}
+
+	list := reflect.ValueOf(records)
+	recordType := list.Type().Elem()
+
+	header := make([]string, recordType.NumField())
+	for i := range header {
+		header[i] = strings.Split(recordType.Field(i).Tag.Get("json"), ",")[0]
+	}
+	w.Write(header)
+
+	for i := 0; i < list.Len(); i++ {
+		record := list.Index(i)
+		row := make([]string, record.NumField())
+		for j := range row {
+			row[j] = formatDataField(record.Field(j))
+		}
+		w.Write(row)
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		fmt.Printf("Error writing %s: %s\n", v.format, err)
+	}
+}
+
+func (v *OViewData) writeJson(value interface{}) {
+	enc := json.NewEncoder(v.out)
+	enc.SetIndent("", "  ")
+	err := enc.Encode(value)
+	if err != nil {
+		fmt.Printf("Error writing json: %s\n", err)
+	}
+}
+
+// Format a field for a csv/tsv cell. Times are RFC 3339 to match
+// json, and nil pointers are left empty
+func formatDataField(field reflect.Value) string {
+	if field.Kind() == reflect.Pointer {
+		if field.IsNil() {
+			return ""
+		}
+		field = field.Elem()
+	}
+
+	switch value := field.Interface().(type) {
+	case time.Time:
+		return value.Format(time.RFC3339)
+	case float64:
+		return strconv.FormatFloat(value, 'f', 2, 64)
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+func (v *OViewData) ShowHoldings(model *omoney.Model, holdings []omoney.Holding) {
+	aliases := accountAliases(model)
+	records := make([]dataHolding, len(holdings))
+	for i, h := range holdings {
+		records[i] = dataHolding{
+			AccountId:   h.AccountId,
+			Account:     aliases[h.AccountId],
+			Symbol:      h.Symbol,
+			Quantity:    h.Quantity,
+			CostBasis:   h.CostBasis,
+			Price:       h.Price,
+			MarketValue: h.MarketValue,
+			Dividends:   h.Dividends,
+		}
+		if !h.PriceDate.IsZero() {
+			priceDate := h.PriceDate
+			records[i].PriceDate = &priceDate
+		}
+	}
+	v.writeList(records)
+}
+
+func (v *OViewData) ShowLots(lots []omoney.Lot) {
+	records := make([]dataLot, len(lots))
+	for i, lot := range lots {
+		records[i] = dataLot{lot.Id, lot.AccountId, lot.Symbol, lot.Acquired, lot.Quantity, lot.CostPerShare}
+	}
+	v.writeList(records)
+}
+
+func (v *OViewData) ShowInvestmentEvents(events []omoney.InvestmentEvent) {
+	records := make([]dataInvestmentEvent, len(events))
+	for i, ev := range events {
+		records[i] = dataInvestmentEvent{ev.Id, ev.AccountId, ev.Symbol, string(ev.Kind), ev.Date, ev.Quantity, ev.Price, ev.Amount, ev.Fees, string(ev.Method)}
+	}
+	v.writeList(records)
+}
+
+func (v *OViewData) ShowCapitalGains(model *omoney.Model, gains []omoney.Disposal) {
+	aliases := accountAliases(model)
+	records := make([]dataDisposal, len(gains))
+	for i, d := range gains {
+		term := "short"
+		if d.LongTerm {
+			term = "long"
+		}
+		records[i] = dataDisposal{
+			SellId:    d.SellId,
+			LotId:     d.LotId,
+			AccountId: d.AccountId,
+			Account:   aliases[d.AccountId],
+			Symbol:    d.Symbol,
+			Quantity:  d.Quantity,
+			Acquired:  d.Acquired,
+			Sold:      d.Sold,
+			Proceeds:  d.Proceeds,
+			CostBasis: d.CostBasis,
+			Gain:      d.Gain,
+			Term:      term,
+			WashSale:  d.WashSale,
+		}
+	}
+	v.writeList(records)
+}
+
+func (v *OViewData) ShowInstallments(installments []omoney.Installment) {
+	records := make([]dataInstallment, len(installments))
+	for i, in := range installments {
+		records[i] = dataInstallment{in.Number, in.Date, in.Payment, in.Principal, in.Interest, in.Balance}
+	}
+	v.writeList(records)
+}
+
+func (v *OViewData) ShowLoanPayments(payments []omoney.LoanPayment) {
+	records := make([]dataLoanPayment, len(payments))
+	for i, p := range payments {
+		records[i] = dataLoanPayment{p.TransactionId, p.Date, p.Amount, p.Principal, p.Interest, p.Balance}
+	}
+	v.writeList(records)
+}
+
+func (v *OViewData) ShowLoanProjections(projections []omoney.LoanProjection) {
+	records := make([]dataLoanProjection, len(projections))
+	for i, p := range projections {
+		records[i] = dataLoanProjection{p.Extra, len(p.Installments), p.PayoffDate, p.TotalInterest}
+	}
+	v.writeList(records)
+}
+
+func (v *OViewData) ShowPayoffPlans(debts []omoney.Debt, plans []omoney.PayoffPlan) {
+	records := make([]dataPayoff, 0, len(debts)*len(plans))
+	for _, plan := range plans {
+		for _, d := range debts {
+			records = append(records, dataPayoff{
+				Strategy:      string(plan.Strategy),
+				AccountId:     d.AccountId,
+				Account:       d.Alias,
+				Balance:       d.Balance,
+				Apr:           d.Apr,
+				Minimum:       d.MinPayment,
+				Priority:      slices.Index(plan.Order, d.AccountId) + 1,
+				PaidOff:       plan.PaidOff[d.AccountId],
+				DebtFree:      plan.DebtFree,
+				TotalInterest: plan.TotalInterest,
+			})
+		}
+	}
+	v.writeList(records)
+}
+
+func (v *OViewData) ShowStatements(statements []omoney.Statement, now time.Time) {
+	records := make([]dataStatement, len(statements))
+	for i, s := range statements {
+		records[i] = dataStatement{
+			AccountId:       s.AccountId,
+			Account:         s.Alias,
+			Opening:         s.Opening,
+			Closing:         s.Closing,
+			Due:             s.Due,
+			PreviousBalance: s.PreviousBalance,
+			Charges:         s.Charges,
+			Credits:         s.Credits,
+			Balance:         s.Balance,
+			MinPayment:      s.MinPayment,
+			Paid:            s.Paid,
+			Status:          string(s.Status(now)),
+		}
+	}
+	v.writeList(records)
+}
+
+func (v *OViewData) ShowAlertRules(model *omoney.Model, rules []omoney.AlertRule) {
+	aliases := accountAliases(model)
+	records := make([]dataAlertRule, len(rules))
+	for i, r := range rules {
+		records[i] = dataAlertRule{
+			Id:          r.Id,
+			Kind:        string(r.Kind),
+			Target:      r.Target,
+			Amount:      r.Amount,
+			WarnPercent: r.WarnPercent,
+		}
+		if r.Kind != omoney.AlertBudget {
+			records[i].Account = aliases[r.Target]
+		}
+	}
+	v.writeList(records)
+}
+
+func (v *OViewData) ShowAlerts(alerts []omoney.Alert) {
+	records := make([]dataAlert, len(alerts))
+	for i, a := range alerts {
+		records[i] = dataAlert{a.Id, a.RuleId, a.Time, a.TransactionId, a.Message, a.Notified, a.Dismissed}
+	}
+	v.writeList(records)
+}
+
+func (v *OViewData) ShowCategoryTrend(months []omoney.MonthTotals) {
+	categories, _ := spendingCategories(months)
+	records := make([]dataCategoryMonth, 0, len(months)*len(categories))
+	for _, month := range months {
+		for _, category := range categories {
+			records = append(records, dataCategoryMonth{month.Month, category, month.Categories[category]})
+		}
+	}
+	v.writeList(records)
+}
+
+func (v *OViewData) ShowBalanceHistory(acc omoney.Account, points []omoney.BalancePoint) {
+	records := make([]dataBalancePoint, len(points))
+	for i, p := range points {
+		records[i] = dataBalancePoint{acc.Id, p.Date, p.Balance}
+	}
+	v.writeList(records)
+}
+
+func (v *OViewData) ShowIncomeExpense(months []omoney.MonthTotals) {
+	records := make([]dataMonthTotals, len(months))
+	for i, month := range months {
+		records[i] = dataMonthTotals{month.Month, month.Income, month.Expenses, month.Net()}
+	}
+	v.writeList(records)
+}
+
+func (v *OViewData) ShowPersonBalances(balances []omoney.PersonBalance) {
+	records := make([]dataPersonBalance, len(balances))
+	for i, b := range balances {
+		records[i] = dataPersonBalance{b.Person.Name, b.Owed}
+	}
+	v.writeList(records)
+}
+
+func (v *OViewData) ShowSharedTransactions(model *omoney.Model, shared []omoney.SharedTransaction, workingIndex int) {
+	records := make([]dataSharedTransaction, len(shared))
+	for i, s := range shared {
+		tr := s.Transaction
+		records[i] = dataSharedTransaction{workingIndex + i, tr.Id, tr.AccountId, tr.Date, tr.Payee, tr.Category, tr.Amount, s.Share}
+	}
+	v.writeList(records)
+}
+
+func (v *OViewData) ShowExpenseReports(reports []omoney.ReportSummary) {
+	records := make([]dataExpenseReport, len(reports))
+	for i, r := range reports {
+		records[i] = dataExpenseReport{
+			Id:          r.Report.Id,
+			Name:        r.Report.Name,
+			Created:     r.Report.Created,
+			Count:       r.Count,
+			Total:       r.Total,
+			Outstanding: r.Outstanding(),
+		}
+		if r.Deposit != nil {
+			records[i].DepositId = r.Deposit.Id
+		}
+	}
+	v.writeList(records)
+}
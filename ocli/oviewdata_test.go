@@ -0,0 +1,59 @@
+package ocli
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dknelson9876/oregano/omoney"
+)
+
+func testDataTransactions() []omoney.Transaction {
+	date := time.Date(2024, 01, 02, 12, 0, 0, 0, time.UTC)
+	return []omoney.Transaction{
+		*omoney.NewTransaction("acc", "Spotify", 10.99, omoney.WithDate(date), omoney.WithCategory("music")),
+		*omoney.NewTransaction("acc", "Joe's, Inc", 5, omoney.WithDate(date)),
+	}
+}
+
+func TestOViewDataJson(t *testing.T) {
+	var out bytes.Buffer
+	NewOViewData("json", &out).ShowTransactions(testDataTransactions(), true, 3)
+
+	var records []map[string]interface{}
+	err := json.Unmarshal(out.Bytes(), &records)
+	if err != nil {
+		t.Fatalf("Output is not valid json: %s\n%s", err, out.String())
+	}
+	if len(records) != 2 || records[0]["wid"] != 3.0 || records[0]["amount"] != 10.99 || records[0]["category"] != "music" {
+		t.Fatalf("Unexpected json output: %s", out.String())
+	}
+}
+
+func TestOViewDataCsv(t *testing.T) {
+	var out bytes.Buffer
+	NewOViewData("csv", &out).ShowTransactions(testDataTransactions(), true, 0)
+
+	lines := strings.Split(strings.TrimRight(out.String(), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected header and 2 rows, got:\n%s", out.String())
+	}
+	if lines[0] != "wid,id,account_id,date,payee,amount,category,inst_description,description,status,pending_id,reimbursable,report_id" {
+		t.Fatalf("Unexpected header: %s", lines[0])
+	}
+	if !strings.HasPrefix(lines[2], "1,") || !strings.Contains(lines[2], `,2024-01-02T12:00:00Z,"Joe's, Inc",5.00,`) {
+		t.Fatalf("Unexpected row: %s", lines[2])
+	}
+}
+
+func TestOViewDataTsvSingle(t *testing.T) {
+	var out bytes.Buffer
+	NewOViewData("tsv", &out).ShowTransaction(testDataTransactions()[0])
+
+	lines := strings.Split(strings.TrimRight(out.String(), "\n"), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[1], "\tSpotify\t10.99\tmusic\t") {
+		t.Fatalf("Unexpected tsv output:\n%s", out.String())
+	}
+}
@@ -0,0 +1,590 @@
+package ocli
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/araddon/dateparse"
+	"github.com/dknelson9876/oregano/omoney"
+)
+
+const (
+	// Number of transactions returned per page when no limit is given
+	defaultPageLimit = 50
+	// Largest page of transactions that will be returned at once
+	maxPageLimit = 500
+)
+
+// Serves the model as a JSON REST API on the local machine, so that
+// scripts and other tools can read and change accounts and transactions
+type ApiServer struct {
+	Model *omoney.Model
+	// Bearer token that every request must present
+	Token string
+
+	// requests are handled one at a time, since the model
+	// is not safe to use from several goroutines at once
+	mu  sync.Mutex
+	srv *http.Server
+}
+
+// The body of every response that is not a success
+type apiError struct {
+	Error apiErrorDetail `json:"error"`
+}
+
+type apiErrorDetail struct {
+	// Short machine readable reason, such as "not_found"
+	Code string `json:"code"`
+	// Human readable explanation
+	Message string `json:"message"`
+}
+
+type apiAccount struct {
+	Id            string    `json:"id"`
+	Alias         string    `json:"alias"`
+	Type          string    `json:"type"`
+	AnchorBalance float64   `json:"anchor_balance"`
+	AnchorTime    time.Time `json:"anchor_time"`
+	// Whether the account is linked through Plaid. The
+	// token itself is never exposed
+	Linked      bool `json:"linked"`
+	NeedsRelink bool `json:"needs_relink"`
+	Closed      bool `json:"closed"`
+}
+
+type apiBalance struct {
+	AccountId string  `json:"account_id"`
+	Alias     string  `json:"alias"`
+	Balance   float64 `json:"balance"`
+	// Balance plus pending transactions
+	Available float64 `json:"available"`
+}
+
+type apiTransaction struct {
+	Id              string    `json:"id"`
+	AccountId       string    `json:"account_id"`
+	Payee           string    `json:"payee"`
+	Amount          float64   `json:"amount"`
+	Date            time.Time `json:"date"`
+	Category        string    `json:"category"`
+	InstDescription string    `json:"inst_description"`
+	Description     string    `json:"description"`
+	Status          string    `json:"status"`
+	Reimbursable    bool      `json:"reimbursable"`
+}
+
+// One page of a listing, along with the total number of matches
+type apiPage struct {
+	Items  interface{} `json:"items"`
+	Total  int         `json:"total"`
+	Limit  int         `json:"limit"`
+	Offset int         `json:"offset"`
+}
+
+type apiAccountInput struct {
+	Alias string `json:"alias"`
+	Type  string `json:"type"`
+}
+
+// Fields of a transaction that can be set when creating or updating.
+// Fields left out of an update are not changed
+type apiTransactionInput struct {
+	Account     *string  `json:"account"`
+	Payee       *string  `json:"payee"`
+	Amount      *float64 `json:"amount"`
+	Date        *string  `json:"date"`
+	Category    *string  `json:"category"`
+	Description *string  `json:"description"`
+}
+
+func NewApiServer(model *omoney.Model, token string) *ApiServer {
+	return &ApiServer{
+		Model: model,
+		Token: token,
+	}
+}
+
+// Serve the API on addr until Shutdown is called
+func (s *ApiServer) ListenAndServe(addr string) error {
+	s.srv = &http.Server{Addr: addr, Handler: s}
+
+	log.Printf("Serving API on http://%s/api/ ...\n", addr)
+	err := s.srv.ListenAndServe()
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// Stop accepting requests, waiting for those in progress to finish
+func (s *ApiServer) Shutdown(ctx context.Context) error {
+	if s.srv == nil {
+		return nil
+	}
+	return s.srv.Shutdown(ctx)
+}
+
+func (s *ApiServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeApiError(w, http.StatusUnauthorized, "unauthorized", "missing or invalid bearer token")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// /api/[resource]/(id)
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api"), "/")
+	parts := strings.Split(path, "/")
+	if !strings.HasPrefix(r.URL.Path, "/api/") || len(parts) > 2 {
+		writeApiError(w, http.StatusNotFound, "not_found", "no such endpoint")
+		return
+	}
+
+	id := ""
+	if len(parts) == 2 {
+		id = parts[1]
+	}
+
+	switch {
+	case parts[0] == "accounts" && id == "":
+		switch r.Method {
+		case http.MethodGet:
+			s.listAccounts(w, r)
+		case http.MethodPost:
+			s.createAccount(w, r)
+		default:
+			writeMethodNotAllowed(w, "GET, POST")
+		}
+	case parts[0] == "accounts":
+		switch r.Method {
+		case http.MethodGet:
+			s.getAccount(w, id)
+		case http.MethodDelete:
+			s.deleteAccount(w, r, id)
+		default:
+			writeMethodNotAllowed(w, "GET, DELETE")
+		}
+	case parts[0] == "balances" && id == "":
+		if r.Method != http.MethodGet {
+			writeMethodNotAllowed(w, "GET")
+			return
+		}
+		s.listBalances(w, r)
+	case parts[0] == "transactions" && id == "":
+		switch r.Method {
+		case http.MethodGet:
+			s.listTransactions(w, r)
+		case http.MethodPost:
+			s.createTransaction(w, r)
+		default:
+			writeMethodNotAllowed(w, "GET, POST")
+		}
+	case parts[0] == "transactions":
+		switch r.Method {
+		case http.MethodGet:
+			s.getTransaction(w, id)
+		case http.MethodPatch:
+			s.updateTransaction(w, r, id)
+		case http.MethodDelete:
+			s.deleteTransaction(w, id)
+		default:
+			writeMethodNotAllowed(w, "GET, PATCH, DELETE")
+		}
+	default:
+		writeApiError(w, http.StatusNotFound, "not_found", "no such endpoint")
+	}
+}
+
+func (s *ApiServer) authorized(r *http.Request) bool {
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found || s.Token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.Token)) == 1
+}
+
+// GET /api/accounts(?closed=true)
+func (s *ApiServer) listAccounts(w http.ResponseWriter, r *http.Request) {
+	accs := listedAccounts(s.Model, ShowAccountOptions{ShowClosed: r.URL.Query().Get("closed") == "true"})
+	items := make([]apiAccount, len(accs))
+	for i, acc := range accs {
+		items[i] = toApiAccount(acc)
+	}
+	writeJson(w, http.StatusOK, items)
+}
+
+// POST /api/accounts
+func (s *ApiServer) createAccount(w http.ResponseWriter, r *http.Request) {
+	var input apiAccountInput
+	if !readJson(w, r, &input) {
+		return
+	}
+
+	acc, err := BuildManualAccount([]string{input.Alias, input.Type})
+	if err != nil {
+		writeApiError(w, http.StatusBadRequest, "invalid_account", err.Error())
+		return
+	}
+	if input.Alias == "" {
+		writeApiError(w, http.StatusBadRequest, "invalid_account", "alias is required")
+		return
+	}
+	if s.Model.IsValidAccountAlias(input.Alias) {
+		writeApiError(w, http.StatusConflict, "conflict",
+			fmt.Sprintf("an account with alias %s already exists", input.Alias))
+		return
+	}
+
+	err = s.Model.AddAccount(*acc)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	writeJson(w, http.StatusCreated, toApiAccount(*acc))
+}
+
+// GET /api/accounts/{id or alias}
+func (s *ApiServer) getAccount(w http.ResponseWriter, id string) {
+	acc, err := s.Model.GetAccount(id)
+	if err != nil {
+		writeApiError(w, http.StatusNotFound, "not_found", err.Error())
+		return
+	}
+	writeJson(w, http.StatusOK, toApiAccount(acc))
+}
+
+// DELETE /api/accounts/{id or alias}(?cascade=true)
+func (s *ApiServer) deleteAccount(w http.ResponseWriter, r *http.Request, id string) {
+	if _, err := s.Model.GetAccount(id); err != nil {
+		writeApiError(w, http.StatusNotFound, "not_found", err.Error())
+		return
+	}
+
+	cascade := r.URL.Query().Get("cascade") == "true"
+	err := s.Model.RemoveAccount(id, cascade)
+	if errors.Is(err, omoney.ErrAccountHasTransactions) {
+		writeApiError(w, http.StatusConflict, "conflict", err.Error())
+		return
+	} else if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GET /api/balances(?closed=true)
+func (s *ApiServer) listBalances(w http.ResponseWriter, r *http.Request) {
+	accs := listedAccounts(s.Model, ShowAccountOptions{ShowClosed: r.URL.Query().Get("closed") == "true"})
+	items := make([]apiBalance, len(accs))
+	for i, acc := range accs {
+		bal, err := s.Model.GetCurrentBalance(acc.Id)
+		if err != nil {
+			writeInternalError(w, err)
+			return
+		}
+		available, err := s.Model.GetAvailableBalance(acc.Id)
+		if err != nil {
+			writeInternalError(w, err)
+			return
+		}
+		items[i] = apiBalance{
+			AccountId: acc.Id,
+			Alias:     acc.Alias,
+			Balance:   bal,
+			Available: available,
+		}
+	}
+	writeJson(w, http.StatusOK, items)
+}
+
+// GET /api/transactions?account=&start=&end=&q=&limit=&offset=
+func (s *ApiServer) listTransactions(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	op := omoney.GetTransactionsOptions{Count: defaultPageLimit}
+
+	accId := ""
+	if account := query.Get("account"); account != "" {
+		acc, err := s.Model.GetAccount(account)
+		if err != nil {
+			writeApiError(w, http.StatusBadRequest, "invalid_query", err.Error())
+			return
+		}
+		accId = acc.Id
+	}
+
+	if q := query.Get("q"); q != "" {
+		parsed, err := omoney.ParseQuery(q)
+		if err != nil {
+			writeApiError(w, http.StatusBadRequest, "invalid_query", err.Error())
+			return
+		}
+		op.Query = parsed
+	}
+
+	for param, dest := range map[string]**time.Time{"start": &op.StartDate, "end": &op.EndDate} {
+		if value := query.Get(param); value != "" {
+			date, err := dateparse.ParseLocal(value)
+			if err != nil {
+				writeApiError(w, http.StatusBadRequest, "invalid_query",
+					fmt.Sprintf("unable to parse %s date %s", param, value))
+				return
+			}
+			*dest = &date
+		}
+	}
+
+	for param, dest := range map[string]*int{"limit": &op.Count, "offset": &op.Offset} {
+		if value := query.Get(param); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				writeApiError(w, http.StatusBadRequest, "invalid_query",
+					fmt.Sprintf("%s must be a non-negative integer", param))
+				return
+			}
+			*dest = n
+		}
+	}
+	if op.Count > maxPageLimit {
+		op.Count = maxPageLimit
+	}
+
+	total, err := s.Model.CountTransactions(accId, op)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	var trs []omoney.Transaction
+	if accId != "" {
+		trs, err = s.Model.GetTransactionsByAccount(accId, op)
+	} else {
+		trs, err = s.Model.GetTransactions(op)
+	}
+	if err != nil && err != sql.ErrNoRows {
+		writeInternalError(w, err)
+		return
+	}
+
+	items := make([]apiTransaction, len(trs))
+	for i, tr := range trs {
+		items[i] = toApiTransaction(tr)
+	}
+	writeJson(w, http.StatusOK, apiPage{
+		Items:  items,
+		Total:  total,
+		Limit:  op.Count,
+		Offset: op.Offset,
+	})
+}
+
+// POST /api/transactions
+func (s *ApiServer) createTransaction(w http.ResponseWriter, r *http.Request) {
+	var input apiTransactionInput
+	if !readJson(w, r, &input) {
+		return
+	}
+	if input.Account == nil || input.Payee == nil || input.Amount == nil {
+		writeApiError(w, http.StatusBadRequest, "invalid_transaction",
+			"account, payee, and amount are required")
+		return
+	}
+
+	acc, err := s.Model.GetAccount(*input.Account)
+	if err != nil {
+		writeApiError(w, http.StatusBadRequest, "invalid_transaction", err.Error())
+		return
+	}
+
+	// build the same arguments `new tr` takes, so that
+	// both are validated the same way
+	args := []string{acc.Id, *input.Payee, formatAmount(*input.Amount)}
+	if input.Date != nil {
+		args = append(args, "-t", *input.Date)
+	}
+	if input.Category != nil {
+		args = append(args, "-c", *input.Category)
+	}
+	if input.Description != nil {
+		args = append(args, "-d", *input.Description)
+	}
+
+	tr, err := BuildManualTransaction(args)
+	if err != nil {
+		writeApiError(w, http.StatusBadRequest, "invalid_transaction", err.Error())
+		return
+	}
+
+	err = s.Model.AddTransaction(tr)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	writeJson(w, http.StatusCreated, toApiTransaction(*tr))
+}
+
+// GET /api/transactions/{id}
+func (s *ApiServer) getTransaction(w http.ResponseWriter, id string) {
+	tr, err := s.Model.GetTransactionById(id)
+	if err == sql.ErrNoRows {
+		writeApiError(w, http.StatusNotFound, "not_found", fmt.Sprintf("no transaction with id %s", id))
+		return
+	} else if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, toApiTransaction(tr))
+}
+
+// PATCH /api/transactions/{id}
+func (s *ApiServer) updateTransaction(w http.ResponseWriter, r *http.Request, id string) {
+	var input apiTransactionInput
+	if !readJson(w, r, &input) {
+		return
+	}
+
+	if _, err := s.Model.GetTransactionById(id); err == sql.ErrNoRows {
+		writeApiError(w, http.StatusNotFound, "not_found", fmt.Sprintf("no transaction with id %s", id))
+		return
+	}
+
+	// build the same flags `edit` takes, so that
+	// both are validated the same way
+	var tokens []string
+	if input.Account != nil {
+		tokens = append(tokens, "--account", *input.Account)
+	}
+	if input.Payee != nil {
+		tokens = append(tokens, "--payee", *input.Payee)
+	}
+	if input.Amount != nil {
+		tokens = append(tokens, "--amount", formatAmount(*input.Amount))
+	}
+	if input.Date != nil {
+		tokens = append(tokens, "--date", *input.Date)
+	}
+	if input.Category != nil {
+		tokens = append(tokens, "--category", *input.Category)
+	}
+	if input.Description != nil {
+		tokens = append(tokens, "--desc", *input.Description)
+	}
+	if len(tokens) == 0 {
+		writeApiError(w, http.StatusBadRequest, "invalid_transaction", "no fields to update")
+		return
+	}
+
+	ops, err := BuildTransactionUpdates(s.Model, tokens)
+	if err != nil {
+		writeApiError(w, http.StatusBadRequest, "invalid_transaction", err.Error())
+		return
+	}
+
+	err = s.Model.UpdateTransaction(id, ops...)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	s.getTransaction(w, id)
+}
+
+// DELETE /api/transactions/{id}
+func (s *ApiServer) deleteTransaction(w http.ResponseWriter, id string) {
+	if _, err := s.Model.GetTransactionById(id); err == sql.ErrNoRows {
+		writeApiError(w, http.StatusNotFound, "not_found", fmt.Sprintf("no transaction with id %s", id))
+		return
+	}
+
+	err := s.Model.RemoveTransactionById(id)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func toApiAccount(acc omoney.Account) apiAccount {
+	return apiAccount{
+		Id:            acc.Id,
+		Alias:         acc.Alias,
+		Type:          string(acc.Type),
+		AnchorBalance: acc.AnchorBalance,
+		AnchorTime:    acc.AnchorTime,
+		Linked:        acc.PlaidToken != "",
+		NeedsRelink:   acc.NeedsRelink,
+		Closed:        acc.Closed,
+	}
+}
+
+func toApiTransaction(tr omoney.Transaction) apiTransaction {
+	return apiTransaction{
+		Id:              tr.Id,
+		AccountId:       tr.AccountId,
+		Payee:           tr.Payee,
+		Amount:          tr.Amount,
+		Date:            tr.Date,
+		Category:        tr.Category,
+		InstDescription: tr.InstDescription,
+		Description:     tr.Description,
+		Status:          string(tr.Status),
+		Reimbursable:    tr.Reimbursable,
+	}
+}
+
+func formatAmount(amount float64) string {
+	return strconv.FormatFloat(amount, 'f', -1, 64)
+}
+
+// Decode the request body into v, writing an error response and
+// returning false if it is not valid JSON
+func readJson(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(v)
+	if err != nil {
+		writeApiError(w, http.StatusBadRequest, "invalid_body",
+			fmt.Sprintf("malformed JSON body: %s", err))
+		return false
+	}
+	return true
+}
+
+func writeJson(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		log.Printf("Failed to write API response: %s\n", err)
+	}
+}
+
+func writeApiError(w http.ResponseWriter, status int, code string, message string) {
+	writeJson(w, status, apiError{apiErrorDetail{Code: code, Message: message}})
+}
+
+func writeMethodNotAllowed(w http.ResponseWriter, allowed string) {
+	w.Header().Set("Allow", allowed)
+	writeApiError(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed on this endpoint")
+}
+
+// Log the details of an unexpected error, but keep them out of the response
+func writeInternalError(w http.ResponseWriter, err error) {
+	log.Printf("API error: %s\n", err)
+	if errors.Is(err, omoney.ErrSecretsLocked) {
+		writeApiError(w, http.StatusServiceUnavailable, "locked", "secrets are locked")
+		return
+	}
+	writeApiError(w, http.StatusInternalServerError, "internal", "internal server error")
+}
@@ -0,0 +1,186 @@
+package ocli
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dknelson9876/oregano/omoney"
+)
+
+const testApiToken = "test-token"
+
+func newTestApiServer(t *testing.T) *ApiServer {
+	model, err := LoadModelFromDB(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	acc := omoney.NewAccount(omoney.WithAlias("chase"), omoney.WithAccountType(omoney.Checking))
+	err = model.AddAccount(*acc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		tr := omoney.NewTransaction(acc.Id, fmt.Sprintf("payee%d", i), float64(10*i),
+			omoney.WithDate(time.Date(2024, 01, i+1, 12, 0, 0, 0, time.Local)))
+		err = model.AddTransaction(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return NewApiServer(model, testApiToken)
+}
+
+func doApiRequest(s *ApiServer, method string, target string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+testApiToken)
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestApiRejectsBadToken(t *testing.T) {
+	s := newTestApiServer(t)
+
+	for _, header := range []string{"", "Bearer wrong", testApiToken} {
+		req := httptest.NewRequest(http.MethodGet, "/api/accounts", nil)
+		req.Header.Set("Authorization", header)
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("Authorization %q accepted with status %d", header, rec.Code)
+		}
+		var body apiError
+		if json.Unmarshal(rec.Body.Bytes(), &body) != nil || body.Error.Code != "unauthorized" {
+			t.Fatalf("Unexpected error body: %s", rec.Body.String())
+		}
+	}
+}
+
+func TestApiListTransactionsPaginates(t *testing.T) {
+	s := newTestApiServer(t)
+
+	rec := doApiRequest(s, http.MethodGet, "/api/transactions?account=chase&limit=2&offset=1", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("List transactions failed with %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var page struct {
+		Items []apiTransaction `json:"items"`
+		Total int              `json:"total"`
+	}
+	err := json.Unmarshal(rec.Body.Bytes(), &page)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if page.Total != 5 || len(page.Items) != 2 {
+		t.Fatalf("Pagination failed"+
+			"\nhave total %d, items %d"+
+			"\nneed total %d, items %d",
+			page.Total, len(page.Items), 5, 2)
+	}
+	// newest first, skipping the newest
+	if page.Items[0].Payee != "payee3" || page.Items[1].Payee != "payee2" {
+		t.Fatalf("Wrong page returned: %+v", page.Items)
+	}
+}
+
+func TestApiCreateUpdateDeleteTransaction(t *testing.T) {
+	s := newTestApiServer(t)
+
+	rec := doApiRequest(s, http.MethodPost, "/api/transactions",
+		`{"account": "chase", "payee": "Spotify", "amount": 10.99, "date": "2024-02-01", "category": "music"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Create failed with %d: %s", rec.Code, rec.Body.String())
+	}
+	var created apiTransaction
+	json.Unmarshal(rec.Body.Bytes(), &created)
+
+	rec = doApiRequest(s, http.MethodPatch, "/api/transactions/"+created.Id, `{"amount": 12.5}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Update failed with %d: %s", rec.Code, rec.Body.String())
+	}
+	var updated apiTransaction
+	json.Unmarshal(rec.Body.Bytes(), &updated)
+	if updated.Amount != 12.5 || updated.Category != "music" {
+		t.Fatalf("Update failed: %+v", updated)
+	}
+
+	rec = doApiRequest(s, http.MethodDelete, "/api/transactions/"+created.Id, "")
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("Delete failed with %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doApiRequest(s, http.MethodGet, "/api/transactions/"+created.Id, "")
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("Deleted transaction still found, status %d", rec.Code)
+	}
+}
+
+func TestApiDeleteAccountWithTransactions(t *testing.T) {
+	s := newTestApiServer(t)
+
+	rec := doApiRequest(s, http.MethodDelete, "/api/accounts/chase", "")
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("Deleting an account with transactions gave %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doApiRequest(s, http.MethodDelete, "/api/accounts/chase?cascade=true", "")
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("Cascading delete failed with %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doApiRequest(s, http.MethodGet, "/api/transactions", "")
+	var page apiPage
+	json.Unmarshal(rec.Body.Bytes(), &page)
+	if page.Total != 0 {
+		t.Fatalf("Cascading delete left %d transactions", page.Total)
+	}
+}
+
+func TestApiValidatesTransactions(t *testing.T) {
+	s := newTestApiServer(t)
+
+	bodies := []string{
+		`{"payee": "Spotify", "amount": 10}`,
+		`{"account": "nope", "payee": "Spotify", "amount": 10}`,
+		`{"account": "chase", "payee": "Spotify", "amount": 10, "date": "not a date"}`,
+		`{"account": "chase", "payee": "Spotify", "amount": 10, "color": "red"}`,
+	}
+	for _, body := range bodies {
+		rec := doApiRequest(s, http.MethodPost, "/api/transactions", body)
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("Invalid transaction %s accepted with status %d", body, rec.Code)
+		}
+	}
+}
+
+func TestApiLeavesOutClosedAccounts(t *testing.T) {
+	s := newTestApiServer(t)
+	old := omoney.NewAccount(omoney.WithAlias("old"), omoney.WithAccountType(omoney.Savings))
+	s.Model.AddAccount(*old)
+	s.Model.SetClosed("old", true)
+
+	for _, target := range []string{"/api/accounts", "/api/balances"} {
+		var items []apiAccount
+		rec := doApiRequest(s, http.MethodGet, target, "")
+		json.Unmarshal(rec.Body.Bytes(), &items)
+		if len(items) != 1 || items[0].Alias != "chase" {
+			t.Fatalf("%s listed closed account: %s", target, rec.Body.String())
+		}
+
+		rec = doApiRequest(s, http.MethodGet, target+"?closed=true", "")
+		json.Unmarshal(rec.Body.Bytes(), &items)
+		if len(items) != 2 {
+			t.Fatalf("%s?closed=true left out closed account: %s", target, rec.Body.String())
+		}
+	}
+}
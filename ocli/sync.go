@@ -0,0 +1,148 @@
+package ocli
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/dknelson9876/oregano/omoney"
+	"github.com/plaid/plaid-go/plaid"
+)
+
+type SyncResult struct {
+	Added    int
+	Modified int
+	Removed  int
+}
+
+// Pull every transaction update Plaid has for the item behind account
+// (an alias or id) since the last stored cursor, apply them to the model,
+// then store the new cursor
+func SyncItem(ctx context.Context, client *plaid.APIClient, model *omoney.Model, account string) (*SyncResult, error) {
+	acc, err := model.GetAccount(account)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := model.GetAccessToken(acc.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &SyncResult{}
+	cursor := acc.SyncCursor
+	hasMore := true
+	for hasMore {
+		request := plaid.NewTransactionsSyncRequest(token)
+		if cursor != "" {
+			request.SetCursor(cursor)
+		}
+
+		resp, _, err := client.PlaidApi.TransactionsSync(ctx).TransactionsSyncRequest(*request).Execute()
+		if err != nil {
+			return result, err
+		}
+
+		for _, ptr := range resp.GetAdded() {
+			tr := convertPlaidTransaction(acc.Id, ptr)
+			model.ResolvePayee(tr)
+			pfc := ptr.GetPersonalFinanceCategory()
+			tr.Category = model.MapPlaidCategory(pfc.Primary, pfc.Detailed)
+			err = model.AddSyncedTransaction(tr)
+			if err != nil {
+				return result, err
+			}
+			result.Added++
+		}
+
+		for _, ptr := range resp.GetModified() {
+			tr := convertPlaidTransaction(acc.Id, ptr)
+			model.ResolvePayee(tr)
+			pfc := ptr.GetPersonalFinanceCategory()
+			tr.Category = model.MapPlaidCategory(pfc.Primary, pfc.Detailed)
+			stored, err := model.GetTransactionById(tr.Id)
+			if err != nil {
+				return result, err
+			}
+			err = model.UpdateTransaction(tr.Id, modifiedUpdates(model, stored, tr)...)
+			if err != nil {
+				return result, err
+			}
+			result.Modified++
+		}
+
+		for _, removed := range resp.GetRemoved() {
+			err = model.RemoveTransactionById(removed.GetTransactionId())
+			if errors.Is(err, sql.ErrNoRows) {
+				// a pending transaction already replaced by its posted one
+				continue
+			} else if err != nil {
+				return result, err
+			}
+			result.Removed++
+		}
+
+		cursor = resp.GetNextCursor()
+		hasMore = resp.GetHasMore()
+	}
+
+	return result, model.SetSyncCursor(acc.Id, cursor)
+}
+
+// The updates that bring stored in line with tr, Plaid's modified version
+// of it, categorized by the current mappings. The category is only
+// changed while stored has none or still has the one its Plaid category
+// mapped to, so that categories set by hand are kept. The status is only
+// changed while either is pending, so that a transaction the user
+// cleared or reconciled stays that way
+func modifiedUpdates(model *omoney.Model, stored omoney.Transaction, tr *omoney.Transaction) []omoney.UpdateTransactionOptions {
+	ops := []omoney.UpdateTransactionOptions{
+		omoney.WithPayeeUpdate(tr.Payee),
+		omoney.WithAmountUpdate(tr.Amount),
+		omoney.WithDateUpdate(tr.Date),
+		omoney.WithPlaidCategoryUpdate(tr.PlaidCategory),
+	}
+	if tr.Category != "" &&
+		(stored.Category == "" || stored.Category == model.MappedCategory(stored.PlaidCategory)) {
+		ops = append(ops, omoney.WithCategoryUpdate(tr.Category))
+	}
+	if stored.Status == omoney.Pending || tr.Status == omoney.Pending {
+		ops = append(ops, omoney.WithStatusUpdate(tr.Status))
+	}
+	return ops
+}
+
+// Build a transaction for the account with id accId out of a transaction
+// reported by Plaid. Plaid's amounts are positive when money leaves the
+// account, which already matches the convention used by omoney. A posted
+// transaction keeps the id of the pending one it replaces, if Plaid has one
+func convertPlaidTransaction(accId string, ptr plaid.Transaction) *omoney.Transaction {
+	payee := ptr.GetMerchantName()
+	if payee == "" {
+		payee = ptr.GetName()
+	}
+
+	date, err := time.ParseInLocation("2006-01-02", ptr.GetDate(), time.Local)
+	if err != nil {
+		date = time.Now()
+	}
+
+	pfc := ptr.GetPersonalFinanceCategory()
+	plaidCategory := pfc.Detailed
+	if plaidCategory == "" {
+		plaidCategory = pfc.Primary
+	}
+
+	tr := omoney.NewTransaction(accId, payee, float64(ptr.GetAmount()),
+		omoney.WithDate(date),
+		omoney.WithInstDescription(collapseWhitepace(ptr.GetName())),
+		omoney.WithPlaidCategory(plaidCategory),
+		omoney.WithPendingId(ptr.GetPendingTransactionId()),
+	)
+	tr.Id = ptr.GetTransactionId()
+	if ptr.GetPending() {
+		tr.Status = omoney.Pending
+	}
+	return tr
+}
@@ -0,0 +1,86 @@
+package ocli
+
+import (
+	"testing"
+
+	"github.com/dknelson9876/oregano/omoney"
+)
+
+func TestModifiedKeepsStatus(t *testing.T) {
+	model, err := LoadModelFromDB(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	acc := omoney.NewAccount(omoney.WithAlias("chase"), omoney.WithAccountType(omoney.Checking))
+	model.AddAccount(*acc)
+
+	for _, test := range []struct {
+		stored   omoney.TransactionStatus
+		modified omoney.TransactionStatus
+		need     omoney.TransactionStatus
+	}{
+		{omoney.Cleared, omoney.Posted, omoney.Cleared},
+		{omoney.Reconciled, omoney.Posted, omoney.Reconciled},
+		{omoney.Pending, omoney.Posted, omoney.Posted},
+		{omoney.Posted, omoney.Pending, omoney.Pending},
+	} {
+		tr := omoney.NewTransaction(acc.Id, "Cafe", 5, omoney.WithStatus(test.stored))
+		err = model.AddTransaction(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stored, _ := model.GetTransactionById(tr.Id)
+
+		modified := *tr
+		modified.Payee = "Blue Bottle"
+		modified.Status = test.modified
+		err = model.UpdateTransaction(tr.Id, modifiedUpdates(model, stored, &modified)...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		have, _ := model.GetTransactionById(tr.Id)
+		if have.Status != test.need || have.Payee != "Blue Bottle" {
+			t.Fatalf("Modified status from %s to %s failed\nhave: %s %s\nneed: %s Blue Bottle",
+				test.stored, test.modified, have.Status, have.Payee, test.need)
+		}
+	}
+}
+
+func TestModifiedReappliesMapping(t *testing.T) {
+	model, err := LoadModelFromDB(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	acc := omoney.NewAccount(omoney.WithAlias("chase"), omoney.WithAccountType(omoney.Checking))
+	model.AddAccount(*acc)
+	model.SetCategoryMapping("FOOD_AND_DRINK", "food")
+	model.SetCategoryMapping("TRAVEL", "travel")
+
+	mapped := omoney.NewTransaction(acc.Id, "Cafe", 5,
+		omoney.WithPlaidCategory("FOOD_AND_DRINK_COFFEE"), omoney.WithCategory("food"))
+	edited := omoney.NewTransaction(acc.Id, "Cafe", 5,
+		omoney.WithPlaidCategory("FOOD_AND_DRINK_COFFEE"), omoney.WithCategory("work"))
+	for _, tr := range []*omoney.Transaction{mapped, edited} {
+		model.AddTransaction(tr)
+		stored, _ := model.GetTransactionById(tr.Id)
+
+		// Plaid decided it was a train ticket after all
+		modified := *tr
+		modified.PlaidCategory = "TRAVEL_TRAIN"
+		modified.Category = model.MapPlaidCategory("TRAVEL", "TRAVEL_TRAIN")
+		err = model.UpdateTransaction(tr.Id, modifiedUpdates(model, stored, &modified)...)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	have, _ := model.GetTransactionById(mapped.Id)
+	if have.Category != "travel" || have.PlaidCategory != "TRAVEL_TRAIN" {
+		t.Fatalf("Reapplying mapping failed\nhave: %s (%s)\nneed: travel (TRAVEL_TRAIN)", have.Category, have.PlaidCategory)
+	}
+	have, _ = model.GetTransactionById(edited.Id)
+	if have.Category != "work" {
+		t.Fatalf("Reapplying mapping overwrote a category set by hand\nhave: %s\nneed: work", have.Category)
+	}
+}
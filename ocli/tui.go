@@ -0,0 +1,520 @@
+package ocli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/table"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/dknelson9876/oregano/omoney"
+)
+
+const (
+	// Most transactions loaded into the table for one account
+	tuiTransactionLimit = 1000
+	tuiSidebarWidth     = 28
+)
+
+type tuiMode int
+
+const (
+	tuiBrowse tuiMode = iota
+	tuiFilter
+	tuiEdit
+	tuiConfirmDelete
+)
+
+// The transaction fields that can be edited inline, in the order tab
+// cycles through them, along with the `edit` flag that changes each
+var tuiEditFields = []struct {
+	name string
+	flag string
+}{
+	{"payee", "--payee"},
+	{"amount", "--amount"},
+	{"date", "--date"},
+	{"category", "--category"},
+	{"description", "--desc"},
+}
+
+var (
+	tuiPaneStyle = lipgloss.NewStyle().
+			Border(lipgloss.RoundedBorder()).
+			BorderForeground(lipgloss.Color("240"))
+	tuiFocusedPaneStyle = tuiPaneStyle.Copy().
+				BorderForeground(lipgloss.Color("2"))
+	tuiSelectedStyle = lipgloss.NewStyle().
+				Foreground(lipgloss.Color("0")).
+				Background(lipgloss.Color("2"))
+	tuiHelpStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("241"))
+)
+
+// Full screen view of the model, with accounts in a sidebar next to
+// a table of the selected account's transactions
+type Tui struct {
+	model *omoney.Model
+
+	accounts []omoney.Account
+	balances []float64
+	// 0 selects every account, otherwise accounts[accCursor-1]
+	accCursor int
+
+	// transactions loaded for the selected account(s)
+	trs []omoney.Transaction
+	// trs that pass the filter, in the order shown in the table
+	shown []omoney.Transaction
+
+	table  table.Model
+	filter textinput.Model
+	editor textinput.Model
+	// index into tuiEditFields of the field being edited
+	editField int
+
+	mode         tuiMode
+	sidebarFocus bool
+	status       string
+	width        int
+	height       int
+}
+
+func NewTui(model *omoney.Model) *Tui {
+	t := &Tui{
+		model:  model,
+		filter: textinput.New(),
+		editor: textinput.New(),
+		table: table.New(
+			table.WithColumns(tuiColumns(80)),
+			table.WithFocused(true),
+		),
+		width:  100,
+		height: 30,
+	}
+	t.filter.Prompt = "/"
+	t.filter.Placeholder = "payee, category, or description"
+
+	styles := table.DefaultStyles()
+	styles.Selected = tuiSelectedStyle
+	t.table.SetStyles(styles)
+
+	t.reload()
+	t.resize()
+	return t
+}
+
+// Run the TUI until the user quits
+func RunTui(model *omoney.Model) error {
+	_, err := tea.NewProgram(NewTui(model), tea.WithAltScreen()).Run()
+	return err
+}
+
+func (t *Tui) Init() tea.Cmd {
+	return nil
+}
+
+func (t *Tui) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		t.width, t.height = msg.Width, msg.Height
+		t.resize()
+		return t, nil
+	case tea.KeyMsg:
+		if msg.Type == tea.KeyCtrlC {
+			return t, tea.Quit
+		}
+
+		switch t.mode {
+		case tuiFilter:
+			return t.updateFilter(msg)
+		case tuiEdit:
+			return t.updateEdit(msg)
+		case tuiConfirmDelete:
+			return t.updateConfirmDelete(msg)
+		default:
+			return t.updateBrowse(msg)
+		}
+	}
+	return t, nil
+}
+
+func (t *Tui) updateBrowse(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	t.status = ""
+
+	switch msg.String() {
+	case "q":
+		return t, tea.Quit
+	case "tab":
+		t.setSidebarFocus(!t.sidebarFocus)
+		return t, nil
+	case "/":
+		t.mode = tuiFilter
+		return t, t.filter.Focus()
+	case "esc":
+		t.filter.SetValue("")
+		t.applyFilter()
+		return t, nil
+	case "r":
+		t.reload()
+		return t, nil
+	case "u":
+		ops, err := t.model.Undo(1)
+		if err != nil {
+			t.status = fmt.Sprintf("Error: %s", err)
+		} else {
+			t.status = fmt.Sprintf("Undid %s", ops[0].String())
+		}
+		t.reload()
+		return t, nil
+	}
+
+	if t.sidebarFocus {
+		switch msg.String() {
+		case "up", "k":
+			if t.accCursor > 0 {
+				t.accCursor--
+				t.loadTransactions()
+			}
+		case "down", "j":
+			if t.accCursor < len(t.accounts) {
+				t.accCursor++
+				t.loadTransactions()
+			}
+		case "enter", "right", "l":
+			t.setSidebarFocus(false)
+		}
+		return t, nil
+	}
+
+	switch msg.String() {
+	case "left", "h":
+		t.setSidebarFocus(true)
+		return t, nil
+	case "e", "enter":
+		if tr := t.selected(); tr != nil {
+			t.mode = tuiEdit
+			t.editField = 0
+			t.startEditField()
+			return t, t.editor.Focus()
+		}
+		return t, nil
+	case "d":
+		if t.selected() != nil {
+			t.mode = tuiConfirmDelete
+		}
+		return t, nil
+	}
+
+	var cmd tea.Cmd
+	t.table, cmd = t.table.Update(msg)
+	return t, cmd
+}
+
+func (t *Tui) updateFilter(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyEnter:
+		t.mode = tuiBrowse
+		t.filter.Blur()
+		return t, nil
+	case tea.KeyEsc:
+		t.mode = tuiBrowse
+		t.filter.Blur()
+		t.filter.SetValue("")
+		t.applyFilter()
+		return t, nil
+	}
+
+	var cmd tea.Cmd
+	t.filter, cmd = t.filter.Update(msg)
+	t.applyFilter()
+	return t, cmd
+}
+
+func (t *Tui) updateEdit(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyTab:
+		t.editField = (t.editField + 1) % len(tuiEditFields)
+		t.startEditField()
+		return t, nil
+	case tea.KeyShiftTab:
+		t.editField = (t.editField + len(tuiEditFields) - 1) % len(tuiEditFields)
+		t.startEditField()
+		return t, nil
+	case tea.KeyEsc:
+		t.mode = tuiBrowse
+		t.editor.Blur()
+		return t, nil
+	case tea.KeyEnter:
+		t.mode = tuiBrowse
+		t.editor.Blur()
+		t.saveEdit()
+		return t, nil
+	}
+
+	var cmd tea.Cmd
+	t.editor, cmd = t.editor.Update(msg)
+	return t, cmd
+}
+
+func (t *Tui) updateConfirmDelete(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	t.mode = tuiBrowse
+	tr := t.selected()
+	if tr == nil || msg.String() != "y" {
+		t.status = "Delete cancelled"
+		return t, nil
+	}
+
+	err := t.model.RemoveTransactionById(tr.Id)
+	if err != nil {
+		t.status = fmt.Sprintf("Error: %s", err)
+	} else {
+		t.status = fmt.Sprintf("Deleted %s (u to undo)", tr.Payee)
+	}
+	t.reload()
+	return t, nil
+}
+
+func (t *Tui) View() string {
+	sidebarStyle, tableStyle := tuiPaneStyle, tuiFocusedPaneStyle
+	if t.sidebarFocus {
+		sidebarStyle, tableStyle = tuiFocusedPaneStyle, tuiPaneStyle
+	}
+
+	sidebar := sidebarStyle.
+		Width(tuiSidebarWidth).
+		Height(t.table.Height() + 1).
+		Render(t.sidebarView())
+	trTable := tableStyle.Render(t.table.View())
+
+	return lipgloss.JoinVertical(lipgloss.Left,
+		lipgloss.JoinHorizontal(lipgloss.Top, sidebar, trTable),
+		t.statusView(),
+	)
+}
+
+func (t *Tui) sidebarView() string {
+	lines := make([]string, 0, len(t.accounts)+1)
+	lines = append(lines, t.sidebarLine(0, "All accounts", ""))
+	for i, acc := range t.accounts {
+		name := acc.Alias
+		if name == "" {
+			name = acc.Id
+		}
+		if acc.NeedsRelink {
+			name = "⚠️ " + name
+		}
+		lines = append(lines, t.sidebarLine(i+1, name, fmt.Sprintf("$%.2f", t.balances[i])))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (t *Tui) sidebarLine(index int, name string, balance string) string {
+	nameWidth := tuiSidebarWidth - len(balance) - 1
+	if len(name) > nameWidth {
+		name = name[:nameWidth-1] + "…"
+	}
+	line := fmt.Sprintf("%-*s %s", nameWidth, name, balance)
+	if index == t.accCursor {
+		return tuiSelectedStyle.Render(line)
+	}
+	return line
+}
+
+func (t *Tui) statusView() string {
+	switch t.mode {
+	case tuiFilter:
+		return t.filter.View()
+	case tuiEdit:
+		return fmt.Sprintf("%s %s  %s",
+			tuiEditFields[t.editField].name,
+			t.editor.View(),
+			tuiHelpStyle.Render("(tab next field, enter save, esc cancel)"))
+	case tuiConfirmDelete:
+		return fmt.Sprintf("Delete %s? (y/n)", t.selected().Payee)
+	}
+
+	help := tuiHelpStyle.Render("tab switch pane • / filter • e edit • d delete • u undo • r reload • q quit")
+	status := fmt.Sprintf("%d of %d transactions", len(t.shown), len(t.trs))
+	if t.filter.Value() != "" {
+		status += fmt.Sprintf(" matching %q", t.filter.Value())
+	}
+	if t.status != "" {
+		status = t.status
+	}
+	return status + "  " + help
+}
+
+func (t *Tui) setSidebarFocus(focus bool) {
+	t.sidebarFocus = focus
+	if focus {
+		t.table.Blur()
+	} else {
+		t.table.Focus()
+	}
+}
+
+// Reload accounts, balances, and transactions from the model,
+// keeping the same selections where they still exist. Closed accounts
+// are left out, the same as in ls
+func (t *Tui) reload() {
+	t.accounts = listedAccounts(t.model, ShowAccountOptions{})
+	t.balances = make([]float64, len(t.accounts))
+	for i, acc := range t.accounts {
+		t.balances[i], _ = t.model.GetCurrentBalance(acc.Id)
+	}
+	if t.accCursor > len(t.accounts) {
+		t.accCursor = len(t.accounts)
+	}
+	t.loadTransactions()
+}
+
+func (t *Tui) loadTransactions() {
+	op := omoney.GetTransactionsOptions{Count: tuiTransactionLimit}
+
+	var err error
+	if t.accCursor == 0 {
+		t.trs, err = t.model.GetTransactions(op)
+	} else {
+		t.trs, err = t.model.GetTransactionsByAccount(t.accounts[t.accCursor-1].Id, op)
+	}
+	if err != nil {
+		t.trs = nil
+		t.status = fmt.Sprintf("Error: %s", err)
+	}
+	t.applyFilter()
+}
+
+// Show only the loaded transactions that match the filter, ignoring case
+func (t *Tui) applyFilter() {
+	query := strings.ToLower(t.filter.Value())
+
+	t.shown = make([]omoney.Transaction, 0, len(t.trs))
+	for _, tr := range t.trs {
+		if query == "" ||
+			strings.Contains(strings.ToLower(tr.Payee), query) ||
+			strings.Contains(strings.ToLower(tr.Category), query) ||
+			strings.Contains(strings.ToLower(tr.Description), query) ||
+			strings.Contains(strings.ToLower(tr.InstDescription), query) {
+			t.shown = append(t.shown, tr)
+		}
+	}
+
+	rows := make([]table.Row, len(t.shown))
+	for i, tr := range t.shown {
+		rows[i] = table.Row{
+			tr.Date.Format("2006/01/02"),
+			tr.Payee,
+			fmt.Sprintf("$%.2f", tr.Amount),
+			tr.Category,
+			tr.Description,
+		}
+	}
+	t.table.SetRows(rows)
+
+	if t.table.Cursor() >= len(rows) {
+		t.table.SetCursor(len(rows) - 1)
+	}
+	if t.table.Cursor() < 0 {
+		t.table.SetCursor(0)
+	}
+}
+
+func (t *Tui) selected() *omoney.Transaction {
+	i := t.table.Cursor()
+	if i < 0 || i >= len(t.shown) {
+		return nil
+	}
+	return &t.shown[i]
+}
+
+// Fill the editor with the current value of the field being edited
+func (t *Tui) startEditField() {
+	tr := t.selected()
+	if tr == nil {
+		return
+	}
+
+	var value string
+	switch tuiEditFields[t.editField].name {
+	case "payee":
+		value = tr.Payee
+	case "amount":
+		value = formatAmount(tr.Amount)
+	case "date":
+		value = tr.Date.Format("2006-01-02 15:04:05")
+	case "category":
+		value = tr.Category
+	case "description":
+		value = tr.Description
+	}
+	t.editor.SetValue(value)
+	t.editor.CursorEnd()
+}
+
+// Save the editor's value into the selected transaction, validated
+// the same way as the `edit` command
+func (t *Tui) saveEdit() {
+	tr := t.selected()
+	if tr == nil {
+		return
+	}
+
+	field := tuiEditFields[t.editField]
+	ops, err := BuildTransactionUpdates(t.model, []string{field.flag, t.editor.Value()})
+	if err == nil {
+		err = t.model.UpdateTransaction(tr.Id, ops...)
+	}
+	if err != nil {
+		t.status = fmt.Sprintf("Error: %s", err)
+		return
+	}
+
+	t.status = fmt.Sprintf("Updated %s of %s", field.name, tr.Payee)
+	if field.flag == "--payee" && tr.InstDescription != "" {
+		_, err = t.model.LearnPayee(tr.InstDescription, t.editor.Value())
+		if err != nil {
+			t.status = fmt.Sprintf("Error: %s", err)
+		}
+	}
+	t.reload()
+}
+
+// Size the table to fill the space beside the sidebar, leaving
+// room for the borders and the status line
+func (t *Tui) resize() {
+	// two border columns around each pane
+	tableWidth := t.width - tuiSidebarWidth - 4
+	if tableWidth < 40 {
+		tableWidth = 40
+	}
+	// two border rows and one status line
+	tableHeight := t.height - 3
+	if tableHeight < 5 {
+		tableHeight = 5
+	}
+
+	t.table.SetColumns(tuiColumns(tableWidth))
+	t.table.SetWidth(tableWidth)
+	t.table.SetHeight(tableHeight)
+}
+
+// Split width between the table columns, giving whatever is
+// left after the fixed columns to payee and description
+func tuiColumns(width int) []table.Column {
+	const dateWidth, amountWidth, categoryWidth = 10, 11, 16
+	// each column is padded by one cell on either side
+	flexible := width - dateWidth - amountWidth - categoryWidth - 10
+	if flexible < 20 {
+		flexible = 20
+	}
+	payeeWidth := flexible / 2
+
+	return []table.Column{
+		{Title: "DATE", Width: dateWidth},
+		{Title: "PAYEE", Width: payeeWidth},
+		{Title: "AMOUNT", Width: amountWidth},
+		{Title: "CATEGORY", Width: categoryWidth},
+		{Title: "DESCRIPTION", Width: flexible - payeeWidth},
+	}
+}
@@ -0,0 +1,90 @@
+package ocli
+
+import (
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/dknelson9876/oregano/omoney"
+)
+
+func sendKeys(t *Tui, keys ...tea.KeyMsg) {
+	for _, key := range keys {
+		t.Update(key)
+	}
+}
+
+func runeKeys(s string) []tea.KeyMsg {
+	keys := make([]tea.KeyMsg, 0, len(s))
+	for _, r := range s {
+		keys = append(keys, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+	}
+	return keys
+}
+
+func TestTuiFilter(t *testing.T) {
+	tui := NewTui(newTestApiServer(t).Model)
+	if len(tui.shown) != 5 {
+		t.Fatalf("Expected 5 transactions, found %d", len(tui.shown))
+	}
+
+	tui.Update(tea.WindowSizeMsg{Width: 120, Height: 20})
+	if view := tui.View(); !strings.Contains(view, "chase") || !strings.Contains(view, "payee4") {
+		t.Fatalf("View is missing accounts or transactions:\n%s", view)
+	}
+
+	sendKeys(tui, runeKeys("/payee3")...)
+	sendKeys(tui, tea.KeyMsg{Type: tea.KeyEnter})
+	if len(tui.shown) != 1 || tui.shown[0].Payee != "payee3" {
+		t.Fatalf("Filter failed: %+v", tui.shown)
+	}
+
+	sendKeys(tui, tea.KeyMsg{Type: tea.KeyEsc})
+	if len(tui.shown) != 5 {
+		t.Fatalf("Clearing filter failed, showing %d", len(tui.shown))
+	}
+}
+
+func TestTuiLeavesOutClosedAccounts(t *testing.T) {
+	model := newTestApiServer(t).Model
+	old := omoney.NewAccount(omoney.WithAlias("old"), omoney.WithAccountType(omoney.Savings))
+	model.AddAccount(*old)
+	model.SetClosed("old", true)
+
+	tui := NewTui(model)
+	if len(tui.accounts) != 1 || tui.accounts[0].Alias != "chase" {
+		t.Fatalf("TUI listed closed account: %+v", tui.accounts)
+	}
+}
+
+func TestTuiEditAndUndo(t *testing.T) {
+	tui := NewTui(newTestApiServer(t).Model)
+	id := tui.selected().Id
+
+	// edit the category, one tab past payee and amount and date
+	sendKeys(tui, runeKeys("e")...)
+	sendKeys(tui,
+		tea.KeyMsg{Type: tea.KeyTab},
+		tea.KeyMsg{Type: tea.KeyTab},
+		tea.KeyMsg{Type: tea.KeyTab},
+	)
+	sendKeys(tui, runeKeys("food")...)
+	sendKeys(tui, tea.KeyMsg{Type: tea.KeyEnter})
+
+	tr, err := tui.model.GetTransactionById(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tr.Category != "food" {
+		t.Fatalf("Inline edit failed"+
+			"\nhave: %s"+
+			"\nneed: %s",
+			tr.Category, "food")
+	}
+
+	sendKeys(tui, runeKeys("u")...)
+	tr, _ = tui.model.GetTransactionById(id)
+	if tr.Category != "" {
+		t.Fatalf("Undo in tui failed, category is %s", tr.Category)
+	}
+}
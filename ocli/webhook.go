@@ -0,0 +1,313 @@
+package ocli
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/plaid/plaid-go/plaid"
+)
+
+// Plaid rejects webhooks older than this, so we do too
+const webhookMaxAge = 5 * time.Minute
+
+// Cached verification keys are fetched again once they are this old,
+// to find out whether Plaid has since expired them
+const keyCacheMaxAge = time.Hour
+
+// Somewhere to look up the public keys that Plaid signs webhooks with
+type VerificationKeySource interface {
+	GetVerificationKey(kid string) (plaid.JWKPublicKey, error)
+}
+
+// Fetches verification keys from Plaid's /webhook_verification_key/get
+type PlaidKeySource struct {
+	Client *plaid.APIClient
+}
+
+func (s *PlaidKeySource) GetVerificationKey(kid string) (plaid.JWKPublicKey, error) {
+	request := plaid.NewWebhookVerificationKeyGetRequest(kid)
+	resp, _, err := s.Client.PlaidApi.WebhookVerificationKeyGet(context.Background()).
+		WebhookVerificationKeyGetRequest(*request).
+		Execute()
+	if err != nil {
+		return plaid.JWKPublicKey{}, err
+	}
+	return resp.GetKey(), nil
+}
+
+// Reads verification keys from a local json file holding a list of JWKs,
+// so that webhooks can be tested without talking to Plaid
+type FileKeySource struct {
+	Path string
+}
+
+func (s *FileKeySource) GetVerificationKey(kid string) (plaid.JWKPublicKey, error) {
+	var keys []plaid.JWKPublicKey
+	err := load(s.Path, &keys)
+	if err != nil {
+		return plaid.JWKPublicKey{}, err
+	}
+
+	for _, key := range keys {
+		if key.Kid == kid {
+			return key, nil
+		}
+	}
+	return plaid.JWKPublicKey{}, fmt.Errorf("no key with id %s in %s", kid, s.Path)
+}
+
+// Listens for webhooks from Plaid, and passes along which items
+// have new transactions or need to be relinked
+type WebhookReceiver struct {
+	Keys VerificationKeySource
+	// Called with the item id when Plaid has new transactions for it
+	OnSync func(itemId string) error
+	// Called with the item id and whether or not the item needs to go
+	// through Link again
+	OnRelink func(itemId string, needsRelink bool) error
+
+	keyCache map[string]cachedKey
+	mu       sync.Mutex
+	srv      *http.Server
+}
+
+type cachedKey struct {
+	key     plaid.JWKPublicKey
+	fetched time.Time
+}
+
+type webhookBody struct {
+	WebhookType string `json:"webhook_type"`
+	WebhookCode string `json:"webhook_code"`
+	ItemId      string `json:"item_id"`
+	Error       *struct {
+		ErrorCode string `json:"error_code"`
+	} `json:"error"`
+}
+
+func NewWebhookReceiver(keys VerificationKeySource,
+	onSync func(string) error,
+	onRelink func(string, bool) error) *WebhookReceiver {
+	return &WebhookReceiver{
+		Keys:     keys,
+		OnSync:   onSync,
+		OnRelink: onRelink,
+		keyCache: make(map[string]cachedKey),
+	}
+}
+
+// Start listening for webhooks on the given port in the background
+func (wr *WebhookReceiver) Listen(port string) {
+	mux := http.NewServeMux()
+	mux.Handle("/webhook", wr)
+	wr.srv = &http.Server{Addr: fmt.Sprintf(":%s", port), Handler: mux}
+
+	go func() {
+		log.Printf("Listening for Plaid webhooks on port %s...\n", port)
+		err := wr.srv.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
+			log.Printf("Webhook listener stopped: %s\n", err)
+		}
+	}()
+}
+
+func (wr *WebhookReceiver) Shutdown() error {
+	if wr.srv == nil {
+		return nil
+	}
+	return wr.srv.Shutdown(context.Background())
+}
+
+func (wr *WebhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "invalid HTTP method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return
+	}
+
+	err = wr.verify(r.Header.Get("Plaid-Verification"), body)
+	if err != nil {
+		log.Printf("Rejected webhook: %s\n", err)
+		http.Error(w, "verification failed", http.StatusUnauthorized)
+		return
+	}
+
+	var hook webhookBody
+	err = json.Unmarshal(body, &hook)
+	if err != nil {
+		http.Error(w, "malformed body", http.StatusBadRequest)
+		return
+	}
+
+	err = wr.dispatch(hook)
+	if err != nil {
+		log.Printf("Failed to handle webhook %s/%s: %s\n", hook.WebhookType, hook.WebhookCode, err)
+		http.Error(w, "failed to handle webhook", http.StatusInternalServerError)
+		return
+	}
+
+	fmt.Fprintf(w, "ok")
+}
+
+func (wr *WebhookReceiver) dispatch(hook webhookBody) error {
+	switch hook.WebhookType {
+	case "TRANSACTIONS":
+		switch hook.WebhookCode {
+		case "SYNC_UPDATES_AVAILABLE", "DEFAULT_UPDATE", "INITIAL_UPDATE",
+			"HISTORICAL_UPDATE", "TRANSACTIONS_REMOVED":
+			if wr.OnSync != nil {
+				return wr.OnSync(hook.ItemId)
+			}
+		}
+	case "ITEM":
+		switch hook.WebhookCode {
+		case "ERROR":
+			if hook.Error == nil || hook.Error.ErrorCode != "ITEM_LOGIN_REQUIRED" {
+				return nil
+			}
+			fallthrough
+		case "PENDING_EXPIRATION", "USER_PERMISSION_REVOKED":
+			if wr.OnRelink != nil {
+				return wr.OnRelink(hook.ItemId, true)
+			}
+		case "LOGIN_REPAIRED":
+			if wr.OnRelink != nil {
+				return wr.OnRelink(hook.ItemId, false)
+			}
+		}
+	}
+	// anything else is not something we act on
+	return nil
+}
+
+// Check the JWT from the Plaid-Verification header against the request body,
+// following https://plaid.com/docs/api/webhooks/webhook-verification/
+func (wr *WebhookReceiver) verify(token string, body []byte) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return errors.New("malformed verification token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	err := decodeJwtSegment(parts[0], &header)
+	if err != nil {
+		return err
+	}
+	if header.Alg != "ES256" {
+		return fmt.Errorf("unexpected signing algorithm %s", header.Alg)
+	}
+
+	key, err := wr.getKey(header.Kid)
+	if err != nil {
+		return err
+	}
+	if key.ExpiredAt.Get() != nil {
+		return fmt.Errorf("key %s has expired", header.Kid)
+	}
+
+	pub, err := jwkToPublicKey(key)
+	if err != nil {
+		return err
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || len(sig) != 64 {
+		return errors.New("malformed signature")
+	}
+	hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	r := new(big.Int).SetBytes(sig[:32])
+	s := new(big.Int).SetBytes(sig[32:])
+	if !ecdsa.Verify(pub, hash[:], r, s) {
+		return errors.New("invalid signature")
+	}
+
+	var claims struct {
+		Iat               int64  `json:"iat"`
+		RequestBodySha256 string `json:"request_body_sha256"`
+	}
+	err = decodeJwtSegment(parts[1], &claims)
+	if err != nil {
+		return err
+	}
+	if time.Since(time.Unix(claims.Iat, 0)) > webhookMaxAge {
+		return errors.New("webhook is too old")
+	}
+
+	bodyHash := sha256.Sum256(body)
+	if subtle.ConstantTimeCompare([]byte(hex.EncodeToString(bodyHash[:])),
+		[]byte(claims.RequestBodySha256)) != 1 {
+		return errors.New("body does not match signed hash")
+	}
+
+	return nil
+}
+
+func (wr *WebhookReceiver) getKey(kid string) (plaid.JWKPublicKey, error) {
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+
+	// an expired key stays expired, so there's no need to check again
+	cached, ok := wr.keyCache[kid]
+	if ok && (cached.key.ExpiredAt.Get() != nil || time.Since(cached.fetched) < keyCacheMaxAge) {
+		return cached.key, nil
+	}
+
+	key, err := wr.Keys.GetVerificationKey(kid)
+	if err != nil {
+		return plaid.JWKPublicKey{}, err
+	}
+	wr.keyCache[kid] = cachedKey{key, time.Now()}
+	return key, nil
+}
+
+func decodeJwtSegment(segment string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func jwkToPublicKey(key plaid.JWKPublicKey) (*ecdsa.PublicKey, error) {
+	if key.Kty != "EC" || key.Crv != "P-256" {
+		return nil, fmt.Errorf("unsupported key type %s/%s", key.Kty, key.Crv)
+	}
+
+	x, err := base64.RawURLEncoding.DecodeString(key.X)
+	if err != nil {
+		return nil, err
+	}
+	y, err := base64.RawURLEncoding.DecodeString(key.Y)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(x),
+		Y:     new(big.Int).SetBytes(y),
+	}, nil
+}
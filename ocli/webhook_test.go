@@ -0,0 +1,180 @@
+package ocli
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/plaid/plaid-go/plaid"
+)
+
+type stubKeySource struct {
+	keys map[string]plaid.JWKPublicKey
+}
+
+func (s *stubKeySource) GetVerificationKey(kid string) (plaid.JWKPublicKey, error) {
+	if key, ok := s.keys[kid]; ok {
+		return key, nil
+	}
+	return plaid.JWKPublicKey{}, errors.New("unknown key")
+}
+
+func newStubKey(t *testing.T, kid string) (*ecdsa.PrivateKey, *stubKeySource) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := plaid.JWKPublicKey{
+		Alg: "ES256",
+		Crv: "P-256",
+		Kid: kid,
+		Kty: "EC",
+		Use: "sig",
+		X:   base64.RawURLEncoding.EncodeToString(priv.PublicKey.X.FillBytes(make([]byte, 32))),
+		Y:   base64.RawURLEncoding.EncodeToString(priv.PublicKey.Y.FillBytes(make([]byte, 32))),
+	}
+	return priv, &stubKeySource{keys: map[string]plaid.JWKPublicKey{kid: key}}
+}
+
+func signWebhook(t *testing.T, priv *ecdsa.PrivateKey, kid string, body string, iat time.Time) string {
+	header, _ := json.Marshal(map[string]string{"alg": "ES256", "kid": kid, "typ": "JWT"})
+	bodyHash := sha256.Sum256([]byte(body))
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iat":                 iat.Unix(),
+		"request_body_sha256": hex.EncodeToString(bodyHash[:]),
+	})
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." +
+		base64.RawURLEncoding.EncodeToString(claims)
+	hash := sha256.Sum256([]byte(signingInput))
+	r, s, err := ecdsa.Sign(rand.Reader, priv, hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sig := append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func postWebhook(wr *WebhookReceiver, token string, body string) int {
+	req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body))
+	req.Header.Set("Plaid-Verification", token)
+	rec := httptest.NewRecorder()
+	wr.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestWebhookTriggersSync(t *testing.T) {
+	priv, keys := newStubKey(t, "key1")
+
+	synced := ""
+	wr := NewWebhookReceiver(keys,
+		func(itemId string) error { synced = itemId; return nil },
+		nil)
+
+	body := `{"webhook_type":"TRANSACTIONS","webhook_code":"SYNC_UPDATES_AVAILABLE","item_id":"item1"}`
+	code := postWebhook(wr, signWebhook(t, priv, "key1", body, time.Now()), body)
+	if code != http.StatusOK {
+		t.Fatalf("Webhook sync failed: status %d", code)
+	}
+	if synced != "item1" {
+		t.Fatalf("Webhook sync failed"+
+			"\nhave: %s"+
+			"\nneed: %s",
+			synced, "item1")
+	}
+}
+
+func TestWebhookMarksRelink(t *testing.T) {
+	priv, keys := newStubKey(t, "key1")
+
+	relink := map[string]bool{}
+	wr := NewWebhookReceiver(keys, nil,
+		func(itemId string, needsRelink bool) error { relink[itemId] = needsRelink; return nil })
+
+	body := `{"webhook_type":"ITEM","webhook_code":"ERROR","item_id":"item1","error":{"error_code":"ITEM_LOGIN_REQUIRED"}}`
+	postWebhook(wr, signWebhook(t, priv, "key1", body, time.Now()), body)
+	body = `{"webhook_type":"ITEM","webhook_code":"LOGIN_REPAIRED","item_id":"item2"}`
+	postWebhook(wr, signWebhook(t, priv, "key1", body, time.Now()), body)
+
+	if needs, ok := relink["item1"]; !ok || !needs {
+		t.Fatal("Webhook relink failed: item1 not marked")
+	}
+	if needs, ok := relink["item2"]; !ok || needs {
+		t.Fatal("Webhook relink failed: item2 not cleared")
+	}
+}
+
+func TestWebhookRejectsBadSignatures(t *testing.T) {
+	priv, keys := newStubKey(t, "key1")
+	other, _ := newStubKey(t, "key1")
+
+	called := false
+	wr := NewWebhookReceiver(keys,
+		func(itemId string) error { called = true; return nil },
+		nil)
+
+	body := `{"webhook_type":"TRANSACTIONS","webhook_code":"SYNC_UPDATES_AVAILABLE","item_id":"item1"}`
+	tokens := map[string]string{
+		"wrong key":     signWebhook(t, other, "key1", body, time.Now()),
+		"unknown kid":   signWebhook(t, priv, "key2", body, time.Now()),
+		"too old":       signWebhook(t, priv, "key1", body, time.Now().Add(-10*time.Minute)),
+		"tampered body": signWebhook(t, priv, "key1", strings.Replace(body, "item1", "item2", 1), time.Now()),
+		"missing":       "",
+	}
+
+	for name, token := range tokens {
+		code := postWebhook(wr, token, body)
+		if code != http.StatusUnauthorized {
+			t.Fatalf("Webhook verification (%s) failed: status %d", name, code)
+		}
+	}
+	if called {
+		t.Fatal("Webhook verification failed: sync called for rejected webhook")
+	}
+}
+
+func TestWebhookRechecksExpiredKeys(t *testing.T) {
+	priv, keys := newStubKey(t, "key1")
+
+	called := 0
+	wr := NewWebhookReceiver(keys,
+		func(itemId string) error { called++; return nil },
+		nil)
+
+	body := `{"webhook_type":"TRANSACTIONS","webhook_code":"SYNC_UPDATES_AVAILABLE","item_id":"item1"}`
+	code := postWebhook(wr, signWebhook(t, priv, "key1", body, time.Now()), body)
+	if code != http.StatusOK {
+		t.Fatalf("Webhook sync failed: status %d", code)
+	}
+
+	// Plaid expires the key, which is noticed once the cached copy is old
+	key := keys.keys["key1"]
+	key.ExpiredAt = *plaid.NewNullableInt32(plaid.PtrInt32(int32(time.Now().Unix())))
+	keys.keys["key1"] = key
+	cached := wr.keyCache["key1"]
+	cached.fetched = time.Now().Add(-2 * keyCacheMaxAge)
+	wr.keyCache["key1"] = cached
+
+	code = postWebhook(wr, signWebhook(t, priv, "key1", body, time.Now()), body)
+	if code != http.StatusUnauthorized {
+		t.Fatalf("Webhook with expired key failed: status %d", code)
+	}
+	if called != 1 {
+		t.Fatalf("Webhook with expired key failed"+
+			"\nhave syncs: %d"+
+			"\nneed syncs: %d",
+			called, 1)
+	}
+}
@@ -42,6 +42,26 @@ type Account struct {
 	// The calculated current balance of this account
 	// CurrentBalance float64
 	// The time at which `CurrentBalance` was last calculated
+
+	// Plaid provided cursor marking the last transaction update
+	// pulled for this item. Defaults to empty string, which
+	// requests the full transaction history on the next sync
+	SyncCursor string
+	// Set when Plaid reports that the login for this item has
+	// expired and the user must go through Link again.
+	// Defaults to false
+	NeedsRelink bool
+	// Set once the account has been closed. Closed accounts are
+	// left out of account lists, but their transactions are kept
+	// and still count anywhere transactions are gathered up
+	Closed bool
+	// Terms of a personal loan. Zero unless set with SetLoanTerms
+	Loan LoanTerms `bun:"embed:loan_"`
+	// Day of the month a credit card's statements close, from 1 to 28.
+	// Zero unless set with SetStatementDays
+	StatementDay int
+	// Day of the month a credit card statement's payment is due
+	DueDay int
 }
 
 type AccountOption func(*Account)
@@ -0,0 +1,290 @@
+package omoney
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type AlertKind string
+
+const (
+	// Spending in a category over a month nears or passes a budget
+	AlertBudget AlertKind = "budget"
+	// An account's balance drops below a minimum
+	AlertLowBalance AlertKind = "balance"
+	// A single transaction is at least some amount
+	AlertLarge AlertKind = "large"
+)
+
+// How close to a budget spending gets before warning, unless a rule
+// says otherwise
+const defaultWarnPercent = 80
+
+// A threshold that raises an alert when a transaction added crosses it
+type AlertRule struct {
+	Id   int64 `bun:",pk,autoincrement"`
+	Kind AlertKind
+	// The category of a budget, or the id of the account for a low
+	// balance. Large transactions are watched in one account if set,
+	// or every account if empty
+	Target string
+	// The monthly budget, the lowest balance, or the smallest amount
+	// a large transaction can be
+	Amount float64
+	// The percent of a budget spent that warns before it is passed
+	WarnPercent float64
+}
+
+// Something worth knowing that a transaction caused
+type Alert struct {
+	Id     int64 `bun:",pk,autoincrement"`
+	RuleId int64
+	// Alerts with the same key are only raised once, so that a budget
+	// warns once a month rather than after every transaction
+	Key           string `bun:",unique"`
+	Time          time.Time
+	TransactionId string
+	Message       string
+	// Set once a notifier has delivered the alert
+	Notified bool
+	// Set once the user has seen the alert and cleared it
+	Dismissed bool
+}
+
+func (r AlertRule) Validate() error {
+	switch r.Kind {
+	case AlertBudget:
+		if r.Target == "" {
+			return errors.New("a budget needs a category")
+		}
+		if r.Amount <= 0 {
+			return errors.New("a budget must be more than 0")
+		}
+		if r.WarnPercent < 0 || r.WarnPercent > 100 {
+			return errors.New("warning percent must be from 0 to 100")
+		}
+	case AlertLowBalance:
+		if r.Target == "" {
+			return errors.New("a low balance alert needs an account")
+		}
+	case AlertLarge:
+		if r.Amount <= 0 {
+			return errors.New("a large transaction must be more than 0")
+		}
+	default:
+		return fmt.Errorf("unknown alert kind %s, expected one of budget, balance, large", r.Kind)
+	}
+	return nil
+}
+
+// Add a rule, replacing the alias of an account it targets with its id
+func (m *Model) AddAlertRule(rule *AlertRule) error {
+	if rule.Kind == AlertBudget && rule.WarnPercent == 0 {
+		rule.WarnPercent = defaultWarnPercent
+	}
+	err := rule.Validate()
+	if err != nil {
+		return err
+	}
+	if rule.Kind != AlertBudget && rule.Target != "" {
+		acc, err := m.GetAccount(rule.Target)
+		if err != nil {
+			return err
+		}
+		rule.Target = acc.Id
+	}
+
+	_, err = m.db.NewInsert().
+		Model(rule).
+		Exec(context.TODO())
+	return err
+}
+
+func (m *Model) RemoveAlertRule(id int64) error {
+	res, err := m.db.NewDelete().
+		Model((*AlertRule)(nil)).
+		Where("id = ?", id).
+		Exec(context.TODO())
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("no alert rule with id %d", id)
+	}
+	return nil
+}
+
+func (m *Model) GetAlertRules() ([]AlertRule, error) {
+	rules := make([]AlertRule, 0)
+	err := m.db.NewSelect().
+		Model(&rules).
+		Order("kind", "target", "id").
+		Scan(context.TODO())
+	return rules, err
+}
+
+// Alerts newest first, leaving out dismissed ones unless asked for
+func (m *Model) GetAlerts(includeDismissed bool) ([]Alert, error) {
+	alerts := make([]Alert, 0)
+	query := m.db.NewSelect().
+		Model(&alerts).
+		Order("time DESC", "id DESC")
+	if !includeDismissed {
+		query = query.Where("dismissed = ?", false)
+	}
+	err := query.Scan(context.TODO())
+	return alerts, err
+}
+
+// Alerts no notifier has delivered yet, oldest first
+func (m *Model) GetUnnotifiedAlerts() ([]Alert, error) {
+	alerts := make([]Alert, 0)
+	err := m.db.NewSelect().
+		Model(&alerts).
+		Where("notified = ?", false).
+		Order("time", "id").
+		Scan(context.TODO())
+	return alerts, err
+}
+
+func (m *Model) MarkAlertNotified(id int64) error {
+	_, err := m.db.NewUpdate().
+		Model((*Alert)(nil)).
+		Set("notified = ?", true).
+		Where("id = ?", id).
+		Exec(context.TODO())
+	return err
+}
+
+// Clear every alert that hasn't been dismissed yet
+func (m *Model) DismissAlerts() error {
+	_, err := m.db.NewUpdate().
+		Model((*Alert)(nil)).
+		Set("dismissed = ?", true).
+		Where("dismissed = ?", false).
+		Exec(context.TODO())
+	return err
+}
+
+// Check every rule against tr, which was just added, and raise an
+// alert for each threshold it crossed
+func (m *Model) checkAlerts(tr *Transaction) error {
+	rules, err := m.GetAlertRules()
+	if err != nil {
+		return err
+	}
+
+	for _, rule := range rules {
+		var key, message string
+		switch rule.Kind {
+		case AlertBudget:
+			key, message, err = m.checkBudget(rule, tr)
+		case AlertLowBalance:
+			key, message, err = m.checkLowBalance(rule, tr)
+		case AlertLarge:
+			key, message, err = m.checkLarge(rule, tr)
+		}
+		if err != nil {
+			return err
+		}
+		if key == "" {
+			continue
+		}
+
+		alert := &Alert{
+			RuleId:        rule.Id,
+			Key:           key,
+			Time:          time.Now(),
+			TransactionId: tr.Id,
+			Message:       message,
+		}
+		_, err = m.db.NewInsert().
+			Model(alert).
+			On("CONFLICT (key) DO NOTHING").
+			Exec(context.TODO())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Spending in the budget's category over the month of tr, including
+// pending transactions but not reimbursable ones, warns once when it
+// reaches the warning percent and again when it passes the budget
+func (m *Model) checkBudget(rule AlertRule, tr *Transaction) (string, string, error) {
+	if tr.Category != rule.Target || tr.Amount <= 0 || tr.Reimbursable {
+		return "", "", nil
+	}
+
+	start := time.Date(tr.Date.Year(), tr.Date.Month(), 1, 0, 0, 0, 0, tr.Date.Location())
+	end := start.AddDate(0, 1, 0)
+	spent := 0.0
+	err := m.db.NewRaw(
+		"SELECT coalesce(sum(amount), 0.0) FROM transactions WHERE category = ? AND date >= ? AND date < ? AND "+notReimbursement,
+		rule.Target, dbTime(start), dbTime(end),
+	).Scan(context.TODO(), &spent)
+	if err != nil {
+		return "", "", err
+	}
+
+	month := start.Format("2006/01")
+	percent := spent / rule.Amount * 100
+	switch {
+	case spent > rule.Amount:
+		return fmt.Sprintf("budget:%d:%s:over", rule.Id, month),
+			fmt.Sprintf("%s is over budget for %s: $%.2f spent of $%.2f (%.0f%%)",
+				rule.Target, month, spent, rule.Amount, percent), nil
+	case percent >= rule.WarnPercent:
+		return fmt.Sprintf("budget:%d:%s:warn", rule.Id, month),
+			fmt.Sprintf("%s is close to its budget for %s: $%.2f spent of $%.2f (%.0f%%)",
+				rule.Target, month, spent, rule.Amount, percent), nil
+	}
+	return "", "", nil
+}
+
+// Alerts when tr takes the balance of the rule's account from at or
+// above its minimum to below it
+func (m *Model) checkLowBalance(rule AlertRule, tr *Transaction) (string, string, error) {
+	if tr.AccountId != rule.Target || tr.Status == Pending {
+		return "", "", nil
+	}
+	acc, err := m.GetAccount(tr.AccountId)
+	if err != nil {
+		return "", "", err
+	}
+	if acc.Type == Investment || acc.Type == PersonalLoan || !tr.Date.After(acc.AnchorTime) {
+		// tr doesn't move the balance shown
+		return "", "", nil
+	}
+
+	after, err := m.GetCurrentBalance(acc.Id)
+	if err != nil {
+		return "", "", err
+	}
+	before := after - tr.Amount
+	if after >= rule.Amount || before < rule.Amount {
+		return "", "", nil
+	}
+	return fmt.Sprintf("balance:%d:%s", rule.Id, tr.Id),
+		fmt.Sprintf("%s is below $%.2f after %s: balance $%.2f",
+			acc.Alias, rule.Amount, tr.Payee, after), nil
+}
+
+func (m *Model) checkLarge(rule AlertRule, tr *Transaction) (string, string, error) {
+	if rule.Target != "" && tr.AccountId != rule.Target {
+		return "", "", nil
+	}
+	if tr.Amount < rule.Amount && -tr.Amount < rule.Amount {
+		return "", "", nil
+	}
+	acc, err := m.GetAccount(tr.AccountId)
+	if err != nil {
+		return "", "", err
+	}
+	return fmt.Sprintf("large:%d:%s", rule.Id, tr.Id),
+		fmt.Sprintf("Large transaction in %s: $%.2f to %s on %s",
+			acc.Alias, tr.Amount, tr.Payee, tr.Date.Format("2006/01/02")), nil
+}
@@ -0,0 +1,99 @@
+package omoney
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBudgetAlerts(t *testing.T) {
+	m := &Model{db: CreateEmptyDB()}
+	AddDummyAccounts(m, 1)
+	acc := m.GetAccounts()[0]
+	err := m.AddAlertRule(&AlertRule{Kind: AlertBudget, Target: "groceries", Amount: 500})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	add := func(amount float64, d int) {
+		err := m.AddTransaction(NewTransaction(acc.Id, "Market", amount,
+			WithDate(day(2024, 1, d)), WithCategory("groceries")))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	add(300, 2)
+	add(100, 9)
+	add(50, 16)
+	add(100, 23)
+
+	alerts, err := m.GetAlerts(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// warned once at 80%, then once when passing the budget
+	if len(alerts) != 2 ||
+		!strings.Contains(alerts[1].Message, "close to its budget") ||
+		!strings.Contains(alerts[0].Message, "over budget") {
+		t.Fatalf("Budget alerts failed\nhave: %+v\nneed: a warning, then over budget", alerts)
+	}
+
+	// a new month starts over
+	add(100, 40)
+	alerts, _ = m.GetAlerts(false)
+	if len(alerts) != 2 {
+		t.Fatalf("Budget alerts failed\nhave: %+v\nneed: nothing new in February", alerts)
+	}
+
+	err = m.DismissAlerts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	alerts, _ = m.GetAlerts(false)
+	if len(alerts) != 0 {
+		t.Fatalf("DismissAlerts failed\nhave: %+v", alerts)
+	}
+}
+
+func TestBalanceAndLargeAlerts(t *testing.T) {
+	m := &Model{db: CreateEmptyDB()}
+	acc := *NewAccount(WithAlias("visa"), WithAccountType(CreditCard), WithAnchor(0, day(2024, 1, 1)))
+	m.AddAccount(acc)
+	for _, rule := range []AlertRule{
+		{Kind: AlertLowBalance, Target: "visa", Amount: -100},
+		{Kind: AlertLarge, Amount: 1000},
+	} {
+		err := m.AddAlertRule(&rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m.AddTransaction(NewTransaction(acc.Id, "Payment", -80, WithDate(day(2024, 1, 2))))
+	m.AddTransaction(NewTransaction(acc.Id, "Refund", -50, WithDate(day(2024, 1, 3))))
+	// already below, so no new alert
+	m.AddTransaction(NewTransaction(acc.Id, "Refund", -10, WithDate(day(2024, 1, 4))))
+	m.AddTransaction(NewTransaction(acc.Id, "Laptop", 1500, WithDate(day(2024, 1, 5))))
+
+	alerts, err := m.GetUnnotifiedAlerts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(alerts) != 2 ||
+		!strings.HasPrefix(alerts[0].Message, "visa is below $-100.00 after Refund") ||
+		!strings.HasPrefix(alerts[1].Message, "Large transaction in visa: $1500.00 to Laptop") {
+		t.Fatalf("Alerts failed\nhave: %+v", alerts)
+	}
+
+	err = m.MarkAlertNotified(alerts[0].Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alerts, _ = m.GetUnnotifiedAlerts()
+	if len(alerts) != 1 {
+		t.Fatalf("MarkAlertNotified failed\nhave: %+v", alerts)
+	}
+
+	if err := m.AddAlertRule(&AlertRule{Kind: AlertBudget, Amount: 100}); err == nil {
+		t.Fatal("A budget without a category should fail")
+	}
+}
@@ -0,0 +1,192 @@
+package omoney
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Name of the folder, next to the database, that attached files
+// are copied into
+const AttachmentDirName = "attachments"
+
+// A file such as a receipt or warranty kept with a transaction. The
+// file is copied into the attachment folder and named by the sha256
+// of its contents, so attaching the same file twice stores it once
+type Attachment struct {
+	Id string `bun:",pk"`
+	// The transaction this file belongs to. Attachments are kept
+	// when their transaction is removed, so that undoing the removal
+	// brings them back, until CleanAttachments clears them out
+	TransactionId string
+	// Name of the file when it was attached
+	Name string
+	// Hex sha256 of the contents, which with the extension
+	// of Name is the file's name in the attachment folder
+	Hash  string
+	Size  int64
+	Added time.Time
+	// Where the stored copy of the file is. Filled in when loaded
+	Path string `bun:"-"`
+}
+
+// The folder attached files are stored in, next to the database
+func (m *Model) AttachmentDir() (string, error) {
+	if m.path == "" {
+		return "", errors.New("database is not stored in a file")
+	}
+	return filepath.Join(filepath.Dir(m.path), AttachmentDirName), nil
+}
+
+// Name of the stored copy of a file with the given name and hash
+func storedName(name string, hash string) string {
+	return hash + strings.ToLower(filepath.Ext(name))
+}
+
+// Copy the file at src into the attachment folder and attach it to
+// the transaction with id trId
+func (m *Model) AttachFile(trId string, src string) (*Attachment, error) {
+	if _, err := m.GetTransactionById(trId); err != nil {
+		return nil, err
+	}
+
+	dir, err := m.AttachmentDir()
+	if err != nil {
+		return nil, err
+	}
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+
+	// copy to a temporary file first, since the name
+	// isn't known until all of the contents are read
+	tmp, err := os.CreateTemp(dir, incomingPrefix+"*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), in)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	att := &Attachment{
+		Id:            uuid.New().String(),
+		TransactionId: trId,
+		Name:          filepath.Base(src),
+		Hash:          hex.EncodeToString(hash.Sum(nil)),
+		Size:          size,
+		Added:         time.Now().Truncate(time.Second),
+	}
+	att.Path = filepath.Join(dir, storedName(att.Name, att.Hash))
+
+	if _, err := os.Stat(att.Path); errors.Is(err, os.ErrNotExist) {
+		err = os.Rename(tmp.Name(), att.Path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = m.db.NewInsert().
+		Model(att).
+		Exec(context.TODO())
+	if err != nil {
+		return nil, err
+	}
+	return att, nil
+}
+
+// Every attachment of the transaction with id trId, oldest first
+func (m *Model) GetAttachments(trId string) ([]Attachment, error) {
+	var atts []Attachment
+	err := m.db.NewSelect().
+		Model(&atts).
+		Where("transaction_id = ?", trId).
+		Order("added", "name").
+		Scan(context.TODO())
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := m.AttachmentDir()
+	if err != nil {
+		return nil, err
+	}
+	for i := range atts {
+		atts[i].Path = filepath.Join(dir, storedName(atts[i].Name, atts[i].Hash))
+	}
+	return atts, nil
+}
+
+// Files being copied in by AttachFile start with this until they are
+// renamed, and are left alone by CleanAttachments
+const incomingPrefix = "incoming-"
+
+// Remove attachments whose transaction no longer exists, then any
+// stored file that no attachment refers to, other than those still
+// being attached. Returns the names of the files that were deleted
+func (m *Model) CleanAttachments() ([]string, error) {
+	_, err := m.db.NewDelete().
+		Model((*Attachment)(nil)).
+		Where("transaction_id NOT IN (SELECT id FROM transactions)").
+		Exec(context.TODO())
+	if err != nil {
+		return nil, err
+	}
+
+	var atts []Attachment
+	err = m.db.NewSelect().
+		Model(&atts).
+		Scan(context.TODO())
+	if err != nil {
+		return nil, err
+	}
+	inUse := make(map[string]bool, len(atts))
+	for _, att := range atts {
+		inUse[storedName(att.Name, att.Hash)] = true
+	}
+
+	dir, err := m.AttachmentDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []string{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	removed := make([]string, 0)
+	for _, entry := range entries {
+		if entry.IsDir() || inUse[entry.Name()] || strings.HasPrefix(entry.Name(), incomingPrefix) {
+			continue
+		}
+		err = os.Remove(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return removed, err
+		}
+		removed = append(removed, entry.Name())
+	}
+	return removed, nil
+}
@@ -0,0 +1,98 @@
+package omoney
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAttachFile(t *testing.T) {
+	dir := t.TempDir()
+	m, err := NewModelFromDB(filepath.Join(dir, DbFilename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	AddDummyAccounts(m, 1)
+	acc, _ := m.GetAccount("acc0")
+	tr := NewTransaction(acc.Id, "Best Buy", 499.99)
+	m.AddTransaction(tr)
+
+	src := filepath.Join(t.TempDir(), "Receipt.PDF")
+	os.WriteFile(src, []byte("receipt"), 0600)
+
+	// the same file attached twice is stored once
+	first, err := m.AttachFile(tr.Id, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := m.AttachFile(tr.Id, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Path != second.Path || filepath.Ext(first.Path) != ".pdf" {
+		t.Fatalf("Attached copies differ: %s, %s", first.Path, second.Path)
+	}
+	if contents, _ := os.ReadFile(first.Path); string(contents) != "receipt" {
+		t.Fatalf("Stored copy has contents %q", contents)
+	}
+
+	atts, err := m.GetAttachments(tr.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(atts) != 2 || atts[0].Name != "Receipt.PDF" || atts[0].Path != first.Path || atts[0].Size != 7 {
+		t.Fatalf("GetAttachments failed: %+v", atts)
+	}
+
+	if _, err := m.AttachFile("missing", src); err == nil {
+		t.Fatal("Attaching to a missing transaction succeeded")
+	}
+}
+
+func TestCleanAttachments(t *testing.T) {
+	dir := t.TempDir()
+	m, err := NewModelFromDB(filepath.Join(dir, DbFilename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	AddDummyAccounts(m, 1)
+	acc, _ := m.GetAccount("acc0")
+	kept := NewTransaction(acc.Id, "Kept", 1)
+	removed := NewTransaction(acc.Id, "Removed", 2)
+	m.AddTransaction(kept)
+	m.AddTransaction(removed)
+
+	srcDir := t.TempDir()
+	os.WriteFile(filepath.Join(srcDir, "a.jpg"), []byte("a"), 0600)
+	os.WriteFile(filepath.Join(srcDir, "b.jpg"), []byte("b"), 0600)
+	keptAtt, _ := m.AttachFile(kept.Id, filepath.Join(srcDir, "a.jpg"))
+	removedAtt, _ := m.AttachFile(removed.Id, filepath.Join(srcDir, "b.jpg"))
+
+	m.RemoveTransactionById(removed.Id)
+
+	// still there in case the removal is undone
+	if atts, _ := m.GetAttachments(removed.Id); len(atts) != 1 {
+		t.Fatalf("Attachment of removed transaction was dropped early")
+	}
+
+	// another attach still copying its file in
+	incoming := filepath.Join(filepath.Dir(keptAtt.Path), "incoming-1234")
+	os.WriteFile(incoming, []byte("c"), 0600)
+
+	files, err := m.CleanAttachments()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0] != filepath.Base(removedAtt.Path) {
+		t.Fatalf("CleanAttachments removed %v", files)
+	}
+	if _, err := os.Stat(incoming); err != nil {
+		t.Fatalf("File being attached was removed: %s", err)
+	}
+	if _, err := os.Stat(keptAtt.Path); err != nil {
+		t.Fatalf("File still in use was removed: %s", err)
+	}
+	if atts, _ := m.GetAttachments(removed.Id); len(atts) != 0 {
+		t.Fatalf("Orphaned attachment was kept: %+v", atts)
+	}
+}
@@ -0,0 +1,158 @@
+package omoney
+
+import (
+	"context"
+	"time"
+)
+
+// A rule translating one of Plaid's personal_finance_category values
+// into the category name used within this program
+type CategoryMapping struct {
+	// The Plaid category being matched, either a primary category
+	// such as FOOD_AND_DRINK or a detailed category such as
+	// FOOD_AND_DRINK_COFFEE. Detailed matches take priority.
+	PlaidCategory string `bun:",pk"`
+	// The category assigned to matching transactions
+	Category string
+}
+
+// A Plaid category that was seen during a sync without a mapping,
+// kept so that the user can review and map it later
+type UnmappedCategory struct {
+	PlaidCategory string `bun:",pk"`
+	// The number of synced transactions that carried this category
+	Count int
+	// The last time a transaction carrying this category was synced
+	LastSeen time.Time
+}
+
+// A condition matching the plaid_category column against plaidCategory.
+// For a primary category this also matches its detailed categories,
+// such as FOOD_AND_DRINK_COFFEE for FOOD_AND_DRINK, unless they have a
+// mapping of their own
+func plaidCategoryCondition(plaidCategory string) (string, []interface{}) {
+	return "(plaid_category = ? OR (plaid_category LIKE ? ESCAPE '\\' AND " +
+			"plaid_category NOT IN (SELECT plaid_category FROM category_mappings)))",
+		[]interface{}{plaidCategory, escapeLike(plaidCategory) + "\\_%"}
+}
+
+// Create or replace the mapping for plaidCategory, remove it and any
+// of its detailed categories from the review list, and categorize any
+// uncategorized transactions that were waiting on them
+func (m *Model) SetCategoryMapping(plaidCategory string, category string) error {
+	mapping := &CategoryMapping{PlaidCategory: plaidCategory, Category: category}
+	_, err := m.db.NewInsert().
+		Model(mapping).
+		On("CONFLICT (plaid_category) DO UPDATE").
+		Set("category = EXCLUDED.category").
+		Exec(context.TODO())
+	if err != nil {
+		return err
+	}
+
+	cond, args := plaidCategoryCondition(plaidCategory)
+	_, err = m.db.NewDelete().
+		Model((*UnmappedCategory)(nil)).
+		Where(cond, args...).
+		Exec(context.TODO())
+	if err != nil {
+		return err
+	}
+
+	_, err = m.db.NewUpdate().
+		Model((*Transaction)(nil)).
+		Set("category = ?", category).
+		Where(cond, args...).
+		Where("category = ''").
+		Exec(context.TODO())
+	return err
+}
+
+func (m *Model) RemoveCategoryMapping(plaidCategory string) error {
+	_, err := m.db.NewDelete().
+		Model((*CategoryMapping)(nil)).
+		Where("plaid_category = ?", plaidCategory).
+		Exec(context.TODO())
+	return err
+}
+
+func (m *Model) GetCategoryMappings() []CategoryMapping {
+	var mappings []CategoryMapping
+	err := m.db.NewSelect().
+		Model(&mappings).
+		Order("plaid_category").
+		Scan(context.TODO())
+	if err != nil {
+		return make([]CategoryMapping, 0)
+	}
+	return mappings
+}
+
+// Return the Plaid categories that have been seen without a mapping,
+// most common first
+func (m *Model) GetUnmappedCategories() []UnmappedCategory {
+	var unmapped []UnmappedCategory
+	err := m.db.NewSelect().
+		Model(&unmapped).
+		Order("count DESC").
+		Scan(context.TODO())
+	if err != nil {
+		return make([]UnmappedCategory, 0)
+	}
+	return unmapped
+}
+
+// The category plaidCategory is mapped to, by its own mapping or else
+// by that of the primary category it is a detailed category of, or the
+// empty string if neither is mapped. Unlike MapPlaidCategory, nothing
+// is added to the review list
+func (m *Model) MappedCategory(plaidCategory string) string {
+	category := ""
+	m.db.NewSelect().
+		Model((*CategoryMapping)(nil)).
+		Column("category").
+		Where("plaid_category = ? OR ? LIKE replace(plaid_category, '_', '\\_') || '\\_%' ESCAPE '\\'",
+			plaidCategory, plaidCategory).
+		OrderExpr("length(plaid_category) DESC").
+		Limit(1).
+		Scan(context.TODO(), &category)
+	return category
+}
+
+// Given the primary and detailed personal_finance_category of a
+// transaction from Plaid, return the matching category. If neither
+// is mapped, the detailed category is added to the review list and
+// the empty string is returned
+func (m *Model) MapPlaidCategory(primary string, detailed string) string {
+	for _, plaidCategory := range []string{detailed, primary} {
+		if plaidCategory == "" {
+			continue
+		}
+
+		category := ""
+		err := m.db.NewSelect().
+			Model((*CategoryMapping)(nil)).
+			Column("category").
+			Where("plaid_category = ?", plaidCategory).
+			Scan(context.TODO(), &category)
+		if err == nil {
+			return category
+		}
+	}
+
+	unmapped := detailed
+	if unmapped == "" {
+		unmapped = primary
+	}
+	if unmapped == "" {
+		return ""
+	}
+
+	m.db.NewInsert().
+		Model(&UnmappedCategory{PlaidCategory: unmapped, Count: 1, LastSeen: time.Now()}).
+		On("CONFLICT (plaid_category) DO UPDATE").
+		Set("count = count + 1").
+		Set("last_seen = EXCLUDED.last_seen").
+		Exec(context.TODO())
+	return ""
+}
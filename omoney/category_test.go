@@ -0,0 +1,137 @@
+package omoney
+
+import (
+	"testing"
+)
+
+func TestMapPlaidCategoryPrefersDetailed(t *testing.T) {
+	m := &Model{db: CreateEmptyDB()}
+
+	m.SetCategoryMapping("FOOD_AND_DRINK", "food")
+	m.SetCategoryMapping("FOOD_AND_DRINK_COFFEE", "coffee")
+
+	if cat := m.MapPlaidCategory("FOOD_AND_DRINK", "FOOD_AND_DRINK_COFFEE"); cat != "coffee" {
+		t.Fatalf("MapPlaidCategory detailed failed"+
+			"\nhave: %s"+
+			"\nneed: %s",
+			cat, "coffee")
+	}
+
+	if cat := m.MapPlaidCategory("FOOD_AND_DRINK", "FOOD_AND_DRINK_GROCERIES"); cat != "food" {
+		t.Fatalf("MapPlaidCategory primary failed"+
+			"\nhave: %s"+
+			"\nneed: %s",
+			cat, "food")
+	}
+}
+
+func TestMapPlaidCategoryCollectsUnmapped(t *testing.T) {
+	m := &Model{db: CreateEmptyDB()}
+
+	m.MapPlaidCategory("TRAVEL", "TRAVEL_FLIGHTS")
+	m.MapPlaidCategory("TRAVEL", "TRAVEL_FLIGHTS")
+	m.MapPlaidCategory("RENT_AND_UTILITIES", "RENT_AND_UTILITIES_RENT")
+
+	unmapped := m.GetUnmappedCategories()
+	if len(unmapped) != 2 {
+		t.Fatalf("Unmapped category review failed"+
+			"\nhave length: %d"+
+			"\nneed length: %d",
+			len(unmapped), 2)
+	}
+	if unmapped[0].PlaidCategory != "TRAVEL_FLIGHTS" || unmapped[0].Count != 2 {
+		t.Fatalf("Unmapped category count failed"+
+			"\nhave: %+v",
+			unmapped[0])
+	}
+
+	m.SetCategoryMapping("TRAVEL_FLIGHTS", "travel")
+	if len(m.GetUnmappedCategories()) != 1 {
+		t.Fatal("Mapping a category did not remove it from review")
+	}
+}
+
+func TestSetCategoryMappingFillsWaitingTransactions(t *testing.T) {
+	m := &Model{db: CreateEmptyDB()}
+	AddDummyAccounts(m, 1)
+	acc, err := m.GetAccount("acc0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	waiting := NewTransaction(acc.Id, "Delta", 300, WithPlaidCategory("TRAVEL_FLIGHTS"))
+	edited := NewTransaction(acc.Id, "United", 200,
+		WithPlaidCategory("TRAVEL_FLIGHTS"),
+		WithCategory("work"),
+	)
+	m.AddTransaction(waiting)
+	m.AddTransaction(edited)
+
+	m.SetCategoryMapping("TRAVEL_FLIGHTS", "travel")
+
+	retrieved, _ := m.GetTransactionById(waiting.Id)
+	if retrieved.Category != "travel" {
+		t.Fatalf("Mapping did not categorize waiting transaction"+
+			"\nhave: %s"+
+			"\nneed: %s",
+			retrieved.Category, "travel")
+	}
+
+	retrieved, _ = m.GetTransactionById(edited.Id)
+	if retrieved.Category != "work" {
+		t.Fatalf("Mapping overwrote existing category"+
+			"\nhave: %s"+
+			"\nneed: %s",
+			retrieved.Category, "work")
+	}
+}
+
+func TestPrimaryMappingFillsDetailed(t *testing.T) {
+	m := &Model{db: CreateEmptyDB()}
+	AddDummyAccounts(m, 1)
+	acc, err := m.GetAccount("acc0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m.SetCategoryMapping("FOOD_AND_DRINK_COFFEE", "coffee")
+	restaurant := NewTransaction(acc.Id, "Diner", 30, WithPlaidCategory("FOOD_AND_DRINK_RESTAURANT"))
+	// left for the coffee mapping, which was set first
+	coffee := NewTransaction(acc.Id, "Cafe", 5, WithPlaidCategory("FOOD_AND_DRINK_COFFEE"))
+	m.AddTransaction(restaurant)
+	m.AddTransaction(coffee)
+	m.MapPlaidCategory("FOOD_AND_DRINK", "FOOD_AND_DRINK_RESTAURANT")
+
+	m.SetCategoryMapping("FOOD_AND_DRINK", "food")
+
+	retrieved, _ := m.GetTransactionById(restaurant.Id)
+	if retrieved.Category != "food" {
+		t.Fatalf("Primary mapping did not categorize detailed transaction"+
+			"\nhave: %s"+
+			"\nneed: %s",
+			retrieved.Category, "food")
+	}
+	retrieved, _ = m.GetTransactionById(coffee.Id)
+	if retrieved.Category != "" {
+		t.Fatalf("Primary mapping overrode detailed mapping"+
+			"\nhave: %s"+
+			"\nneed: %s",
+			retrieved.Category, "")
+	}
+	if len(m.GetUnmappedCategories()) != 0 {
+		t.Fatal("Mapping a primary category did not remove its detailed categories from review")
+	}
+
+	if cat := m.MappedCategory("FOOD_AND_DRINK_RESTAURANT"); cat != "food" {
+		t.Fatalf("MappedCategory primary failed"+
+			"\nhave: %s"+
+			"\nneed: %s",
+			cat, "food")
+	}
+	if cat := m.MappedCategory("FOOD_AND_DRINK_COFFEE"); cat != "coffee" {
+		t.Fatalf("MappedCategory detailed failed"+
+			"\nhave: %s"+
+			"\nneed: %s",
+			cat, "coffee")
+	}
+}
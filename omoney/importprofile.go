@@ -0,0 +1,44 @@
+package omoney
+
+import (
+	"context"
+)
+
+// A saved set of answers to the questions asked while importing a
+// csv file, so that files laid out the same way can be imported again
+// without asking
+type ImportProfile struct {
+	// Name the profile is chosen by when importing
+	Name string `bun:",pk"`
+	// Whether the first row of the file holds column headers
+	Headers bool
+	// Index of the column holding each transaction field, keyed
+	// by the field names used while importing
+	Columns map[string]int
+	// Id of the account to use for each account name that appears
+	// in the file but is not an alias or id of a known account
+	Accounts map[string]string
+}
+
+// Returns sql.ErrNoRows if there is no profile named name
+func (m *Model) GetImportProfile(name string) (ImportProfile, error) {
+	profile := &ImportProfile{}
+	err := m.db.NewSelect().
+		Model(profile).
+		Where("name = ?", name).
+		Limit(1).
+		Scan(context.TODO())
+	return *profile, err
+}
+
+// Create or replace the profile with the same name
+func (m *Model) SaveImportProfile(profile *ImportProfile) error {
+	_, err := m.db.NewInsert().
+		Model(profile).
+		On("CONFLICT (name) DO UPDATE").
+		Set("headers = EXCLUDED.headers").
+		Set("columns = EXCLUDED.columns").
+		Set("accounts = EXCLUDED.accounts").
+		Exec(context.TODO())
+	return err
+}
@@ -0,0 +1,48 @@
+package omoney
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+)
+
+func TestSaveImportProfile(t *testing.T) {
+	m := &Model{db: CreateEmptyDB()}
+
+	if _, err := m.GetImportProfile("chase"); err != sql.ErrNoRows {
+		t.Fatalf("Missing profile returned err: %v", err)
+	}
+
+	profile := &ImportProfile{
+		Name:     "chase",
+		Headers:  true,
+		Columns:  map[string]int{"Payee": 2, "Amount": 3},
+		Accounts: map[string]string{"CHASE 1234": "acc-id"},
+	}
+	err := m.SaveImportProfile(profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// saving again under the same name replaces it
+	profile.Columns["Amount"] = 4
+	err = m.SaveImportProfile(profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	retrieved, err := m.GetImportProfile("chase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !retrieved.Headers || retrieved.Columns["Amount"] != 4 || retrieved.Accounts["CHASE 1234"] != "acc-id" {
+		t.Fatalf("GetImportProfile failed"+
+			"\nhave: %+v"+
+			"\nneed: %+v",
+			retrieved, *profile)
+	}
+	count, _ := m.db.NewSelect().Model((*ImportProfile)(nil)).Count(context.TODO())
+	if count != 1 {
+		t.Fatalf("Expected 1 profile, found %d", count)
+	}
+}
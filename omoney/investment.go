@@ -0,0 +1,681 @@
+package omoney
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// A stock, fund, or anything else bought in shares, named by its
+// ticker symbol
+type Security struct {
+	Symbol string `bun:",pk"`
+	// Optional full name, such as "Vanguard Total Stock Market ETF"
+	Name string
+}
+
+// The closing price of a security on a day
+type SecurityPrice struct {
+	Symbol string    `bun:",pk"`
+	Date   time.Time `bun:",pk"`
+	Price  float64
+}
+
+type InvestmentEventKind string
+
+const (
+	EventBuy      InvestmentEventKind = "buy"
+	EventSell     InvestmentEventKind = "sell"
+	EventDividend InvestmentEventKind = "dividend"
+	EventSplit    InvestmentEventKind = "split"
+)
+
+// How a sell picks which lots its shares come out of
+type LotMethod string
+
+const (
+	// Oldest lots first. Used when a sell doesn't say
+	MethodFifo LotMethod = "fifo"
+	// Newest lots first
+	MethodLifo LotMethod = "lifo"
+	// Exactly the shares listed in the sell's Lots
+	MethodSpecific LotMethod = "specific"
+)
+
+// Something that happened to a security held in an investment account.
+// Holdings and lots are not stored, but worked out by replaying these
+// events in order, so removing a mistaken event fixes everything after
+type InvestmentEvent struct {
+	Id        int64 `bun:",pk,autoincrement"`
+	AccountId string
+	Symbol    string
+	Kind      InvestmentEventKind
+	Date      time.Time
+	// Shares bought or sold. For a split, the number of new shares
+	// per old share, so 2 for a 2-for-1 split and 0.1 for 1-for-10
+	Quantity float64
+	// Price per share of a buy or sell
+	Price float64
+	// Cash paid out by a dividend
+	Amount float64
+	// Commissions and fees paid on a buy or sell
+	Fees float64
+	// How a sell picks its lots. Empty means MethodFifo
+	Method LotMethod
+	// The shares a MethodSpecific sell takes from each lot.
+	// Stored in their own table
+	Lots []LotSelection `bun:"-"`
+}
+
+// Shares a sell takes from one lot, when the lots are picked by hand
+type LotSelection struct {
+	SellId   int64 `bun:",pk"`
+	LotId    int64 `bun:",pk"`
+	Quantity float64
+}
+
+// Shares of a security bought together, as much of them as is still
+// held. Cost is carried through splits, so CostPerShare changes while
+// Quantity * CostPerShare stays the same
+type Lot struct {
+	// Id of the buy event that opened this lot
+	Id           int64
+	AccountId    string
+	Symbol       string
+	Acquired     time.Time
+	Quantity     float64
+	CostPerShare float64
+}
+
+// Everything held of one security in one account
+type Holding struct {
+	AccountId string
+	Symbol    string
+	Quantity  float64
+	// What was paid for the shares still held, including fees
+	CostBasis float64
+	// Latest known price, and the day it is from
+	Price     float64
+	PriceDate time.Time
+	// Quantity * Price
+	MarketValue float64
+	// Total paid out in dividends, including on shares since sold
+	Dividends float64
+	Lots      []Lot
+}
+
+// Shares of one lot closed by a sell, and the gain or loss realized
+type Disposal struct {
+	SellId    int64
+	LotId     int64
+	AccountId string
+	Symbol    string
+	Acquired  time.Time
+	Sold      time.Time
+	Quantity  float64
+	// What the shares sold for, less their share of the sell's fees
+	Proceeds  float64
+	CostBasis float64
+	Gain      float64
+	// Whether the shares were held for more than a year
+	LongTerm bool
+	// Whether this is a loss with the same security bought within
+	// 30 days before or after, in any account, and still held after
+	// the sale. The loss isn't adjusted
+	WashSale bool
+}
+
+// Shares are compared with some tolerance, since splits and
+// fractional shares leave floating point remainders
+const shareEpsilon = 1e-9
+
+// Record a buy, sell, dividend, or split. The account must be an
+// investment account, and a sell cannot sell more shares than are
+// held on its date
+func (m *Model) AddInvestmentEvent(ev *InvestmentEvent) error {
+	return m.RunInTx(func(tx *Model) error {
+		acc, err := tx.GetAccount(ev.AccountId)
+		if err != nil {
+			return err
+		}
+		if acc.Type != Investment {
+			return fmt.Errorf("%s is a %s account, not an investment account", ev.AccountId, acc.Type)
+		}
+		ev.AccountId = acc.Id
+		ev.Symbol = strings.ToUpper(ev.Symbol)
+		if len(ev.Lots) > 0 && ev.Method == "" {
+			ev.Method = MethodSpecific
+		}
+
+		err = validateInvestmentEvent(ev)
+		if err != nil {
+			return err
+		}
+
+		err = tx.ensureSecurity(ev.Symbol)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.db.NewInsert().
+			Model(ev).
+			Exec(context.TODO())
+		if err != nil {
+			return err
+		}
+
+		if len(ev.Lots) > 0 {
+			for i := range ev.Lots {
+				ev.Lots[i].SellId = ev.Id
+			}
+			_, err = tx.db.NewInsert().
+				Model(&ev.Lots).
+				Exec(context.TODO())
+			if err != nil {
+				return err
+			}
+		}
+
+		// make sure the history still adds up with this event in it
+		events, err := tx.GetInvestmentEvents(ev.AccountId, ev.Symbol)
+		if err != nil {
+			return err
+		}
+		_, err = replay(events)
+		return err
+	})
+}
+
+func validateInvestmentEvent(ev *InvestmentEvent) error {
+	if ev.Symbol == "" {
+		return errors.New("missing symbol")
+	}
+	switch ev.Kind {
+	case EventBuy, EventSell:
+		if ev.Quantity <= 0 {
+			return errors.New("quantity must be more than 0")
+		}
+		if ev.Price < 0 || ev.Fees < 0 {
+			return errors.New("price and fees cannot be negative")
+		}
+	case EventDividend:
+		if ev.Amount <= 0 {
+			return errors.New("dividend amount must be more than 0")
+		}
+	case EventSplit:
+		if ev.Quantity <= 0 {
+			return errors.New("split ratio must be more than 0")
+		}
+	default:
+		return fmt.Errorf("unknown investment event %s", ev.Kind)
+	}
+
+	switch ev.Method {
+	case "":
+	case MethodFifo, MethodLifo, MethodSpecific:
+		if ev.Kind != EventSell {
+			return fmt.Errorf("only sells pick lots, not %ss", ev.Kind)
+		}
+	default:
+		return fmt.Errorf("unknown lot method %s", ev.Method)
+	}
+	if ev.Method == MethodSpecific && len(ev.Lots) == 0 {
+		return errors.New("a specific lot sell must list its lots")
+	}
+	if ev.Method != MethodSpecific && len(ev.Lots) > 0 {
+		return fmt.Errorf("a %s sell cannot list lots", ev.Method)
+	}
+	return nil
+}
+
+// Remove the event with id, as long as the history still adds up
+// without it (a buy cannot be removed if its shares were sold)
+func (m *Model) RemoveInvestmentEvent(id int64) error {
+	return m.RunInTx(func(tx *Model) error {
+		ev := &InvestmentEvent{}
+		err := tx.db.NewSelect().
+			Model(ev).
+			Where("id = ?", id).
+			Scan(context.TODO())
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.db.NewDelete().
+			Model((*InvestmentEvent)(nil)).
+			Where("id = ?", id).
+			Exec(context.TODO())
+		if err != nil {
+			return err
+		}
+		_, err = tx.db.NewDelete().
+			Model((*LotSelection)(nil)).
+			Where("sell_id = ?", id).
+			Exec(context.TODO())
+		if err != nil {
+			return err
+		}
+
+		events, err := tx.GetInvestmentEvents(ev.AccountId, ev.Symbol)
+		if err != nil {
+			return err
+		}
+		_, err = replay(events)
+		return err
+	})
+}
+
+// The events of the account with id accId (or every account if empty)
+// for symbol (or every security if empty), in the order they happened
+func (m *Model) GetInvestmentEvents(accId string, symbol string) ([]InvestmentEvent, error) {
+	var events []InvestmentEvent
+	query := m.db.NewSelect().Model(&events)
+	if accId != "" {
+		query = query.Where("account_id = ?", accId)
+	}
+	if symbol != "" {
+		query = query.Where("symbol = ?", strings.ToUpper(symbol))
+	}
+	err := query.Order("date", "id").Scan(context.TODO())
+	if err != nil {
+		return nil, err
+	}
+
+	// fill in the lots picked by hand
+	sellIds := make([]int64, 0)
+	for _, ev := range events {
+		if ev.Method == MethodSpecific {
+			sellIds = append(sellIds, ev.Id)
+		}
+	}
+	if len(sellIds) == 0 {
+		return events, nil
+	}
+	var selections []LotSelection
+	err = m.db.NewSelect().
+		Model(&selections).
+		Where("sell_id IN (?)", bun.In(sellIds)).
+		Order("sell_id", "lot_id").
+		Scan(context.TODO())
+	if err != nil {
+		return nil, err
+	}
+	for i := range events {
+		for _, sel := range selections {
+			if sel.SellId == events[i].Id {
+				events[i].Lots = append(events[i].Lots, sel)
+			}
+		}
+	}
+	return events, nil
+}
+
+// What is left after replaying the events of a single security in a
+// single account
+type replayed struct {
+	lots      []Lot
+	dividends float64
+	disposals []Disposal
+	// The sell that closed each lot no longer held, by lot id
+	closedBy map[int64]InvestmentEvent
+}
+
+// Work out the open lots, dividends, and shares sold from events of
+// a single security in a single account
+func replay(events []InvestmentEvent) (replayed, error) {
+	r := replayed{lots: make([]Lot, 0), disposals: make([]Disposal, 0),
+		closedBy: make(map[int64]InvestmentEvent)}
+
+	for _, ev := range events {
+		switch ev.Kind {
+		case EventBuy:
+			r.lots = append(r.lots, Lot{
+				Id:           ev.Id,
+				AccountId:    ev.AccountId,
+				Symbol:       ev.Symbol,
+				Acquired:     ev.Date,
+				Quantity:     ev.Quantity,
+				CostPerShare: (ev.Quantity*ev.Price + ev.Fees) / ev.Quantity,
+			})
+		case EventSell:
+			lots, disposals, err := sellLots(r.lots, ev)
+			if err != nil {
+				return replayed{}, err
+			}
+			for _, lot := range r.lots {
+				if !slices.ContainsFunc(lots, func(open Lot) bool { return open.Id == lot.Id }) {
+					r.closedBy[lot.Id] = ev
+				}
+			}
+			r.lots = lots
+			r.disposals = append(r.disposals, disposals...)
+		case EventSplit:
+			for i := range r.lots {
+				r.lots[i].Quantity *= ev.Quantity
+				r.lots[i].CostPerShare /= ev.Quantity
+			}
+		case EventDividend:
+			r.dividends += ev.Amount
+		}
+	}
+
+	return r, nil
+}
+
+// Take the shares sold by ev out of lots, as picked by its method.
+// Returns the lots still open and what was taken from each
+func sellLots(lots []Lot, ev InvestmentEvent) ([]Lot, []Disposal, error) {
+	type take struct {
+		i        int
+		quantity float64
+	}
+	takes := make([]take, 0)
+
+	if ev.Method == MethodSpecific {
+		total := 0.0
+		for _, sel := range ev.Lots {
+			i := slices.IndexFunc(lots, func(lot Lot) bool { return lot.Id == sel.LotId })
+			if i == -1 {
+				return nil, nil, fmt.Errorf("lot %d of %s isn't held on %s",
+					sel.LotId, ev.Symbol, ev.Date.Format("2006/01/02"))
+			}
+			if sel.Quantity > lots[i].Quantity+shareEpsilon {
+				return nil, nil, fmt.Errorf("selling %g shares from lot %d, but it only has %g",
+					sel.Quantity, sel.LotId, lots[i].Quantity)
+			}
+			takes = append(takes, take{i, sel.Quantity})
+			total += sel.Quantity
+		}
+		if math.Abs(total-ev.Quantity) > shareEpsilon {
+			return nil, nil, fmt.Errorf("the lots picked add up to %g shares, but %g were sold", total, ev.Quantity)
+		}
+	} else {
+		remaining := ev.Quantity
+		held := 0.0
+		for n := range lots {
+			i := n
+			if ev.Method == MethodLifo {
+				i = len(lots) - 1 - n
+			}
+			held += lots[i].Quantity
+			if remaining <= shareEpsilon {
+				continue
+			}
+			taken := min(lots[i].Quantity, remaining)
+			takes = append(takes, take{i, taken})
+			remaining -= taken
+		}
+		if remaining > shareEpsilon {
+			return nil, nil, fmt.Errorf("selling %g shares of %s on %s, but only %g were held",
+				ev.Quantity, ev.Symbol, ev.Date.Format("2006/01/02"), held)
+		}
+	}
+
+	open := slices.Clone(lots)
+	disposals := make([]Disposal, 0, len(takes))
+	for _, t := range takes {
+		lot := &open[t.i]
+		d := Disposal{
+			SellId:    ev.Id,
+			LotId:     lot.Id,
+			AccountId: ev.AccountId,
+			Symbol:    ev.Symbol,
+			Acquired:  lot.Acquired,
+			Sold:      ev.Date,
+			Quantity:  t.quantity,
+			Proceeds:  t.quantity*ev.Price - ev.Fees*t.quantity/ev.Quantity,
+			CostBasis: t.quantity * lot.CostPerShare,
+			LongTerm:  ev.Date.After(lot.Acquired.AddDate(1, 0, 0)),
+		}
+		d.Gain = d.Proceeds - d.CostBasis
+		disposals = append(disposals, d)
+		lot.Quantity -= t.quantity
+	}
+
+	open = slices.DeleteFunc(open, func(lot Lot) bool { return lot.Quantity <= shareEpsilon })
+	return open, disposals, nil
+}
+
+// Replay events of every account and security, each on its own,
+// calling fn with the result of each in order of account and symbol
+func replayEach(events []InvestmentEvent, fn func(accId string, symbol string, r replayed) error) error {
+	type key struct{ accId, symbol string }
+	grouped := make(map[key][]InvestmentEvent)
+	keys := make([]key, 0)
+	for _, ev := range events {
+		k := key{ev.AccountId, ev.Symbol}
+		if _, ok := grouped[k]; !ok {
+			keys = append(keys, k)
+		}
+		grouped[k] = append(grouped[k], ev)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].accId != keys[j].accId {
+			return keys[i].accId < keys[j].accId
+		}
+		return keys[i].symbol < keys[j].symbol
+	})
+
+	for _, k := range keys {
+		r, err := replay(grouped[k])
+		if err != nil {
+			return err
+		}
+		err = fn(k.accId, k.symbol, r)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// What the account with id accId (or every account if empty) holds,
+// valued at the latest prices on or before asOf. Securities that have
+// been sold off completely are left out
+func (m *Model) GetHoldings(accId string, asOf time.Time) ([]Holding, error) {
+	events, err := m.GetInvestmentEvents(accId, "")
+	if err != nil {
+		return nil, err
+	}
+	// ignore anything that happened after asOf
+	events = slices.DeleteFunc(events, func(ev InvestmentEvent) bool { return ev.Date.After(asOf) })
+
+	holdings := make([]Holding, 0)
+	err = replayEach(events, func(accId string, symbol string, r replayed) error {
+		h := Holding{AccountId: accId, Symbol: symbol, Dividends: r.dividends, Lots: r.lots}
+		for _, lot := range r.lots {
+			h.Quantity += lot.Quantity
+			h.CostBasis += lot.Quantity * lot.CostPerShare
+		}
+		if h.Quantity <= shareEpsilon {
+			return nil
+		}
+
+		var err error
+		h.Price, h.PriceDate, err = m.GetPrice(symbol, asOf)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		h.MarketValue = h.Quantity * h.Price
+		holdings = append(holdings, h)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return holdings, nil
+}
+
+// Every lot closed by sells during year, in the account with id accId
+// (or every account if empty), ordered by when they were sold. Losses
+// are flagged as wash sales when the same security was bought within
+// 30 days of the sale, in any account, and those shares weren't sold by
+// the time of the sale too
+func (m *Model) GetCapitalGains(year int, accId string) ([]Disposal, error) {
+	// every account is needed to find wash sales
+	events, err := m.GetInvestmentEvents("", "")
+	if err != nil {
+		return nil, err
+	}
+
+	gains := make([]Disposal, 0)
+	closedBy := make(map[int64]InvestmentEvent)
+	err = replayEach(events, func(acc string, symbol string, r replayed) error {
+		for lotId, sell := range r.closedBy {
+			closedBy[lotId] = sell
+		}
+		if accId != "" && acc != accId {
+			return nil
+		}
+		for _, d := range r.disposals {
+			if d.Sold.Year() == year {
+				gains = append(gains, d)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range gains {
+		d := &gains[i]
+		if d.Gain >= 0 {
+			continue
+		}
+		start, end := d.Sold.AddDate(0, 0, -30), d.Sold.AddDate(0, 0, 30)
+		d.WashSale = slices.ContainsFunc(events, func(ev InvestmentEvent) bool {
+			if ev.Kind != EventBuy || ev.Symbol != d.Symbol || ev.Id == d.LotId ||
+				ev.Date.Before(start) || ev.Date.After(end) {
+				return false
+			}
+			// shares all sold by this sale or before it don't replace it
+			sell, closed := closedBy[ev.Id]
+			return !closed || sell.Date.After(d.Sold) ||
+				(sell.Date.Equal(d.Sold) && sell.Id > d.SellId)
+		})
+	}
+
+	sort.SliceStable(gains, func(i, j int) bool {
+		return gains[i].Sold.Before(gains[j].Sold)
+	})
+	return gains, nil
+}
+
+// The total value of what the account with id accId holds at asOf
+func (m *Model) MarketValue(accId string, asOf time.Time) (float64, error) {
+	holdings, err := m.GetHoldings(accId, asOf)
+	if err != nil {
+		return 0, err
+	}
+	value := 0.0
+	for _, h := range holdings {
+		value += h.MarketValue
+	}
+	return value, nil
+}
+
+// The latest price of symbol on or before asOf, either from the loaded
+// price history or the price it was last bought or sold at, whichever
+// is newer. Returns sql.ErrNoRows if there is neither
+func (m *Model) GetPrice(symbol string, asOf time.Time) (float64, time.Time, error) {
+	symbol = strings.ToUpper(symbol)
+	before := dbTime(asOf)
+
+	price := &SecurityPrice{}
+	priceErr := m.db.NewSelect().
+		Model(price).
+		Where("symbol = ?", symbol).
+		Where("date <= ?", before).
+		Order("date DESC").
+		Limit(1).
+		Scan(context.TODO())
+	if priceErr != nil && priceErr != sql.ErrNoRows {
+		return 0, time.Time{}, priceErr
+	}
+
+	trade := &InvestmentEvent{}
+	tradeErr := m.db.NewSelect().
+		Model(trade).
+		Where("symbol = ?", symbol).
+		Where("kind IN (?, ?)", EventBuy, EventSell).
+		Where("date <= ?", before).
+		Order("date DESC", "id DESC").
+		Limit(1).
+		Scan(context.TODO())
+	if tradeErr != nil && tradeErr != sql.ErrNoRows {
+		return 0, time.Time{}, tradeErr
+	}
+
+	switch {
+	case priceErr == nil && (tradeErr != nil || !trade.Date.After(price.Date)):
+		return price.Price, price.Date, nil
+	case tradeErr == nil:
+		return trade.Price, trade.Date, nil
+	default:
+		return 0, time.Time{}, sql.ErrNoRows
+	}
+}
+
+// Store prices, replacing any already known for the same
+// security and day
+func (m *Model) SetPrices(prices []SecurityPrice) error {
+	return m.RunInTx(func(tx *Model) error {
+		for i := range prices {
+			prices[i].Symbol = strings.ToUpper(prices[i].Symbol)
+			err := tx.ensureSecurity(prices[i].Symbol)
+			if err != nil {
+				return err
+			}
+		}
+		if len(prices) == 0 {
+			return nil
+		}
+
+		_, err := tx.db.NewInsert().
+			Model(&prices).
+			On("CONFLICT (symbol, date) DO UPDATE").
+			Set("price = EXCLUDED.price").
+			Exec(context.TODO())
+		return err
+	})
+}
+
+// Set the full name of a security, adding it if it is new
+func (m *Model) SetSecurityName(symbol string, name string) error {
+	sec := &Security{Symbol: strings.ToUpper(symbol), Name: name}
+	_, err := m.db.NewInsert().
+		Model(sec).
+		On("CONFLICT (symbol) DO UPDATE").
+		Set("name = EXCLUDED.name").
+		Exec(context.TODO())
+	return err
+}
+
+func (m *Model) GetSecurities() []Security {
+	var secs []Security
+	err := m.db.NewSelect().
+		Model(&secs).
+		Order("symbol").
+		Scan(context.TODO())
+	if err != nil {
+		return make([]Security, 0)
+	}
+	return secs
+}
+
+func (m *Model) ensureSecurity(symbol string) error {
+	_, err := m.db.NewInsert().
+		Model(&Security{Symbol: symbol}).
+		On("CONFLICT (symbol) DO NOTHING").
+		Exec(context.TODO())
+	return err
+}
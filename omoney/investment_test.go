@@ -0,0 +1,301 @@
+package omoney
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+func addBrokerage(t *testing.T, m *Model) Account {
+	acc := *NewAccount(WithAlias("brokerage"), WithAccountType(Investment))
+	m.AddAccount(acc)
+	acc, err := m.GetAccount("brokerage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return acc
+}
+
+func day(year int, month time.Month, d int) time.Time {
+	return time.Date(year, month, d, 0, 0, 0, 0, time.Local)
+}
+
+func closeTo(a, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
+
+func TestHoldingsFromEvents(t *testing.T) {
+	m := &Model{db: CreateEmptyDB()}
+	acc := addBrokerage(t, m)
+
+	events := []InvestmentEvent{
+		{AccountId: "brokerage", Symbol: "vti", Kind: EventBuy, Date: day(2020, 1, 2), Quantity: 10, Price: 100, Fees: 5},
+		{AccountId: "brokerage", Symbol: "VTI", Kind: EventBuy, Date: day(2020, 6, 1), Quantity: 10, Price: 150},
+		{AccountId: "brokerage", Symbol: "VTI", Kind: EventDividend, Date: day(2020, 9, 1), Amount: 12.5},
+		{AccountId: "brokerage", Symbol: "VTI", Kind: EventSplit, Date: day(2021, 1, 4), Quantity: 2},
+		// sells the oldest lot (20 shares after the split) and 5 of the next
+		{AccountId: "brokerage", Symbol: "VTI", Kind: EventSell, Date: day(2021, 3, 1), Quantity: 25, Price: 90},
+	}
+	for i := range events {
+		err := m.AddInvestmentEvent(&events[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	holdings, err := m.GetHoldings(acc.Id, day(2022, 1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(holdings) != 1 {
+		t.Fatalf("GetHoldings failed\nhave: %v\nneed: 1 holding", holdings)
+	}
+	h := holdings[0]
+	if h.Symbol != "VTI" || !closeTo(h.Quantity, 15) || len(h.Lots) != 1 {
+		t.Fatalf("GetHoldings failed"+
+			"\nhave: %v"+
+			"\nneed: 15 shares of VTI in 1 lot", h)
+	}
+	// the second lot cost $1500 for what are now 20 shares
+	if !closeTo(h.Lots[0].CostPerShare, 75) || !closeTo(h.CostBasis, 1125) {
+		t.Fatalf("Cost basis failed"+
+			"\nhave: %v, %v"+
+			"\nneed: 75, 1125", h.Lots[0].CostPerShare, h.CostBasis)
+	}
+	if !closeTo(h.Dividends, 12.5) {
+		t.Fatalf("Dividends failed\nhave: %v\nneed: 12.5", h.Dividends)
+	}
+	// with no price history, the last trade price is used
+	if !closeTo(h.Price, 90) || !closeTo(h.MarketValue, 1350) {
+		t.Fatalf("Market value failed"+
+			"\nhave: %v, %v"+
+			"\nneed: 90, 1350", h.Price, h.MarketValue)
+	}
+
+	// before the split, the first lot is still whole and includes its fees
+	holdings, _ = m.GetHoldings(acc.Id, day(2020, 3, 1))
+	if len(holdings) != 1 || !closeTo(holdings[0].CostBasis, 1005) {
+		t.Fatalf("Holdings as of a date failed\nhave: %v\nneed: cost basis 1005", holdings)
+	}
+}
+
+func TestSellMoreThanHeld(t *testing.T) {
+	m := &Model{db: CreateEmptyDB()}
+	addBrokerage(t, m)
+
+	buy := &InvestmentEvent{AccountId: "brokerage", Symbol: "AAPL", Kind: EventBuy, Date: day(2023, 1, 1), Quantity: 5, Price: 130}
+	if err := m.AddInvestmentEvent(buy); err != nil {
+		t.Fatal(err)
+	}
+	sell := &InvestmentEvent{AccountId: "brokerage", Symbol: "AAPL", Kind: EventSell, Date: day(2023, 2, 1), Quantity: 6, Price: 150}
+	if err := m.AddInvestmentEvent(sell); err == nil {
+		t.Fatal("Selling more shares than held should fail")
+	}
+	events, _ := m.GetInvestmentEvents("", "AAPL")
+	if len(events) != 1 {
+		t.Fatalf("Failed sell was kept\nhave: %v\nneed: only the buy", events)
+	}
+
+	// and a buy can't be removed once its shares are sold
+	sell.Quantity = 5
+	if err := m.AddInvestmentEvent(sell); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.RemoveInvestmentEvent(buy.Id); err == nil {
+		t.Fatal("Removing a buy whose shares were sold should fail")
+	}
+}
+
+func TestInvestmentEventsNeedInvestmentAccount(t *testing.T) {
+	m := &Model{db: CreateEmptyDB()}
+	AddDummyAccounts(m, 1)
+
+	ev := &InvestmentEvent{AccountId: "acc0", Symbol: "VTI", Kind: EventBuy, Date: day(2023, 1, 1), Quantity: 1, Price: 200}
+	if err := m.AddInvestmentEvent(ev); err == nil {
+		t.Fatal("Buying into a non-investment account should fail")
+	}
+}
+
+func TestBalanceIsMarketValue(t *testing.T) {
+	m := &Model{db: CreateEmptyDB()}
+	acc := addBrokerage(t, m)
+
+	err := m.AddInvestmentEvent(&InvestmentEvent{AccountId: acc.Id, Symbol: "VTI", Kind: EventBuy, Date: day(2023, 1, 3), Quantity: 4, Price: 190})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a cash transaction in the account doesn't count towards its value
+	m.AddTransaction(NewTransaction(acc.Id, "Transfer", 760, WithDate(day(2023, 1, 2))))
+
+	err = m.SetPrices([]SecurityPrice{
+		{Symbol: "vti", Date: day(2023, 6, 1), Price: 210},
+		{Symbol: "VTI", Date: day(2023, 12, 29), Price: 237.5},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	price, date, err := m.GetPrice("VTI", day(2023, 7, 1))
+	if err != nil || price != 210 || !date.Equal(day(2023, 6, 1)) {
+		t.Fatalf("GetPrice failed"+
+			"\nhave: %v on %v (%v)"+
+			"\nneed: 210 on %v", price, date, err, day(2023, 6, 1))
+	}
+
+	bal, err := m.GetCurrentBalance(acc.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !closeTo(bal, 950) {
+		t.Fatalf("GetCurrentBalance failed\nhave: %v\nneed: 950", bal)
+	}
+
+	// loading a price again replaces it
+	m.SetPrices([]SecurityPrice{{Symbol: "VTI", Date: day(2023, 12, 29), Price: 240}})
+	bal, _ = m.MarketValue(acc.Id, time.Now())
+	if !closeTo(bal, 960) {
+		t.Fatalf("Replacing a price failed\nhave: %v\nneed: 960", bal)
+	}
+}
+
+func TestCapitalGains(t *testing.T) {
+	m := &Model{db: CreateEmptyDB()}
+	acc := addBrokerage(t, m)
+	ira := *NewAccount(WithAlias("ira"), WithAccountType(Investment))
+	m.AddAccount(ira)
+
+	add := func(ev InvestmentEvent) int64 {
+		err := m.AddInvestmentEvent(&ev)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ev.Id
+	}
+	first := add(InvestmentEvent{AccountId: "brokerage", Symbol: "VTI", Kind: EventBuy, Date: day(2022, 3, 1), Quantity: 10, Price: 200})
+	add(InvestmentEvent{AccountId: "brokerage", Symbol: "VTI", Kind: EventBuy, Date: day(2023, 8, 1), Quantity: 10, Price: 220})
+	third := add(InvestmentEvent{AccountId: "brokerage", Symbol: "VTI", Kind: EventBuy, Date: day(2023, 9, 1), Quantity: 10, Price: 230, Fees: 10})
+
+	// lifo sells from the newest lot, at a loss
+	add(InvestmentEvent{AccountId: "brokerage", Symbol: "VTI", Kind: EventSell, Date: day(2023, 10, 2), Quantity: 4, Price: 210, Fees: 4, Method: MethodLifo})
+	// specific lots: 6 from the first (long term), 2 from the third
+	add(InvestmentEvent{AccountId: "brokerage", Symbol: "VTI", Kind: EventSell, Date: day(2023, 12, 1), Quantity: 8, Price: 240,
+		Lots: []LotSelection{{LotId: first, Quantity: 6}, {LotId: third, Quantity: 2}}})
+	// a year with nothing else sold, and a buy in another account
+	// within 30 days of the loss above makes it a wash sale
+	add(InvestmentEvent{AccountId: "brokerage", Symbol: "VTI", Kind: EventSell, Date: day(2024, 2, 1), Quantity: 1, Price: 250})
+	add(InvestmentEvent{AccountId: "ira", Symbol: "VTI", Kind: EventBuy, Date: day(2023, 10, 20), Quantity: 1, Price: 205})
+
+	gains, err := m.GetCapitalGains(2023, acc.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gains) != 3 {
+		t.Fatalf("GetCapitalGains failed\nhave: %v\nneed: 3 lots sold", gains)
+	}
+
+	lifo := gains[0]
+	// cost is 231/share with fees, proceeds 209/share after fees
+	if lifo.LotId != third || !closeTo(lifo.CostBasis, 924) || !closeTo(lifo.Proceeds, 836) ||
+		lifo.LongTerm || !lifo.WashSale {
+		t.Fatalf("LIFO sell failed"+
+			"\nhave: %+v"+
+			"\nneed: lot %d, cost 924, proceeds 836, short term wash sale", lifo, third)
+	}
+
+	long, short := gains[1], gains[2]
+	if long.LotId != first || !closeTo(long.Gain, 240) || !long.LongTerm || long.WashSale {
+		t.Fatalf("Specific long term lot failed\nhave: %+v\nneed: lot %d with a long term gain of 240", long, first)
+	}
+	if short.LotId != third || !closeTo(short.Gain, 18) || short.LongTerm {
+		t.Fatalf("Specific short term lot failed\nhave: %+v\nneed: lot %d with a short term gain of 18", short, third)
+	}
+
+	gains, _ = m.GetCapitalGains(2024, "")
+	if len(gains) != 1 || gains[0].LotId != first {
+		t.Fatalf("FIFO sell failed\nhave: %v\nneed: 1 share from lot %d", gains, first)
+	}
+}
+
+func TestWashSaleIgnoresLotsSoldTogether(t *testing.T) {
+	m := &Model{db: CreateEmptyDB()}
+	addBrokerage(t, m)
+
+	add := func(ev InvestmentEvent) int64 {
+		err := m.AddInvestmentEvent(&ev)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ev.Id
+	}
+	first := add(InvestmentEvent{AccountId: "brokerage", Symbol: "VTI", Kind: EventBuy, Date: day(2024, 1, 1), Quantity: 10, Price: 200})
+	second := add(InvestmentEvent{AccountId: "brokerage", Symbol: "VTI", Kind: EventBuy, Date: day(2024, 1, 20), Quantity: 10, Price: 210})
+	// both lots sold at a loss, so neither is still held to replace the other
+	add(InvestmentEvent{AccountId: "brokerage", Symbol: "VTI", Kind: EventSell, Date: day(2024, 2, 1), Quantity: 20, Price: 180})
+
+	gains, err := m.GetCapitalGains(2024, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gains) != 2 || gains[0].LotId != first || gains[1].LotId != second {
+		t.Fatalf("GetCapitalGains failed\nhave: %v\nneed: lots %d and %d sold", gains, first, second)
+	}
+	for _, d := range gains {
+		if d.Gain >= 0 || d.WashSale {
+			t.Fatalf("Wash sale failed\nhave: %+v\nneed: a loss that isn't a wash sale", d)
+		}
+	}
+
+	// a buy after the sale still counts
+	add(InvestmentEvent{AccountId: "brokerage", Symbol: "VTI", Kind: EventBuy, Date: day(2024, 2, 15), Quantity: 5, Price: 185})
+	gains, _ = m.GetCapitalGains(2024, "")
+	if !gains[0].WashSale || !gains[1].WashSale {
+		t.Fatalf("Wash sale after rebuying failed\nhave: %+v\nneed: both wash sales", gains)
+	}
+}
+
+func TestSpecificLotsMustAddUp(t *testing.T) {
+	m := &Model{db: CreateEmptyDB()}
+	addBrokerage(t, m)
+
+	buy := &InvestmentEvent{AccountId: "brokerage", Symbol: "VTI", Kind: EventBuy, Date: day(2023, 1, 1), Quantity: 5, Price: 200}
+	if err := m.AddInvestmentEvent(buy); err != nil {
+		t.Fatal(err)
+	}
+
+	sells := []InvestmentEvent{
+		// lots add up to less than sold
+		{AccountId: "brokerage", Symbol: "VTI", Kind: EventSell, Date: day(2023, 2, 1), Quantity: 4, Price: 210,
+			Lots: []LotSelection{{LotId: buy.Id, Quantity: 3}}},
+		// more than the lot has
+		{AccountId: "brokerage", Symbol: "VTI", Kind: EventSell, Date: day(2023, 2, 1), Quantity: 6, Price: 210,
+			Lots: []LotSelection{{LotId: buy.Id, Quantity: 6}}},
+		// a lot that doesn't exist
+		{AccountId: "brokerage", Symbol: "VTI", Kind: EventSell, Date: day(2023, 2, 1), Quantity: 1, Price: 210,
+			Lots: []LotSelection{{LotId: buy.Id + 100, Quantity: 1}}},
+	}
+	for _, sell := range sells {
+		if err := m.AddInvestmentEvent(&sell); err == nil {
+			t.Fatalf("Sell should have failed: %+v", sell)
+		}
+	}
+
+	sell := &InvestmentEvent{AccountId: "brokerage", Symbol: "VTI", Kind: EventSell, Date: day(2023, 2, 1), Quantity: 2, Price: 210,
+		Lots: []LotSelection{{LotId: buy.Id, Quantity: 2}}}
+	if err := m.AddInvestmentEvent(sell); err != nil {
+		t.Fatal(err)
+	}
+	events, _ := m.GetInvestmentEvents("", "VTI")
+	if len(events) != 2 || len(events[1].Lots) != 1 || events[1].Method != MethodSpecific {
+		t.Fatalf("Specific lots weren't stored\nhave: %+v", events)
+	}
+
+	// removing the sell removes its lots with it
+	if err := m.RemoveInvestmentEvent(sell.Id); err != nil {
+		t.Fatal(err)
+	}
+	count, _ := m.db.NewSelect().Model((*LotSelection)(nil)).Count(context.TODO())
+	if count != 0 {
+		t.Fatalf("Removing a sell failed\nhave: %d lot selections\nneed: 0", count)
+	}
+}
@@ -0,0 +1,402 @@
+package omoney
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+type OperationKind string
+
+const (
+	OpAddTransaction    OperationKind = "add transaction"
+	OpUpdateTransaction OperationKind = "update transaction"
+	OpRemoveTransaction OperationKind = "remove transaction"
+	OpRemoveAccount     OperationKind = "remove account"
+	OpSetAlias          OperationKind = "set alias"
+	OpSetAnchor         OperationKind = "set anchor"
+	OpCloseAccount      OperationKind = "close account"
+	OpReopenAccount     OperationKind = "reopen account"
+	OpSetLoanTerms      OperationKind = "set loan terms"
+	OpSetStatementDays  OperationKind = "set statement days"
+	OpSetShare          OperationKind = "set share"
+	OpAddReport         OperationKind = "add expense report"
+	OpRemoveReport      OperationKind = "remove expense report"
+	OpMatchReport       OperationKind = "match reimbursement"
+)
+
+// Kinds of operation that change an account rather than a transaction
+var accountOpKinds = []OperationKind{OpRemoveAccount, OpSetAlias, OpSetAnchor, OpCloseAccount, OpReopenAccount, OpSetLoanTerms, OpSetStatementDays}
+
+// Kinds of operation that change an expense report
+var reportOpKinds = []OperationKind{OpAddReport, OpRemoveReport, OpMatchReport}
+
+// Only this many of the most recent operations are kept in the journal
+const journalLimit = 500
+
+// A single change made to the model, recorded with the state of the
+// changed row before and after so that it can be undone and redone
+type Operation struct {
+	Id   int64 `bun:",pk,autoincrement"`
+	Kind OperationKind
+	// The id of the transaction, account, or share that was changed
+	TargetId string
+	// JSON encoding of the row before the change. Empty
+	// string if the row did not exist yet
+	Before string
+	// JSON encoding of the row after the change. Empty
+	// string if the row was removed
+	After string
+	// When the operation was originally made
+	Time time.Time
+	// Whether this operation has been undone and is waiting
+	// to either be redone or discarded
+	Undone bool
+	// Id of the first operation in the batch this one was made in,
+	// so that a change to many rows is undone and redone as one.
+	// Zero for operations made on their own
+	Batch int64
+}
+
+// Whether this operation changed an account, as opposed to a transaction
+func (op *Operation) isAccountOp() bool {
+	for _, kind := range accountOpKinds {
+		if op.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether this operation changed someone's share of a transaction
+func (op *Operation) isShareOp() bool {
+	return op.Kind == OpSetShare
+}
+
+// Whether this operation changed an expense report
+func (op *Operation) isReportOp() bool {
+	for _, kind := range reportOpKinds {
+		if op.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func (op *Operation) String() string {
+	state := op.After
+	if state == "" {
+		state = op.Before
+	}
+
+	if op.isShareOp() {
+		var share Share
+		if json.Unmarshal([]byte(state), &share) == nil {
+			return fmt.Sprintf("%s ($%.2f of %s)", op.Kind, share.Amount, share.TransactionId)
+		}
+		return fmt.Sprintf("%s (%s)", op.Kind, op.TargetId)
+	}
+
+	if op.isReportOp() {
+		var report ExpenseReport
+		if json.Unmarshal([]byte(state), &report) == nil {
+			return fmt.Sprintf("%s (%s)", op.Kind, report.Name)
+		}
+		return fmt.Sprintf("%s (%s)", op.Kind, op.TargetId)
+	}
+
+	if op.isAccountOp() {
+		var acc Account
+		if json.Unmarshal([]byte(state), &acc) == nil && acc.Alias != "" {
+			return fmt.Sprintf("%s (%s)", op.Kind, acc.Alias)
+		}
+		return fmt.Sprintf("%s (%s)", op.Kind, op.TargetId)
+	}
+
+	var tr Transaction
+	if json.Unmarshal([]byte(state), &tr) == nil {
+		return fmt.Sprintf("%s (%s $%.2f %s)", op.Kind, tr.Payee, tr.Amount, tr.Date.Format("2006/01/02"))
+	}
+	return fmt.Sprintf("%s (%s)", op.Kind, op.TargetId)
+}
+
+// Run fn with a copy of the model where every change is made inside a
+// single database transaction, which is committed only if fn returns nil
+func (m *Model) RunInTx(fn func(tx *Model) error) error {
+	return m.db.RunInTx(context.TODO(), nil, func(ctx context.Context, tx bun.Tx) error {
+		return fn(&Model{db: tx, path: m.path, secrets: m.secretKey(), batch: m.batch, unjournaled: m.unjournaled})
+	})
+}
+
+// A copy of the model whose changes are kept out of the journal, for
+// changes made in the background, such as syncs started by a webhook.
+// Otherwise they would become what the next undo reverts, and would
+// throw away anything waiting to be redone
+func (m *Model) Unjournaled() *Model {
+	return &Model{db: m.db, path: m.path, secrets: m.secretKey(), unjournaled: true}
+}
+
+// Same as RunInTx, but every operation recorded by fn joins one batch,
+// which undo and redo treat as a single change
+func (m *Model) RunInBatch(fn func(tx *Model) error) error {
+	return m.RunInTx(func(tx *Model) error {
+		if tx.batch == nil {
+			tx.batch = new(int64)
+		}
+		return fn(tx)
+	})
+}
+
+// Add an operation to the journal, unless the model is unjournaled. Any
+// operations that were undone are discarded, since they can no longer
+// be cleanly redone
+func (m *Model) record(kind OperationKind, targetId string, before interface{}, after interface{}) error {
+	if m.unjournaled {
+		return nil
+	}
+	op := &Operation{
+		Kind:     kind,
+		TargetId: targetId,
+		Time:     time.Now(),
+	}
+
+	var err error
+	op.Before, err = encodeState(before)
+	if err != nil {
+		return err
+	}
+	op.After, err = encodeState(after)
+	if err != nil {
+		return err
+	}
+	if m.batch != nil {
+		op.Batch = *m.batch
+	}
+
+	_, err = m.db.NewDelete().
+		Model((*Operation)(nil)).
+		Where("undone = ?", true).
+		Exec(context.TODO())
+	if err != nil {
+		return err
+	}
+
+	_, err = m.db.NewInsert().
+		Model(op).
+		Exec(context.TODO())
+	if err != nil {
+		return err
+	}
+
+	// the first operation of a batch names it
+	if m.batch != nil && *m.batch == 0 {
+		*m.batch = op.Id
+		_, err = m.db.NewUpdate().
+			Model((*Operation)(nil)).
+			Set("batch = ?", op.Id).
+			Where("id = ?", op.Id).
+			Exec(context.TODO())
+		if err != nil {
+			return err
+		}
+	}
+
+	// trim old operations, but never only part of a batch
+	cutoff := op.Id - journalLimit
+	_, err = m.db.NewDelete().
+		Model((*Operation)(nil)).
+		Where("id <= ?", cutoff).
+		Where("(batch = 0 OR batch NOT IN (SELECT batch FROM operations WHERE id > ?))", cutoff).
+		Exec(context.TODO())
+	return err
+}
+
+// Select the operations making up the last n changes that are undone
+// (or not), in the given order by id. All the operations of a batch
+// count as one change
+func (m *Model) selectChanges(n int, undone bool, order string) ([]Operation, error) {
+	var ops []Operation
+	err := m.db.NewSelect().
+		Model(&ops).
+		Where("undone = ?", undone).
+		Order(order).
+		Scan(context.TODO())
+	if err != nil {
+		return nil, err
+	}
+
+	changes := 0
+	var lastBatch int64
+	for i, op := range ops {
+		if op.Batch == 0 || op.Batch != lastBatch {
+			changes++
+		}
+		if changes > n {
+			return ops[:i], nil
+		}
+		lastBatch = op.Batch
+	}
+	return ops, nil
+}
+
+// Revert the last n changes that have not already been undone,
+// newest first. Returns the operations that were undone
+func (m *Model) Undo(n int) ([]Operation, error) {
+	var ops []Operation
+	err := m.RunInTx(func(tx *Model) error {
+		var err error
+		ops, err = tx.selectChanges(n, false, "id DESC")
+		if err != nil {
+			return err
+		}
+
+		for _, op := range ops {
+			err = tx.writeState(&op, op.After, op.Before)
+			if err != nil {
+				return err
+			}
+			err = tx.markUndone(op.Id, true)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ops) == 0 {
+		return nil, errors.New("nothing to undo")
+	}
+	return ops, nil
+}
+
+// Reapply the last n changes that were undone, oldest first.
+// Returns the operations that were redone
+func (m *Model) Redo(n int) ([]Operation, error) {
+	var ops []Operation
+	err := m.RunInTx(func(tx *Model) error {
+		var err error
+		ops, err = tx.selectChanges(n, true, "id ASC")
+		if err != nil {
+			return err
+		}
+
+		for _, op := range ops {
+			err = tx.writeState(&op, op.Before, op.After)
+			if err != nil {
+				return err
+			}
+			err = tx.markUndone(op.Id, false)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ops) == 0 {
+		return nil, errors.New("nothing to redo")
+	}
+	return ops, nil
+}
+
+func (m *Model) markUndone(id int64, undone bool) error {
+	_, err := m.db.NewUpdate().
+		Model((*Operation)(nil)).
+		Set("undone = ?", undone).
+		Where("id = ?", id).
+		Exec(context.TODO())
+	return err
+}
+
+// Change the row targeted by op from the encoded state from to the
+// encoded state to, removing the row if to is empty and adding it if
+// from is. Otherwise only the columns that differ between the two are
+// written, leaving alone anything changed outside of the journal
+func (m *Model) writeState(op *Operation, from string, to string) error {
+	var model interface{}
+	if op.isAccountOp() {
+		model = &Account{}
+	} else if op.isShareOp() {
+		model = &Share{}
+	} else if op.isReportOp() {
+		model = &ExpenseReport{}
+	} else {
+		model = &Transaction{}
+	}
+
+	if to == "" {
+		_, err := m.db.NewDelete().
+			Model(model).
+			Where("id = ?", op.TargetId).
+			Exec(context.TODO())
+		return err
+	}
+	err := json.Unmarshal([]byte(to), model)
+	if err != nil {
+		return err
+	}
+	if from == "" {
+		_, err = m.db.NewInsert().Model(model).Exec(context.TODO())
+		return err
+	}
+
+	old := reflect.New(reflect.TypeOf(model).Elem())
+	err = json.Unmarshal([]byte(from), old.Interface())
+	if err != nil {
+		return err
+	}
+	table := m.db.Dialect().Tables().Get(old.Elem().Type())
+	columns := make([]string, 0)
+	for _, field := range table.DataFields {
+		if !reflect.DeepEqual(field.Value(old.Elem()).Interface(),
+			field.Value(reflect.ValueOf(model).Elem()).Interface()) {
+			columns = append(columns, field.Name)
+		}
+	}
+	if len(columns) == 0 {
+		return nil
+	}
+	_, err = m.db.NewUpdate().
+		Model(model).
+		Column(columns...).
+		Where("id = ?", op.TargetId).
+		Exec(context.TODO())
+	return err
+}
+
+func encodeState(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case *Transaction:
+		if v == nil {
+			return "", nil
+		}
+	case *Account:
+		if v == nil {
+			return "", nil
+		}
+	case *Share:
+		if v == nil {
+			return "", nil
+		}
+	case *ExpenseReport:
+		if v == nil {
+			return "", nil
+		}
+	}
+
+	b, err := json.Marshal(v)
+	return string(b), err
+}
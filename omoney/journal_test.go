@@ -0,0 +1,321 @@
+package omoney
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestUndoRedoAddTransaction(t *testing.T) {
+	m := &Model{db: CreateEmptyDB()}
+	AddDummyAccounts(m, 1)
+	acc, _ := m.GetAccount("acc0")
+
+	tr := NewTransaction(acc.Id, "Spotify", 18.25)
+	err := m.AddTransaction(tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = m.Undo(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = m.GetTransactionById(tr.Id); err == nil {
+		t.Fatal("Undo add transaction failed: transaction still exists")
+	}
+
+	_, err = m.Redo(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	retrieved, err := m.GetTransactionById(tr.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tr.LooseEquals(&retrieved) {
+		t.Fatalf("Redo add transaction failed"+
+			"\nhave: %+v"+
+			"\nneed: %+v",
+			retrieved, tr)
+	}
+}
+
+func TestUndoMultipleOperations(t *testing.T) {
+	m := &Model{db: CreateEmptyDB()}
+	AddDummyAccounts(m, 1)
+	acc, _ := m.GetAccount("acc0")
+
+	tr := NewTransaction(acc.Id, "Spotify", 18.25,
+		WithDate(time.Date(2001, 03, 03, 12, 0, 0, 0, time.Local)))
+	m.AddTransaction(tr)
+	m.UpdateTransaction(tr.Id, WithPayeeUpdate("Hulu"), WithAmountUpdate(20))
+	m.RemoveTransactionById(tr.Id)
+	m.SetAlias(acc.Id, "renamed")
+
+	ops, err := m.Undo(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ops) != 3 {
+		t.Fatalf("Undo 3 failed"+
+			"\nhave length: %d"+
+			"\nneed length: %d",
+			len(ops), 3)
+	}
+
+	if _, err = m.GetAccount("acc0"); err != nil {
+		t.Fatal("Undo set alias failed")
+	}
+
+	retrieved, err := m.GetTransactionById(tr.Id)
+	if err != nil {
+		t.Fatal("Undo remove transaction failed")
+	}
+	if !tr.LooseEquals(&retrieved) {
+		t.Fatalf("Undo update transaction failed"+
+			"\nhave: %+v"+
+			"\nneed: %+v",
+			retrieved, tr)
+	}
+}
+
+func TestNewOperationDiscardsRedo(t *testing.T) {
+	m := &Model{db: CreateEmptyDB()}
+	AddDummyAccounts(m, 1)
+	acc, _ := m.GetAccount("acc0")
+
+	m.AddTransaction(NewTransaction(acc.Id, "Spotify", 18.25))
+	m.Undo(1)
+	m.AddTransaction(NewTransaction(acc.Id, "Hulu", 20))
+
+	if _, err := m.Redo(1); err == nil {
+		t.Fatal("Redo after a new operation should fail")
+	}
+}
+
+func TestUndoRemoveAccount(t *testing.T) {
+	m := &Model{db: CreateEmptyDB()}
+	acc := *NewAccount(WithAlias("dummy"),
+		WithAnchor(20, time.Date(2001, 01, 01, 0, 0, 0, 0, time.Local)),
+		WithAccountType(Checking),
+	)
+	m.AddAccount(acc)
+
+	m.RemoveAccount("dummy", false)
+	m.Undo(1)
+
+	retrieved, err := m.GetAccount("dummy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !acc.LooseEquals(&retrieved) {
+		t.Fatalf("Undo remove account failed"+
+			"\nhave: %+v"+
+			"\nneed: %+v",
+			retrieved, acc)
+	}
+}
+
+func TestUndoBatchAsOneChange(t *testing.T) {
+	m := &Model{db: CreateEmptyDB()}
+	AddDummyAccounts(m, 1)
+	acc, _ := m.GetAccount("acc0")
+
+	ids := make([]string, 3)
+	for i := range ids {
+		tr := NewTransaction(acc.Id, "Store", float64(i+1))
+		m.AddTransaction(tr)
+		ids[i] = tr.Id
+	}
+
+	err := m.UpdateTransactions(ids, WithCategoryUpdate("groceries"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ops, err := m.Undo(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ops) != 3 {
+		t.Fatalf("Undo of a batch reverted %d operations, need 3", len(ops))
+	}
+	for _, id := range ids {
+		tr, _ := m.GetTransactionById(id)
+		if tr.Category != "" {
+			t.Fatalf("Undo batch failed, category is %s", tr.Category)
+		}
+	}
+
+	// the transactions themselves were added one at a time
+	if count, _ := m.CountTransactions(acc.Id, GetTransactionsOptions{}); count != 3 {
+		t.Fatalf("Undo batch removed transactions, %d left", count)
+	}
+
+	ops, err = m.Redo(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ops) != 3 {
+		t.Fatalf("Redo of a batch reapplied %d operations, need 3", len(ops))
+	}
+	for _, id := range ids {
+		tr, _ := m.GetTransactionById(id)
+		if tr.Category != "groceries" {
+			t.Fatalf("Redo batch failed, category is %s", tr.Category)
+		}
+	}
+}
+
+func TestBatchIsAllOrNothing(t *testing.T) {
+	m := &Model{db: CreateEmptyDB()}
+	AddDummyAccounts(m, 1)
+	acc, _ := m.GetAccount("acc0")
+
+	tr := NewTransaction(acc.Id, "Store", 10)
+	m.AddTransaction(tr)
+
+	err := m.UpdateTransactions([]string{tr.Id, "missing"}, WithCategoryUpdate("groceries"))
+	if err == nil {
+		t.Fatal("Updating a missing transaction succeeded")
+	}
+
+	retrieved, _ := m.GetTransactionById(tr.Id)
+	if retrieved.Category != "" {
+		t.Fatalf("Failed batch was partly applied, category is %s", retrieved.Category)
+	}
+}
+
+func TestRemoveAccountRefusesOrCascades(t *testing.T) {
+	m := &Model{db: CreateEmptyDB()}
+	AddDummyAccounts(m, 1)
+	acc, _ := m.GetAccount("acc0")
+	m.AddTransaction(NewTransaction(acc.Id, "Store", 1))
+	m.AddTransaction(NewTransaction(acc.Id, "Store", 2))
+
+	err := m.RemoveAccount("acc0", false)
+	if !errors.Is(err, ErrAccountHasTransactions) {
+		t.Fatalf("Removing an account with transactions returned %v", err)
+	}
+	if _, err := m.GetAccount("acc0"); err != nil {
+		t.Fatal("Refused removal still removed the account")
+	}
+
+	err = m.RemoveAccount("acc0", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count, _ := m.CountTransactions(acc.Id, GetTransactionsOptions{}); count != 0 {
+		t.Fatalf("Cascading removal left %d transactions", count)
+	}
+
+	// one undo brings back the account and its transactions
+	_, err = m.Undo(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.GetAccount("acc0"); err != nil {
+		t.Fatal("Undo cascading removal did not restore the account")
+	}
+	if count, _ := m.CountTransactions(acc.Id, GetTransactionsOptions{}); count != 2 {
+		t.Fatalf("Undo cascading removal restored %d transactions, need 2", count)
+	}
+}
+
+func TestUndoCloseAccount(t *testing.T) {
+	m := &Model{db: CreateEmptyDB()}
+	AddDummyAccounts(m, 1)
+
+	err := m.SetClosed("acc0", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if acc, _ := m.GetAccount("acc0"); !acc.Closed {
+		t.Fatal("SetClosed failed to close the account")
+	}
+
+	ops, err := m.Undo(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ops[0].Kind != OpCloseAccount {
+		t.Fatalf("Undid %s instead of closing the account", ops[0].Kind)
+	}
+	if acc, _ := m.GetAccount("acc0"); acc.Closed {
+		t.Fatal("Undo close account failed")
+	}
+}
+
+func TestUndoKeepsUnrelatedColumns(t *testing.T) {
+	m := &Model{db: CreateEmptyDB()}
+	AddDummyAccounts(m, 1)
+	acc, _ := m.GetAccount("acc0")
+
+	tr := NewTransaction(acc.Id, "Spotify", 18.25)
+	m.AddTransaction(tr)
+	m.UpdateTransaction(tr.Id, WithPayeeUpdate("Hulu"))
+	// changed since, without going through the journal
+	_, err := m.db.NewUpdate().
+		Model((*Transaction)(nil)).
+		Set("description = ?", "streaming").
+		Where("id = ?", tr.Id).
+		Exec(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = m.Undo(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	retrieved, _ := m.GetTransactionById(tr.Id)
+	if retrieved.Payee != "Spotify" || retrieved.Description != "streaming" {
+		t.Fatalf("Undo update transaction failed"+
+			"\nhave: %s, %s"+
+			"\nneed: %s, %s",
+			retrieved.Payee, retrieved.Description, "Spotify", "streaming")
+	}
+}
+
+func TestUnjournaledKeepsUndoAndRedo(t *testing.T) {
+	m := &Model{db: CreateEmptyDB()}
+	AddDummyAccounts(m, 1)
+	acc, _ := m.GetAccount("acc0")
+
+	first := NewTransaction(acc.Id, "Spotify", 18.25)
+	second := NewTransaction(acc.Id, "Hulu", 20)
+	m.AddTransaction(first)
+	m.AddTransaction(second)
+	if _, err := m.Undo(1); err != nil {
+		t.Fatal(err)
+	}
+
+	// a sync in the background, between the user's undo and redo
+	synced := NewTransaction(acc.Id, "Netflix", 15)
+	err := m.Unjournaled().AddSyncedTransaction(synced)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = m.Redo(1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = m.GetTransactionById(second.Id); err != nil {
+		t.Fatal("Redo after sync failed: transaction not restored")
+	}
+
+	ops, err := m.Undo(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ops) != 2 || ops[0].TargetId != second.Id || ops[1].TargetId != first.Id {
+		t.Fatalf("Undo after sync failed"+
+			"\nhave: %v"+
+			"\nneed: the two transactions added by hand", ops)
+	}
+	if _, err = m.GetTransactionById(synced.Id); err != nil {
+		t.Fatal("Undo after sync reverted the sync")
+	}
+}
@@ -0,0 +1,288 @@
+package omoney
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// The terms a loan was borrowed under. Kept on its account, in
+// columns starting with loan_
+type LoanTerms struct {
+	// The amount borrowed
+	Principal float64
+	// Annual percentage rate, such as 6.5 for 6.5%
+	Apr float64
+	// Number of monthly payments the loan is paid off in
+	TermMonths int
+	// Day of the month payments are due, from 1 to 28
+	PaymentDay int
+	// When the money was borrowed, which interest accrues from
+	Start time.Time
+}
+
+// One payment of an amortization schedule or projection
+type Installment struct {
+	Number    int
+	Date      time.Time
+	Payment   float64
+	Principal float64
+	Interest  float64
+	// What is still owed after this payment
+	Balance float64
+}
+
+// A payment transaction into a loan account, split into the interest
+// accrued since the last payment and the principal it paid down
+type LoanPayment struct {
+	TransactionId string
+	Date          time.Time
+	Amount        float64
+	Interest      float64
+	Principal     float64
+	// What is still owed after this payment
+	Balance float64
+}
+
+// Where paying off a loan ends up
+type LoanProjection struct {
+	// Extra paid on top of the scheduled payment each month
+	Extra         float64
+	Installments  []Installment
+	PayoffDate    time.Time
+	TotalInterest float64
+}
+
+// Amounts below this are treated as paid off, to ignore rounding
+const loanEpsilon = 0.005
+
+// Projections stop after this many payments, in case the payment
+// never covers the interest
+const maxInstallments = 1200
+
+func (t LoanTerms) IsSet() bool {
+	return t.Principal > 0 && t.TermMonths > 0
+}
+
+func (t LoanTerms) Validate() error {
+	if t.Principal <= 0 {
+		return errors.New("principal must be more than 0")
+	}
+	if t.Apr < 0 {
+		return errors.New("APR cannot be negative")
+	}
+	if t.TermMonths <= 0 {
+		return errors.New("term must be at least 1 month")
+	}
+	if t.PaymentDay < 1 || t.PaymentDay > 28 {
+		return errors.New("payment day must be from 1 to 28")
+	}
+	if t.Start.IsZero() {
+		return errors.New("missing start date")
+	}
+	return nil
+}
+
+func (t LoanTerms) monthlyRate() float64 {
+	return t.Apr / 100 / 12
+}
+
+// The fixed monthly payment that pays off the loan over its term
+func (t LoanTerms) MonthlyPayment() float64 {
+	n := float64(t.TermMonths)
+	r := t.monthlyRate()
+	if r == 0 {
+		return t.Principal / n
+	}
+	return t.Principal * r / (1 - math.Pow(1+r, -n))
+}
+
+// When payment number n (counting from 1) is due. The first payment
+// is due on the first payment day after the loan starts
+func (t LoanTerms) DueDate(n int) time.Time {
+	first := time.Date(t.Start.Year(), t.Start.Month(), t.PaymentDay, 0, 0, 0, 0, t.Start.Location())
+	if !first.After(t.Start) {
+		first = first.AddDate(0, 1, 0)
+	}
+	return first.AddDate(0, n-1, 0)
+}
+
+// The full amortization schedule of the loan, paying extra on top
+// of the monthly payment every month
+func (t LoanTerms) Schedule(extra float64) ([]Installment, error) {
+	return amortize(t, t.Principal, 1, extra)
+}
+
+// Pay balance down with monthly payments starting with payment
+// number first, until it is paid off
+func amortize(t LoanTerms, balance float64, first int, extra float64) ([]Installment, error) {
+	payment := t.MonthlyPayment() + extra
+	installments := make([]Installment, 0, t.TermMonths)
+	for n := first; balance > loanEpsilon; n++ {
+		if len(installments) == maxInstallments {
+			return nil, fmt.Errorf("a payment of $%.2f never pays off the loan", payment)
+		}
+
+		in := Installment{Number: n, Date: t.DueDate(n)}
+		in.Interest = balance * t.monthlyRate()
+		in.Payment = math.Min(payment, balance+in.Interest)
+		in.Principal = in.Payment - in.Interest
+		if in.Principal <= 0 {
+			return nil, fmt.Errorf("a payment of $%.2f doesn't cover the interest", payment)
+		}
+		balance -= in.Principal
+		in.Balance = math.Max(balance, 0)
+		installments = append(installments, in)
+	}
+	return installments, nil
+}
+
+// Set the terms of the personal loan account with alias or id account
+func (m *Model) SetLoanTerms(account string, terms LoanTerms) error {
+	err := terms.Validate()
+	if err != nil {
+		return err
+	}
+
+	return m.RunInTx(func(tx *Model) error {
+		before, err := tx.GetAccount(account)
+		if err != nil {
+			return err
+		}
+		if before.Type != PersonalLoan {
+			return fmt.Errorf("%s is a %s account, not a personal loan", account, before.Type)
+		}
+
+		after := before
+		after.Loan = terms
+		_, err = tx.db.NewUpdate().
+			Model(&after).
+			Column("loan_principal", "loan_apr", "loan_term_months", "loan_payment_day", "loan_start").
+			WherePK().
+			Exec(context.TODO())
+		if err != nil {
+			return err
+		}
+		return tx.record(OpSetLoanTerms, before.Id, &before, &after)
+	})
+}
+
+// The loan account with alias or id account, which must have terms
+func (m *Model) getLoan(account string) (Account, error) {
+	acc, err := m.GetAccount(account)
+	if err != nil {
+		return Account{}, err
+	}
+	if acc.Type != PersonalLoan {
+		return Account{}, fmt.Errorf("%s is a %s account, not a personal loan", account, acc.Type)
+	}
+	if !acc.Loan.IsSet() {
+		return Account{}, fmt.Errorf("%s has no loan terms yet", account)
+	}
+	return acc, nil
+}
+
+// Every payment made to the loan with alias or id account, split into
+// interest and principal. Payments are transactions into the account
+// with a negative amount, and interest accrues daily on what is owed
+// between them. Positive amounts, such as fees, are added to what is owed
+func (m *Model) GetLoanPayments(account string) ([]LoanPayment, error) {
+	acc, err := m.getLoan(account)
+	if err != nil {
+		return nil, err
+	}
+	payments, _, err := m.replayLoan(acc)
+	return payments, err
+}
+
+// The principal still owed on a loan, after every payment and fee
+func (m *Model) loanBalance(acc Account) (float64, error) {
+	_, balance, err := m.replayLoan(acc)
+	return balance, err
+}
+
+// Split the payments to a loan, returning them and what is still owed
+func (m *Model) replayLoan(acc Account) ([]LoanPayment, float64, error) {
+	var trs []Transaction
+	err := m.db.NewSelect().
+		Model(&trs).
+		Where("account_id = ?", acc.Id).
+		Where("status != ?", Pending).
+		Where("date >= ?", dbTime(acc.Loan.Start)).
+		Order("date", "id").
+		Scan(context.TODO())
+	if err != nil {
+		return nil, 0, err
+	}
+
+	dailyRate := acc.Loan.Apr / 100 / 365
+	balance := acc.Loan.Principal
+	last := acc.Loan.Start
+	accrued := 0.0
+	payments := make([]LoanPayment, 0, len(trs))
+	for _, tr := range trs {
+		days := tr.Date.Sub(last).Hours() / 24
+		accrued += balance * dailyRate * math.Max(days, 0)
+		last = tr.Date
+
+		if tr.Amount >= 0 {
+			balance += tr.Amount
+			continue
+		}
+
+		p := LoanPayment{TransactionId: tr.Id, Date: tr.Date, Amount: -tr.Amount}
+		p.Interest = math.Min(accrued, p.Amount)
+		p.Principal = p.Amount - p.Interest
+		accrued -= p.Interest
+		balance -= p.Principal
+		p.Balance = balance
+		payments = append(payments, p)
+	}
+	return payments, balance, nil
+}
+
+// Project paying off the loan with alias or id account from what is
+// owed after its last payment, once for each amount of extra paid
+// on top of the monthly payment
+func (m *Model) ProjectLoanPayoff(account string, extras ...float64) ([]LoanProjection, error) {
+	acc, err := m.getLoan(account)
+	if err != nil {
+		return nil, err
+	}
+	payments, balance, err := m.replayLoan(acc)
+	if err != nil {
+		return nil, err
+	}
+
+	next := 1
+	if len(payments) > 0 {
+		// the next payment due after the last one made
+		last := payments[len(payments)-1]
+		for !acc.Loan.DueDate(next).After(last.Date) {
+			next++
+		}
+	}
+
+	if len(extras) == 0 {
+		extras = []float64{0}
+	}
+	projections := make([]LoanProjection, 0, len(extras))
+	for _, extra := range extras {
+		installments, err := amortize(acc.Loan, balance, next, extra)
+		if err != nil {
+			return nil, err
+		}
+
+		p := LoanProjection{Extra: extra, Installments: installments}
+		for _, in := range installments {
+			p.TotalInterest += in.Interest
+		}
+		if len(installments) > 0 {
+			p.PayoffDate = installments[len(installments)-1].Date
+		}
+		projections = append(projections, p)
+	}
+	return projections, nil
+}
@@ -0,0 +1,111 @@
+package omoney
+
+import (
+	"math"
+	"testing"
+)
+
+func addLoan(t *testing.T, m *Model) Account {
+	acc := *NewAccount(WithAlias("car"), WithAccountType(PersonalLoan))
+	m.AddAccount(acc)
+	err := m.SetLoanTerms("car", LoanTerms{Principal: 10000, Apr: 6, TermMonths: 36, PaymentDay: 15, Start: day(2024, 1, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	acc, _ = m.GetAccount("car")
+	return acc
+}
+
+func TestAmortizationSchedule(t *testing.T) {
+	terms := LoanTerms{Principal: 10000, Apr: 6, TermMonths: 36, PaymentDay: 15, Start: day(2024, 1, 1)}
+	if payment := terms.MonthlyPayment(); math.Abs(payment-304.22) > 0.005 {
+		t.Fatalf("MonthlyPayment failed\nhave: %.4f\nneed: 304.22", payment)
+	}
+
+	schedule, err := terms.Schedule(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(schedule) != 36 {
+		t.Fatalf("Schedule failed\nhave: %d payments\nneed: 36", len(schedule))
+	}
+	first, last := schedule[0], schedule[35]
+	if !first.Date.Equal(day(2024, 1, 15)) || !closeTo(first.Interest, 50) || last.Balance > loanEpsilon {
+		t.Fatalf("Schedule failed"+
+			"\nhave: first %+v, last %+v"+
+			"\nneed: first due 2024/01/15 with $50 interest, paid off at the end", first, last)
+	}
+
+	// extra payments finish sooner
+	faster, err := terms.Schedule(200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(faster) >= 36 || len(faster) < 20 {
+		t.Fatalf("Schedule with extra failed\nhave: %d payments", len(faster))
+	}
+}
+
+func TestLoanPaymentsSplit(t *testing.T) {
+	m := &Model{db: CreateEmptyDB()}
+	acc := addLoan(t, m)
+
+	// paid 31 days after the start, then 30 days after that
+	m.AddTransaction(NewTransaction(acc.Id, "Car payment", -304.22, WithDate(day(2024, 2, 1))))
+	m.AddTransaction(NewTransaction(acc.Id, "Car payment", -304.22, WithDate(day(2024, 3, 2))))
+
+	payments, err := m.GetLoanPayments("car")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(payments) != 2 {
+		t.Fatalf("GetLoanPayments failed\nhave: %v\nneed: 2 payments", payments)
+	}
+	interest := 10000 * 0.06 / 365 * 31
+	if !closeTo(payments[0].Interest, interest) || !closeTo(payments[0].Principal, 304.22-interest) ||
+		!closeTo(payments[0].Balance, 10000-(304.22-interest)) {
+		t.Fatalf("Payment split failed"+
+			"\nhave: %+v"+
+			"\nneed: interest %.4f", payments[0], interest)
+	}
+	if payments[1].Balance >= payments[0].Balance {
+		t.Fatalf("Second payment didn't pay down the loan: %+v", payments[1])
+	}
+
+	projections, err := m.ProjectLoanPayoff("car", 0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base, extra := projections[0], projections[1]
+	// payments 1 and 2 were already made
+	if base.Installments[0].Number != 3 || !extra.PayoffDate.Before(base.PayoffDate) ||
+		extra.TotalInterest >= base.TotalInterest {
+		t.Fatalf("ProjectLoanPayoff failed"+
+			"\nhave: next payment %d, payoff %v vs %v, interest %.2f vs %.2f",
+			base.Installments[0].Number, base.PayoffDate, extra.PayoffDate, base.TotalInterest, extra.TotalInterest)
+	}
+}
+
+func TestUndoSetLoanTerms(t *testing.T) {
+	m := &Model{db: CreateEmptyDB()}
+	addLoan(t, m)
+
+	err := m.SetLoanTerms("car", LoanTerms{Principal: 5000, Apr: 3, TermMonths: 12, PaymentDay: 1, Start: day(2024, 1, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Undo(1); err != nil {
+		t.Fatal(err)
+	}
+	acc, _ := m.GetAccount("car")
+	if acc.Loan.Principal != 10000 || acc.Loan.TermMonths != 36 {
+		t.Fatalf("Undo set loan terms failed\nhave: %+v\nneed: the first terms", acc.Loan)
+	}
+
+	// only personal loans have terms
+	AddDummyAccounts(m, 1)
+	err = m.SetLoanTerms("acc0", LoanTerms{Principal: 5000, Apr: 3, TermMonths: 12, PaymentDay: 1, Start: day(2024, 1, 1)})
+	if err == nil {
+		t.Fatal("Setting loan terms on an unknown account type should fail")
+	}
+}
@@ -0,0 +1,572 @@
+package omoney
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/migrate"
+)
+
+const (
+	schemaVersionTable      = "schema_version"
+	schemaVersionLocksTable = "schema_version_locks"
+)
+
+// Every change to the shape of the database, applied in order of name.
+// Once a migration has been released, never edit it. Instead add a new
+// migration with the next number that makes the change.
+//
+// Migrations that add columns go through addColumnIfMissing, since a
+// fresh database gets every current column from the initial migration
+var Migrations = migrate.NewMigrations()
+
+func init() {
+	Migrations.Add(migrate.Migration{
+		Name:    "0001",
+		Comment: "create_accounts_and_transactions",
+		Up: func(ctx context.Context, db *bun.DB) error {
+			return createTables(ctx, db, (*Account)(nil), (*Transaction)(nil))
+		},
+		Down: func(ctx context.Context, db *bun.DB) error {
+			return dropTables(ctx, db, (*Transaction)(nil), (*Account)(nil))
+		},
+	})
+
+	Migrations.Add(migrate.Migration{
+		Name:    "0002",
+		Comment: "plaid_sync_and_category_mapping",
+		Up: func(ctx context.Context, db *bun.DB) error {
+			err := addColumnIfMissing(ctx, db, "accounts", "sync_cursor", "VARCHAR DEFAULT ''")
+			if err != nil {
+				return err
+			}
+			err = addColumnIfMissing(ctx, db, "accounts", "needs_relink", "BOOLEAN DEFAULT false")
+			if err != nil {
+				return err
+			}
+			err = addColumnIfMissing(ctx, db, "transactions", "plaid_category", "VARCHAR DEFAULT ''")
+			if err != nil {
+				return err
+			}
+			return createTables(ctx, db, (*CategoryMapping)(nil), (*UnmappedCategory)(nil))
+		},
+		Down: func(ctx context.Context, db *bun.DB) error {
+			err := dropTables(ctx, db, (*CategoryMapping)(nil), (*UnmappedCategory)(nil))
+			if err != nil {
+				return err
+			}
+			return dropColumns(ctx, db, map[string][]string{
+				"accounts":     {"sync_cursor", "needs_relink"},
+				"transactions": {"plaid_category"},
+			})
+		},
+	})
+
+	Migrations.Add(migrate.Migration{
+		Name:    "0003",
+		Comment: "operation_journal",
+		Up: func(ctx context.Context, db *bun.DB) error {
+			return createTables(ctx, db, (*Operation)(nil))
+		},
+		Down: func(ctx context.Context, db *bun.DB) error {
+			return dropTables(ctx, db, (*Operation)(nil))
+		},
+	})
+
+	Migrations.Add(migrate.Migration{
+		Name:    "0004",
+		Comment: "secret_params",
+		Up: func(ctx context.Context, db *bun.DB) error {
+			return createTables(ctx, db, (*SecretParams)(nil))
+		},
+		Down: func(ctx context.Context, db *bun.DB) error {
+			return dropTables(ctx, db, (*SecretParams)(nil))
+		},
+	})
+
+	Migrations.Add(migrate.Migration{
+		Name:    "0005",
+		Comment: "import_profiles",
+		Up: func(ctx context.Context, db *bun.DB) error {
+			return createTables(ctx, db, (*ImportProfile)(nil))
+		},
+		Down: func(ctx context.Context, db *bun.DB) error {
+			return dropTables(ctx, db, (*ImportProfile)(nil))
+		},
+	})
+
+	Migrations.Add(migrate.Migration{
+		Name:    "0006",
+		Comment: "transaction_search",
+		Up: func(ctx context.Context, db *bun.DB) error {
+			return createSearchIndex(ctx, db)
+		},
+		Down: func(ctx context.Context, db *bun.DB) error {
+			return dropSearchIndex(ctx, db)
+		},
+	})
+
+	Migrations.Add(migrate.Migration{
+		Name:    "0007",
+		Comment: "journal_batches",
+		Up: func(ctx context.Context, db *bun.DB) error {
+			return addColumnIfMissing(ctx, db, "operations", "batch", "BIGINT DEFAULT 0")
+		},
+		Down: func(ctx context.Context, db *bun.DB) error {
+			return dropColumns(ctx, db, map[string][]string{
+				"operations": {"batch"},
+			})
+		},
+	})
+
+	Migrations.Add(migrate.Migration{
+		Name:    "0008",
+		Comment: "attachments",
+		Up: func(ctx context.Context, db *bun.DB) error {
+			return createTables(ctx, db, (*Attachment)(nil))
+		},
+		Down: func(ctx context.Context, db *bun.DB) error {
+			return dropTables(ctx, db, (*Attachment)(nil))
+		},
+	})
+
+	Migrations.Add(migrate.Migration{
+		Name:    "0009",
+		Comment: "payee_aliases",
+		Up: func(ctx context.Context, db *bun.DB) error {
+			return createTables(ctx, db, (*PayeeAlias)(nil))
+		},
+		Down: func(ctx context.Context, db *bun.DB) error {
+			return dropTables(ctx, db, (*PayeeAlias)(nil))
+		},
+	})
+
+	Migrations.Add(migrate.Migration{
+		Name:    "0010",
+		Comment: "closed_accounts_and_foreign_keys",
+		Up: func(ctx context.Context, db *bun.DB) error {
+			return db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+				err := addColumnIfMissing(ctx, tx, "accounts", "closed", "BOOLEAN DEFAULT false")
+				if err != nil {
+					return err
+				}
+				err = adoptOrphanedTransactions(ctx, tx)
+				if err != nil {
+					return err
+				}
+				err = rebuildTable(ctx, tx, "transactions", transactionsForeignKey)
+				if err != nil {
+					return err
+				}
+				// the triggers keeping search up to date went with the old table
+				return createSearchIndex(ctx, tx)
+			})
+		},
+		Down: func(ctx context.Context, db *bun.DB) error {
+			return db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+				err := rebuildTable(ctx, tx, "transactions")
+				if err != nil {
+					return err
+				}
+				err = createSearchIndex(ctx, tx)
+				if err != nil {
+					return err
+				}
+				return dropColumns(ctx, tx, map[string][]string{
+					"accounts": {"closed"},
+				})
+			})
+		},
+	})
+
+	Migrations.Add(migrate.Migration{
+		Name:    "0011",
+		Comment: "investments",
+		Up: func(ctx context.Context, db *bun.DB) error {
+			return createTables(ctx, db, (*Security)(nil), (*SecurityPrice)(nil), (*InvestmentEvent)(nil))
+		},
+		Down: func(ctx context.Context, db *bun.DB) error {
+			return dropTables(ctx, db, (*InvestmentEvent)(nil), (*SecurityPrice)(nil), (*Security)(nil))
+		},
+	})
+
+	Migrations.Add(migrate.Migration{
+		Name:    "0012",
+		Comment: "lot_selection",
+		Up: func(ctx context.Context, db *bun.DB) error {
+			err := addColumnIfMissing(ctx, db, "investment_events", "method", "VARCHAR DEFAULT ''")
+			if err != nil {
+				return err
+			}
+			return createTables(ctx, db, (*LotSelection)(nil))
+		},
+		Down: func(ctx context.Context, db *bun.DB) error {
+			err := dropTables(ctx, db, (*LotSelection)(nil))
+			if err != nil {
+				return err
+			}
+			return dropColumns(ctx, db, map[string][]string{
+				"investment_events": {"method"},
+			})
+		},
+	})
+
+	Migrations.Add(migrate.Migration{
+		Name:    "0013",
+		Comment: "loan_terms",
+		Up: func(ctx context.Context, db *bun.DB) error {
+			columns := [][2]string{
+				{"loan_principal", "FLOAT DEFAULT 0"},
+				{"loan_apr", "FLOAT DEFAULT 0"},
+				{"loan_term_months", "INTEGER DEFAULT 0"},
+				{"loan_payment_day", "INTEGER DEFAULT 0"},
+				{"loan_start", "TIMESTAMP DEFAULT '0001-01-01 00:00:00+00:00'"},
+			}
+			for _, col := range columns {
+				err := addColumnIfMissing(ctx, db, "accounts", col[0], col[1])
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(ctx context.Context, db *bun.DB) error {
+			return dropColumns(ctx, db, map[string][]string{
+				"accounts": {"loan_principal", "loan_apr", "loan_term_months", "loan_payment_day", "loan_start"},
+			})
+		},
+	})
+
+	Migrations.Add(migrate.Migration{
+		Name:    "0014",
+		Comment: "statement_cycles",
+		Up: func(ctx context.Context, db *bun.DB) error {
+			for _, col := range []string{"statement_day", "due_day"} {
+				err := addColumnIfMissing(ctx, db, "accounts", col, "INTEGER DEFAULT 0")
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(ctx context.Context, db *bun.DB) error {
+			return dropColumns(ctx, db, map[string][]string{
+				"accounts": {"statement_day", "due_day"},
+			})
+		},
+	})
+
+	Migrations.Add(migrate.Migration{
+		Name:    "0015",
+		Comment: "transaction_status",
+		Up: func(ctx context.Context, db *bun.DB) error {
+			err := addColumnIfMissing(ctx, db, "transactions", "status", "VARCHAR DEFAULT 'posted'")
+			if err != nil {
+				return err
+			}
+			return addColumnIfMissing(ctx, db, "transactions", "pending_id", "VARCHAR DEFAULT ''")
+		},
+		Down: func(ctx context.Context, db *bun.DB) error {
+			return dropColumns(ctx, db, map[string][]string{
+				"transactions": {"status", "pending_id"},
+			})
+		},
+	})
+
+	Migrations.Add(migrate.Migration{
+		Name:    "0016",
+		Comment: "alerts",
+		Up: func(ctx context.Context, db *bun.DB) error {
+			return createTables(ctx, db, (*AlertRule)(nil), (*Alert)(nil))
+		},
+		Down: func(ctx context.Context, db *bun.DB) error {
+			return dropTables(ctx, db, (*Alert)(nil), (*AlertRule)(nil))
+		},
+	})
+
+	Migrations.Add(migrate.Migration{
+		Name:    "0017",
+		Comment: "people_shares",
+		Up: func(ctx context.Context, db *bun.DB) error {
+			return createTables(ctx, db, (*Person)(nil), (*Share)(nil))
+		},
+		Down: func(ctx context.Context, db *bun.DB) error {
+			return dropTables(ctx, db, (*Share)(nil), (*Person)(nil))
+		},
+	})
+
+	Migrations.Add(migrate.Migration{
+		Name:    "0018",
+		Comment: "reimbursements",
+		Up: func(ctx context.Context, db *bun.DB) error {
+			err := addColumnIfMissing(ctx, db, "transactions", "reimbursable", "BOOLEAN DEFAULT FALSE")
+			if err != nil {
+				return err
+			}
+			err = addColumnIfMissing(ctx, db, "transactions", "report_id", "INTEGER DEFAULT 0")
+			if err != nil {
+				return err
+			}
+			return createTables(ctx, db, (*ExpenseReport)(nil))
+		},
+		Down: func(ctx context.Context, db *bun.DB) error {
+			err := dropTables(ctx, db, (*ExpenseReport)(nil))
+			if err != nil {
+				return err
+			}
+			return dropColumns(ctx, db, map[string][]string{
+				"transactions": {"reimbursable", "report_id"},
+			})
+		},
+	})
+}
+
+func (m *Model) migrator() (*migrate.Migrator, error) {
+	db, ok := m.db.(*bun.DB)
+	if !ok {
+		return nil, errors.New("migrations cannot be run inside a transaction")
+	}
+
+	return migrate.NewMigrator(db, Migrations,
+		migrate.WithTableName(schemaVersionTable),
+		migrate.WithLocksTableName(schemaVersionLocksTable),
+	), nil
+}
+
+// Return every known migration, marked with whether and when
+// it has been applied to this database
+func (m *Model) MigrationStatus() (migrate.MigrationSlice, error) {
+	ctx := context.TODO()
+	migrator, err := m.migrator()
+	if err != nil {
+		return nil, err
+	}
+
+	err = migrator.Init(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return migrator.MigrationsWithStatus(ctx)
+}
+
+// Return the migrations that have not yet been applied to this database
+func (m *Model) PendingMigrations() (migrate.MigrationSlice, error) {
+	ms, err := m.MigrationStatus()
+	if err != nil {
+		return nil, err
+	}
+	return ms.Unapplied(), nil
+}
+
+// Apply all pending migrations as one group
+func (m *Model) Migrate() (*migrate.MigrationGroup, error) {
+	ctx := context.TODO()
+	migrator, err := m.migrator()
+	if err != nil {
+		return nil, err
+	}
+
+	err = migrator.Init(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = migrator.Lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer migrator.Unlock(ctx)
+
+	return migrator.Migrate(ctx)
+}
+
+// Undo the most recently applied group of migrations
+func (m *Model) Rollback() (*migrate.MigrationGroup, error) {
+	ctx := context.TODO()
+	migrator, err := m.migrator()
+	if err != nil {
+		return nil, err
+	}
+
+	err = migrator.Init(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = migrator.Lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer migrator.Unlock(ctx)
+
+	return migrator.Rollback(ctx)
+}
+
+// Write a consistent copy of the whole database to path
+func (m *Model) Backup(path string) error {
+	_, err := m.db.ExecContext(context.TODO(), "VACUUM INTO ?", path)
+	return err
+}
+
+// Write a backup of the database next to the database file, named
+// with the current time, and return its path
+func (m *Model) BackupNextToDB() (string, error) {
+	if m.path == "" {
+		return "", errors.New("database is not stored in a file")
+	}
+
+	backup := fmt.Sprintf("%s.%s.bak", m.path, time.Now().Format("20060102-150405"))
+	return backup, m.Backup(backup)
+}
+
+// Every transaction belongs to an account that exists. The check is
+// deferred to the end of each database transaction, so that undo can
+// replace an account row while its transactions still point at it
+const transactionsForeignKey = `FOREIGN KEY ("account_id") REFERENCES "accounts" ("id") DEFERRABLE INITIALLY DEFERRED`
+
+// Give transactions left behind by removed accounts somewhere to
+// belong, before the foreign key starts requiring it. Transactions
+// pointing at an alias are moved to that account's id, and the rest
+// get a closed account named removed-<id>
+func adoptOrphanedTransactions(ctx context.Context, db bun.IDB) error {
+	_, err := db.ExecContext(ctx, `UPDATE transactions
+		SET account_id = (SELECT id FROM accounts WHERE alias = transactions.account_id)
+		WHERE account_id NOT IN (SELECT id FROM accounts)
+		AND account_id IN (SELECT alias FROM accounts)`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.NewRaw(`INSERT INTO accounts
+		(id, alias, plaid_token, type, anchor_balance, anchor_time, sync_cursor, needs_relink, closed)
+		SELECT DISTINCT account_id, 'removed-' || account_id, '', ?, 0, ?, '', false, true
+		FROM transactions
+		WHERE account_id NOT IN (SELECT id FROM accounts)`,
+		UnknownAccount, time.Now().Truncate(time.Second)).
+		Exec(ctx)
+	return err
+}
+
+// Recreate table with the same columns and primary key, plus the
+// given table constraints, since SQLite cannot add constraints to an
+// existing table. Rows are copied over, but triggers and indexes on
+// the old table are dropped along with it
+func rebuildTable(ctx context.Context, db bun.IDB, table string, constraints ...string) error {
+	var columns []struct {
+		Name    string
+		Type    string
+		NotNull bool
+		Dflt    sql.NullString
+		Pk      int
+	}
+	err := db.NewRaw(`SELECT name, type, "notnull" AS not_null, dflt_value AS dflt, pk
+		FROM pragma_table_info(?) ORDER BY cid`, table).
+		Scan(ctx, &columns)
+	if err != nil {
+		return err
+	}
+	if len(columns) == 0 {
+		return fmt.Errorf("table %s does not exist", table)
+	}
+
+	defs := make([]string, 0, len(columns)+len(constraints)+1)
+	names := make([]string, 0, len(columns))
+	keys := make([]string, 0, 1)
+	for _, col := range columns {
+		def := fmt.Sprintf("%q %s", col.Name, col.Type)
+		if col.NotNull {
+			def += " NOT NULL"
+		}
+		if col.Dflt.Valid {
+			def += " DEFAULT " + col.Dflt.String
+		}
+		defs = append(defs, def)
+		names = append(names, fmt.Sprintf("%q", col.Name))
+		if col.Pk > 0 {
+			keys = append(keys, fmt.Sprintf("%q", col.Name))
+		}
+	}
+	if len(keys) > 0 {
+		defs = append(defs, fmt.Sprintf("PRIMARY KEY (%s)", strings.Join(keys, ", ")))
+	}
+	defs = append(defs, constraints...)
+
+	rebuilt := table + "_rebuild"
+	cols := strings.Join(names, ", ")
+	for _, stmt := range []string{
+		fmt.Sprintf("CREATE TABLE %q (%s)", rebuilt, strings.Join(defs, ", ")),
+		fmt.Sprintf("INSERT INTO %q (%s) SELECT %s FROM %q", rebuilt, cols, cols, table),
+		fmt.Sprintf("DROP TABLE %q", table),
+		fmt.Sprintf("ALTER TABLE %q RENAME TO %q", rebuilt, table),
+	} {
+		_, err = db.ExecContext(ctx, stmt)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func createTables(ctx context.Context, db bun.IDB, models ...interface{}) error {
+	for _, model := range models {
+		_, err := db.NewCreateTable().
+			Model(model).
+			IfNotExists().
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func dropTables(ctx context.Context, db bun.IDB, models ...interface{}) error {
+	for _, model := range models {
+		_, err := db.NewDropTable().
+			Model(model).
+			IfExists().
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Add column to table with the given SQL type and constraints, unless
+// a column by that name is already there
+func addColumnIfMissing(ctx context.Context, db bun.IDB, table string, column string, definition string) error {
+	count := 0
+	err := db.NewRaw("SELECT count(*) FROM pragma_table_info(?) WHERE name = ?", table, column).
+		Scan(ctx, &count)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	_, err = db.NewRaw(fmt.Sprintf("ALTER TABLE ? ADD COLUMN ? %s", definition),
+		bun.Ident(table), bun.Ident(column)).
+		Exec(ctx)
+	return err
+}
+
+// Drop each listed column (table -> columns)
+func dropColumns(ctx context.Context, db bun.IDB, columns map[string][]string) error {
+	for table, cols := range columns {
+		for _, column := range cols {
+			_, err := db.NewRaw("ALTER TABLE ? DROP COLUMN ?", bun.Ident(table), bun.Ident(column)).
+				Exec(ctx)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package omoney
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/uptrace/bun/driver/sqliteshim"
+)
+
+// Build a database file with the schema as it was before migrations existed
+func createUnversionedDB(t *testing.T, path string) {
+	sqldb, err := sql.Open(sqliteshim.ShimName, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqldb.Close()
+
+	stmts := []string{
+		`CREATE TABLE "accounts" ("id" VARCHAR NOT NULL, "alias" VARCHAR, "plaid_token" VARCHAR,
+			"type" VARCHAR, "anchor_balance" FLOAT, "anchor_time" TIMESTAMP,
+			PRIMARY KEY ("id"), UNIQUE ("alias"))`,
+		`CREATE TABLE "transactions" ("id" VARCHAR, "account_id" VARCHAR, "payee" VARCHAR,
+			"amount" FLOAT, "date" TIMESTAMP, "category" VARCHAR, "inst_description" VARCHAR,
+			"description" VARCHAR)`,
+		`INSERT INTO "accounts" VALUES ('acc-id', 'old', '', 'checking', 10, '2020-01-01 00:00:00+00:00')`,
+	}
+	for _, stmt := range stmts {
+		_, err = sqldb.ExecContext(context.TODO(), stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMigrateUnversionedDB(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, DbFilename)
+	createUnversionedDB(t, path)
+
+	m, err := NewModelFromDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backups, _ := filepath.Glob(path + ".*.bak")
+	if len(backups) != 1 {
+		t.Fatalf("Backup before migrating failed"+
+			"\nhave backups: %d"+
+			"\nneed backups: %d",
+			len(backups), 1)
+	}
+
+	acc, err := m.GetAccount("old")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tr := NewTransaction(acc.Id, "Delta", 300, WithPlaidCategory("TRAVEL_FLIGHTS"))
+	err = m.AddTransaction(tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pending, err := m.PendingMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 0 {
+		t.Fatalf("Migrate failed, still pending: %s", pending)
+	}
+}
+
+func TestMigrateRollbackAndReapply(t *testing.T) {
+	path := filepath.Join(t.TempDir(), DbFilename)
+
+	m, err := NewModelFromDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = m.Rollback()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pending, err := m.PendingMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != len(Migrations.Sorted()) {
+		t.Fatalf("Rollback failed"+
+			"\nhave pending: %d"+
+			"\nneed pending: %d",
+			len(pending), len(Migrations.Sorted()))
+	}
+
+	_, err = m.Migrate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	AddDummyAccounts(m, 1)
+	if len(m.GetAccounts()) != 1 {
+		t.Fatal("Reapplying migrations failed")
+	}
+}
+
+func TestMigrateAdoptsOrphanedTransactions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), DbFilename)
+	createUnversionedDB(t, path)
+
+	sqldb, err := sql.Open(sqliteshim.ShimName, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = sqldb.ExecContext(context.TODO(), `INSERT INTO "transactions" VALUES
+		('tr-alias', 'old', 'Deli', 5, '2020-01-02 00:00:00+00:00', '', '', ''),
+		('tr-gone', 'gone-id', 'Cafe', 3, '2020-01-03 00:00:00+00:00', '', '', '')`)
+	sqldb.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := NewModelFromDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tr, err := m.GetTransactionById("tr-alias")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tr.AccountId != "acc-id" {
+		t.Fatalf("Transaction stored under an alias was not moved to the account id: %s", tr.AccountId)
+	}
+
+	acc, err := m.GetAccount("removed-gone-id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !acc.Closed {
+		t.Fatal("Account made for orphaned transactions is not closed")
+	}
+
+	// the foreign key now holds
+	err = m.AddTransaction(NewTransaction("gone-again", "Nowhere", 1))
+	if err == nil {
+		t.Fatal("Adding a transaction to a missing account succeeded")
+	}
+}
@@ -3,8 +3,13 @@ package omoney
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"log"
+	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/araddon/dateparse"
 	"github.com/uptrace/bun"
@@ -14,6 +19,9 @@ import (
 
 const (
 	DbFilename = "oregano_data.db"
+	// Added to the database's name when opening it, since SQLite
+	// only enforces foreign keys when asked to on each connection
+	foreignKeysPragma = "?_pragma=foreign_keys(1)"
 )
 
 type Model struct {
@@ -21,34 +29,60 @@ type Model struct {
 	// Accounts map[string]Account
 	// Aliases  map[string]string // alias -> uuid
 
-	db *bun.DB
+	// Either the database itself, or a transaction on it when
+	// this model was handed out by RunInTx
+	db bun.IDB
+	// Location of the database file, empty if the database
+	// is held in memory
+	path string
+	// Key that secrets such as Plaid tokens are encrypted with,
+	// shared with the copies handed out by RunInTx
+	secrets *secretKey
+	// Batch that operations recorded through this model join, when
+	// handed out by RunInBatch. Zero until the first is recorded
+	batch *int64
+	// Set when handed out by Unjournaled, so that nothing changed
+	// through this model is recorded for undo
+	unjournaled bool
 }
 
+// Open the database at filepath, creating it if needed, and bring its
+// schema up to date. If migrations need to be applied to an existing
+// database, a backup of it is written next to it first
 func NewModelFromDB(filepath string) (*Model, error) {
-	sqldb, err := sql.Open(sqliteshim.ShimName, filepath)
+	info, statErr := os.Stat(filepath)
+	existing := statErr == nil && info.Size() > 0
+
+	sqldb, err := sql.Open(sqliteshim.ShimName, filepath+foreignKeysPragma)
 	if err != nil {
 		return nil, err
 	}
 
 	db := bun.NewDB(sqldb, sqlitedialect.New())
+	m := &Model{db: db, path: filepath}
 
-	_, err = db.NewCreateTable().
-		Model((*Account)(nil)).
-		IfNotExists().
-		Exec(context.TODO())
+	pending, err := m.PendingMigrations()
 	if err != nil {
 		return nil, err
 	}
 
-	_, err = db.NewCreateTable().
-		Model((*Transaction)(nil)).
-		IfNotExists().
-		Exec(context.TODO())
-	if err != nil {
-		return nil, err
+	if len(pending) > 0 {
+		if existing {
+			backup, err := m.BackupNextToDB()
+			if err != nil {
+				return nil, fmt.Errorf("failed to back up database before migrating: %w", err)
+			}
+			log.Printf("Backed up database to %s\n", backup)
+		}
+
+		group, err := m.Migrate()
+		if err != nil {
+			return nil, fmt.Errorf("failed to migrate database: %w", err)
+		}
+		log.Printf("Migrated database to version %s\n", group.Migrations[len(group.Migrations)-1].Name)
 	}
 
-	return &Model{db: db}, nil
+	return m, nil
 }
 
 func (m *Model) GetAccount(input string) (Account, error) {
@@ -150,34 +184,108 @@ func (m *Model) resolveToId(input string) (string, error) {
 }
 
 // given a string that is an id or an alias, return the matching
-// Account's PlaidToken
+// Account's decrypted PlaidToken
 func (m *Model) GetAccessToken(input string) (string, error) {
 	acc, err := m.GetAccount(input)
 	if err != nil {
 		return "", err
 	} else {
-		return acc.PlaidToken, nil
+		return m.DecryptSecret(acc.PlaidToken)
 	}
 }
 
-func (m *Model) AddAccount(acc Account) {
-	m.db.NewInsert().
+// Store a new account. If the account has a PlaidToken, it is
+// encrypted before being written, so the model must be unlocked
+func (m *Model) AddAccount(acc Account) error {
+	if acc.PlaidToken != "" && !strings.HasPrefix(acc.PlaidToken, encryptedPrefix) {
+		token, err := m.EncryptSecret(acc.PlaidToken)
+		if err != nil {
+			return err
+		}
+		acc.PlaidToken = token
+	}
+
+	_, err := m.db.NewInsert().
 		Model(&acc).
 		Exec(context.TODO())
+	return err
 }
 
-func (m *Model) RemoveAccount(input string) error {
-	id, err := m.resolveToId(input)
-	if err != nil {
-		return err
-	}
+// Returned when removing an account that still has transactions
+// without asking for them to be removed along with it
+var ErrAccountHasTransactions = errors.New("close it instead, or remove its transactions along with it")
+
+// Remove the account matching the id or alias. If it still has
+// transactions, they are removed too when cascade is set, or else
+// nothing is removed and ErrAccountHasTransactions is returned.
+// A single undo restores the account and all of its transactions
+func (m *Model) RemoveAccount(input string, cascade bool) error {
+	return m.RunInBatch(func(tx *Model) error {
+		before, err := tx.GetAccount(input)
+		if err != nil {
+			return err
+		}
 
-	_, err = m.db.NewDelete().
-		Model((*Account)(nil)).
-		Where("id = ?", id).
-		Exec(context.TODO())
+		var ids []string
+		err = tx.db.NewSelect().
+			Model((*Transaction)(nil)).
+			Column("id").
+			Where("account_id = ?", before.Id).
+			Scan(context.TODO(), &ids)
+		if err != nil {
+			return err
+		}
+		if len(ids) > 0 && !cascade {
+			return fmt.Errorf("account %s still has %d transactions: %w", input, len(ids), ErrAccountHasTransactions)
+		}
 
-	return err
+		for _, id := range ids {
+			err = tx.removeTransaction(id)
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err = tx.db.NewDelete().
+			Model((*Account)(nil)).
+			Where("id = ?", before.Id).
+			Exec(context.TODO())
+		if err != nil {
+			return err
+		}
+		return tx.record(OpRemoveAccount, before.Id, &before, nil)
+	})
+}
+
+// Close the account matching the id or alias, hiding it from account
+// lists while keeping its transactions, or reopen it
+func (m *Model) SetClosed(account string, closed bool) error {
+	return m.RunInTx(func(tx *Model) error {
+		before, err := tx.GetAccount(account)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.db.NewUpdate().
+			Model((*Account)(nil)).
+			Set("closed = ?", closed).
+			Where("id = ?", before.Id).
+			Exec(context.TODO())
+		if err != nil {
+			return err
+		}
+
+		after, err := tx.GetAccount(before.Id)
+		if err != nil {
+			return err
+		}
+
+		kind := OpCloseAccount
+		if !closed {
+			kind = OpReopenAccount
+		}
+		return tx.record(kind, before.Id, &before, &after)
+	})
 }
 
 // iterate over accounts, ensuring consistency in data
@@ -193,15 +301,59 @@ func (m *Model) RepairAccounts() {
 }
 
 func (m *Model) SetAlias(id string, alias string) error {
-	err := m.db.NewUpdate().
+	return m.RunInTx(func(tx *Model) error {
+		before, err := tx.GetAccount(id)
+		if err != nil {
+			return err
+		}
+
+		err = tx.db.NewUpdate().
+			Model((*Account)(nil)).
+			Set("alias = ?", alias).
+			Where("id = ?", before.Id).
+			Scan(context.TODO())
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+
+		after, err := tx.GetAccount(before.Id)
+		if err != nil {
+			return err
+		}
+		return tx.record(OpSetAlias, before.Id, &before, &after)
+	})
+}
+
+// Flag or clear the account matching the id or alias as needing
+// to go through Plaid Link again
+func (m *Model) SetNeedsRelink(account string, needsRelink bool) error {
+	id, err := m.resolveToId(account)
+	if err != nil {
+		return err
+	}
+
+	_, err = m.db.NewUpdate().
 		Model((*Account)(nil)).
-		Set("alias = ?", alias).
+		Set("needs_relink = ?", needsRelink).
 		Where("id = ?", id).
-		Scan(context.TODO())
-	if err != nil && err != sql.ErrNoRows{
+		Exec(context.TODO())
+	return err
+}
+
+// Store the cursor returned by the latest Plaid transaction sync
+// so that the next sync only pulls changes made after it
+func (m *Model) SetSyncCursor(account string, cursor string) error {
+	id, err := m.resolveToId(account)
+	if err != nil {
 		return err
 	}
-	return nil
+
+	_, err = m.db.NewUpdate().
+		Model((*Account)(nil)).
+		Set("sync_cursor = ?", cursor).
+		Where("id = ?", id).
+		Exec(context.TODO())
+	return err
 }
 
 func (m *Model) SetAnchor(account string, anchor []string) error {
@@ -220,35 +372,51 @@ func (m *Model) SetAnchor(account string, anchor []string) error {
 		return err
 	}
 
-	acc := &Account{}
-
-	err = m.db.NewSelect().
-		Model(acc).
-		Where("id = ?", id).
-		Scan(context.TODO())
-	if err != nil {
-		fmt.Printf("set anchor failed: %s\n", err)
-		return err
-	}
+	return m.RunInTx(func(tx *Model) error {
+		acc := &Account{}
 
-	acc.AnchorBalance = amount
-	acc.AnchorTime = date
+		err = tx.db.NewSelect().
+			Model(acc).
+			Where("id = ?", id).
+			Scan(context.TODO())
+		if err != nil {
+			fmt.Printf("set anchor failed: %s\n", err)
+			return err
+		}
+		before := *acc
 
-	_, err = m.db.NewUpdate().
-		Model(acc).
-		Column("anchor_balance").
-		Column("anchor_time").
-		WherePK().
-		Exec(context.TODO())
+		acc.AnchorBalance = amount
+		acc.AnchorTime = date
 
-	return err
+		_, err = tx.db.NewUpdate().
+			Model(acc).
+			Column("anchor_balance").
+			Column("anchor_time").
+			WherePK().
+			Exec(context.TODO())
+		if err != nil {
+			return err
+		}
+		return tx.record(OpSetAnchor, id, &before, acc)
+	})
 }
 
+// The balance of the account with id accId. For investment accounts
+// this is the market value of what is held, and for loans with terms
+// the principal still owed, rather than the sum of their transactions
 func (m *Model) GetCurrentBalance(accId string) (float64, error) {
+	acc, err := m.GetAccount(accId)
+	if err == nil && acc.Type == Investment {
+		return m.MarketValue(acc.Id, time.Now())
+	}
+	if err == nil && acc.Type == PersonalLoan && acc.Loan.IsSet() {
+		return m.loanBalance(acc)
+	}
+
 	sum := 0.0
-	err := m.db.NewRaw(
-		"SELECT sum(amount) FROM transactions WHERE account_id = ? AND date > (SELECT anchor_time FROM accounts WHERE id = ?)",
-		bun.Ident(accId), bun.Ident(accId),
+	err = m.db.NewRaw(
+		"SELECT sum(amount) FROM transactions WHERE account_id = ? AND status != ? AND date > (SELECT anchor_time FROM accounts WHERE id = ?)",
+		bun.Ident(accId), Pending, bun.Ident(accId),
 		).Scan(context.TODO(), &sum)
 	if err != nil {
 		return 0, err
@@ -267,3 +435,23 @@ func (m *Model) GetCurrentBalance(accId string) (float64, error) {
 	return sum + anchor, nil
 }
 
+// The current balance of the account with id accId, plus every pending
+// transaction in it. For a bank account this is what is available to
+// spend, and for a credit card what is owed once everything posts
+func (m *Model) GetAvailableBalance(accId string) (float64, error) {
+	current, err := m.GetCurrentBalance(accId)
+	if err != nil {
+		return 0, err
+	}
+
+	pending := 0.0
+	err = m.db.NewRaw(
+		"SELECT coalesce(sum(amount), 0.0) FROM transactions WHERE account_id = ? AND status = ?",
+		accId, Pending,
+	).Scan(context.TODO(), &pending)
+	if err != nil {
+		return 0, err
+	}
+	return current + pending, nil
+}
+
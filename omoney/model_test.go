@@ -1,7 +1,6 @@
 package omoney
 
 import (
-	"context"
 	"database/sql"
 	"fmt"
 	"sort"
@@ -15,25 +14,15 @@ import (
 )
 
 func CreateEmptyDB() *bun.DB {
-	sqldb, err := sql.Open(sqliteshim.ShimName, "file::memory:")
+	sqldb, err := sql.Open(sqliteshim.ShimName, "file::memory:"+foreignKeysPragma)
 	if err != nil {
 		panic(err)
 	}
 
 	db := bun.NewDB(sqldb, sqlitedialect.New())
 
-	_, err = db.NewCreateTable().
-		Model((*Account)(nil)).
-		IfNotExists().
-		Exec(context.TODO())
-	if err != nil {
-		panic(err)
-	}
-
-	_, err = db.NewCreateTable().
-		Model((*Transaction)(nil)).
-		IfNotExists().
-		Exec(context.TODO())
+	m := &Model{db: db}
+	_, err = m.Migrate()
 	if err != nil {
 		panic(err)
 	}
@@ -361,3 +350,80 @@ func TestGetCurrentBalance(t *testing.T) {
 			received, 45)
 	}
 }
+
+func TestAvailableBalance(t *testing.T) {
+	m := &Model{db: CreateEmptyDB()}
+	acc := *NewAccount(WithAlias("visa"), WithAccountType(CreditCard), WithAnchor(100, day(2024, 1, 1)))
+	m.AddAccount(acc)
+	m.AddTransaction(NewTransaction(acc.Id, "Groceries", 50, WithDate(day(2024, 1, 5))))
+	m.AddTransaction(NewTransaction(acc.Id, "Hotel", 200, WithDate(day(2024, 1, 6)), WithStatus(Pending)))
+
+	current, err := m.GetCurrentBalance(acc.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	available, err := m.GetAvailableBalance(acc.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current != 150 || available != 350 {
+		t.Fatalf("Balances failed\nhave: current %.2f, available %.2f\nneed: current 150.00, available 350.00", current, available)
+	}
+}
+
+func TestPendingReplacedByPosted(t *testing.T) {
+	m := &Model{db: CreateEmptyDB()}
+	acc := *NewAccount(WithAlias("visa"), WithAccountType(CreditCard), WithAnchor(0, day(2024, 1, 1)))
+	m.AddAccount(acc)
+
+	linked := NewTransaction(acc.Id, "Restaurant", 40, WithDate(day(2024, 1, 5)), WithStatus(Pending))
+	unlinked := NewTransaction(acc.Id, "Gas", 30, WithDate(day(2024, 1, 5)), WithStatus(Pending))
+	tooOld := NewTransaction(acc.Id, "Gas", 30, WithDate(day(2023, 12, 1)), WithStatus(Pending))
+	for _, tr := range []*Transaction{linked, unlinked, tooOld} {
+		m.AddTransaction(tr)
+	}
+
+	// the posted amount includes a tip, so only the id links them
+	m.AddTransaction(NewTransaction(acc.Id, "Restaurant", 48, WithDate(day(2024, 1, 7)), WithPendingId(linked.Id)))
+	// entered by hand, so not guessed to be the pending one
+	manual := NewTransaction(acc.Id, "Gas", 30, WithDate(day(2024, 1, 6)))
+	m.AddTransaction(manual)
+	if _, err := m.GetTransactionById(unlinked.Id); err != nil {
+		t.Fatalf("Adding by hand removed a pending transaction: %v", err)
+	}
+	m.RemoveTransaction(manual)
+	// a different payee is never the same purchase
+	m.AddSyncedTransaction(NewTransaction(acc.Id, "Cafe", 30, WithDate(day(2024, 1, 6))))
+	if _, err := m.GetTransactionById(unlinked.Id); err != nil {
+		t.Fatalf("Syncing another payee removed a pending transaction: %v", err)
+	}
+	// matched by payee and amount, within a few days
+	m.AddSyncedTransaction(NewTransaction(acc.Id, "Gas", 30, WithDate(day(2024, 1, 8))))
+
+	trs, err := m.GetTransactionsByAccount(acc.Id, GetTransactionsOptions{Count: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pending := 0
+	for _, tr := range trs {
+		if tr.Id == linked.Id || tr.Id == unlinked.Id {
+			t.Fatalf("Replacing pending failed\nhave: %+v still there", tr)
+		}
+		if tr.Status == Pending {
+			pending++
+		}
+	}
+	if len(trs) != 4 || pending != 1 {
+		t.Fatalf("Replacing pending failed\nhave: %+v\nneed: 3 posted, and the old pending", trs)
+	}
+
+	// undoing the posted transaction brings its pending one back
+	_, err = m.Undo(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr, err := m.GetTransactionById(unlinked.Id)
+	if err != nil || tr.Status != Pending {
+		t.Fatalf("Undo failed\nhave: %+v, %v\nneed: pending %s", tr, err, unlinked.Id)
+	}
+}
@@ -0,0 +1,194 @@
+package omoney
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// A learned rule giving the payee for transactions whose institution
+// description normalizes to the same key, so that renaming one
+// "SQ *BLUE BOTTLE COF 8855" renames every later visit to any store
+type PayeeAlias struct {
+	// PayeeKey of the institution descriptions being matched
+	Key string `bun:",pk"`
+	// The payee assigned to matching transactions
+	Payee string
+}
+
+var (
+	// Card processors and payment services that put their own name
+	// in front of the merchant's, such as "SQ *" for Square
+	processorPrefix = regexp.MustCompile(`^(?:SQ|SQU|TST|SP|PP|PAYPAL|IC|DD|GRUBHUB|LEVELUP|PY|WPY|BT|FS|ZTL|CKE|EB|GOOGLE)\s*\*\s*`)
+	// Words banks put in front of the merchant to say how it was paid,
+	// sometimes followed by the date of the purchase
+	paymentPrefix = regexp.MustCompile(`^(?:POS|DEBIT CARD PURCHASE|DEBIT CARD|DEBIT|CHECKCARD|CHECK CARD|PURCHASE AUTHORIZED ON|PURCHASE|RECURRING PAYMENT|RECURRING|ACH)\s+(?:\d{1,2}/\d{1,2}(?:/\d{2,4})?\s+|\d{4}\s+)?`)
+	// Store numbers, such as "#123", "8855", or "STORE#42"
+	storeNumber = regexp.MustCompile(`^(?:STORE|NO\.?)?#?\d+$`)
+	// Words that come before a store number, as in "STORE 42"
+	storeMarker = regexp.MustCompile(`^(?:STORE|NO\.?|#)$`)
+	// Phone numbers and web addresses customer service is reached at
+	contactInfo = regexp.MustCompile(`^(?:\+?1?[-.]?\d{3}[-.]\d{3}[-.]\d{4}|\d{10}|[\w.-]+\.(?:COM|NET|ORG|CO)(?:/\S*)?)$`)
+)
+
+// Two letter codes for US states and Canadian provinces, which end
+// the location an institution appends to a description
+var regionCodes = map[string]bool{}
+
+func init() {
+	for _, code := range strings.Fields("AL AK AZ AR CA CO CT DE DC FL GA HI ID IL IN IA KS KY LA ME MD MA MI MN MS MO MT NE NV NH NJ NM NY NC ND OH OK OR PA RI SC SD TN TX UT VT VA WA WV WI WY PR AB BC MB NB NL NS ON PE QC SK") {
+		regionCodes[code] = true
+	}
+}
+
+// Clean up a description from a bank into a readable payee, so that
+// "SQ *BLUE BOTTLE COF 8855 SAN FRANCISCO CA" becomes "Blue Bottle Cof".
+// In order, this strips how the purchase was paid, processor prefixes,
+// reference codes after a '*', the state or province at the end,
+// store numbers and anything after them (usually the city), and
+// phone numbers and web addresses. What is left is put in title case
+func NormalizePayee(instDesc string) string {
+	words := normalizeWords(instDesc)
+	if len(words) == 0 {
+		return titleCase(strings.Fields(strings.ToUpper(instDesc)))
+	}
+	return titleCase(words)
+}
+
+// The key that institution descriptions are matched on when looking up
+// learned payees. Descriptions of the same merchant at different stores
+// and on different days have the same key
+func PayeeKey(instDesc string) string {
+	return strings.Join(normalizeWords(instDesc), " ")
+}
+
+func normalizeWords(instDesc string) []string {
+	desc := strings.Join(strings.Fields(strings.ToUpper(instDesc)), " ")
+	desc = paymentPrefix.ReplaceAllString(desc, "")
+	desc = processorPrefix.ReplaceAllString(desc, "")
+
+	// anything after a '*' that remains is a reference code,
+	// such as "AMZN MKTP US*2K4L71234"
+	if i := strings.Index(desc, "*"); i > 0 {
+		desc = desc[:i]
+	}
+
+	words := strings.Fields(desc)
+	if n := len(words); n > 1 && regionCodes[words[n-1]] {
+		words = words[:n-1]
+	}
+
+	kept := make([]string, 0, len(words))
+	for i, word := range words {
+		if i > 0 && storeNumber.MatchString(word) {
+			break
+		}
+		if i > 0 && i+1 < len(words) && storeMarker.MatchString(word) && storeNumber.MatchString(words[i+1]) {
+			break
+		}
+		if i > 0 && contactInfo.MatchString(word) {
+			continue
+		}
+		kept = append(kept, word)
+	}
+
+	// punctuation left dangling at the end, as in "SHAKE SHACK -"
+	for len(kept) > 0 && strings.IndexFunc(kept[len(kept)-1], isWordRune) == -1 {
+		kept = kept[:len(kept)-1]
+	}
+	return kept
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func titleCase(words []string) string {
+	for i, word := range words {
+		runes := []rune(strings.ToLower(word))
+		for j := range runes {
+			if j == 0 || runes[j-1] == '-' {
+				runes[j] = unicode.ToUpper(runes[j])
+			}
+		}
+		words[i] = string(runes)
+	}
+	return strings.Join(words, " ")
+}
+
+// Set the payee of tr from its institution description: a learned
+// payee if there is one, or else the normalized description when the
+// payee is missing or just a copy of the description
+func (m *Model) ResolvePayee(tr *Transaction) {
+	if tr.InstDescription == "" {
+		return
+	}
+
+	if payee, ok := m.LookupPayee(tr.InstDescription); ok {
+		tr.Payee = payee
+		return
+	}
+
+	payee := strings.Join(strings.Fields(tr.Payee), " ")
+	if payee == "" || strings.EqualFold(payee, strings.Join(strings.Fields(tr.InstDescription), " ")) {
+		tr.Payee = NormalizePayee(tr.InstDescription)
+	}
+}
+
+// The learned payee for an institution description, if there is one
+func (m *Model) LookupPayee(instDesc string) (string, bool) {
+	key := PayeeKey(instDesc)
+	if key == "" {
+		return "", false
+	}
+
+	payee := ""
+	err := m.db.NewSelect().
+		Model((*PayeeAlias)(nil)).
+		Column("payee").
+		Where("key = ?", key).
+		Scan(context.TODO(), &payee)
+	return payee, err == nil
+}
+
+// Remember payee for every transaction whose institution description
+// has the same key as instDesc. Returns the key it was stored under
+func (m *Model) LearnPayee(instDesc string, payee string) (string, error) {
+	key := PayeeKey(instDesc)
+	if key == "" {
+		return "", nil
+	}
+	return key, m.SetPayeeAlias(key, payee)
+}
+
+// Create or replace the learned payee for key
+func (m *Model) SetPayeeAlias(key string, payee string) error {
+	alias := &PayeeAlias{Key: key, Payee: payee}
+	_, err := m.db.NewInsert().
+		Model(alias).
+		On("CONFLICT (key) DO UPDATE").
+		Set("payee = EXCLUDED.payee").
+		Exec(context.TODO())
+	return err
+}
+
+func (m *Model) RemovePayeeAlias(key string) error {
+	_, err := m.db.NewDelete().
+		Model((*PayeeAlias)(nil)).
+		Where("key = ?", key).
+		Exec(context.TODO())
+	return err
+}
+
+func (m *Model) GetPayeeAliases() []PayeeAlias {
+	var aliases []PayeeAlias
+	err := m.db.NewSelect().
+		Model(&aliases).
+		Order("key").
+		Scan(context.TODO())
+	if err != nil {
+		return make([]PayeeAlias, 0)
+	}
+	return aliases
+}
@@ -0,0 +1,78 @@
+package omoney
+
+import "testing"
+
+func TestNormalizePayee(t *testing.T) {
+	tests := []struct {
+		instDesc string
+		want     string
+	}{
+		{"SQ *BLUE BOTTLE COF 8855 SAN FRANCISCO CA", "Blue Bottle Cof"},
+		{"TST* SHAKE SHACK - 123 NEW YORK NY", "Shake Shack"},
+		{"PAYPAL *SPOTIFY", "Spotify"},
+		{"AMZN MKTP US*2K4L71234", "Amzn Mktp Us"},
+		{"STARBUCKS STORE 12345 SEATTLE WA", "Starbucks"},
+		{"POS 03/14 SAFEWAY #1234", "Safeway"},
+		{"NETFLIX.COM 866-579-7172 CA", "Netflix.com"},
+		{"DOLLAR STORE", "Dollar Store"},
+		{"7-ELEVEN 33012", "7-Eleven"},
+		{"12345", "12345"},
+	}
+
+	for _, test := range tests {
+		if have := NormalizePayee(test.instDesc); have != test.want {
+			t.Fatalf("NormalizePayee(%q) failed"+
+				"\nhave: %s"+
+				"\nneed: %s",
+				test.instDesc, have, test.want)
+		}
+	}
+}
+
+func TestLearnedPayee(t *testing.T) {
+	m := &Model{db: CreateEmptyDB()}
+
+	// without a learned payee, a copy of the description is normalized
+	// but a payee given some other way is left alone
+	tr := NewTransaction("acc", "SQ *BLUE BOTTLE COF 8855 SAN FRANCISCO CA", 5,
+		WithInstDescription("SQ *BLUE BOTTLE COF 8855 SAN FRANCISCO CA"))
+	m.ResolvePayee(tr)
+	if tr.Payee != "Blue Bottle Cof" {
+		t.Fatalf("ResolvePayee without alias gave %s", tr.Payee)
+	}
+	tr = NewTransaction("acc", "Blue Bottle Coffee", 5,
+		WithInstDescription("SQ *BLUE BOTTLE COF 8855 SAN FRANCISCO CA"))
+	m.ResolvePayee(tr)
+	if tr.Payee != "Blue Bottle Coffee" {
+		t.Fatalf("ResolvePayee replaced a merchant name with %s", tr.Payee)
+	}
+
+	_, err := m.LearnPayee("SQ *BLUE BOTTLE COF 8855 SAN FRANCISCO CA", "Blue Bottle")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a different store on a different day
+	tr = NewTransaction("acc", "", 6,
+		WithInstDescription("SQ * BLUE BOTTLE COF 0412 OAKLAND CA"))
+	m.ResolvePayee(tr)
+	if tr.Payee != "Blue Bottle" {
+		t.Fatalf("ResolvePayee with alias failed"+
+			"\nhave: %s"+
+			"\nneed: %s",
+			tr.Payee, "Blue Bottle")
+	}
+
+	aliases := m.GetPayeeAliases()
+	if len(aliases) != 1 || aliases[0].Key != "BLUE BOTTLE COF" {
+		t.Fatalf("GetPayeeAliases failed: %+v", aliases)
+	}
+
+	err = m.RemovePayeeAlias("BLUE BOTTLE COF")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.LookupPayee("SQ *BLUE BOTTLE COF 8855"); ok {
+		t.Fatal("Removed payee alias still matches")
+	}
+}
@@ -0,0 +1,193 @@
+package omoney
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"time"
+)
+
+// An account owed money on, and what it costs to carry
+type Debt struct {
+	AccountId string
+	Alias     string
+	// What is owed now
+	Balance float64
+	// Annual percentage rate, such as 24.99 for 24.99%
+	Apr float64
+	// The least that must be paid every month
+	MinPayment float64
+}
+
+// The order debts are paid down in, once every minimum is paid
+type PayoffStrategy string
+
+const (
+	// Smallest balance first
+	Snowball PayoffStrategy = "snowball"
+	// Highest APR first
+	Avalanche PayoffStrategy = "avalanche"
+	// An order given by hand
+	CustomOrder PayoffStrategy = "custom"
+)
+
+// The result of paying off debts in one order with a monthly budget
+type PayoffPlan struct {
+	Strategy PayoffStrategy
+	// Account ids, in the order extra money went to them
+	Order []string
+	// Months until every debt is paid off
+	Months        int
+	DebtFree      time.Time
+	TotalInterest float64
+	// When each account, by id, is paid off
+	PaidOff map[string]time.Time
+}
+
+// Plans stop after this many months, in case the budget never
+// gets ahead of the interest
+const maxPayoffMonths = 1200
+
+// Every open credit card and personal loan that has money owed on it,
+// with the APR and payment of loans that have terms. Cards and loans
+// without terms are left for the caller to fill in
+func (m *Model) GetDebts() ([]Debt, error) {
+	debts := make([]Debt, 0)
+	for _, acc := range m.GetAccounts() {
+		if acc.Closed || (acc.Type != CreditCard && acc.Type != PersonalLoan) {
+			continue
+		}
+		bal, err := m.GetCurrentBalance(acc.Id)
+		if err != nil {
+			return nil, err
+		}
+		if bal <= loanEpsilon {
+			continue
+		}
+
+		debt := Debt{AccountId: acc.Id, Alias: acc.Alias, Balance: bal}
+		if acc.Loan.IsSet() {
+			debt.Apr = acc.Loan.Apr
+			debt.MinPayment = acc.Loan.MonthlyPayment()
+		}
+		debts = append(debts, debt)
+	}
+	return debts, nil
+}
+
+// Sort debts into the order strategy pays them down in. For
+// CustomOrder, the debts with account ids in order come first,
+// followed by any others in avalanche order
+func OrderDebts(debts []Debt, strategy PayoffStrategy, order []string) ([]Debt, error) {
+	sorted := slices.Clone(debts)
+	avalanche := func(i, j int) bool {
+		if sorted[i].Apr != sorted[j].Apr {
+			return sorted[i].Apr > sorted[j].Apr
+		}
+		return sorted[i].Balance < sorted[j].Balance
+	}
+
+	switch strategy {
+	case Snowball:
+		sort.SliceStable(sorted, func(i, j int) bool {
+			if sorted[i].Balance != sorted[j].Balance {
+				return sorted[i].Balance < sorted[j].Balance
+			}
+			return sorted[i].Apr > sorted[j].Apr
+		})
+	case Avalanche:
+		sort.SliceStable(sorted, avalanche)
+	case CustomOrder:
+		sort.SliceStable(sorted, avalanche)
+		rank := func(d Debt) int {
+			i := slices.Index(order, d.AccountId)
+			if i == -1 {
+				return len(order)
+			}
+			return i
+		}
+		for _, id := range order {
+			if !slices.ContainsFunc(debts, func(d Debt) bool { return d.AccountId == id }) {
+				return nil, fmt.Errorf("account %s has no debt to order", id)
+			}
+		}
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return rank(sorted[i]) < rank(sorted[j])
+		})
+	default:
+		return nil, fmt.Errorf("unknown payoff strategy %s", strategy)
+	}
+	return sorted, nil
+}
+
+// Simulate paying budget every month, starting the month after start,
+// until every debt is paid off. Each month interest is added to every
+// balance, every minimum is paid, and whatever is left of the budget
+// goes to the first debt still owed in the strategy's order
+func PlanPayoff(debts []Debt, budget float64, strategy PayoffStrategy, order []string, start time.Time) (PayoffPlan, error) {
+	if len(debts) == 0 {
+		return PayoffPlan{}, errors.New("no debts to pay off")
+	}
+	minimums := 0.0
+	for _, d := range debts {
+		if d.Apr < 0 || d.MinPayment <= 0 {
+			return PayoffPlan{}, fmt.Errorf("%s needs an APR and a minimum payment", d.Alias)
+		}
+		minimums += d.MinPayment
+	}
+	if budget < minimums {
+		return PayoffPlan{}, fmt.Errorf("a budget of $%.2f doesn't cover the $%.2f of minimum payments", budget, minimums)
+	}
+
+	sorted, err := OrderDebts(debts, strategy, order)
+	if err != nil {
+		return PayoffPlan{}, err
+	}
+
+	plan := PayoffPlan{Strategy: strategy, PaidOff: make(map[string]time.Time, len(sorted))}
+	balances := make([]float64, len(sorted))
+	for i, d := range sorted {
+		plan.Order = append(plan.Order, d.AccountId)
+		balances[i] = d.Balance
+	}
+
+	for month := 1; len(plan.PaidOff) < len(sorted); month++ {
+		if month > maxPayoffMonths {
+			return PayoffPlan{}, fmt.Errorf("a budget of $%.2f never pays off these debts", budget)
+		}
+		date := start.AddDate(0, month, 0)
+
+		left := budget
+		for i, d := range sorted {
+			if balances[i] <= loanEpsilon {
+				continue
+			}
+			interest := balances[i] * d.Apr / 100 / 12
+			plan.TotalInterest += interest
+			balances[i] += interest
+
+			paid := math.Min(d.MinPayment, balances[i])
+			balances[i] -= paid
+			left -= paid
+		}
+		for i := range sorted {
+			if left <= 0 {
+				break
+			}
+			paid := math.Min(left, balances[i])
+			balances[i] -= paid
+			left -= paid
+		}
+
+		for i, d := range sorted {
+			if _, done := plan.PaidOff[d.AccountId]; !done && balances[i] <= loanEpsilon {
+				plan.PaidOff[d.AccountId] = date
+			}
+		}
+		plan.Months = month
+		plan.DebtFree = date
+	}
+	return plan, nil
+}
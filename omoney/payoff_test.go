@@ -0,0 +1,114 @@
+package omoney
+
+import (
+	"math"
+	"testing"
+)
+
+func testDebts() []Debt {
+	return []Debt{
+		{AccountId: "visa", Alias: "visa", Balance: 5000, Apr: 24.99, MinPayment: 100},
+		{AccountId: "store", Alias: "store", Balance: 800, Apr: 12, MinPayment: 25},
+		{AccountId: "car", Alias: "car", Balance: 9000, Apr: 6, MinPayment: 300},
+	}
+}
+
+func TestOrderDebts(t *testing.T) {
+	orders := map[PayoffStrategy][]string{
+		Snowball:  {"store", "visa", "car"},
+		Avalanche: {"visa", "store", "car"},
+	}
+	for strategy, need := range orders {
+		sorted, err := OrderDebts(testDebts(), strategy, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, d := range sorted {
+			if d.AccountId != need[i] {
+				t.Fatalf("%s order failed\nhave: %v\nneed: %v", strategy, sorted, need)
+			}
+		}
+	}
+
+	// accounts left out of a custom order come after, highest APR first
+	sorted, err := OrderDebts(testDebts(), CustomOrder, []string{"car"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sorted[0].AccountId != "car" || sorted[1].AccountId != "visa" || sorted[2].AccountId != "store" {
+		t.Fatalf("Custom order failed\nhave: %v\nneed: car, visa, store", sorted)
+	}
+	if _, err := OrderDebts(testDebts(), CustomOrder, []string{"amex"}); err == nil {
+		t.Fatal("Ordering an account without debt should fail")
+	}
+}
+
+func TestPlanPayoff(t *testing.T) {
+	start := day(2024, 1, 1)
+	snowball, err := PlanPayoff(testDebts(), 1000, Snowball, nil, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	avalanche, err := PlanPayoff(testDebts(), 1000, Avalanche, nil, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// snowball clears the smallest balance first, while avalanche
+	// pays the least interest overall
+	if !snowball.PaidOff["store"].Before(avalanche.PaidOff["store"]) {
+		t.Fatalf("Snowball failed\nhave: store paid off %v, vs %v with avalanche",
+			snowball.PaidOff["store"], avalanche.PaidOff["store"])
+	}
+	if avalanche.TotalInterest >= snowball.TotalInterest {
+		t.Fatalf("Avalanche failed\nhave: $%.2f interest\nneed: less than snowball's $%.2f",
+			avalanche.TotalInterest, snowball.TotalInterest)
+	}
+	// 14800 owed at $1000 a month, plus interest
+	if avalanche.Months < 15 || avalanche.Months > 18 || !avalanche.DebtFree.Equal(start.AddDate(0, avalanche.Months, 0)) {
+		t.Fatalf("Avalanche failed\nhave: %d months, debt free %v", avalanche.Months, avalanche.DebtFree)
+	}
+	for _, d := range testDebts() {
+		if paid := avalanche.PaidOff[d.AccountId]; paid.After(avalanche.DebtFree) || paid.IsZero() {
+			t.Fatalf("Payoff date of %s failed\nhave: %v", d.Alias, paid)
+		}
+	}
+
+	if _, err := PlanPayoff(testDebts(), 400, Avalanche, nil, start); err == nil {
+		t.Fatal("A budget below the minimums should fail")
+	}
+}
+
+func TestGetDebts(t *testing.T) {
+	m := &Model{db: CreateEmptyDB()}
+	addLoan(t, m)
+	card := *NewAccount(WithAlias("visa"), WithAccountType(CreditCard))
+	m.AddAccount(card)
+	m.AddTransaction(NewTransaction(card.Id, "Groceries", 120, WithDate(day(2030, 1, 1))))
+	paidOff := *NewAccount(WithAlias("amex"), WithAccountType(CreditCard))
+	m.AddAccount(paidOff)
+	AddDummyAccounts(m, 1)
+
+	debts, err := m.GetDebts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(debts) != 2 {
+		t.Fatalf("GetDebts failed\nhave: %v\nneed: car and visa", debts)
+	}
+	for _, d := range debts {
+		switch d.Alias {
+		case "car":
+			// loans with terms fill in what they can
+			if d.Balance != 10000 || d.Apr != 6 || math.Abs(d.MinPayment-304.22) > 0.005 {
+				t.Fatalf("Loan debt failed\nhave: %+v", d)
+			}
+		case "visa":
+			if d.Balance != 120 || d.Apr != 0 || d.MinPayment != 0 {
+				t.Fatalf("Card debt failed\nhave: %+v", d)
+			}
+		default:
+			t.Fatalf("Unexpected debt %+v", d)
+		}
+	}
+}
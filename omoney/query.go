@@ -0,0 +1,356 @@
+package omoney
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/araddon/dateparse"
+)
+
+// A filter over transactions, written in a small query language such as
+//
+//	payee ~ "amazon" and amount > 50 and category = "" and date >= 2024-01
+//
+// Comparisons are joined with and/or/not and grouped with parentheses.
+// The fields are payee, amount, date, category, desc, instdesc, status,
+// reimbursable (1 or 0), and account (an alias or id). Operators are = != < <= > >= on every
+// field, plus ~ and !~ (contains, ignoring case) on text fields.
+// Dates may be a year, a month, or a day, and compare against the
+// whole period, so `date = 2024-01` matches all of January
+type Query struct {
+	// The original text of the query
+	Source string
+	// SQL condition on the transactions table, with ? placeholders
+	where string
+	args  []interface{}
+}
+
+type queryField struct {
+	column string
+	kind   queryFieldKind
+}
+
+type queryFieldKind int
+
+const (
+	queryText queryFieldKind = iota
+	queryNumber
+	queryDate
+	queryAccount
+)
+
+var queryFields = map[string]queryField{
+	"payee":            {"payee", queryText},
+	"amount":           {"amount", queryNumber},
+	"date":             {"date", queryDate},
+	"category":         {"category", queryText},
+	"desc":             {"description", queryText},
+	"description":      {"description", queryText},
+	"instdesc":         {"inst_description", queryText},
+	"inst_description": {"inst_description", queryText},
+	"status":           {"status", queryText},
+	"reimbursable":     {"reimbursable", queryNumber},
+	"account":          {"account_id", queryAccount},
+}
+
+type queryTokenKind int
+
+const (
+	tokWord queryTokenKind = iota
+	tokString
+	tokOperator
+	tokLParen
+	tokRParen
+	tokEnd
+)
+
+type queryToken struct {
+	kind queryTokenKind
+	text string
+	// Offset of the token in the query, for error messages
+	pos int
+}
+
+// Parse a query into a filter that can be passed in GetTransactionsOptions
+func ParseQuery(input string) (*Query, error) {
+	tokens, err := lexQuery(input)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &queryParser{tokens: tokens}
+	where, args, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEnd {
+		return nil, fmt.Errorf("unexpected %q at position %d", tok.text, tok.pos)
+	}
+
+	return &Query{Source: input, where: where, args: args}, nil
+}
+
+func lexQuery(input string) ([]queryToken, error) {
+	tokens := make([]queryToken, 0)
+	runes := []rune(input)
+
+	i := 0
+	for i < len(runes) {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, queryToken{tokLParen, "(", i})
+			i++
+		case r == ')':
+			tokens = append(tokens, queryToken{tokRParen, ")", i})
+			i++
+		case r == '"' || r == '\'':
+			start := i
+			i++
+			var sb strings.Builder
+			for i < len(runes) && runes[i] != r {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+				}
+				sb.WriteRune(runes[i])
+				i++
+			}
+			if i == len(runes) {
+				return nil, fmt.Errorf("unterminated string starting at position %d", start)
+			}
+			i++
+			tokens = append(tokens, queryToken{tokString, sb.String(), start})
+		case strings.ContainsRune("=!<>~", r):
+			start := i
+			for i < len(runes) && strings.ContainsRune("=!<>~", runes[i]) {
+				i++
+			}
+			op := string(runes[start:i])
+			switch op {
+			case "=", "==", "!=", "<", "<=", ">", ">=", "~", "!~":
+			default:
+				return nil, fmt.Errorf("unknown operator %s at position %d", op, start)
+			}
+			tokens = append(tokens, queryToken{tokOperator, op, start})
+		default:
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) &&
+				!strings.ContainsRune("()=!<>~\"'", runes[i]) {
+				i++
+			}
+			tokens = append(tokens, queryToken{tokWord, string(runes[start:i]), start})
+		}
+	}
+
+	return append(tokens, queryToken{tokEnd, "end of query", len(runes)}), nil
+}
+
+type queryParser struct {
+	tokens []queryToken
+	i      int
+}
+
+func (p *queryParser) peek() queryToken {
+	return p.tokens[p.i]
+}
+
+func (p *queryParser) next() queryToken {
+	tok := p.tokens[p.i]
+	if tok.kind != tokEnd {
+		p.i++
+	}
+	return tok
+}
+
+// Whether the next token is the keyword kw, consuming it if so
+func (p *queryParser) keyword(kw string) bool {
+	tok := p.peek()
+	if tok.kind == tokWord && strings.EqualFold(tok.text, kw) {
+		p.i++
+		return true
+	}
+	return false
+}
+
+// or := and ("or" and)*
+func (p *queryParser) parseOr() (string, []interface{}, error) {
+	where, args, err := p.parseAnd()
+	if err != nil {
+		return "", nil, err
+	}
+	for p.keyword("or") {
+		right, rightArgs, err := p.parseAnd()
+		if err != nil {
+			return "", nil, err
+		}
+		where = fmt.Sprintf("(%s OR %s)", where, right)
+		args = append(args, rightArgs...)
+	}
+	return where, args, nil
+}
+
+// and := not ("and" not)*
+func (p *queryParser) parseAnd() (string, []interface{}, error) {
+	where, args, err := p.parseNot()
+	if err != nil {
+		return "", nil, err
+	}
+	for p.keyword("and") {
+		right, rightArgs, err := p.parseNot()
+		if err != nil {
+			return "", nil, err
+		}
+		where = fmt.Sprintf("(%s AND %s)", where, right)
+		args = append(args, rightArgs...)
+	}
+	return where, args, nil
+}
+
+// not := "not" not | "(" or ")" | comparison
+func (p *queryParser) parseNot() (string, []interface{}, error) {
+	if p.keyword("not") {
+		where, args, err := p.parseNot()
+		if err != nil {
+			return "", nil, err
+		}
+		return fmt.Sprintf("(NOT %s)", where), args, nil
+	}
+
+	if p.peek().kind == tokLParen {
+		p.next()
+		where, args, err := p.parseOr()
+		if err != nil {
+			return "", nil, err
+		}
+		if tok := p.next(); tok.kind != tokRParen {
+			return "", nil, fmt.Errorf("expected ) at position %d, found %q", tok.pos, tok.text)
+		}
+		return where, args, nil
+	}
+
+	return p.parseComparison()
+}
+
+// comparison := field operator value
+func (p *queryParser) parseComparison() (string, []interface{}, error) {
+	fieldTok := p.next()
+	if fieldTok.kind != tokWord {
+		return "", nil, fmt.Errorf("expected a field at position %d, found %q", fieldTok.pos, fieldTok.text)
+	}
+	field, ok := queryFields[strings.ToLower(fieldTok.text)]
+	if !ok {
+		return "", nil, fmt.Errorf("unknown field %s at position %d", fieldTok.text, fieldTok.pos)
+	}
+
+	opTok := p.next()
+	if opTok.kind != tokOperator {
+		return "", nil, fmt.Errorf("expected an operator after %s at position %d, found %q", fieldTok.text, opTok.pos, opTok.text)
+	}
+	op := opTok.text
+	if op == "==" {
+		op = "="
+	}
+
+	valueTok := p.next()
+	if valueTok.kind != tokWord && valueTok.kind != tokString {
+		return "", nil, fmt.Errorf("expected a value after %s at position %d, found %q", op, valueTok.pos, valueTok.text)
+	}
+	value := valueTok.text
+
+	if (op == "~" || op == "!~") && field.kind != queryText {
+		return "", nil, fmt.Errorf("%s cannot be used with %s at position %d", op, fieldTok.text, opTok.pos)
+	}
+
+	switch field.kind {
+	case queryText:
+		switch op {
+		case "~":
+			return fmt.Sprintf("%s LIKE ? ESCAPE '\\'", field.column), []interface{}{likePattern(value)}, nil
+		case "!~":
+			return fmt.Sprintf("%s NOT LIKE ? ESCAPE '\\'", field.column), []interface{}{likePattern(value)}, nil
+		default:
+			return fmt.Sprintf("%s %s ?", field.column, op), []interface{}{value}, nil
+		}
+	case queryNumber:
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return "", nil, fmt.Errorf("%s is not a number at position %d", value, valueTok.pos)
+		}
+		return fmt.Sprintf("%s %s ?", field.column, op), []interface{}{n}, nil
+	case queryDate:
+		start, end, err := parseQueryDate(value)
+		if err != nil {
+			return "", nil, fmt.Errorf("%s is not a date at position %d", value, valueTok.pos)
+		}
+		return dateCondition(field.column, op, start, end)
+	case queryAccount:
+		if op != "=" && op != "!=" {
+			return "", nil, fmt.Errorf("account can only be compared with = or != at position %d", opTok.pos)
+		}
+		in := "IN"
+		if op == "!=" {
+			in = "NOT IN"
+		}
+		return fmt.Sprintf("%s %s (SELECT id FROM accounts WHERE id = ? OR alias = ?)", field.column, in),
+			[]interface{}{value, value}, nil
+	}
+
+	return "", nil, fmt.Errorf("unsupported field %s", fieldTok.text)
+}
+
+// Match value anywhere in the text, treating % and _ in it literally
+func likePattern(value string) string {
+	return "%" + escapeLike(value) + "%"
+}
+
+// Escape value for a LIKE pattern with ESCAPE '\', so that % and _ in
+// it are matched literally
+func escapeLike(value string) string {
+	value = strings.ReplaceAll(value, "\\", "\\\\")
+	value = strings.ReplaceAll(value, "%", "\\%")
+	return strings.ReplaceAll(value, "_", "\\_")
+}
+
+// Parse a year (2024), month (2024-01) or day (2024-01-15) into the
+// period it covers, [start, end). Anything else dateparse understands
+// is taken as the day it falls on
+func parseQueryDate(value string) (time.Time, time.Time, error) {
+	if t, err := time.ParseInLocation("2006", value, time.Local); err == nil {
+		return t, t.AddDate(1, 0, 0), nil
+	}
+	if t, err := time.ParseInLocation("2006-01", value, time.Local); err == nil {
+		return t, t.AddDate(0, 1, 0), nil
+	}
+
+	t, err := dateparse.ParseLocal(value)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+	return day, day.AddDate(0, 0, 1), nil
+}
+
+// Compare a date column against the period [start, end)
+func dateCondition(column string, op string, start time.Time, end time.Time) (string, []interface{}, error) {
+	s, e := dbTime(start), dbTime(end)
+	switch op {
+	case "=":
+		return fmt.Sprintf("(%s >= ? AND %s < ?)", column, column), []interface{}{s, e}, nil
+	case "!=":
+		return fmt.Sprintf("(%s < ? OR %s >= ?)", column, column), []interface{}{s, e}, nil
+	case "<":
+		return fmt.Sprintf("%s < ?", column), []interface{}{s}, nil
+	case "<=":
+		return fmt.Sprintf("%s < ?", column), []interface{}{e}, nil
+	case ">":
+		return fmt.Sprintf("%s >= ?", column), []interface{}{e}, nil
+	case ">=":
+		return fmt.Sprintf("%s >= ?", column), []interface{}{s}, nil
+	}
+	return "", nil, fmt.Errorf("%s cannot be used with dates", op)
+}
@@ -0,0 +1,136 @@
+package omoney
+
+import (
+	"testing"
+	"time"
+)
+
+func addQueryTransactions(m *Model) {
+	AddDummyAccounts(m, 2)
+	acc0, _ := m.GetAccount("acc0")
+	acc1, _ := m.GetAccount("acc1")
+
+	trs := []*Transaction{
+		NewTransaction(acc0.Id, "AMAZON MKTPLACE", 75,
+			WithDate(time.Date(2024, 01, 10, 12, 0, 0, 0, time.Local))),
+		NewTransaction(acc0.Id, "Amazon Prime", 14.99,
+			WithDate(time.Date(2024, 02, 01, 12, 0, 0, 0, time.Local)),
+			WithCategory("subscriptions")),
+		NewTransaction(acc1.Id, "Safeway", 60,
+			WithDate(time.Date(2023, 12, 31, 12, 0, 0, 0, time.Local))),
+		NewTransaction(acc1.Id, "50%_off", 5,
+			WithDate(time.Date(2024, 01, 31, 12, 0, 0, 0, time.Local)),
+			WithDescription("coupon")),
+	}
+	for _, tr := range trs {
+		m.AddTransaction(tr)
+	}
+}
+
+func TestQueryMatches(t *testing.T) {
+	m := &Model{db: CreateEmptyDB()}
+	addQueryTransactions(m)
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{`payee ~ "amazon" and amount > 50 and category = "" and date >= 2024-01`, []string{"AMAZON MKTPLACE"}},
+		{`payee ~ amazon`, []string{"Amazon Prime", "AMAZON MKTPLACE"}},
+		{`date = 2024-01`, []string{"50%_off", "AMAZON MKTPLACE"}},
+		{`date < 2024`, []string{"Safeway"}},
+		{`date <= 2024-01-10 and date > 2023`, []string{"AMAZON MKTPLACE"}},
+		{`account = acc1 or category != ""`, []string{"Amazon Prime", "50%_off", "Safeway"}},
+		{`not (account = acc1) and not payee ~ prime`, []string{"AMAZON MKTPLACE"}},
+		{`payee ~ "%"`, []string{"50%_off"}},
+		{`desc ~ coup OR amount <= 5`, []string{"50%_off"}},
+	}
+
+	for _, test := range tests {
+		q, err := ParseQuery(test.query)
+		if err != nil {
+			t.Fatalf("ParseQuery(%s) failed: %s", test.query, err)
+		}
+
+		trs, err := m.GetTransactions(GetTransactionsOptions{Count: 10, Query: q})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		have := make([]string, len(trs))
+		for i, tr := range trs {
+			have[i] = tr.Payee
+		}
+		if len(have) != len(test.want) {
+			t.Fatalf("Query %s failed"+
+				"\nhave: %v"+
+				"\nneed: %v",
+				test.query, have, test.want)
+		}
+		for i := range have {
+			if have[i] != test.want[i] {
+				t.Fatalf("Query %s failed"+
+					"\nhave: %v"+
+					"\nneed: %v",
+					test.query, have, test.want)
+			}
+		}
+	}
+}
+
+func TestQueryErrors(t *testing.T) {
+	queries := []string{
+		`payee`,
+		`color = red`,
+		`amount ~ 5`,
+		`amount > lots`,
+		`date >= someday`,
+		`payee = "unterminated`,
+		`(payee = a`,
+		`payee = a b`,
+		`account > acc0`,
+		`payee => a`,
+	}
+
+	for _, query := range queries {
+		if _, err := ParseQuery(query); err == nil {
+			t.Fatalf("ParseQuery(%s) should have failed", query)
+		}
+	}
+}
+
+func TestQueryDateEastOfUTC(t *testing.T) {
+	// midnight local time is the previous day in UTC, which is how
+	// dates are stored
+	local := time.Local
+	time.Local = time.FixedZone("AEDT", 11*60*60)
+	defer func() { time.Local = local }()
+
+	m := &Model{db: CreateEmptyDB()}
+	AddDummyAccounts(m, 1)
+	acc, _ := m.GetAccount("acc0")
+	m.AddTransaction(NewTransaction(acc.Id, "Cafe", 5, WithDate(time.Date(2024, 1, 15, 0, 0, 0, 0, time.Local))))
+	m.AddTransaction(NewTransaction(acc.Id, "Bakery", 7, WithDate(time.Date(2024, 1, 16, 0, 0, 0, 0, time.Local))))
+
+	for query, want := range map[string]string{
+		"date = 2024-01-15": "Cafe",
+		"date > 2024-01-15": "Bakery",
+		"date <= 2024-01":   "",
+	} {
+		q, err := ParseQuery(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		trs, err := m.GetTransactions(GetTransactionsOptions{Count: 10, Query: q})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want == "" {
+			if len(trs) != 2 {
+				t.Fatalf("Query %s failed\nhave: %v\nneed: both", query, trs)
+			}
+		} else if len(trs) != 1 || trs[0].Payee != want {
+			t.Fatalf("Query %s failed\nhave: %v\nneed: %s", query, trs, want)
+		}
+	}
+}
@@ -0,0 +1,324 @@
+package omoney
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// A group of reimbursable transactions submitted to be paid back together,
+// such as the expenses of one work trip
+type ExpenseReport struct {
+	Id      int64  `bun:",pk,autoincrement"`
+	Name    string `bun:",unique"`
+	Created time.Time
+	// The deposit that paid the report back, once one has been matched
+	DepositId string
+}
+
+// A report along with what is in it and what paid it back
+type ReportSummary struct {
+	Report ExpenseReport
+	// The sum of the report's transactions
+	Total float64
+	Count int
+	// The deposit that paid the report back, or nil while it is owed
+	Deposit *Transaction
+}
+
+// How much of the report is still owed, which is negative when the
+// deposit paid back more than was spent
+func (s ReportSummary) Outstanding() float64 {
+	if s.Deposit == nil {
+		return s.Total
+	}
+	return s.Total + s.Deposit.Amount
+}
+
+// Mark the transactions with ids as reimbursable or not. Transactions
+// that aren't reimbursable are taken out of any report they were in
+func (m *Model) SetReimbursable(ids []string, reimbursable bool) error {
+	ops := []UpdateTransactionOptions{WithReimbursableUpdate(reimbursable)}
+	if !reimbursable {
+		ops = append(ops, WithReportUpdate(0))
+	}
+	return m.UpdateTransactions(ids, ops...)
+}
+
+func (m *Model) AddExpenseReport(name string) (*ExpenseReport, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || strings.ContainsAny(name, " \t") {
+		return nil, fmt.Errorf("invalid name '%s', names can't be empty or contain spaces", name)
+	}
+	if _, err := m.GetExpenseReport(name); err == nil {
+		return nil, fmt.Errorf("report %s already exists", name)
+	}
+
+	report := &ExpenseReport{Name: name, Created: time.Now()}
+	err := m.RunInTx(func(tx *Model) error {
+		_, err := tx.db.NewInsert().
+			Model(report).
+			Exec(context.TODO())
+		if err != nil {
+			return err
+		}
+		return tx.record(OpAddReport, intTarget(report.Id), nil, report)
+	})
+	return report, err
+}
+
+// Remove a report, leaving its transactions reimbursable but in no report
+func (m *Model) RemoveExpenseReport(name string) error {
+	report, err := m.GetExpenseReport(name)
+	if err != nil {
+		return err
+	}
+	return m.RunInBatch(func(tx *Model) error {
+		ids, err := tx.reportTransactionIds(report.Id)
+		if err != nil {
+			return err
+		}
+		if len(ids) > 0 {
+			err = tx.UpdateTransactions(ids, WithReportUpdate(0))
+			if err != nil {
+				return err
+			}
+		}
+		_, err = tx.db.NewDelete().
+			Model((*ExpenseReport)(nil)).
+			Where("id = ?", report.Id).
+			Exec(context.TODO())
+		if err != nil {
+			return err
+		}
+		return tx.record(OpRemoveReport, intTarget(report.Id), &report, nil)
+	})
+}
+
+func (m *Model) GetExpenseReport(name string) (ExpenseReport, error) {
+	var report ExpenseReport
+	err := m.db.NewSelect().
+		Model(&report).
+		Where("name = ?", name).
+		Limit(1).
+		Scan(context.TODO())
+	if err != nil {
+		return report, fmt.Errorf("no expense report named %s", name)
+	}
+	return report, nil
+}
+
+// Every report, newest first, with what is in it and what paid it back
+func (m *Model) GetExpenseReports() ([]ReportSummary, error) {
+	var reports []ExpenseReport
+	err := m.db.NewSelect().
+		Model(&reports).
+		Order("created DESC", "id DESC").
+		Scan(context.TODO())
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]ReportSummary, len(reports))
+	for i, report := range reports {
+		summaries[i], err = m.summarizeReport(report)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return summaries, nil
+}
+
+func (m *Model) GetReportSummary(name string) (ReportSummary, error) {
+	report, err := m.GetExpenseReport(name)
+	if err != nil {
+		return ReportSummary{}, err
+	}
+	return m.summarizeReport(report)
+}
+
+func (m *Model) summarizeReport(report ExpenseReport) (ReportSummary, error) {
+	summary := ReportSummary{Report: report}
+	err := m.db.NewRaw(
+		"SELECT coalesce(sum(amount), 0.0) AS total, count(*) AS count FROM transactions WHERE report_id = ?",
+		report.Id,
+	).Scan(context.TODO(), &summary.Total, &summary.Count)
+	if err != nil {
+		return summary, err
+	}
+	if report.DepositId != "" {
+		deposit, err := m.GetTransactionById(report.DepositId)
+		if err == nil {
+			summary.Deposit = &deposit
+		} else if err != sql.ErrNoRows {
+			return summary, err
+		}
+	}
+	return summary, nil
+}
+
+// The transactions in the report named name, newest first, leaving out
+// those not matching query when it isn't nil
+func (m *Model) GetReportTransactions(name string, query *Query) ([]Transaction, error) {
+	report, err := m.GetExpenseReport(name)
+	if err != nil {
+		return nil, err
+	}
+	trs := make([]Transaction, 0)
+	sel := m.db.NewSelect().
+		Model(&trs).
+		Where("report_id = ?", report.Id)
+	if query != nil {
+		sel = sel.Where(query.where, query.args...)
+	}
+	err = sel.Order("date DESC", "id").
+		Scan(context.TODO())
+	return trs, err
+}
+
+func (m *Model) reportTransactionIds(reportId int64) ([]string, error) {
+	ids := make([]string, 0)
+	err := m.db.NewSelect().
+		Model((*Transaction)(nil)).
+		Column("id").
+		Where("report_id = ?", reportId).
+		Scan(context.TODO(), &ids)
+	return ids, err
+}
+
+// Put the transactions with ids in the report named name, marking them
+// reimbursable. Reports already paid back can't be added to
+func (m *Model) AddToReport(name string, ids []string) error {
+	summary, err := m.GetReportSummary(name)
+	if err != nil {
+		return err
+	}
+	if summary.Deposit != nil {
+		return fmt.Errorf("report %s has already been paid back", name)
+	}
+	return m.UpdateTransactions(ids, WithReimbursableUpdate(true), WithReportUpdate(summary.Report.Id))
+}
+
+// Match the transaction with id depositId as what paid back the report
+// named name, whether or not it was for the same amount. A deposit can
+// only pay back one report
+func (m *Model) MatchReimbursement(name string, depositId string) error {
+	report, err := m.GetExpenseReport(name)
+	if err != nil {
+		return err
+	}
+	deposit, err := m.GetTransactionById(depositId)
+	if err != nil {
+		return err
+	}
+	if deposit.Amount >= 0 {
+		return errors.New("a reimbursement must be money coming in")
+	}
+	if deposit.Reimbursable {
+		return errors.New("a reimbursable expense can't also be a reimbursement")
+	}
+
+	var other ExpenseReport
+	err = m.db.NewSelect().
+		Model(&other).
+		Where("deposit_id = ?", depositId).
+		Where("id != ?", report.Id).
+		Limit(1).
+		Scan(context.TODO())
+	if err == nil {
+		return fmt.Errorf("that deposit already paid back report %s", other.Name)
+	} else if err != sql.ErrNoRows {
+		return err
+	}
+	return m.setReportDeposit(report, depositId)
+}
+
+// Forget what paid back the report named name
+func (m *Model) UnmatchReimbursement(name string) error {
+	report, err := m.GetExpenseReport(name)
+	if err != nil {
+		return err
+	}
+	return m.setReportDeposit(report, "")
+}
+
+func (m *Model) setReportDeposit(report ExpenseReport, depositId string) error {
+	return m.RunInTx(func(tx *Model) error {
+		_, err := tx.db.NewUpdate().
+			Model((*ExpenseReport)(nil)).
+			Set("deposit_id = ?", depositId).
+			Where("id = ?", report.Id).
+			Exec(context.TODO())
+		if err != nil {
+			return err
+		}
+		after := report
+		after.DepositId = depositId
+		return tx.record(OpMatchReport, intTarget(report.Id), &report, &after)
+	})
+}
+
+// Match tr, which was just added, to the oldest report still owed that it
+// pays back exactly, if it is a deposit made after the report's first
+// expense
+func (m *Model) matchReimbursement(tr *Transaction) error {
+	if tr.Amount >= 0 || tr.Reimbursable || tr.Status == Pending {
+		return nil
+	}
+
+	var reports []ExpenseReport
+	err := m.db.NewRaw(
+		"SELECT r.* FROM expense_reports AS r "+
+			"WHERE r.deposit_id = '' OR r.deposit_id NOT IN (SELECT id FROM transactions) "+
+			"ORDER BY r.created, r.id",
+	).Scan(context.TODO(), &reports)
+	if err != nil {
+		return err
+	}
+
+	for _, report := range reports {
+		summary, err := m.summarizeReport(report)
+		if err != nil {
+			return err
+		}
+		if summary.Count == 0 || math.Abs(summary.Total+tr.Amount) >= 0.005 {
+			continue
+		}
+		var first Transaction
+		err = m.db.NewSelect().
+			Model(&first).
+			Where("report_id = ?", report.Id).
+			Order("date").
+			Limit(1).
+			Scan(context.TODO())
+		if err != nil {
+			return err
+		}
+		if tr.Date.Before(startOfDay(first.Date)) {
+			continue
+		}
+		return m.setReportDeposit(report, tr.Id)
+	}
+	return nil
+}
+
+// Every reimbursable transaction that hasn't been paid back yet, whether
+// or not it is in a report, newest first
+func (m *Model) GetOutstandingReimbursements() ([]Transaction, error) {
+	trs := make([]Transaction, 0)
+	err := m.db.NewSelect().
+		Model(&trs).
+		Where("reimbursable").
+		Where("report_id NOT IN (SELECT r.id FROM expense_reports AS r JOIN transactions AS d ON d.id = r.deposit_id)").
+		Order("date DESC", "id").
+		Scan(context.TODO())
+	return trs, err
+}
+
+// A condition on transactions leaving out reimbursable expenses and the
+// deposits that paid them back, neither of which are really spending
+const notReimbursement = "NOT reimbursable AND id NOT IN (SELECT deposit_id FROM expense_reports)"
@@ -0,0 +1,161 @@
+package omoney
+
+import (
+	"testing"
+)
+
+func TestExpenseReports(t *testing.T) {
+	m := &Model{db: CreateEmptyDB()}
+	card := addCard(t, m)
+	hotel := NewTransaction(card.Id, "Hotel", 300, WithDate(day(2024, 1, 5)), WithCategory("travel"))
+	flight := NewTransaction(card.Id, "Airline", 200, WithDate(day(2024, 1, 4)), WithCategory("travel"))
+	taxi := NewTransaction(card.Id, "Taxi", 40, WithDate(day(2024, 1, 6)), WithCategory("travel"), WithReimbursable(true))
+	lunch := NewTransaction(card.Id, "Diner", 25, WithDate(day(2024, 1, 6)), WithCategory("travel"))
+	for _, tr := range []*Transaction{hotel, flight, taxi, lunch} {
+		if err := m.AddTransaction(tr); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := m.AddExpenseReport("conference"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddToReport("conference", []string{hotel.Id, flight.Id}); err != nil {
+		t.Fatal(err)
+	}
+
+	outstanding, err := m.GetOutstandingReimbursements()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(outstanding) != 3 {
+		t.Fatalf("GetOutstandingReimbursements failed\nhave: %+v\nneed: the hotel, flight and taxi", outstanding)
+	}
+
+	// a deposit for a different amount isn't matched
+	m.AddTransaction(NewTransaction(card.Id, "Employer", -100, WithDate(day(2024, 1, 20))))
+	deposit := NewTransaction(card.Id, "Employer", -500, WithDate(day(2024, 1, 25)))
+	m.AddTransaction(deposit)
+
+	summary, err := m.GetReportSummary("conference")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Total != 500 || summary.Count != 2 || summary.Deposit == nil ||
+		summary.Deposit.Id != deposit.Id || summary.Outstanding() != 0 {
+		t.Fatalf("Matching reimbursement failed\nhave: %+v\nneed: $500 paid back by the deposit", summary)
+	}
+	outstanding, _ = m.GetOutstandingReimbursements()
+	if len(outstanding) != 1 || outstanding[0].Id != taxi.Id {
+		t.Fatalf("GetOutstandingReimbursements failed\nhave: %+v\nneed: only the taxi", outstanding)
+	}
+	if err := m.AddToReport("conference", []string{lunch.Id}); err == nil {
+		t.Fatal("Adding to a report already paid back should fail")
+	}
+
+	// neither the expenses nor the deposit are spending or income
+	months, err := m.GetMonthlyTotals("", day(2024, 1, 1), day(2024, 1, 1), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if months[0].Categories["travel"] != 25 || months[0].Income != 100 {
+		t.Fatalf("GetMonthlyTotals failed\nhave: %+v\nneed: $25 of travel, $100 in", months[0])
+	}
+
+	if err := m.RemoveExpenseReport("conference"); err != nil {
+		t.Fatal(err)
+	}
+	hotelAfter, _ := m.GetTransactionById(hotel.Id)
+	if !hotelAfter.Reimbursable || hotelAfter.ReportId != 0 {
+		t.Fatalf("RemoveExpenseReport failed\nhave: %+v\nneed: reimbursable, in no report", hotelAfter)
+	}
+}
+
+func TestReimbursableOutsideBudget(t *testing.T) {
+	m := &Model{db: CreateEmptyDB()}
+	card := addCard(t, m)
+	err := m.AddAlertRule(&AlertRule{Kind: AlertBudget, Target: "travel", Amount: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.AddTransaction(NewTransaction(card.Id, "Hotel", 300, WithDate(day(2024, 1, 5)),
+		WithCategory("travel"), WithReimbursable(true)))
+	m.AddTransaction(NewTransaction(card.Id, "Taxi", 50, WithDate(day(2024, 1, 6)), WithCategory("travel")))
+
+	alerts, err := m.GetAlerts(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(alerts) != 0 {
+		t.Fatalf("Budget alerts failed\nhave: %+v\nneed: none, only $50 was spent", alerts)
+	}
+}
+
+func TestUndoRemoveExpenseReport(t *testing.T) {
+	m := &Model{db: CreateEmptyDB()}
+	card := addCard(t, m)
+	hotel := NewTransaction(card.Id, "Hotel", 300, WithDate(day(2024, 1, 5)))
+	m.AddTransaction(hotel)
+	m.AddExpenseReport("conference")
+	m.AddToReport("conference", []string{hotel.Id})
+	deposit := NewTransaction(card.Id, "Employer", -300, WithDate(day(2024, 1, 25)))
+	m.AddTransaction(deposit)
+
+	if err := m.RemoveExpenseReport("conference"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Undo(1); err != nil {
+		t.Fatal(err)
+	}
+
+	summary, err := m.GetReportSummary("conference")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Count != 1 || summary.Deposit == nil || summary.Deposit.Id != deposit.Id {
+		t.Fatalf("Undo remove report failed\nhave: %+v\nneed: the hotel, paid back by the deposit", summary)
+	}
+}
+
+func TestMatchReimbursementOnlyOnce(t *testing.T) {
+	m := &Model{db: CreateEmptyDB()}
+	card := addCard(t, m)
+	m.AddExpenseReport("conference")
+	m.AddExpenseReport("offsite")
+	deposit := NewTransaction(card.Id, "Employer", -300, WithDate(day(2024, 1, 25)))
+	m.AddTransaction(deposit)
+
+	if err := m.MatchReimbursement("conference", deposit.Id); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.MatchReimbursement("offsite", deposit.Id); err == nil {
+		t.Fatal("Matching a deposit to a second report should fail")
+	}
+	// matching the same report again is harmless
+	if err := m.MatchReimbursement("conference", deposit.Id); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetReportTransactionsWithQuery(t *testing.T) {
+	m := &Model{db: CreateEmptyDB()}
+	card := addCard(t, m)
+	hotel := NewTransaction(card.Id, "Hotel", 300, WithDate(day(2024, 1, 5)))
+	taxi := NewTransaction(card.Id, "Taxi", 40, WithDate(day(2024, 1, 6)))
+	m.AddTransaction(hotel)
+	m.AddTransaction(taxi)
+	m.AddExpenseReport("conference")
+	m.AddToReport("conference", []string{hotel.Id, taxi.Id})
+
+	query, err := ParseQuery("amount < 100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	trs, err := m.GetReportTransactions("conference", query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trs) != 1 || trs[0].Id != taxi.Id {
+		t.Fatalf("GetReportTransactions with query failed\nhave: %+v\nneed: only the taxi", trs)
+	}
+}
@@ -0,0 +1,107 @@
+package omoney
+
+import (
+	"context"
+	"strings"
+	"unicode"
+
+	"github.com/uptrace/bun"
+)
+
+// The full text index over transactions lives in an FTS5 table that
+// triggers keep in step with the transactions table, so every insert,
+// update, and delete (including undo and redo) updates it without the
+// rest of the model having to know it exists
+var searchSchema = []string{
+	`CREATE VIRTUAL TABLE IF NOT EXISTS transactions_fts USING fts5(
+		id UNINDEXED, payee, inst_description, description,
+		tokenize = 'unicode61 remove_diacritics 2')`,
+	`CREATE TRIGGER IF NOT EXISTS transactions_fts_insert AFTER INSERT ON transactions BEGIN
+		INSERT INTO transactions_fts (id, payee, inst_description, description)
+		VALUES (new.id, new.payee, new.inst_description, new.description);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS transactions_fts_update AFTER UPDATE ON transactions BEGIN
+		DELETE FROM transactions_fts WHERE id = old.id;
+		INSERT INTO transactions_fts (id, payee, inst_description, description)
+		VALUES (new.id, new.payee, new.inst_description, new.description);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS transactions_fts_delete AFTER DELETE ON transactions BEGIN
+		DELETE FROM transactions_fts WHERE id = old.id;
+	END`,
+}
+
+// Relative weight of a match in each column of transactions_fts when
+// ranking, so a hit on the payee counts for more than one buried in a
+// description. The id column is not indexed and so has no weight
+const searchRank = "bm25(transactions_fts, 0.0, 10.0, 4.0, 2.0)"
+
+func createSearchIndex(ctx context.Context, db bun.IDB) error {
+	for _, stmt := range searchSchema {
+		_, err := db.ExecContext(ctx, stmt)
+		if err != nil {
+			return err
+		}
+	}
+
+	// index whatever was already there
+	_, err := db.ExecContext(ctx, "DELETE FROM transactions_fts")
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, `INSERT INTO transactions_fts (id, payee, inst_description, description)
+		SELECT id, payee, inst_description, description FROM transactions`)
+	return err
+}
+
+func dropSearchIndex(ctx context.Context, db bun.IDB) error {
+	for _, stmt := range []string{
+		"DROP TRIGGER IF EXISTS transactions_fts_insert",
+		"DROP TRIGGER IF EXISTS transactions_fts_update",
+		"DROP TRIGGER IF EXISTS transactions_fts_delete",
+		"DROP TABLE IF EXISTS transactions_fts",
+	} {
+		_, err := db.ExecContext(ctx, stmt)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Find transactions in every account whose payee or descriptions
+// contain all of the words in terms, best matches first. Each word
+// matches as a prefix, so "amaz" finds "Amazon". The dates and query
+// in op narrow the matches further, and Count and Offset page them
+func (m *Model) SearchTransactions(terms string, op GetTransactionsOptions) ([]Transaction, error) {
+	match := searchMatch(terms)
+	if match == "" {
+		return []Transaction{}, nil
+	}
+
+	where, args := transactionsWhere("", op)
+	args = append([]interface{}{match}, args...)
+	args = append(args, op.Count, op.Offset)
+
+	var trs []Transaction
+	err := m.db.NewRaw("SELECT transactions.* FROM transactions"+
+		" JOIN (SELECT id AS match_id, "+searchRank+" AS score"+
+		" FROM transactions_fts WHERE transactions_fts MATCH ?) AS matches"+
+		" ON matches.match_id = transactions.id"+
+		where+
+		" ORDER BY matches.score, date DESC LIMIT ? OFFSET ?", args...).
+		Scan(context.TODO(), &trs)
+	return trs, err
+}
+
+// Turn free text into an FTS5 query that requires every word as a
+// prefix. Each word is quoted so that words like OR and NOT, or a
+// leading '-', are searched for instead of parsed as FTS5 syntax
+func searchMatch(terms string) string {
+	words := strings.FieldsFunc(terms, func(r rune) bool {
+		return unicode.IsSpace(r) || r == '"' || r == '*'
+	})
+	for i, word := range words {
+		words[i] = `"` + word + `"*`
+	}
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,90 @@
+package omoney
+
+import (
+	"testing"
+	"time"
+)
+
+func searchPayees(t *testing.T, m *Model, terms string) []string {
+	trs, err := m.SearchTransactions(terms, GetTransactionsOptions{Count: 10})
+	if err != nil {
+		t.Fatalf("Search %q failed: %s", terms, err)
+	}
+	payees := make([]string, len(trs))
+	for i, tr := range trs {
+		payees[i] = tr.Payee
+	}
+	return payees
+}
+
+func TestSearchTransactions(t *testing.T) {
+	m := &Model{db: CreateEmptyDB()}
+	addQueryTransactions(m)
+	acc1, _ := m.GetAccount("acc1")
+
+	// a payee match outranks a match in the description
+	gift := NewTransaction(acc1.Id, "Target", 30,
+		WithDate(time.Date(2024, 03, 01, 12, 0, 0, 0, time.Local)),
+		WithDescription("amazon gift card"))
+	m.AddTransaction(gift)
+
+	tests := []struct {
+		terms string
+		want  []string
+	}{
+		{"amazon prime", []string{"Amazon Prime"}},
+		{"amaz", []string{"Amazon Prime", "AMAZON MKTPLACE", "Target"}},
+		{"coupon", []string{"50%_off"}},
+		{"gift OR", []string{}},
+		{"  ", []string{}},
+	}
+
+	for _, test := range tests {
+		have := searchPayees(t, m, test.terms)
+		if len(have) != len(test.want) {
+			t.Fatalf("Search %q failed"+
+				"\nhave: %v"+
+				"\nneed: %v",
+				test.terms, have, test.want)
+		}
+		for i := range have {
+			if have[i] != test.want[i] {
+				t.Fatalf("Search %q failed"+
+					"\nhave: %v"+
+					"\nneed: %v",
+					test.terms, have, test.want)
+			}
+		}
+	}
+}
+
+func TestSearchIndexFollowsChanges(t *testing.T) {
+	m := &Model{db: CreateEmptyDB()}
+	addQueryTransactions(m)
+	acc0, _ := m.GetAccount("acc0")
+	tr := NewTransaction(acc0.Id, "Spotify", 9.99)
+	m.AddTransaction(tr)
+
+	if have := searchPayees(t, m, "spotify"); len(have) != 1 {
+		t.Fatalf("Inserted transaction not found: %v", have)
+	}
+
+	m.UpdateTransaction(tr.Id, WithPayeeUpdate("Hulu"))
+	if have := searchPayees(t, m, "spotify"); len(have) != 0 {
+		t.Fatalf("Old payee still found after update: %v", have)
+	}
+	if have := searchPayees(t, m, "hulu"); len(have) != 1 {
+		t.Fatalf("Updated payee not found: %v", have)
+	}
+
+	m.RemoveTransactionById(tr.Id)
+	if have := searchPayees(t, m, "hulu"); len(have) != 0 {
+		t.Fatalf("Removed transaction still found: %v", have)
+	}
+
+	// undoing the removal puts it back in the index
+	m.Undo(1)
+	if have := searchPayees(t, m, "hulu"); len(have) != 1 {
+		t.Fatalf("Restored transaction not found: %v", have)
+	}
+}
@@ -0,0 +1,396 @@
+package omoney
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/uptrace/bun"
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	// Prefix marking a stored value as encrypted, so that values
+	// from before encryption existed can be told apart
+	encryptedPrefix = "enc:v1:"
+	// Known plaintext encrypted with the key, used to check that
+	// a passphrase is correct before using it
+	secretCheck = "oregano"
+)
+
+var (
+	ErrSecretsLocked   = errors.New("secrets are locked")
+	ErrWrongPassphrase = errors.New("passphrase or key file does not match")
+)
+
+// Parameters needed to derive the key that secrets are encrypted with.
+// There is only ever one row in this table
+type SecretParams struct {
+	Id int `bun:",pk"`
+	// Random salt fed to the key derivation, base64 encoded
+	Salt string
+	// secretCheck encrypted with the derived key
+	Verifier string
+}
+
+// The key that secrets are encrypted with, once the model is unlocked
+type secretKey struct {
+	key []byte
+	// Called with the model needing the key to unlock it, the first
+	// time the key is needed while it is locked, if set
+	unlock func(m *Model) error
+}
+
+func (m *Model) secretKey() *secretKey {
+	if m.secrets == nil {
+		m.secrets = &secretKey{}
+	}
+	return m.secrets
+}
+
+// Have unlock called the first time a secret needs to be encrypted or
+// decrypted while the model is locked, so that the passphrase is only
+// asked for when it is needed. unlock is given the model needing the
+// key, which may be a copy handed out by RunInTx, and is expected to call
+// its Unlock or InitSecrets. If it fails it is tried again the next time
+func (m *Model) UnlockWhenNeeded(unlock func(m *Model) error) {
+	m.secretKey().unlock = unlock
+}
+
+// The key secrets are encrypted with, unlocking the model first if
+// UnlockWhenNeeded was given a way to
+func (m *Model) getKey() ([]byte, error) {
+	s := m.secretKey()
+	if s.key == nil && s.unlock != nil {
+		err := s.unlock(m)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if s.key == nil {
+		return nil, ErrSecretsLocked
+	}
+	return s.key, nil
+}
+
+// Whether a passphrase or key file has been set up to encrypt secrets
+func (m *Model) SecretsInitialized() bool {
+	exists, _ := m.db.NewSelect().
+		Model((*SecretParams)(nil)).
+		Exists(context.TODO())
+	return exists
+}
+
+// Whether the key for secrets has been provided this session
+func (m *Model) IsUnlocked() bool {
+	return m.secretKey().key != nil
+}
+
+// Whether any account still has a Plaid token stored without encryption
+func (m *Model) HasPlaintextSecrets() bool {
+	exists, _ := m.db.NewSelect().
+		Model((*Account)(nil)).
+		Where("plaid_token != ''").
+		Where("plaid_token NOT LIKE ?", encryptedPrefix+"%").
+		Exists(context.TODO())
+	return exists
+}
+
+// Set up encryption using a key derived from material (a passphrase or
+// the contents of a key file), then encrypt any secrets already stored
+// in plaintext
+func (m *Model) InitSecrets(material []byte) error {
+	if m.SecretsInitialized() {
+		return errors.New("secrets are already set up, use rekey to change the key")
+	}
+
+	var key []byte
+	err := m.RunInTx(func(tx *Model) error {
+		var params *SecretParams
+		var err error
+		params, key, err = newSecretParams(material)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.db.NewInsert().
+			Model(params).
+			Exec(context.TODO())
+		if err != nil {
+			return err
+		}
+
+		return tx.reencryptSecrets(nil, key)
+	})
+	if err != nil {
+		return err
+	}
+
+	m.secretKey().key = key
+	return nil
+}
+
+// Derive the key from material and check it against the stored check
+// value, keeping it for the rest of the session if it matches
+func (m *Model) Unlock(material []byte) error {
+	params := &SecretParams{}
+	err := m.db.NewSelect().
+		Model(params).
+		Limit(1).
+		Scan(context.TODO())
+	if err != nil {
+		return err
+	}
+
+	salt, err := base64.StdEncoding.DecodeString(params.Salt)
+	if err != nil {
+		return err
+	}
+
+	key := deriveKey(material, salt)
+	check, err := decrypt(key, params.Verifier)
+	if err != nil || subtle.ConstantTimeCompare([]byte(check), []byte(secretCheck)) != 1 {
+		return ErrWrongPassphrase
+	}
+
+	m.secretKey().key = key
+	return nil
+}
+
+// Re-encrypt every stored secret with a key derived from newMaterial.
+// The model must already be unlocked with the current key
+func (m *Model) Rekey(newMaterial []byte) error {
+	oldKey, err := m.getKey()
+	if err != nil {
+		return err
+	}
+
+	var key []byte
+	err = m.RunInTx(func(tx *Model) error {
+		var params *SecretParams
+		var err error
+		params, key, err = newSecretParams(newMaterial)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.db.NewUpdate().
+			Model(params).
+			Column("salt", "verifier").
+			WherePK().
+			Exec(context.TODO())
+		if err != nil {
+			return err
+		}
+
+		return tx.reencryptSecrets(oldKey, key)
+	})
+	if err != nil {
+		return err
+	}
+
+	m.secretKey().key = key
+	return nil
+}
+
+// Encrypt a secret for storage. Empty secrets are stored as is
+func (m *Model) EncryptSecret(plain string) (string, error) {
+	if plain == "" {
+		return "", nil
+	}
+	key, err := m.getKey()
+	if err != nil {
+		return "", err
+	}
+	return encrypt(key, plain)
+}
+
+// Decrypt a secret as it was stored. Secrets stored before encryption
+// was set up are returned unchanged
+func (m *Model) DecryptSecret(stored string) (string, error) {
+	if !strings.HasPrefix(stored, encryptedPrefix) {
+		return stored, nil
+	}
+	key, err := m.getKey()
+	if err != nil {
+		return "", err
+	}
+	return decrypt(key, stored)
+}
+
+// Swap every Plaid token over from oldKey to newKey, including the copies
+// held in the undo journal. A nil oldKey means tokens are in plaintext
+func (m *Model) reencryptSecrets(oldKey []byte, newKey []byte) error {
+	var accs []Account
+	err := m.db.NewSelect().
+		Model(&accs).
+		Where("plaid_token != ''").
+		Scan(context.TODO())
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	for _, acc := range accs {
+		token, err := reencrypt(acc.PlaidToken, oldKey, newKey)
+		if err != nil {
+			return err
+		}
+
+		_, err = m.db.NewUpdate().
+			Model((*Account)(nil)).
+			Set("plaid_token = ?", token).
+			Where("id = ?", acc.Id).
+			Exec(context.TODO())
+		if err != nil {
+			return err
+		}
+	}
+
+	var ops []Operation
+	err = m.db.NewSelect().
+		Model(&ops).
+		Where("kind IN (?)", bun.In(accountOpKinds)).
+		Scan(context.TODO())
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	for _, op := range ops {
+		op.Before, err = reencryptState(op.Before, oldKey, newKey)
+		if err != nil {
+			return err
+		}
+		op.After, err = reencryptState(op.After, oldKey, newKey)
+		if err != nil {
+			return err
+		}
+
+		_, err = m.db.NewUpdate().
+			Model(&op).
+			Column("before", "after").
+			WherePK().
+			Exec(context.TODO())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func reencryptState(state string, oldKey []byte, newKey []byte) (string, error) {
+	if state == "" {
+		return "", nil
+	}
+
+	var acc Account
+	err := json.Unmarshal([]byte(state), &acc)
+	if err != nil {
+		return "", err
+	}
+	if acc.PlaidToken == "" {
+		return state, nil
+	}
+
+	acc.PlaidToken, err = reencrypt(acc.PlaidToken, oldKey, newKey)
+	if err != nil {
+		return "", err
+	}
+	return encodeState(&acc)
+}
+
+func reencrypt(stored string, oldKey []byte, newKey []byte) (string, error) {
+	plain := stored
+	if strings.HasPrefix(stored, encryptedPrefix) {
+		if oldKey == nil {
+			return "", errors.New("found secret encrypted with an unknown key")
+		}
+		var err error
+		plain, err = decrypt(oldKey, stored)
+		if err != nil {
+			return "", err
+		}
+	}
+	return encrypt(newKey, plain)
+}
+
+func newSecretParams(material []byte) (*SecretParams, []byte, error) {
+	if len(material) == 0 {
+		return nil, nil, errors.New("passphrase or key file must not be empty")
+	}
+
+	salt := make([]byte, 16)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key := deriveKey(material, salt)
+	check, err := encrypt(key, secretCheck)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &SecretParams{
+		Id:       1,
+		Salt:     base64.StdEncoding.EncodeToString(salt),
+		Verifier: check,
+	}, key, nil
+}
+
+func deriveKey(material []byte, salt []byte) []byte {
+	return argon2.IDKey(material, salt, 1, 64*1024, 4, 32)
+}
+
+// AES-256-GCM, stored as the prefix followed by base64(nonce | ciphertext)
+func encrypt(key []byte, plain string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(plain), nil)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func decrypt(key []byte, stored string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(stored, encryptedPrefix))
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("encrypted secret is too short")
+	}
+
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", ErrWrongPassphrase
+	}
+	return string(plain), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,139 @@
+package omoney
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestInitSecretsEncryptsPlaintextTokens(t *testing.T) {
+	m := &Model{db: CreateEmptyDB()}
+
+	// stored before encryption existed
+	acc := NewAccount(WithAlias("bank"), WithPlaidIds("item1", "access-sandbox-1234"))
+	_, err := m.db.NewInsert().Model(acc).Exec(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.HasPlaintextSecrets() {
+		t.Fatal("Plaintext token not detected")
+	}
+
+	err = m.InitSecrets([]byte("hunter2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.HasPlaintextSecrets() {
+		t.Fatal("InitSecrets left a plaintext token")
+	}
+
+	stored, _ := m.GetAccount("bank")
+	if !strings.HasPrefix(stored.PlaidToken, encryptedPrefix) {
+		t.Fatalf("Token not encrypted at rest: %s", stored.PlaidToken)
+	}
+
+	token, err := m.GetAccessToken("bank")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "access-sandbox-1234" {
+		t.Fatalf("GetAccessToken failed"+
+			"\nhave: %s"+
+			"\nneed: %s",
+			token, "access-sandbox-1234")
+	}
+}
+
+func TestUnlockChecksPassphrase(t *testing.T) {
+	db := CreateEmptyDB()
+	m := &Model{db: db}
+	m.InitSecrets([]byte("hunter2"))
+	m.AddAccount(*NewAccount(WithAlias("bank"), WithPlaidIds("item1", "access-sandbox-1234")))
+
+	// a fresh session starts out locked
+	m = &Model{db: db}
+	if _, err := m.GetAccessToken("bank"); err != ErrSecretsLocked {
+		t.Fatalf("Locked model returned token, err: %v", err)
+	}
+
+	if err := m.Unlock([]byte("wrong")); err != ErrWrongPassphrase {
+		t.Fatalf("Unlock with wrong passphrase failed, err: %v", err)
+	}
+
+	if err := m.Unlock([]byte("hunter2")); err != nil {
+		t.Fatal(err)
+	}
+	if token, _ := m.GetAccessToken("bank"); token != "access-sandbox-1234" {
+		t.Fatalf("GetAccessToken after unlock failed: %s", token)
+	}
+}
+
+func TestUnlockWhenNeeded(t *testing.T) {
+	db := CreateEmptyDB()
+	m := &Model{db: db}
+	m.InitSecrets([]byte("hunter2"))
+	m.AddAccount(*NewAccount(WithAlias("bank"), WithPlaidIds("item1", "access-sandbox-1234")))
+
+	m = &Model{db: db}
+	asked := 0
+	m.UnlockWhenNeeded(func(m *Model) error {
+		asked++
+		return m.Unlock([]byte("hunter2"))
+	})
+	if asked != 0 {
+		t.Fatal("UnlockWhenNeeded asked before a secret was needed")
+	}
+
+	// unlocking inside a transaction unlocks the model it came from
+	err := m.RunInTx(func(tx *Model) error {
+		_, err := tx.GetAccessToken("bank")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := m.GetAccessToken("bank")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "access-sandbox-1234" || asked != 1 {
+		t.Fatalf("UnlockWhenNeeded failed"+
+			"\nhave: %s, asked %d times"+
+			"\nneed: %s, asked %d times",
+			token, asked, "access-sandbox-1234", 1)
+	}
+}
+
+func TestRekey(t *testing.T) {
+	db := CreateEmptyDB()
+	m := &Model{db: db}
+	m.InitSecrets([]byte("hunter2"))
+	m.AddAccount(*NewAccount(WithAlias("bank"), WithPlaidIds("item1", "access-sandbox-1234")))
+	m.RemoveAccount("bank", false)
+
+	err := m.Rekey([]byte("correct horse"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m = &Model{db: db}
+	if err := m.Unlock([]byte("hunter2")); err != ErrWrongPassphrase {
+		t.Fatal("Old passphrase still unlocks after rekey")
+	}
+	if err := m.Unlock([]byte("correct horse")); err != nil {
+		t.Fatal(err)
+	}
+
+	// the copy of the token in the journal must follow the new key
+	m.Undo(1)
+	token, err := m.GetAccessToken("bank")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "access-sandbox-1234" {
+		t.Fatalf("Token after rekey and undo failed"+
+			"\nhave: %s"+
+			"\nneed: %s",
+			token, "access-sandbox-1234")
+	}
+}
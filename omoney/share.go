@@ -0,0 +1,414 @@
+package omoney
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// The category given to transactions that settle up with someone
+const SettlementCategory = "settlement"
+
+// Someone, such as a roommate or partner, that purchases are split with
+type Person struct {
+	Id   int64  `bun:",pk,autoincrement"`
+	Name string `bun:",unique"`
+}
+
+// The part of a transaction that is someone else's. A share has the same
+// sign as its transaction, so a share of a purchase is owed by the person
+// and a share of a deposit from them pays it back. Like attachments,
+// shares are kept when their transaction is removed, so that undoing the
+// removal brings them back, but only count while it exists
+type Share struct {
+	Id            int64  `bun:",pk,autoincrement"`
+	TransactionId string `bun:",unique:transaction_person"`
+	PersonId      int64  `bun:",unique:transaction_person"`
+	Amount        float64
+}
+
+// How much someone owes, over every transaction shared with them
+type PersonBalance struct {
+	Person Person
+	// Positive when they owe you, negative when you owe them
+	Owed float64
+}
+
+// A transaction shared with someone, and how much of it is theirs
+type SharedTransaction struct {
+	Transaction Transaction
+	Share       float64
+}
+
+func (m *Model) AddPerson(name string) (*Person, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || strings.ContainsAny(name, "= \t") {
+		return nil, fmt.Errorf("invalid name '%s', names can't be empty or contain spaces or '='", name)
+	}
+	if _, err := m.GetPerson(name); err == nil {
+		return nil, fmt.Errorf("%s already exists", name)
+	}
+
+	person := &Person{Name: name}
+	_, err := m.db.NewInsert().
+		Model(person).
+		Exec(context.TODO())
+	return person, err
+}
+
+// Remove someone along with their shares. Fails while they owe or are
+// owed anything, to avoid losing track of a debt
+func (m *Model) RemovePerson(name string) error {
+	person, err := m.GetPerson(name)
+	if err != nil {
+		return err
+	}
+	owed, err := m.personOwed(person.Id)
+	if err != nil {
+		return err
+	}
+	if !isZero(owed) {
+		return fmt.Errorf("%s still has a balance of $%.2f, settle up first", person.Name, owed)
+	}
+
+	return m.RunInTx(func(tx *Model) error {
+		_, err := tx.db.NewDelete().
+			Model((*Share)(nil)).
+			Where("person_id = ?", person.Id).
+			Exec(context.TODO())
+		if err != nil {
+			return err
+		}
+		_, err = tx.db.NewDelete().
+			Model((*Person)(nil)).
+			Where("id = ?", person.Id).
+			Exec(context.TODO())
+		return err
+	})
+}
+
+func (m *Model) GetPerson(name string) (Person, error) {
+	var person Person
+	err := m.db.NewSelect().
+		Model(&person).
+		Where("name = ?", name).
+		Limit(1).
+		Scan(context.TODO())
+	if err != nil {
+		return person, fmt.Errorf("no person named %s", name)
+	}
+	return person, nil
+}
+
+func (m *Model) GetPeople() ([]Person, error) {
+	people := make([]Person, 0)
+	err := m.db.NewSelect().
+		Model(&people).
+		Order("name").
+		Scan(context.TODO())
+	return people, err
+}
+
+// Amounts closer to zero than this are treated as settled
+func isZero(amount float64) bool {
+	return math.Abs(amount) < 0.005
+}
+
+// Set how much of the transaction with id trId is owed by the person
+// named name, replacing any share they already had. A share of zero
+// removes it. Shares must have the same sign as the transaction, and
+// together can't be more than all of it
+func (m *Model) SetShare(trId string, name string, amount float64) error {
+	tr, err := m.GetTransactionById(trId)
+	if err != nil {
+		return err
+	}
+	person, err := m.GetPerson(name)
+	if err != nil {
+		return err
+	}
+
+	var before *Share
+	existing := &Share{}
+	err = m.db.NewSelect().
+		Model(existing).
+		Where("transaction_id = ?", tr.Id).
+		Where("person_id = ?", person.Id).
+		Limit(1).
+		Scan(context.TODO())
+	if err == nil {
+		before = existing
+	} else if err != sql.ErrNoRows {
+		return err
+	}
+
+	if isZero(amount) {
+		if before == nil {
+			return nil
+		}
+		return m.RunInTx(func(tx *Model) error {
+			_, err := tx.db.NewDelete().
+				Model((*Share)(nil)).
+				Where("id = ?", before.Id).
+				Exec(context.TODO())
+			if err != nil {
+				return err
+			}
+			return tx.record(OpSetShare, intTarget(before.Id), before, nil)
+		})
+	}
+	if (amount > 0) != (tr.Amount > 0) {
+		return fmt.Errorf("share of $%.2f must have the same sign as the transaction's $%.2f", amount, tr.Amount)
+	}
+
+	others := 0.0
+	err = m.db.NewRaw(
+		"SELECT coalesce(sum(amount), 0.0) FROM shares WHERE transaction_id = ? AND person_id != ?",
+		tr.Id, person.Id,
+	).Scan(context.TODO(), &others)
+	if err != nil {
+		return err
+	}
+	if math.Abs(others+amount) > math.Abs(tr.Amount)+0.005 {
+		return fmt.Errorf("shares of $%.2f are more than the transaction's $%.2f", others+amount, tr.Amount)
+	}
+
+	return m.RunInTx(func(tx *Model) error {
+		if before != nil {
+			after := *before
+			after.Amount = amount
+			_, err := tx.db.NewUpdate().
+				Model((*Share)(nil)).
+				Set("amount = ?", amount).
+				Where("id = ?", before.Id).
+				Exec(context.TODO())
+			if err != nil {
+				return err
+			}
+			return tx.record(OpSetShare, intTarget(before.Id), before, &after)
+		}
+
+		share := &Share{TransactionId: tr.Id, PersonId: person.Id, Amount: amount}
+		_, err := tx.db.NewInsert().
+			Model(share).
+			Exec(context.TODO())
+		if err != nil {
+			return err
+		}
+		return tx.record(OpSetShare, intTarget(share.Id), nil, share)
+	})
+}
+
+// The journal refers to rows with numeric ids, such as shares, by
+// their id as a string
+func intTarget(id int64) string {
+	return strconv.FormatInt(id, 10)
+}
+
+// Move every share of the transaction with id fromId over to the one
+// with id toId, such as when a pending transaction posts
+func (m *Model) moveShares(fromId string, toId string) error {
+	var shares []Share
+	err := m.db.NewSelect().
+		Model(&shares).
+		Where("transaction_id = ?", fromId).
+		Order("id").
+		Scan(context.TODO())
+	if err != nil {
+		return err
+	}
+
+	for _, before := range shares {
+		after := before
+		after.TransactionId = toId
+		_, err = m.db.NewUpdate().
+			Model((*Share)(nil)).
+			Set("transaction_id = ?", toId).
+			Where("id = ?", before.Id).
+			Exec(context.TODO())
+		if err != nil {
+			return err
+		}
+		err = m.record(OpSetShare, intTarget(before.Id), &before, &after)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Set several people's shares of the transaction with id trId at once,
+// as with SetShare, changing none of them if any can't be set. Undo
+// treats them as one change
+func (m *Model) SetShares(trId string, shares map[string]float64) error {
+	names := make([]string, 0, len(shares))
+	for name := range shares {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return m.RunInBatch(func(tx *Model) error {
+		// clear the old shares first, so that only the new ones
+		// count against the transaction's total
+		for _, name := range names {
+			err := tx.SetShare(trId, name, 0)
+			if err != nil {
+				return err
+			}
+		}
+		for _, name := range names {
+			err := tx.SetShare(trId, name, shares[name])
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Every share of the transaction with id trId, by the name of who owes it
+func (m *Model) GetShares(trId string) (map[string]float64, error) {
+	var rows []struct {
+		Name   string
+		Amount float64
+	}
+	err := m.db.NewRaw(
+		"SELECT p.name, s.amount FROM shares AS s JOIN people AS p ON p.id = s.person_id WHERE s.transaction_id = ?",
+		trId,
+	).Scan(context.TODO(), &rows)
+	if err != nil {
+		return nil, err
+	}
+	shares := make(map[string]float64, len(rows))
+	for _, row := range rows {
+		shares[row.Name] = row.Amount
+	}
+	return shares, nil
+}
+
+// The sum of a person's shares of transactions that still exist
+func (m *Model) personOwed(personId int64) (float64, error) {
+	owed := 0.0
+	err := m.db.NewRaw(
+		"SELECT coalesce(sum(s.amount), 0.0) FROM shares AS s JOIN transactions AS t ON t.id = s.transaction_id WHERE s.person_id = ?",
+		personId,
+	).Scan(context.TODO(), &owed)
+	return owed, err
+}
+
+// What everyone owes or is owed, most owed first
+func (m *Model) GetPersonBalances() ([]PersonBalance, error) {
+	people, err := m.GetPeople()
+	if err != nil {
+		return nil, err
+	}
+	balances := make([]PersonBalance, len(people))
+	for i, person := range people {
+		owed, err := m.personOwed(person.Id)
+		if err != nil {
+			return nil, err
+		}
+		balances[i] = PersonBalance{person, owed}
+	}
+	sort.SliceStable(balances, func(i, j int) bool {
+		return balances[i].Owed > balances[j].Owed
+	})
+	return balances, nil
+}
+
+// Every transaction shared with the person named name, newest first
+func (m *Model) GetSharedTransactions(name string) ([]SharedTransaction, error) {
+	person, err := m.GetPerson(name)
+	if err != nil {
+		return nil, err
+	}
+	var shares []Share
+	err = m.db.NewSelect().
+		Model(&shares).
+		Where("person_id = ?", person.Id).
+		Scan(context.TODO())
+	if err != nil {
+		return nil, err
+	}
+	if len(shares) == 0 {
+		return []SharedTransaction{}, nil
+	}
+
+	ids := make([]string, len(shares))
+	for i, s := range shares {
+		ids[i] = s.TransactionId
+	}
+	var trs []Transaction
+	err = m.db.NewSelect().
+		Model(&trs).
+		Where("id IN (?)", bun.In(ids)).
+		Order("date DESC", "id").
+		Scan(context.TODO())
+	if err != nil {
+		return nil, err
+	}
+
+	amounts := make(map[string]float64, len(shares))
+	for _, s := range shares {
+		amounts[s.TransactionId] = s.Amount
+	}
+	shared := make([]SharedTransaction, len(trs))
+	for i, tr := range trs {
+		shared[i] = SharedTransaction{tr, amounts[tr.Id]}
+	}
+	return shared, nil
+}
+
+// Record a payment in the account with alias or id account that settles
+// amount of what is owed between you and the person named name, or all
+// of it if amount is zero. The payment comes in when they owe you and
+// goes out when you owe them
+func (m *Model) Settle(name string, account string, amount float64, date time.Time) (*Transaction, error) {
+	person, err := m.GetPerson(name)
+	if err != nil {
+		return nil, err
+	}
+	acc, err := m.GetAccount(account)
+	if err != nil {
+		return nil, err
+	}
+	owed, err := m.personOwed(person.Id)
+	if err != nil {
+		return nil, err
+	}
+	if isZero(owed) {
+		return nil, fmt.Errorf("%s is already settled up", person.Name)
+	}
+	if amount < 0 {
+		return nil, errors.New("amount to settle must be more than 0")
+	}
+	if amount == 0 {
+		amount = math.Abs(owed)
+	}
+	if owed > 0 {
+		amount = -amount
+	}
+
+	tr := NewTransaction(acc.Id, person.Name, amount,
+		WithDate(date),
+		WithCategory(SettlementCategory),
+		WithDescription("Settle up with "+person.Name))
+	err = m.RunInBatch(func(tx *Model) error {
+		err := tx.AddTransaction(tr)
+		if err != nil {
+			return err
+		}
+		return tx.SetShare(tr.Id, person.Name, tr.Amount)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tr, nil
+}
@@ -0,0 +1,151 @@
+package omoney
+
+import (
+	"testing"
+)
+
+func TestSharesAndSettle(t *testing.T) {
+	m := &Model{db: CreateEmptyDB()}
+	card := addCard(t, m)
+	for _, name := range []string{"alex", "sam"} {
+		if _, err := m.AddPerson(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := m.AddPerson("alex"); err == nil {
+		t.Fatal("Adding the same person twice should fail")
+	}
+
+	groceries := NewTransaction(card.Id, "Market", 90, WithDate(day(2024, 1, 5)))
+	dinner := NewTransaction(card.Id, "Diner", 60, WithDate(day(2024, 1, 6)))
+	for _, tr := range []*Transaction{groceries, dinner} {
+		if err := m.AddTransaction(tr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, s := range []struct {
+		tr     *Transaction
+		name   string
+		amount float64
+	}{
+		{groceries, "alex", 30},
+		{groceries, "sam", 30},
+		{dinner, "alex", 20},
+		// replaces the share before it
+		{dinner, "alex", 30},
+	} {
+		if err := m.SetShare(s.tr.Id, s.name, s.amount); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.SetShare(groceries.Id, "alex", 70); err == nil {
+		t.Fatal("Shares adding up to more than the transaction should fail")
+	}
+	if err := m.SetShare(groceries.Id, "alex", -10); err == nil {
+		t.Fatal("A share with the opposite sign of the transaction should fail")
+	}
+
+	balances, err := m.GetPersonBalances()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(balances) != 2 || balances[0].Person.Name != "alex" || balances[0].Owed != 60 || balances[1].Owed != 30 {
+		t.Fatalf("GetPersonBalances failed\nhave: %+v\nneed: alex owes 60, sam owes 30", balances)
+	}
+
+	if err := m.RemovePerson("alex"); err == nil {
+		t.Fatal("Removing someone who still owes should fail")
+	}
+
+	tr, err := m.Settle("alex", "visa", 0, day(2024, 1, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tr.Amount != -60 || tr.Category != SettlementCategory {
+		t.Fatalf("Settle failed\nhave: %+v\nneed: $60 coming in", tr)
+	}
+	shared, err := m.GetSharedTransactions("alex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shared) != 3 || shared[0].Transaction.Id != tr.Id || shared[0].Share != -60 {
+		t.Fatalf("GetSharedTransactions failed\nhave: %+v", shared)
+	}
+	if _, err := m.Settle("alex", "visa", 0, day(2024, 1, 11)); err == nil {
+		t.Fatal("Settling when already settled should fail")
+	}
+
+	// removing a shared transaction stops it counting, so alex
+	// has now paid back $30 too much
+	if err := m.RemoveTransactionById(groceries.Id); err != nil {
+		t.Fatal(err)
+	}
+	balances, _ = m.GetPersonBalances()
+	if balances[0].Person.Name != "sam" || balances[0].Owed != 0 || balances[1].Owed != -30 {
+		t.Fatalf("GetPersonBalances failed\nhave: %+v\nneed: sam owes 0, alex is owed 30", balances)
+	}
+	if err := m.RemovePerson("sam"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSharesFollowPosted(t *testing.T) {
+	m := &Model{db: CreateEmptyDB()}
+	card := addCard(t, m)
+	m.AddPerson("alex")
+
+	pending := NewTransaction(card.Id, "Diner", 40, WithDate(day(2024, 1, 5)), WithStatus(Pending))
+	m.AddTransaction(pending)
+	if err := m.SetShare(pending.Id, "alex", 20); err != nil {
+		t.Fatal(err)
+	}
+	posted := NewTransaction(card.Id, "Diner", 40, WithDate(day(2024, 1, 6)))
+	m.AddSyncedTransaction(posted)
+
+	shares, err := m.GetShares(posted.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shares["alex"] != 20 {
+		t.Fatalf("Shares following posted failed\nhave: %v\nneed: alex owes 20", shares)
+	}
+
+	// undoing the posted transaction hands the share back
+	if _, err = m.Undo(1); err != nil {
+		t.Fatal(err)
+	}
+	shares, _ = m.GetShares(pending.Id)
+	if shares["alex"] != 20 {
+		t.Fatalf("Undoing posted failed\nhave: %v\nneed: alex owes 20 of pending", shares)
+	}
+}
+
+func TestUndoSetShare(t *testing.T) {
+	m := &Model{db: CreateEmptyDB()}
+	card := addCard(t, m)
+	m.AddPerson("alex")
+	tr := NewTransaction(card.Id, "Diner", 40)
+	m.AddTransaction(tr)
+
+	m.SetShare(tr.Id, "alex", 20)
+	m.SetShare(tr.Id, "alex", 10)
+	m.SetShare(tr.Id, "alex", 0)
+
+	need := []float64{10, 20, 0}
+	for _, owed := range need {
+		if _, err := m.Undo(1); err != nil {
+			t.Fatal(err)
+		}
+		shares, _ := m.GetShares(tr.Id)
+		if shares["alex"] != owed {
+			t.Fatalf("Undo set share failed\nhave: %v\nneed: alex owes %.2f", shares, owed)
+		}
+	}
+
+	if _, err := m.Redo(3); err != nil {
+		t.Fatal(err)
+	}
+	if shares, _ := m.GetShares(tr.Id); len(shares) != 0 {
+		t.Fatalf("Redo set share failed\nhave: %v\nneed: no shares", shares)
+	}
+}
@@ -0,0 +1,263 @@
+package omoney
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// The minimum payment of a statement is the greater of these, but
+// never more than the statement balance
+const (
+	minPaymentFloor = 25.0
+	minPaymentRate  = 0.02
+)
+
+// How many days before a payment is due to start warning about it
+const dueSoonDays = 5
+
+// One billing cycle of a credit card, from the day after the last
+// statement closed through the day this one closed. Pending
+// transactions are left out until they post
+type Statement struct {
+	AccountId string
+	Alias     string
+	// First and last day of the cycle
+	Opening time.Time
+	Closing time.Time
+	// When the payment for this statement is due
+	Due time.Time
+	// What was owed when the last statement closed
+	PreviousBalance float64
+	// Purchases, fees, and interest added during the cycle
+	Charges float64
+	// Payments and credits during the cycle, as a positive amount
+	Credits float64
+	// What is owed as of the closing day
+	Balance    float64
+	MinPayment float64
+	// Payments made after closing, through the due date
+	Paid float64
+	// Whether the cycle is still going, so nothing is due yet
+	Open         bool
+	Transactions []Transaction
+}
+
+// Whether a statement's payment is in
+type StatementStatus string
+
+const (
+	StatementOpen       StatementStatus = "open"
+	StatementNothingDue StatementStatus = "nothing due"
+	StatementPaid       StatementStatus = "paid"
+	StatementMinPaid    StatementStatus = "minimum paid"
+	StatementDue        StatementStatus = "due"
+	StatementLate       StatementStatus = "late"
+)
+
+func (s Statement) Status(now time.Time) StatementStatus {
+	switch {
+	case s.Open:
+		return StatementOpen
+	case s.Balance <= loanEpsilon:
+		return StatementNothingDue
+	case s.Paid >= s.Balance-loanEpsilon:
+		return StatementPaid
+	case s.Paid >= s.MinPayment-loanEpsilon:
+		return StatementMinPaid
+	case now.Before(s.Due.AddDate(0, 0, 1)):
+		return StatementDue
+	default:
+		return StatementLate
+	}
+}
+
+// Whether the minimum payment is due within a few days, or overdue,
+// without having been paid
+func (s Statement) NeedsPayment(now time.Time) bool {
+	status := s.Status(now)
+	return status == StatementLate ||
+		(status == StatementDue && !now.Before(s.Due.AddDate(0, 0, -dueSoonDays)))
+}
+
+func minimumPayment(balance float64) float64 {
+	if balance <= 0 {
+		return 0
+	}
+	return math.Min(balance, math.Max(minPaymentFloor, balance*minPaymentRate))
+}
+
+// Set the day of the month statements close and the day payments are
+// due on the credit card with alias or id account. A due day before
+// or on the closing day is in the month after the statement closes
+func (m *Model) SetStatementDays(account string, closingDay int, dueDay int) error {
+	if closingDay < 1 || closingDay > 28 || dueDay < 1 || dueDay > 28 {
+		return errors.New("closing and due days must be from 1 to 28")
+	}
+
+	return m.RunInTx(func(tx *Model) error {
+		before, err := tx.GetAccount(account)
+		if err != nil {
+			return err
+		}
+		if before.Type != CreditCard {
+			return fmt.Errorf("%s is a %s account, not a credit card", account, before.Type)
+		}
+
+		after := before
+		after.StatementDay = closingDay
+		after.DueDay = dueDay
+		_, err = tx.db.NewUpdate().
+			Model(&after).
+			Column("statement_day", "due_day").
+			WherePK().
+			Exec(context.TODO())
+		if err != nil {
+			return err
+		}
+		return tx.record(OpSetStatementDays, before.Id, &before, &after)
+	})
+}
+
+// The day the statement closing on or before t closed
+func lastClosing(acc Account, t time.Time) time.Time {
+	closing := time.Date(t.Year(), t.Month(), acc.StatementDay, 0, 0, 0, 0, t.Location())
+	if closing.After(t) {
+		closing = closing.AddDate(0, -1, 0)
+	}
+	return closing
+}
+
+// When the payment for the statement closing on closing is due
+func dueDate(acc Account, closing time.Time) time.Time {
+	due := time.Date(closing.Year(), closing.Month(), acc.DueDay, 0, 0, 0, 0, closing.Location())
+	if acc.DueDay <= acc.StatementDay {
+		due = due.AddDate(0, 1, 0)
+	}
+	return due
+}
+
+// The balance of an account from every transaction dated before t,
+// working forwards or backwards from its anchor
+func (m *Model) balanceBefore(acc Account, t time.Time) (float64, error) {
+	sum := 0.0
+	var err error
+	if t.After(acc.AnchorTime) {
+		err = m.db.NewRaw(
+			"SELECT coalesce(sum(amount), 0.0) FROM transactions WHERE account_id = ? AND status != ? AND date > ? AND date < ?",
+			acc.Id, Pending, dbTime(acc.AnchorTime), dbTime(t),
+		).Scan(context.TODO(), &sum)
+	} else {
+		err = m.db.NewRaw(
+			"SELECT -coalesce(sum(amount), 0.0) FROM transactions WHERE account_id = ? AND status != ? AND date >= ? AND date <= ?",
+			acc.Id, Pending, dbTime(t), dbTime(acc.AnchorTime),
+		).Scan(context.TODO(), &sum)
+	}
+	return acc.AnchorBalance + sum, err
+}
+
+// The last count statements of the credit card with alias or id
+// account as of now, newest first. The first is the cycle still open
+func (m *Model) GetStatements(account string, count int, now time.Time) ([]Statement, error) {
+	acc, err := m.GetAccount(account)
+	if err != nil {
+		return nil, err
+	}
+	if acc.Type != CreditCard {
+		return nil, fmt.Errorf("%s is a %s account, not a credit card", account, acc.Type)
+	}
+	if acc.StatementDay == 0 {
+		return nil, fmt.Errorf("%s has no statement closing day yet", account)
+	}
+
+	// the open cycle closes on the next closing day, or today
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	closing := lastClosing(acc, now)
+	if closing.Before(today) {
+		closing = closing.AddDate(0, 1, 0)
+	}
+
+	statements := make([]Statement, 0, count)
+	for i := 0; i < count; i++ {
+		s, err := m.statementClosing(acc, closing)
+		if err != nil {
+			return nil, err
+		}
+		s.Open = !closing.Before(today)
+		statements = append(statements, s)
+		closing = closing.AddDate(0, -1, 0)
+	}
+	return statements, nil
+}
+
+// The statement of acc that closed on closing
+func (m *Model) statementClosing(acc Account, closing time.Time) (Statement, error) {
+	s := Statement{
+		AccountId: acc.Id,
+		Alias:     acc.Alias,
+		Opening:   closing.AddDate(0, -1, 1),
+		Closing:   closing,
+		Due:       dueDate(acc, closing),
+	}
+	// transactions on the closing day are in this cycle
+	end := closing.AddDate(0, 0, 1)
+
+	var err error
+	s.PreviousBalance, err = m.balanceBefore(acc, s.Opening)
+	if err != nil {
+		return Statement{}, err
+	}
+
+	err = m.db.NewSelect().
+		Model(&s.Transactions).
+		Where("account_id = ?", acc.Id).
+		Where("status != ?", Pending).
+		Where("date >= ?", dbTime(s.Opening)).
+		Where("date < ?", dbTime(end)).
+		Order("date DESC", "id").
+		Scan(context.TODO())
+	if err != nil {
+		return Statement{}, err
+	}
+	for _, tr := range s.Transactions {
+		if tr.Amount >= 0 {
+			s.Charges += tr.Amount
+		} else {
+			s.Credits -= tr.Amount
+		}
+	}
+	s.Balance = s.PreviousBalance + s.Charges - s.Credits
+	s.MinPayment = minimumPayment(s.Balance)
+
+	err = m.db.NewRaw(
+		"SELECT -coalesce(sum(amount), 0.0) FROM transactions WHERE account_id = ? AND status != ? AND amount < 0 AND date >= ? AND date < ?",
+		acc.Id, Pending, dbTime(end), dbTime(s.Due.AddDate(0, 0, 1)),
+	).Scan(context.TODO(), &s.Paid)
+	if err != nil {
+		return Statement{}, err
+	}
+	return s, nil
+}
+
+// The last closed statement of every open credit card with a closing
+// day, whose minimum payment is due within a few days or overdue and
+// hasn't been seen yet
+func (m *Model) GetUnpaidStatements(now time.Time) ([]Statement, error) {
+	unpaid := make([]Statement, 0)
+	for _, acc := range m.GetAccounts() {
+		if acc.Closed || acc.Type != CreditCard || acc.StatementDay == 0 {
+			continue
+		}
+		statements, err := m.GetStatements(acc.Id, 2, now)
+		if err != nil {
+			return nil, err
+		}
+		last := statements[1]
+		if last.NeedsPayment(now) {
+			unpaid = append(unpaid, last)
+		}
+	}
+	return unpaid, nil
+}
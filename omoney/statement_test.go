@@ -0,0 +1,118 @@
+package omoney
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func addCard(t *testing.T, m *Model) Account {
+	card := *NewAccount(WithAlias("visa"), WithAccountType(CreditCard), WithAnchor(0, day(2024, 1, 1)))
+	err := m.AddAccount(card)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.SetStatementDays("visa", 20, 15)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return card
+}
+
+func TestGetStatements(t *testing.T) {
+	m := &Model{db: CreateEmptyDB()}
+	card := addCard(t, m)
+	trs := []*Transaction{
+		NewTransaction(card.Id, "Groceries", 100, WithDate(day(2024, 1, 10))),
+		// the closing day is part of the cycle
+		NewTransaction(card.Id, "Gas", 50, WithDate(day(2024, 1, 20))),
+		NewTransaction(card.Id, "Books", 2000, WithDate(day(2024, 1, 21))),
+		NewTransaction(card.Id, "Refund", -30, WithDate(day(2024, 2, 1))),
+		NewTransaction(card.Id, "Payment", -150, WithDate(day(2024, 2, 10))),
+	}
+	for _, tr := range trs {
+		m.AddTransaction(tr)
+	}
+
+	statements, err := m.GetStatements("visa", 3, day(2024, 2, 25))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statements) != 3 || !statements[0].Open || statements[1].Open {
+		t.Fatalf("GetStatements failed\nhave: %+v", statements)
+	}
+
+	jan := statements[2]
+	if !jan.Closing.Equal(day(2024, 1, 20)) || !jan.Due.Equal(day(2024, 2, 15)) {
+		t.Fatalf("January cycle failed\nhave: closing %v due %v\nneed: closing %v due %v",
+			jan.Closing, jan.Due, day(2024, 1, 20), day(2024, 2, 15))
+	}
+	// refunds before the due date count towards paying it
+	if jan.Balance != 150 || jan.MinPayment != 25 || jan.Paid != 180 || len(jan.Transactions) != 2 {
+		t.Fatalf("January statement failed\nhave: %+v", jan)
+	}
+	if jan.Status(day(2024, 2, 25)) != StatementPaid {
+		t.Fatalf("January status failed\nhave: %s\nneed: %s", jan.Status(day(2024, 2, 25)), StatementPaid)
+	}
+
+	feb := statements[1]
+	// 150 carried over, 2000 charged, 180 paid or credited
+	if feb.PreviousBalance != 150 || feb.Charges != 2000 || feb.Credits != 180 || feb.Balance != 1970 {
+		t.Fatalf("February statement failed\nhave: %+v", feb)
+	}
+	if math.Abs(feb.MinPayment-39.4) > 0.005 || feb.Paid != 0 {
+		t.Fatalf("February minimum failed\nhave: %+v", feb)
+	}
+}
+
+func TestGetUnpaidStatements(t *testing.T) {
+	m := &Model{db: CreateEmptyDB()}
+	card := addCard(t, m)
+	m.AddTransaction(NewTransaction(card.Id, "Groceries", 100, WithDate(day(2024, 1, 10))))
+
+	// not close enough to the due date to warn yet
+	unpaid, err := m.GetUnpaidStatements(day(2024, 2, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(unpaid) != 0 {
+		t.Fatalf("Early warning failed\nhave: %v\nneed: nothing", unpaid)
+	}
+
+	unpaid, err = m.GetUnpaidStatements(day(2024, 2, 12))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(unpaid) != 1 || unpaid[0].Status(day(2024, 2, 12)) != StatementDue {
+		t.Fatalf("Due warning failed\nhave: %+v", unpaid)
+	}
+	unpaid, err = m.GetUnpaidStatements(day(2024, 2, 18))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(unpaid) != 1 || unpaid[0].Status(day(2024, 2, 18)) != StatementLate {
+		t.Fatalf("Late warning failed\nhave: %+v", unpaid)
+	}
+
+	// the minimum is enough to stop warning
+	m.AddTransaction(NewTransaction(card.Id, "Payment", -25, WithDate(day(2024, 2, 14))))
+	unpaid, err = m.GetUnpaidStatements(day(2024, 2, 18))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(unpaid) != 0 {
+		t.Fatalf("Paid warning failed\nhave: %+v\nneed: nothing", unpaid)
+	}
+
+	if err := m.SetStatementDays("visa", 31, 15); err == nil {
+		t.Fatal("A closing day past the 28th should fail")
+	}
+}
+
+// Dates are stored in UTC, so cycle edges must be compared in UTC too
+func TestGetStatementsEastOfUTC(t *testing.T) {
+	local := time.Local
+	time.Local = time.FixedZone("AEDT", 11*60*60)
+	defer func() { time.Local = local }()
+	TestGetStatements(t)
+}
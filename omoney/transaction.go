@@ -8,7 +8,6 @@ import (
 	"time"
 
 	"github.com/google/uuid"
-	"github.com/uptrace/bun"
 )
 
 // A representation of a single transaction that took place between two
@@ -46,12 +45,67 @@ type Transaction struct {
 	// specifics about this individual transaction.
 	// Optional field which defaults to empty string.
 	Description string
+	// The personal_finance_category reported by Plaid, kept so
+	// that the category can be filled in once a mapping for it
+	// exists. Empty for transactions that did not come from Plaid
+	PlaidCategory string
+	// How far along the transaction is, from a pending authorization
+	// to reconciled against a statement. Defaults to posted
+	Status TransactionStatus
+	// For a posted transaction, the id of the pending transaction it
+	// replaces, if the institution reported one. Optional field
+	PendingId string
+	// Set for expenses, such as work travel, that will be paid back.
+	// Left out of category spending and budgets
+	Reimbursable bool
+	// The expense report a reimbursable transaction was put in, or 0
+	ReportId int64
+}
+
+// Where a transaction is in its life, from first seen to checked
+type TransactionStatus string
+
+const (
+	// Authorized, but not yet posted. Left out of the current balance,
+	// and replaced by its posted transaction once that arrives
+	Pending TransactionStatus = "pending"
+	// Posted by the institution
+	Posted TransactionStatus = "posted"
+	// Checked against the account by the user
+	Cleared TransactionStatus = "cleared"
+	// Matched to a statement, and not expected to change again
+	Reconciled TransactionStatus = "reconciled"
+)
+
+func ParseTransactionStatus(input string) (TransactionStatus, error) {
+	switch strings.ToLower(input) {
+	case "pending", "p":
+		return Pending, nil
+	case "posted":
+		return Posted, nil
+	case "cleared", "c":
+		return Cleared, nil
+	case "reconciled", "r":
+		return Reconciled, nil
+	default:
+		return "", fmt.Errorf("unknown status %s, expected one of pending, posted, cleared, reconciled", input)
+	}
 }
 
 const (
 	dateFormatStr = "2006-01-02 15:04:05-07:00"
+	// How many days apart a pending transaction and the posted one
+	// replacing it may be, when the institution doesn't link them
+	pendingMatchDays = 7
 )
 
+// Format t the way dates are stored, so that it can be compared against
+// the date column as text. Dates are stored in UTC, so t is converted
+// first, or a bound in any other zone would be off by its offset
+func dbTime(t time.Time) string {
+	return t.UTC().Format(dateFormatStr)
+}
+
 type TransactionOption func(*Transaction)
 
 func NewTransaction(accountId string, payee string, amount float64,
@@ -62,6 +116,7 @@ func NewTransaction(accountId string, payee string, amount float64,
 		Payee:     payee,
 		Amount:    amount,
 		Date:      time.Now().Truncate(time.Second),
+		Status:    Posted,
 	}
 
 	for _, op := range options {
@@ -91,6 +146,28 @@ func WithInstDescription(instDescription string) TransactionOption {
 		t.InstDescription = instDescription
 	}
 }
+func WithPlaidCategory(plaidCategory string) TransactionOption {
+	return func(t *Transaction) {
+		t.PlaidCategory = plaidCategory
+	}
+}
+func WithStatus(status TransactionStatus) TransactionOption {
+	return func(t *Transaction) {
+		t.Status = status
+	}
+}
+
+func WithReimbursable(reimbursable bool) TransactionOption {
+	return func(t *Transaction) {
+		t.Reimbursable = reimbursable
+	}
+}
+
+func WithPendingId(pendingId string) TransactionOption {
+	return func(t *Transaction) {
+		t.PendingId = pendingId
+	}
+}
 
 // Returns whether or not all fields, excepting uuid, match
 func (t *Transaction) LooseEquals(other *Transaction) bool {
@@ -115,11 +192,97 @@ func (t *Transaction) String() string {
 		t.Description,
 	)
 }
+
+// Add tr to the model. Adding a transaction that isn't pending removes
+// the pending transaction named by its PendingId, if there is one, as
+// part of the same change, and takes over its shares and whether it is
+// reimbursable. A deposit paying back an expense report exactly is
+// matched to it. Any alert rules it crosses raise alerts
 func (m *Model) AddTransaction(tr *Transaction) error {
-	_, err := m.db.NewInsert().
-		Model(tr).
-		Exec(context.TODO())
-	return err
+	return m.addTransaction(tr, false)
+}
+
+// Add tr, which was reported by Plaid, the same as AddTransaction. Plaid
+// doesn't always link a posted transaction to the pending one it
+// replaces, so without a PendingId the pending transaction is guessed
+func (m *Model) AddSyncedTransaction(tr *Transaction) error {
+	return m.addTransaction(tr, true)
+}
+
+func (m *Model) addTransaction(tr *Transaction, guessPending bool) error {
+	return m.RunInBatch(func(tx *Model) error {
+		if tr.Status != Pending {
+			pending, err := tx.findPending(tr, guessPending)
+			if err != nil {
+				return err
+			}
+			if pending != nil {
+				err = tx.removeTransaction(pending.Id)
+				if err != nil {
+					return err
+				}
+				if pending.Reimbursable && !tr.Reimbursable {
+					tr.Reimbursable = true
+					tr.ReportId = pending.ReportId
+				}
+				err = tx.moveShares(pending.Id, tr.Id)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		_, err := tx.db.NewInsert().
+			Model(tr).
+			Exec(context.TODO())
+		if err != nil {
+			return err
+		}
+		err = tx.record(OpAddTransaction, tr.Id, nil, tr)
+		if err != nil {
+			return err
+		}
+		err = tx.matchReimbursement(tr)
+		if err != nil {
+			return err
+		}
+		return tx.checkAlerts(tr)
+	})
+}
+
+// The pending transaction that tr is the posted version of, or nil if
+// there isn't one. This is the one named by tr.PendingId if it is set.
+// Otherwise, if guess is set, it is the oldest pending transaction in
+// the same account to the same payee for the same amount within a few
+// days of tr
+func (m *Model) findPending(tr *Transaction, guess bool) (*Transaction, error) {
+	if tr.PendingId == "" && !guess {
+		return nil, nil
+	}
+
+	var pending []Transaction
+	query := m.db.NewSelect().
+		Model(&pending).
+		Where("account_id = ?", tr.AccountId).
+		Where("status = ?", Pending)
+	if tr.PendingId != "" {
+		query = query.Where("id = ?", tr.PendingId)
+	} else {
+		query = query.
+			Where("payee = ?", tr.Payee).
+			Where("amount = ?", tr.Amount).
+			Where("date >= ?", dbTime(tr.Date.AddDate(0, 0, -pendingMatchDays))).
+			Where("date <= ?", dbTime(tr.Date.AddDate(0, 0, pendingMatchDays))).
+			Order("date", "id")
+	}
+	err := query.Limit(1).Scan(context.TODO())
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	if len(pending) == 0 {
+		return nil, nil
+	}
+	return &pending[0], nil
 }
 
 func (m *Model) GetTransactionById(id string) (Transaction, error) {
@@ -134,14 +297,29 @@ func (m *Model) GetTransactionById(id string) (Transaction, error) {
 }
 
 type GetTransactionsOptions struct {
-	Count     int
+	Count int
+	// Number of matching transactions to skip over, counting
+	// from the newest, for paging through results
+	Offset    int
 	StartDate *time.Time
 	EndDate   *time.Time
+	// Only include transactions matching this query, if set
+	Query *Query
 }
 
 func (m *Model) GetTransactionsByAccount(accId string, ops ...GetTransactionsOptions) ([]Transaction, error) {
-	var trs []Transaction
+	var op GetTransactionsOptions
+	if len(ops) == 1 {
+		op = ops[0]
+	} else {
+		op = GetTransactionsOptions{Count: 10}
+	}
+
+	return m.getTransactions(accId, op)
+}
 
+// Same as GetTransactionsByAccount, but across every account
+func (m *Model) GetTransactions(ops ...GetTransactionsOptions) ([]Transaction, error) {
 	var op GetTransactionsOptions
 	if len(ops) == 1 {
 		op = ops[0]
@@ -149,28 +327,69 @@ func (m *Model) GetTransactionsByAccount(accId string, ops ...GetTransactionsOpt
 		op = GetTransactionsOptions{Count: 10}
 	}
 
+	return m.getTransactions("", op)
+}
+
+// Count the transactions in the account with id accId, or in every account
+// if accId is empty, that match the dates and query in op. Count and
+// Offset are ignored
+func (m *Model) CountTransactions(accId string, op GetTransactionsOptions) (int, error) {
+	where, args := transactionsWhere(accId, op)
+
+	count := 0
+	err := m.db.NewRaw("SELECT count(*) FROM transactions"+where, args...).
+		Scan(context.TODO(), &count)
+	return count, err
+}
+
+func (m *Model) getTransactions(accId string, op GetTransactionsOptions) ([]Transaction, error) {
+	var trs []Transaction
+
 	var query strings.Builder
+	where, args := transactionsWhere(accId, op)
+
+	query.WriteString("SELECT * FROM transactions")
+	query.WriteString(where)
+
+	query.WriteString(" ORDER BY date DESC LIMIT ? OFFSET ?")
+	args = append(args, op.Count, op.Offset)
+
+	err := m.db.NewRaw(query.String(), args...).Scan(context.TODO(), &trs)
+
+	return trs, err
+}
+
+// Build the WHERE clause, and its arguments, selecting transactions
+// from accId (or every account if empty) between the dates in op
+// and matching its query
+func transactionsWhere(accId string, op GetTransactionsOptions) (string, []interface{}) {
+	var conds []string
 	var args []interface{}
 
-	query.WriteString("SELECT * FROM transactions WHERE account_id = ?")
-	args = append(args, bun.Ident(accId))
+	if accId != "" {
+		conds = append(conds, "account_id = ?")
+		args = append(args, accId)
+	}
 
 	if op.StartDate != nil {
-		query.WriteString(" AND date > ?")
-		args = append(args, op.StartDate.Format(dateFormatStr))
+		conds = append(conds, "date > ?")
+		args = append(args, dbTime(*op.StartDate))
 	}
 
 	if op.EndDate != nil {
-		query.WriteString(" AND date < ?")
-		args = append(args, op.EndDate.Format(dateFormatStr))
+		conds = append(conds, "date < ?")
+		args = append(args, dbTime(*op.EndDate))
 	}
 
-	query.WriteString(" ORDER BY date DESC LIMIT ?")
-	args = append(args, op.Count)
-
-	err := m.db.NewRaw(query.String(), args...).Scan(context.TODO(), &trs)
+	if op.Query != nil {
+		conds = append(conds, op.Query.where)
+		args = append(args, op.Query.args...)
+	}
 
-	return trs, err
+	if len(conds) == 0 {
+		return "", args
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
 }
 
 type UpdateTransactionOptions struct {
@@ -202,18 +421,60 @@ func WithDescUpdate(desc string) UpdateTransactionOptions {
 	return UpdateTransactionOptions{"description = ?", desc}
 }
 
-func (m *Model) UpdateTransaction(id string, ops ...UpdateTransactionOptions) error {
-	query := m.db.NewUpdate().Model((*Transaction)(nil)).Where("id = ?", id)
+func WithPlaidCategoryUpdate(plaidCategory string) UpdateTransactionOptions {
+	return UpdateTransactionOptions{"plaid_category = ?", plaidCategory}
+}
 
-	for _, op := range ops {
-		query = query.Set(op.fieldName, op.newVal)
-	}
+func WithStatusUpdate(status TransactionStatus) UpdateTransactionOptions {
+	return UpdateTransactionOptions{"status = ?", status}
+}
 
-	err := query.Scan(context.TODO())
-	if err != nil && err != sql.ErrNoRows {
-		return err
-	}
-	return nil
+func WithReimbursableUpdate(reimbursable bool) UpdateTransactionOptions {
+	return UpdateTransactionOptions{"reimbursable = ?", reimbursable}
+}
+
+func WithReportUpdate(reportId int64) UpdateTransactionOptions {
+	return UpdateTransactionOptions{"report_id = ?", reportId}
+}
+
+func (m *Model) UpdateTransaction(id string, ops ...UpdateTransactionOptions) error {
+	return m.RunInTx(func(tx *Model) error {
+		before, err := tx.GetTransactionById(id)
+		if err != nil {
+			return err
+		}
+
+		query := tx.db.NewUpdate().Model((*Transaction)(nil)).Where("id = ?", id)
+
+		for _, op := range ops {
+			query = query.Set(op.fieldName, op.newVal)
+		}
+
+		err = query.Scan(context.TODO())
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+
+		after, err := tx.GetTransactionById(id)
+		if err != nil {
+			return err
+		}
+		return tx.record(OpUpdateTransaction, id, &before, &after)
+	})
+}
+
+// Apply the same updates to every transaction in ids, all or nothing,
+// as one change that a single undo reverts
+func (m *Model) UpdateTransactions(ids []string, ops ...UpdateTransactionOptions) error {
+	return m.RunInBatch(func(tx *Model) error {
+		for _, id := range ids {
+			err := tx.UpdateTransaction(id, ops...)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
 func (m *Model) RemoveTransaction(tr *Transaction) error {
@@ -221,10 +482,25 @@ func (m *Model) RemoveTransaction(tr *Transaction) error {
 }
 
 func (m *Model) RemoveTransactionById(id string) error {
-	fmt.Printf("Removing tr %s\n", id)
-	_, err := m.db.NewDelete().
+	return m.RunInTx(func(tx *Model) error {
+		return tx.removeTransaction(id)
+	})
+}
+
+// Delete the transaction and record it in the journal. Must be
+// called on a model handed out by RunInTx
+func (m *Model) removeTransaction(id string) error {
+	before, err := m.GetTransactionById(id)
+	if err != nil {
+		return err
+	}
+
+	_, err = m.db.NewDelete().
 		Model((*Transaction)(nil)).
 		Where("id = ?", id).
 		Exec(context.TODO())
-	return err
+	if err != nil {
+		return err
+	}
+	return m.record(OpRemoveTransaction, id, &before, nil)
 }
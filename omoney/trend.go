@@ -0,0 +1,150 @@
+package omoney
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// What went in and out over one month
+type MonthTotals struct {
+	// The first day of the month
+	Month time.Time
+	// Net spending in each category, with "" for uncategorized.
+	// Refunds count against the category they were in
+	Categories map[string]float64
+	// Money coming in, as a positive amount
+	Income float64
+	// Money going out
+	Expenses float64
+}
+
+// The balance of an account at the end of a day
+type BalancePoint struct {
+	Date    time.Time
+	Balance float64
+}
+
+func (t MonthTotals) Net() float64 {
+	return t.Income - t.Expenses
+}
+
+func startOfMonth(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// Totals of every month from the one start is in through the one end
+// is in, oldest first, from the account with id accId or every account
+// if empty. Spending is a positive amount and income a negative one.
+// Pending transactions, reimbursable expenses and the deposits paying
+// them back are left out, as is anything not matching query when it
+// isn't nil. Months without transactions are still included, with
+// totals of zero
+func (m *Model) GetMonthlyTotals(accId string, start time.Time, end time.Time, query *Query) ([]MonthTotals, error) {
+	first := startOfMonth(start)
+	last := startOfMonth(end)
+	if last.Before(first) {
+		return nil, fmt.Errorf("%s is before %s", end.Format("2006/01"), start.Format("2006/01"))
+	}
+
+	months := make([]MonthTotals, 0)
+	index := make(map[string]int)
+	for month := first; !month.After(last); month = month.AddDate(0, 1, 0) {
+		index[month.Format("2006-01")] = len(months)
+		months = append(months, MonthTotals{Month: month, Categories: make(map[string]float64)})
+	}
+
+	var trs []Transaction
+	sel := m.db.NewSelect().
+		Model(&trs).
+		Where("status != ?", Pending).
+		Where(notReimbursement).
+		Where("date >= ?", dbTime(first)).
+		Where("date < ?", dbTime(last.AddDate(0, 1, 0)))
+	if accId != "" {
+		sel = sel.Where("account_id = ?", accId)
+	}
+	if query != nil {
+		sel = sel.Where(query.where, query.args...)
+	}
+	err := sel.Scan(context.TODO())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, tr := range trs {
+		i, ok := index[tr.Date.In(first.Location()).Format("2006-01")]
+		if !ok {
+			continue
+		}
+		months[i].Categories[tr.Category] += tr.Amount
+		if tr.Amount >= 0 {
+			months[i].Expenses += tr.Amount
+		} else {
+			months[i].Income -= tr.Amount
+		}
+	}
+	return months, nil
+}
+
+// The balance of the account with alias or id account at the end of
+// every day from start through end. Investment accounts are valued at
+// market each day. Other accounts add up their posted transactions
+// from the anchor, the same as their current balance
+func (m *Model) GetBalanceHistory(account string, start time.Time, end time.Time) ([]BalancePoint, error) {
+	acc, err := m.GetAccount(account)
+	if err != nil {
+		return nil, err
+	}
+	if acc.Type == PersonalLoan && acc.Loan.IsSet() {
+		return nil, fmt.Errorf("%s is a loan, see its payments instead", account)
+	}
+	first := startOfDay(start)
+	last := startOfDay(end)
+	if last.Before(first) {
+		return nil, fmt.Errorf("%s is before %s", end.Format("2006/01/02"), start.Format("2006/01/02"))
+	}
+
+	points := make([]BalancePoint, 0)
+	if acc.Type == Investment {
+		for d := first; !d.After(last); d = d.AddDate(0, 0, 1) {
+			value, err := m.MarketValue(acc.Id, d.AddDate(0, 0, 1).Add(-time.Nanosecond))
+			if err != nil {
+				return nil, err
+			}
+			points = append(points, BalancePoint{d, value})
+		}
+		return points, nil
+	}
+
+	balance, err := m.balanceBefore(acc, first)
+	if err != nil {
+		return nil, err
+	}
+	var trs []Transaction
+	err = m.db.NewSelect().
+		Model(&trs).
+		Where("account_id = ?", acc.Id).
+		Where("status != ?", Pending).
+		Where("date >= ?", dbTime(first)).
+		Where("date < ?", dbTime(last.AddDate(0, 0, 1))).
+		Order("date").
+		Scan(context.TODO())
+	if err != nil {
+		return nil, err
+	}
+
+	i := 0
+	for d := first; !d.After(last); d = d.AddDate(0, 0, 1) {
+		next := d.AddDate(0, 0, 1)
+		for ; i < len(trs) && trs[i].Date.Before(next); i++ {
+			balance += trs[i].Amount
+		}
+		points = append(points, BalancePoint{d, balance})
+	}
+	return points, nil
+}
@@ -0,0 +1,93 @@
+package omoney
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetMonthlyTotals(t *testing.T) {
+	m := &Model{db: CreateEmptyDB()}
+	card := addCard(t, m)
+	for _, tr := range []*Transaction{
+		NewTransaction(card.Id, "Market", 120, WithDate(day(2024, 1, 5)), WithCategory("groceries")),
+		NewTransaction(card.Id, "Market", -20, WithDate(day(2024, 1, 9)), WithCategory("groceries")),
+		NewTransaction(card.Id, "Diner", 40, WithDate(day(2024, 3, 2)), WithCategory("dining")),
+		NewTransaction(card.Id, "Employer", -1000, WithDate(day(2024, 3, 15)), WithCategory("income")),
+		NewTransaction(card.Id, "Diner", 500, WithDate(day(2024, 3, 20)), WithCategory("dining"), WithStatus(Pending)),
+	} {
+		err := m.AddTransaction(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	months, err := m.GetMonthlyTotals("", day(2024, 1, 31), day(2024, 3, 1), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(months) != 3 || !months[1].Month.Equal(day(2024, 2, 1)) || len(months[1].Categories) != 0 {
+		t.Fatalf("GetMonthlyTotals failed\nhave: %+v\nneed: January through March, February empty", months)
+	}
+	// the refund counts against groceries, and as income
+	if months[0].Categories["groceries"] != 100 || months[0].Expenses != 120 || months[0].Income != 20 {
+		t.Fatalf("GetMonthlyTotals failed\nhave: %+v\nneed: $100 of groceries, $120 out, $20 in", months[0])
+	}
+	// the pending transaction is left out
+	if months[2].Categories["dining"] != 40 || months[2].Net() != 960 {
+		t.Fatalf("GetMonthlyTotals failed\nhave: %+v\nneed: $40 of dining, $960 net", months[2])
+	}
+
+	if _, err := m.GetMonthlyTotals("", day(2024, 3, 1), day(2024, 1, 1), nil); err == nil {
+		t.Fatal("GetMonthlyTotals should fail when end is before start")
+	}
+	query, err := ParseQuery(`payee != "Employer" and amount > 30`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	months, err = m.GetMonthlyTotals("", day(2024, 1, 1), day(2024, 3, 1), query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if months[0].Expenses != 120 || months[0].Income != 0 || months[2].Income != 0 || months[2].Expenses != 40 {
+		t.Fatalf("GetMonthlyTotals with query failed\nhave: %+v\nneed: only the $120 and $40 purchases", months)
+	}
+}
+
+func TestGetBalanceHistory(t *testing.T) {
+	m := &Model{db: CreateEmptyDB()}
+	card := addCard(t, m)
+	for _, tr := range []*Transaction{
+		NewTransaction(card.Id, "Market", 50, WithDate(day(2024, 1, 3))),
+		NewTransaction(card.Id, "Diner", 25, WithDate(day(2024, 1, 5))),
+		NewTransaction(card.Id, "Payment", -50, WithDate(day(2024, 1, 5))),
+		NewTransaction(card.Id, "Cinema", 30, WithDate(day(2024, 1, 8))),
+	} {
+		err := m.AddTransaction(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	points, err := m.GetBalanceHistory("visa", day(2024, 1, 4), day(2024, 1, 7))
+	if err != nil {
+		t.Fatal(err)
+	}
+	need := []float64{50, 25, 25, 25}
+	if len(points) != len(need) || !points[0].Date.Equal(day(2024, 1, 4)) {
+		t.Fatalf("GetBalanceHistory failed\nhave: %+v\nneed: %v from 2024/01/04", points, need)
+	}
+	for i := range need {
+		if points[i].Balance != need[i] {
+			t.Fatalf("GetBalanceHistory failed\nhave: %+v\nneed: %v", points, need)
+		}
+	}
+}
+
+// Dates are stored in UTC, so month and day bounds must be compared in UTC
+func TestTrendsEastOfUTC(t *testing.T) {
+	local := time.Local
+	time.Local = time.FixedZone("AEDT", 11*60*60)
+	defer func() { time.Local = local }()
+	TestGetMonthlyTotals(t)
+	TestGetBalanceHistory(t)
+}